@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"os"
@@ -17,6 +18,7 @@ import (
 	"github.com/erupshis/metrics/internal/grpc/interceptors/logging"
 	"github.com/erupshis/metrics/internal/hasher"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/mtls"
 	"github.com/erupshis/metrics/internal/rsa"
 	"github.com/erupshis/metrics/internal/ticker"
 	"google.golang.org/grpc"
@@ -71,8 +73,6 @@ func main() {
 	agent := agentimpl.Create(cfg, log, agentClient)
 	log.Info("agent has started.")
 
-	pollTicker := time.NewTicker(agent.GetPollInterval())
-	defer pollTicker.Stop()
 	repeatTicker := time.NewTicker(agent.GetReportInterval())
 	defer repeatTicker.Stop()
 
@@ -86,8 +86,7 @@ func main() {
 	defer workersPool.CloseJobsChan()
 	defer workersPool.CloseResultsChan()
 
-	go ticker.Run(pollTicker, ctx, func() { agent.UpdateStats() })
-	go ticker.Run(pollTicker, ctx, func() { agent.UpdateExtraStats() })
+	go agent.RunCollectors(ctx)
 	go ticker.Run(repeatTicker, ctx, func() { go workersPool.AddJob(func() error { return agent.PostStatsBatch(ctx) }) })
 
 	go func() {
@@ -117,11 +116,23 @@ func initHTTPClient(cfg *config.Config, log logger.BaseLogger) (client.BaseClien
 	// rsa encrypting
 	rsaEncoder, err := rsa.CreateEncoder(cfg.CertRSA)
 	if err != nil {
-		log.Info("[main] failed to create RSA encoder: %v", err)
+		return nil, fmt.Errorf("error create RSA encoder: %w", err)
+	}
+
+	// mutual TLS.
+	host := cfg.Host
+	var tlsConfig *tls.Config
+	if cfg.ClientCert != "" {
+		serverAddressWOPrefix := strings.TrimPrefix(cfg.Host, "http://")
+		tlsConfig, err = mtls.ClientConfig(cfg.ClientCert, cfg.ClientKey, cfg.CACertRSA, strings.Split(serverAddressWOPrefix, ":")[0])
+		if err != nil {
+			return nil, fmt.Errorf("error create mTLS config: %w", err)
+		}
+		host = "https://" + serverAddressWOPrefix
 	}
 
 	IPparts := strings.Split(cfg.RealIP, "/")
-	return client.CreateDefault(log, hash, rsaEncoder, IPparts[0], cfg.Host), nil
+	return client.CreateDefault(log, hash, rsaEncoder, IPparts[0], cfg.AgentID, host, tlsConfig), nil
 }
 
 func initGRPCClient(cfg *config.Config, log logger.BaseLogger) (client.BaseClient, error) {
@@ -129,9 +140,19 @@ func initGRPCClient(cfg *config.Config, log logger.BaseLogger) (client.BaseClien
 
 	// TLS.
 	serverAddressWOPrefix := strings.TrimPrefix(cfg.Host, "http://")
-	creds, err := credentials.NewClientTLSFromFile(cfg.CertRSA, strings.Split(serverAddressWOPrefix, ":")[0])
-	if err != nil {
-		return nil, fmt.Errorf("error create TLS cert: %w", err)
+	var creds credentials.TransportCredentials
+	if cfg.ClientCert != "" {
+		tlsConfig, err := mtls.ClientConfig(cfg.ClientCert, cfg.ClientKey, cfg.CACertRSA, strings.Split(serverAddressWOPrefix, ":")[0])
+		if err != nil {
+			return nil, fmt.Errorf("error create mTLS config: %w", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	} else {
+		var err error
+		creds, err = credentials.NewClientTLSFromFile(cfg.CertRSA, strings.Split(serverAddressWOPrefix, ":")[0])
+		if err != nil {
+			return nil, fmt.Errorf("error create TLS cert: %w", err)
+		}
 	}
 
 	var opts []grpc.DialOption
@@ -144,5 +165,5 @@ func initGRPCClient(cfg *config.Config, log logger.BaseLogger) (client.BaseClien
 	))
 	opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
 
-	return client.CreateGRPC(serverAddressWOPrefix, IPparts[0], opts...)
+	return client.CreateGRPC(serverAddressWOPrefix, IPparts[0], cfg.AgentID, opts...)
 }
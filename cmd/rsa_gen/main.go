@@ -1,115 +1,250 @@
+// Command rsa_gen manages certificate authority of metrics servers and agents.
+//
+// Usage:
+//
+//	rsa_gen init   [-dir rsa] [-org erupshis.metrics] [-country RU] [-valid 87600h]
+//	rsa_gen server [-dir rsa] [-cn name] [-dns host,...] [-ip 127.0.0.1,::1] [-cert rsa/cert.pem] [-key rsa/key.pem] [-bits 8192] [-valid 87600h]
+//	rsa_gen client -cn agent [-dir rsa] [-dns host,...] [-ip addr,...] [-cert rsa/clients/agent_cert.pem] [-key rsa/clients/agent_key.pem] [-valid 8760h]
+//	rsa_gen list   [-dir rsa]
+//	rsa_gen revoke -serial hex [-dir rsa]
+//
+// Server certificate and key are used by server for TLS and decryption of agents messages, agents get server certificate
+// for encryption and their own client certificates for mutual TLS. Revoked certificates are listed in rsa/ca_crl.pem
+// which is loaded by server with 'client-crl' setting.
 package main
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"flag"
+	"fmt"
 	"log"
-	"math/big"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
 	"time"
+
+	"github.com/erupshis/metrics/internal/certs"
+)
+
+const (
+	defaultDir = "rsa"
+	year       = 365 * 24 * time.Hour
 )
 
-type expiresAfter struct {
-	years  int
-	months int
-	days   int
+// command is a subcommand of rsa_gen.
+type command struct {
+	usage string
+	run   func(args []string) error
 }
 
-var (
-	validTo   = expiresAfter{days: 0, months: 0, years: 10}
-	ipAddress = net.IPv4(127, 0, 0, 1)
+var commands = map[string]command{
+	"init":   {usage: "create certificate authority", run: runInit},
+	"server": {usage: "issue server certificate", run: runServer},
+	"client": {usage: "issue agent's client certificate", run: runClient},
+	"list":   {usage: "list issued certificates", run: runList},
+	"revoke": {usage: "revoke certificate and update CRL", run: runRevoke},
+}
 
-	pathToPrivateKey = "rsa/key.pem"
-	pathToCert       = "rsa/cert.pem"
-	pathToCACert     = "rsa/ca_cert.pem"
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal(usage())
+	}
 
-	caOrganization = []string{"erupshis.metrics"}
-	caCountry      = []string{"RU"}
-)
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		log.Fatalf("unknown command '%s'\n%s", os.Args[1], usage())
+	}
 
-var (
-	// Для подписи запросов на сертификат (CSR)
-	caPrivateKey, _ = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-)
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
 
-func main() {
-	caCertTemplate := &x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization: caOrganization,
-			Country:      caCountry,
-		},
-		IPAddresses:           []net.IP{ipAddress, net.IPv6loopback},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(validTo.years, validTo.months, validTo.days),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-	}
-
-	// Создание сертификата для CA
-	caCertBytes, err := x509.CreateCertificate(rand.Reader, caCertTemplate, caCertTemplate, &caPrivateKey.PublicKey, caPrivateKey)
+// usage returns list of available commands.
+func usage() string {
+	var b strings.Builder
+	b.WriteString("usage: rsa_gen <command> [flags], commands:\n")
+	for _, name := range []string{"init", "server", "client", "list", "revoke"} {
+		fmt.Fprintf(&b, "  %-7s %s\n", name, commands[name].usage)
+	}
+	return b.String()
+}
+
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	dir := fs.String("dir", defaultDir, "authority directory")
+	org := fs.String("org", "erupshis.metrics", "organization of authority")
+	country := fs.String("country", "RU", "country of authority")
+	validity := fs.Duration("valid", 10*year, "validity period of authority")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	subject := pkix.Name{Organization: []string{*org}, Country: []string{*country}}
+	if _, err := certs.Init(*dir, subject, *validity); err != nil {
+		return err
+	}
+
+	fmt.Printf("authority is created, trusted cert: %s, CRL: %s\n", filepath.Join(*dir, certs.CACertFile), filepath.Join(*dir, certs.CRLFile))
+	return nil
+}
+
+func runServer(args []string) error {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	dir := fs.String("dir", defaultDir, "authority directory")
+	cn := fs.String("cn", "", "common name of server")
+	dns := fs.String("dns", "", "comma separated DNS names of server")
+	ips := fs.String("ip", "127.0.0.1,::1", "comma separated IP addresses of server")
+	certPath := fs.String("cert", filepath.Join(defaultDir, "cert.pem"), "output certificate path")
+	keyPath := fs.String("key", filepath.Join(defaultDir, "key.pem"), "output private key path")
+	bits := fs.Int("bits", 8192, "size of RSA key")
+	validity := fs.Duration("valid", 10*year, "validity period of certificate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	req, err := createRequest(*cn, *dns, *ips, *validity)
+	if err != nil {
+		return err
+	}
+	req.Bits = *bits
+
+	authority, err := certs.Open(*dir)
+	if err != nil {
+		return err
+	}
+
+	record, err := authority.IssueServer(req, *certPath, *keyPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Сохранение сертификата CA в файл
-	caCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCertBytes})
-	if caCertPEM == nil {
-		log.Fatal("Failed to encode CA certificate to PEM")
+	fmt.Printf("server certificate %s is issued: %s, %s\n", record.Serial, *certPath, *keyPath)
+	return nil
+}
+
+func runClient(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	dir := fs.String("dir", defaultDir, "authority directory")
+	cn := fs.String("cn", "", "common name of agent, used as its identity by server")
+	dns := fs.String("dns", "", "comma separated DNS names of agent")
+	ips := fs.String("ip", "", "comma separated IP addresses of agent")
+	certPath := fs.String("cert", "", "output certificate path (default <dir>/clients/<cn>_cert.pem)")
+	keyPath := fs.String("key", "", "output private key path (default <dir>/clients/<cn>_key.pem)")
+	validity := fs.Duration("valid", year, "validity period of certificate")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *cn == "" {
+		return fmt.Errorf("common name of agent is required")
 	}
-	if err := os.WriteFile(pathToCACert, caCertPEM, 0644); err != nil {
-		log.Fatal(err)
+	if *certPath == "" {
+		*certPath = filepath.Join(*dir, "clients", *cn+"_cert.pem")
+	}
+	if *keyPath == "" {
+		*keyPath = filepath.Join(*dir, "clients", *cn+"_key.pem")
 	}
 
-	// Создание шаблона сертификата для сервера
-	certTemplate := &x509.Certificate{
-		SerialNumber: big.NewInt(2),
-		Subject: pkix.Name{
-			Organization: caOrganization,
-			Country:      caCountry,
-		},
-		IPAddresses: []net.IP{ipAddress, net.IPv6loopback},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().AddDate(validTo.years, validTo.months, validTo.days),
-		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	req, err := createRequest(*cn, *dns, *ips, *validity)
+	if err != nil {
+		return err
 	}
 
-	// Генерация закрытого ключа для сервера
-	privateKey, err := rsa.GenerateKey(rand.Reader, 8192)
+	authority, err := certs.Open(*dir)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Генерация сертификата для сервера и подпись его CA
-	certBytes, err := x509.CreateCertificate(rand.Reader, certTemplate, caCertTemplate, &privateKey.PublicKey, caPrivateKey)
+	record, err := authority.IssueClient(req, *certPath, *keyPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Сохранение сертификата сервера в файл
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
-	if certPEM == nil {
-		log.Fatal("Failed to encode certificate to PEM")
+	fmt.Printf("client certificate %s is issued: %s, %s\n", record.Serial, *certPath, *keyPath)
+	return nil
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	dir := fs.String("dir", defaultDir, "authority directory")
+	if err := fs.Parse(args); err != nil {
+		return err
 	}
-	if err := os.WriteFile(pathToCert, certPEM, 0644); err != nil {
-		log.Fatal(err)
+
+	authority, err := certs.Open(*dir)
+	if err != nil {
+		return err
 	}
 
-	// Сохранение закрытого ключа сервера в файл
-	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
-	if privateKeyPEM == nil {
-		log.Fatal("Failed to encode key to PEM")
+	records, err := authority.List()
+	if err != nil {
+		return err
 	}
-	if err := os.WriteFile(pathToPrivateKey, privateKeyPEM, 0600); err != nil {
-		log.Fatal(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tKIND\tSUBJECT\tSANS\tNOT AFTER\tSTATUS")
+	for _, record := range records {
+		status := "valid"
+		switch {
+		case record.RevokedAt != nil:
+			status = "revoked " + record.RevokedAt.Format(time.RFC3339)
+		case time.Now().After(record.NotAfter):
+			status = "expired"
+		}
+
+		sans := strings.Join(append(append([]string{}, record.DNSNames...), record.IPs...), ",")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", record.Serial, record.Kind, record.Subject, sans, record.NotAfter.Format(time.RFC3339), status)
 	}
+	return w.Flush()
+}
 
+func runRevoke(args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ContinueOnError)
+	dir := fs.String("dir", defaultDir, "authority directory")
+	serial := fs.String("serial", "", "hex serial of certificate from list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *serial == "" {
+		return fmt.Errorf("serial of certificate is required")
+	}
+
+	authority, err := certs.Open(*dir)
+	if err != nil {
+		return err
+	}
+
+	if err = authority.Revoke(*serial); err != nil {
+		return err
+	}
+
+	fmt.Printf("certificate %s is revoked, CRL: %s\n", *serial, filepath.Join(*dir, certs.CRLFile))
+	return nil
+}
+
+// createRequest parses comma separated SANs of certificate request.
+func createRequest(cn string, dns string, ips string, validity time.Duration) (certs.Request, error) {
+	req := certs.Request{CommonName: cn, Validity: validity}
+	for _, name := range strings.Split(dns, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			req.DNSNames = append(req.DNSNames, name)
+		}
+	}
+
+	for _, value := range strings.Split(ips, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return certs.Request{}, fmt.Errorf("incorrect IP address '%s'", value)
+		}
+		req.IPs = append(req.IPs, ip)
+	}
+	return req, nil
 }
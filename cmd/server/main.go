@@ -13,13 +13,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/erupshis/metrics/internal/grpc/interceptors/identity"
 	ipvalidatorGRPC "github.com/erupshis/metrics/internal/grpc/interceptors/ipvalidator"
 	"github.com/erupshis/metrics/internal/grpc/interceptors/logging"
 	"github.com/erupshis/metrics/internal/hasher"
 	ipvalidatorHTTP "github.com/erupshis/metrics/internal/ipvalidator"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/mtls"
 	"github.com/erupshis/metrics/internal/rsa"
 	"github.com/erupshis/metrics/internal/server"
+	"github.com/erupshis/metrics/internal/server/agents"
+	"github.com/erupshis/metrics/internal/server/alerting"
 	"github.com/erupshis/metrics/internal/server/config"
 	"github.com/erupshis/metrics/internal/server/grpcserver"
 	"github.com/erupshis/metrics/internal/server/grpcserver/controller"
@@ -40,9 +44,16 @@ var (
 	buildCommit  = "N/A"
 )
 
+// grpcWriteMethods gRPC methods which modify metrics, the rest ones are read methods.
+var grpcWriteMethods = []string{
+	"/proto_metrics.Metrics/Updates",
+	"/proto_metrics.Metrics/Update",
+	"/proto_metrics.Metrics/Delete",
+}
+
 type serverInitializer struct {
 	port     int64
-	initFunc func(cfg *config.Config, log logger.BaseLogger, storage *memstorage.MemStorage) (server.BaseServer, error)
+	initFunc func(cfg *config.Config, log logger.BaseLogger, storage *memstorage.MemStorage, agentsRegistry *agents.Registry) (server.BaseServer, error)
 }
 
 func main() {
@@ -70,10 +81,17 @@ func main() {
 		}()
 	}
 	storage := memstorage.Create(ctx, &cfg, storageManager, log)
+	agentsRegistry := agents.Create()
 
 	// Schedule data saving in file with storeInterval
 	scheduleDataStoringInFile(ctx, &cfg, storage, log)
 
+	// Schedule removal of metrics not updated within TTL
+	scheduleMetricsExpiry(ctx, &cfg, storage, log)
+
+	// Schedule alerting rules evaluation
+	scheduleAlerting(ctx, &cfg, storage, log)
+
 	// servers initializer
 	var serversInitializer = map[string]serverInitializer{
 		"http": serverInitializer{
@@ -93,7 +111,7 @@ func main() {
 			continue
 		}
 
-		srv, err := initializer.initFunc(&cfg, log, storage)
+		srv, err := initializer.initFunc(&cfg, log, storage, agentsRegistry)
 		if err != nil {
 			log.Info("failed to init %s server: %v", serverType, err)
 		} else {
@@ -115,6 +133,12 @@ func main() {
 }
 
 func scheduleDataStoringInFile(ctx context.Context, cfg *config.Config, storage *memstorage.MemStorage, log logger.BaseLogger) *time.Ticker {
+	if cfg.StoreInterval == 0 {
+		// metrics and their history are persisted synchronously by storage on each update.
+		log.Info("[main::scheduleDataStoringInFile] synchronous saving mode, periodic saving is disabled")
+		return nil
+	}
+
 	interval := time.Second
 	if cfg.StoreInterval > 1 {
 		interval = cfg.StoreInterval
@@ -132,16 +156,92 @@ func scheduleDataStoringInFile(ctx context.Context, cfg *config.Config, storage
 	return storeTicker
 }
 
+// maxExpiryCheckInterval limits the period of expired metrics check for long TTL.
+const maxExpiryCheckInterval = time.Minute
+
+func scheduleMetricsExpiry(ctx context.Context, cfg *config.Config, storage *memstorage.MemStorage, log logger.BaseLogger) *time.Ticker {
+	if cfg.MetricTTL <= 0 {
+		return nil
+	}
+
+	interval := cfg.MetricTTL / 2
+	if interval > maxExpiryCheckInterval {
+		interval = maxExpiryCheckInterval
+	} else if interval < time.Second {
+		interval = time.Second
+	}
+
+	log.Info("[main::scheduleMetricsExpiry] metrics TTL: %s, check interval: %s", cfg.MetricTTL.String(), interval.String())
+	expiryTicker := time.NewTicker(interval)
+	go ticker.Run(expiryTicker, ctx, func() {
+		expired, err := storage.ExpireMetrics(time.Now())
+		if expired > 0 {
+			log.Info("[main::scheduleMetricsExpiry] expired metrics removed: %d", expired)
+		}
+		if err != nil {
+			log.Info("[main::scheduleMetricsExpiry] failed to remove expired metrics from storage, error: %v", err)
+		}
+	})
+
+	return expiryTicker
+}
+
+func scheduleAlerting(ctx context.Context, cfg *config.Config, storage *memstorage.MemStorage, log logger.BaseLogger) *time.Ticker {
+	if cfg.AlertRulesPath == "" {
+		return nil
+	}
+
+	rules, err := alerting.LoadRules(cfg.AlertRulesPath)
+	if err != nil {
+		log.Info("[main::scheduleAlerting] failed to load alerting rules: %v", err)
+		return nil
+	}
+
+	interval := time.Second
+	if cfg.AlertInterval > interval {
+		interval = cfg.AlertInterval
+	}
+
+	log.Info("[main::scheduleAlerting] alerting rules loaded: %d, evaluation interval: %s", len(rules.Rules), interval.String())
+	engine := alerting.Create(rules, storage, alerting.CreateWebhookSender(nil, log), log)
+	alertTicker := time.NewTicker(interval)
+	go ticker.Run(alertTicker, ctx, func() {
+		engine.Notify(ctx, engine.Evaluate(time.Now()))
+	})
+
+	return alertTicker
+}
+
 func createStorageManager(ctx context.Context, cfg *config.Config, log logger.BaseLogger) storagemngr.StorageManager {
-	if cfg.DataBaseDSN != "" {
+	storageType := cfg.StorageType
+	if storageType == "" {
+		if cfg.DataBaseDSN != "" {
+			storageType = config.StorageDataBase
+		} else if cfg.StoragePath != "" {
+			storageType = config.StorageFile
+		}
+	}
+
+	switch storageType {
+	case config.StorageDataBase:
 		manager, err := storagemngr.CreateDataBaseManager(ctx, cfg, log)
 		if err != nil {
 			log.Info("[main:createStorageManager] failed to create connection to database: %s with error: %v", cfg.DataBaseDSN, err)
 		}
 		return manager
-	} else if cfg.StoragePath != "" {
+	case config.StorageFile:
 		return storagemngr.CreateFileManager(cfg.StoragePath, log)
-	} else {
+	case config.StorageKV:
+		manager, err := storagemngr.CreateKVManager(cfg.StoragePath, log)
+		if err != nil {
+			log.Info("[main:createStorageManager] failed to open key-value storage: %s with error: %v", cfg.StoragePath, err)
+			return nil
+		}
+		return manager
+	case "":
+		return nil
+	default:
+		log.Info("[main:createStorageManager] unknown storage type: %s", storageType)
 		return nil
 	}
 }
@@ -179,7 +279,7 @@ func initShutDown(ctx context.Context, idleConnsClosed chan struct{}, servers []
 	}()
 }
 
-func initHTTPServer(cfg *config.Config, log logger.BaseLogger, storage *memstorage.MemStorage) (server.BaseServer, error) {
+func initHTTPServer(cfg *config.Config, log logger.BaseLogger, storage *memstorage.MemStorage, agentsRegistry *agents.Registry) (server.BaseServer, error) {
 	// hash sum evaluation
 	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
 
@@ -192,7 +292,13 @@ func initHTTPServer(cfg *config.Config, log logger.BaseLogger, storage *memstora
 	// trusted subnet validation.
 	validatorIP := createHTTPTrustedSubnetValidator(cfg, log)
 
-	baseController := base.Create(cfg, log, storage, hash, rsaDecoder, validatorIP)
+	// mutual TLS.
+	var authorizer *mtls.Authorizer
+	if cfg.ClientCA != "" {
+		authorizer = mtls.CreateAuthorizer(cfg.ReadIdentities, cfg.WriteIdentities)
+	}
+
+	baseController := base.Create(cfg, log, storage, agentsRegistry, hash, rsaDecoder, validatorIP, authorizer)
 
 	router := chi.NewRouter()
 	router.Mount("/", baseController.Route())
@@ -200,31 +306,46 @@ func initHTTPServer(cfg *config.Config, log logger.BaseLogger, storage *memstora
 	// server launch.
 	srv := httpserver.NewServer(cfg.Host, router, "http")
 	srv.Host(fmt.Sprintf("%s:%d", cfg.Host, cfg.PortHTTP))
+	if cfg.ClientCA != "" {
+		srv.TLSConfig, err = mtls.ServerConfig(cfg.CertRSA, cfg.KeyRSA, cfg.ClientCA, cfg.ClientCRL)
+		if err != nil {
+			return nil, fmt.Errorf("[main:initHTTPServer] failed to create mTLS config: %w", err)
+		}
+	}
 	return srv, nil
 }
 
-func initGRPCServer(cfg *config.Config, log logger.BaseLogger, storage *memstorage.MemStorage) (server.BaseServer, error) {
-	grpcController := controller.New(storage)
+func initGRPCServer(cfg *config.Config, log logger.BaseLogger, storage *memstorage.MemStorage, agentsRegistry *agents.Registry) (server.BaseServer, error) {
+	grpcController := controller.New(storage, agentsRegistry)
 	// trusted subnet validation.
 	validatorIP := createGRPCTrustedSubnetValidator(cfg, log)
 
+	unaryInterceptors := []grpc.UnaryServerInterceptor{logging.UnaryServer(log)}
+	streamInterceptors := []grpc.StreamServerInterceptor{logging.StreamServer(log)}
+
 	// TLS.
-	cert, err := tls.LoadX509KeyPair(cfg.CertRSA, cfg.KeyRSA)
-	if err != nil {
-		return nil, fmt.Errorf("error create TLS cert: %w", err)
+	var opts []grpc.ServerOption
+	if cfg.ClientCA != "" {
+		tlsConfig, err := mtls.ServerConfig(cfg.CertRSA, cfg.KeyRSA, cfg.ClientCA, cfg.ClientCRL)
+		if err != nil {
+			return nil, fmt.Errorf("error create mTLS config: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+
+		validatorIdentity := identity.Create(mtls.CreateAuthorizer(cfg.ReadIdentities, cfg.WriteIdentities), grpcWriteMethods...)
+		unaryInterceptors = append(unaryInterceptors, validatorIdentity.UnaryServer(log))
+		streamInterceptors = append(streamInterceptors, validatorIdentity.StreamServer(log))
+	} else {
+		cert, err := tls.LoadX509KeyPair(cfg.CertRSA, cfg.KeyRSA)
+		if err != nil {
+			return nil, fmt.Errorf("error create TLS cert: %w", err)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
 	}
 
 	// gRPC server options.
-	var opts []grpc.ServerOption
-	opts = append(opts, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
-	opts = append(opts, grpc.ChainUnaryInterceptor(
-		logging.UnaryServer(log),
-		validatorIP.UnaryServer(log),
-	))
-	opts = append(opts, grpc.ChainStreamInterceptor(
-		logging.StreamServer(log),
-		validatorIP.StreamServer(log),
-	))
+	opts = append(opts, grpc.ChainUnaryInterceptor(append(unaryInterceptors, validatorIP.UnaryServer(log))...))
+	opts = append(opts, grpc.ChainStreamInterceptor(append(streamInterceptors, validatorIP.StreamServer(log))...))
 
 	srv := grpcserver.NewServer(grpcController, "grpc", opts...)
 	srv.Host(fmt.Sprintf(":%d", cfg.PortGRPC))
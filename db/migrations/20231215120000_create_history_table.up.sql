@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS metrics.history (id TEXT NOT NULL, type TEXT NOT NULL, ts TIMESTAMPTZ NOT NULL, value float8, PRIMARY KEY (id, type, ts));
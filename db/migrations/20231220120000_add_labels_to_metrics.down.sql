@@ -0,0 +1,2 @@
+ALTER TABLE metrics.gauges DROP COLUMN IF EXISTS name, DROP COLUMN IF EXISTS labels;
+ALTER TABLE metrics.counters DROP COLUMN IF EXISTS name, DROP COLUMN IF EXISTS labels;
@@ -0,0 +1,5 @@
+ALTER TABLE metrics.gauges ADD COLUMN IF NOT EXISTS name TEXT, ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE metrics.counters ADD COLUMN IF NOT EXISTS name TEXT, ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+
+UPDATE metrics.gauges SET name = id WHERE name IS NULL;
+UPDATE metrics.counters SET name = id WHERE name IS NULL;
@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS metrics.histograms (id TEXT PRIMARY KEY, name TEXT NOT NULL, labels JSONB NOT NULL DEFAULT '{}', value JSONB NOT NULL);
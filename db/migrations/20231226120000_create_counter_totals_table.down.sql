@@ -0,0 +1 @@
+DROP TABLE IF EXISTS metrics.counter_totals;
@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS metrics.counter_totals (id TEXT PRIMARY KEY, value BIGINT NOT NULL);
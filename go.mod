@@ -14,6 +14,7 @@ require (
 	github.com/mailru/easyjson v0.7.7
 	github.com/shirou/gopsutil/v3 v3.23.8
 	github.com/stretchr/testify v1.8.4
+	go.etcd.io/bbolt v1.3.8
 	go.uber.org/zap v1.25.0
 )
 
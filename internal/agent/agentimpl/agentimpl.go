@@ -1,18 +1,16 @@
-// Package agentimpl collects runtime application's metrics and sends them on server via http requests.
+// Package agentimpl collects metrics with registered collectors and sends them on server via http requests.
 package agentimpl
 
 import (
 	"context"
 	"fmt"
-	"math/rand"
-	"runtime"
-	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/erupshis/metrics/internal/agent/client"
+	"github.com/erupshis/metrics/internal/agent/collectors"
 	"github.com/erupshis/metrics/internal/agent/config"
-	"github.com/erupshis/metrics/internal/agent/metricsgetter"
+	"github.com/erupshis/metrics/internal/agent/outbox"
+	"github.com/erupshis/metrics/internal/agent/statsd"
 	"github.com/erupshis/metrics/internal/hasher"
 	"github.com/erupshis/metrics/internal/logger"
 	"github.com/erupshis/metrics/internal/networkmsg"
@@ -20,30 +18,33 @@ import (
 )
 
 type Agent struct {
-	stats      runtime.MemStats
-	statsMutex sync.RWMutex
-
-	pollCount atomic.Int64
-
-	extraStats      metricsgetter.ExtraStats
-	extraStatsMutex sync.RWMutex
+	collectors *collectors.Registry
+	outbox     *outbox.Outbox
 
 	client client.BaseClient
 	logger logger.BaseLogger
 	config config.Config
 }
 
-// Create defines agent with assigned fields from params.
+// Create defines agent with assigned fields from params and registers built-in collectors enabled in config.
+// Undelivered batches are spooled in outbox if its path is configured.
 func Create(config config.Config, logger logger.BaseLogger, client client.BaseClient) *Agent {
-	extraStats := metricsgetter.ExtraStats{Data: make(map[string]float64)}
-	return &Agent{client: client, config: config, logger: logger, extraStats: extraStats}
+	a := &Agent{collectors: collectors.Create(logger), client: client, config: config, logger: logger}
+	a.registerDefaultCollectors()
+
+	if config.OutboxPath != "" {
+		var err error
+		if a.outbox, err = outbox.Create(config.OutboxPath, config.OutboxMaxSize, config.OutboxMaxAge, logger); err != nil {
+			a.logger.Info("[Agent:Create] outbox is disabled: %v", err)
+		}
+	}
+	return a
 }
 
 // CreateDefault agent with predefined fields. Recommended to use for debug only clauses.
 func CreateDefault(certFileRSA string) *Agent {
 	log := logger.CreateLogger("Info")
 	hashKey := ""
-	extraStats := metricsgetter.ExtraStats{Data: make(map[string]float64)}
 
 	encoder, err := rsa.CreateEncoder(certFileRSA)
 	if err != nil {
@@ -51,15 +52,69 @@ func CreateDefault(certFileRSA string) *Agent {
 		return nil
 	}
 
-	return &Agent{client: client.CreateDefault(log, hasher.CreateHasher(hashKey, hasher.SHA256, log),
+	return Create(config.ConfigDefault, log, client.CreateDefault(log, hasher.CreateHasher(hashKey, hasher.SHA256, log),
 		encoder,
 		config.ConfigDefault.RealIP,
-		config.ConfigDefault.Host),
-		config: config.ConfigDefault,
-		logger: log, extraStats: extraStats,
+		config.ConfigDefault.AgentID,
+		config.ConfigDefault.Host,
+		nil))
+}
+
+// registerDefaultCollectors registers built-in collectors. Processes collector is registered if processes to watch are configured.
+// StatsD listener is registered if its address is configured and is collected on report interval by default,
+// so applications' measurements are aggregated per report.
+func (a *Agent) registerDefaultCollectors() {
+	defaultCollectors := []collectors.Collector{
+		collectors.CreateRuntime(),
+		collectors.CreateSystem(),
+		collectors.CreateCPU(),
+		collectors.CreateLoad(),
+		collectors.CreateDisk(),
+		collectors.CreateNetwork(),
+		collectors.CreateRandom(),
+	}
+	if len(a.config.Processes) != 0 {
+		defaultCollectors = append(defaultCollectors, collectors.CreateProcess(a.config.Processes))
+	}
+
+	for _, collector := range defaultCollectors {
+		if err := a.RegisterCollector(collector); err != nil {
+			a.logger.Info("[Agent:registerDefaultCollectors] %v", err)
+		}
+	}
+
+	if a.config.StatsDAddress != "" {
+		if err := a.registerCollector(statsd.Create(a.config.StatsDAddress, a.logger), a.GetReportInterval()); err != nil {
+			a.logger.Info("[Agent:registerDefaultCollectors] %v", err)
+		}
 	}
 }
 
+// RegisterCollector registers collector with its settings from config. Disabled collectors are skipped.
+// Collector is run on poll interval if its own interval is not set. Must be called before RunCollectors.
+func (a *Agent) RegisterCollector(collector collectors.Collector) error {
+	return a.registerCollector(collector, a.GetPollInterval())
+}
+
+// registerCollector registers collector with its settings from config falling back to defaultInterval.
+func (a *Agent) registerCollector(collector collectors.Collector, defaultInterval time.Duration) error {
+	settings := a.config.Collectors[collector.Name()]
+	if settings.Disabled {
+		a.logger.Info("[Agent:RegisterCollector] collector '%s' is disabled.", collector.Name())
+		return nil
+	}
+
+	interval := settings.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if interval <= 0 {
+		interval = config.ConfigDefault.PollInterval
+	}
+
+	return a.collectors.Register(collector, interval)
+}
+
 // GetPollInterval returns collecting poll interval (seconds).
 func (a *Agent) GetPollInterval() time.Duration {
 	return a.config.PollInterval
@@ -70,54 +125,29 @@ func (a *Agent) GetReportInterval() time.Duration {
 	return a.config.ReportInterval
 }
 
-// UpdateStats reads runtime stats and increments pollCount.
-func (a *Agent) UpdateStats() {
-	a.logger.Info("[Agent:UpdateStats] agent trying to update stats.")
-
-	a.statsMutex.Lock()
-	runtime.ReadMemStats(&a.stats)
-	a.statsMutex.Unlock()
-
-	a.pollCount.Add(1)
-
-	a.logger.Info("[Agent:UpdateStats] agent has completed stats updating. pollCount: %d", a.pollCount.Load())
+// Collect runs every registered collector once.
+func (a *Agent) Collect(ctx context.Context) {
+	a.collectors.CollectAll(ctx)
 }
 
-// UpdateExtraStats reads additional extra stats not included in runtime.
-func (a *Agent) UpdateExtraStats() {
-	a.logger.Info("[Agent:UpdateExtraStats] agent trying to update stats.")
-	for key, funcVal := range metricsgetter.AdditionalGaugeMetricsGetter {
-		var err error
-		a.extraStatsMutex.Lock()
-		a.extraStats.Data[key], err = funcVal()
-		a.extraStatsMutex.Unlock()
-		if err != nil {
-			a.logger.Info("[Agent:UpdateExtraStats] agent failed to update extra metric '%s': %v", key, err)
-		}
-	}
-	a.logger.Info("[Agent:UpdateExtraStats] agent has completed stats posting.")
+// RunCollectors runs registered collectors on their intervals until context is canceled.
+func (a *Agent) RunCollectors(ctx context.Context) {
+	a.logger.Info("[Agent:RunCollectors] agent runs collectors: %v.", a.collectors.Names())
+	a.collectors.Run(ctx)
 }
 
 // PostStatsBatch sends all stats in one http post request.
+// If outbox is enabled, spooled batches are sent before and undelivered stats are spooled.
 func (a *Agent) PostStatsBatch(ctx context.Context) error {
 	a.logger.Info("[Agent:PostStatsBatch] agent is trying to update stats.")
-	metrics := make([]networkmsg.Metric, 0)
-	for name, valueGetter := range metricsgetter.GaugeMetricsGetter {
-		a.statsMutex.Lock()
-		metrics = append(metrics, networkmsg.CreateGaugeMetrics(name, valueGetter(&a.stats)))
-		a.statsMutex.Unlock()
-	}
 
-	for name, value := range a.extraStats.Data {
-		a.extraStatsMutex.RLock()
-		metrics = append(metrics, networkmsg.CreateGaugeMetrics(name, value))
-		a.extraStatsMutex.RUnlock()
+	metrics := a.take()
+	if a.outbox != nil {
+		return a.postThroughOutbox(ctx, metrics)
 	}
 
-	metrics = append(metrics, networkmsg.CreateGaugeMetrics("RandomValue", rand.Float64()))
-	metrics = append(metrics, networkmsg.CreateCounterMetrics("PollCount", a.pollCount.Load()))
-
-	if err := a.client.Post(ctx, metrics); err != nil {
+	if err := a.post(ctx, metrics); err != nil {
+		a.collectors.Return(metrics)
 		return fmt.Errorf("[Agent:PostStatsBatch] postBatchJSON couldn't complete sending with error: %w", err)
 	}
 
@@ -125,39 +155,73 @@ func (a *Agent) PostStatsBatch(ctx context.Context) error {
 	return nil
 }
 
+// postThroughOutbox replays spooled batches and then sends metrics. Metrics are spooled if anything fails,
+// so batches are delivered in order they were collected. Metrics are returned in collectors if they can't be spooled.
+func (a *Agent) postThroughOutbox(ctx context.Context, metrics []networkmsg.Metric) error {
+	replayed, err := a.outbox.Replay(ctx, a.post)
+	if replayed != 0 {
+		a.logger.Info("[Agent:PostStatsBatch] %d spooled batches were sent.", replayed)
+	}
+
+	if err == nil {
+		if err = a.post(ctx, metrics); err == nil {
+			a.logger.Info("[Agent:PostStatsBatch] stats was sent.")
+			return nil
+		}
+	}
+
+	if spoolErr := a.outbox.Push(metrics); spoolErr != nil {
+		a.collectors.Return(metrics)
+		return fmt.Errorf("[Agent:PostStatsBatch] couldn't complete sending with error: %w, spooling failed: %v", err, spoolErr)
+	}
+	return fmt.Errorf("[Agent:PostStatsBatch] stats was spooled, couldn't complete sending with error: %w", err)
+}
+
 // PostJSONStats sends all stats in split http posts request(1 request = 1 stat).
 func (a *Agent) PostJSONStats(ctx context.Context) {
 	a.logger.Info("[Agent:PostJSONStats] agent is trying to update stats.")
 
 	failedPostsCount := 0
-	var err error
-	for name, valueGetter := range metricsgetter.GaugeMetricsGetter {
-		a.statsMutex.RLock()
-		err = a.client.Post(ctx, []networkmsg.Metric{networkmsg.CreateGaugeMetrics(name, valueGetter(&a.stats))})
-		a.statsMutex.RUnlock()
-		if err != nil {
+	for _, metric := range a.take() {
+		if err := a.post(ctx, []networkmsg.Metric{metric}); err != nil {
+			a.collectors.Return([]networkmsg.Metric{metric})
 			failedPostsCount++
 		}
 	}
 
-	for name, value := range a.extraStats.Data {
-		a.extraStatsMutex.RLock()
-		err = a.client.Post(ctx, []networkmsg.Metric{networkmsg.CreateGaugeMetrics(name, value)})
-		a.extraStatsMutex.RUnlock()
-		if err != nil {
-			failedPostsCount++
-		}
-	}
+	a.logger.Info("[Agent:PostJSONStats] stats was sent with failed posts: %d", failedPostsCount)
+}
 
-	err = a.client.Post(ctx, []networkmsg.Metric{networkmsg.CreateGaugeMetrics("RandomValue", rand.Float64())})
-	if err != nil {
-		failedPostsCount++
+// take returns collected metrics. Metrics are stamped with collection time by collectors registry,
+// current time is used only for metrics without it.
+func (a *Agent) take() []networkmsg.Metric {
+	metrics := a.collectors.Take()
+	now := time.Now().UnixMilli()
+	for i := range metrics {
+		if metrics[i].Timestamp == 0 {
+			metrics[i].Timestamp = now
+		}
 	}
+	return metrics
+}
 
-	err = a.client.Post(ctx, []networkmsg.Metric{networkmsg.CreateCounterMetrics("PollCount", a.pollCount.Load())})
-	if err != nil {
-		failedPostsCount++
+// post sends metrics via client. Agent identifier is sent by client in header (metadata) of request.
+// If agent label is enabled, metrics are also tagged with agent identifier label in copies, so collected ones keep their series.
+func (a *Agent) post(ctx context.Context, metrics []networkmsg.Metric) error {
+	if a.config.AgentLabel && a.config.AgentID != "" {
+		tagged := make([]networkmsg.Metric, len(metrics))
+		for i, metric := range metrics {
+			labels := make(map[string]string, len(metric.Labels)+1)
+			for name, value := range metric.Labels {
+				labels[name] = value
+			}
+			labels[networkmsg.AgentLabel] = a.config.AgentID
+
+			metric.Labels = labels
+			tagged[i] = metric
+		}
+		metrics = tagged
 	}
 
-	a.logger.Info("[Agent:PostJSONStats] stats was sent with failed posts: %d", failedPostsCount)
+	return a.client.Post(ctx, metrics)
 }
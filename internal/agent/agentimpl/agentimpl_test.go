@@ -3,16 +3,19 @@ package agentimpl
 import (
 	"context"
 	"fmt"
-	"sync"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/caarlos0/env"
 	"github.com/erupshis/metrics/internal/agent/client"
+	"github.com/erupshis/metrics/internal/agent/collectors"
 	"github.com/erupshis/metrics/internal/agent/config"
-	"github.com/erupshis/metrics/internal/agent/metricsgetter"
+	"github.com/erupshis/metrics/internal/agent/statsd"
 	"github.com/erupshis/metrics/internal/configutils"
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -92,53 +95,129 @@ func TestAgent_GetReportInterval(t *testing.T) {
 	}
 }
 
-func TestAgent_UpdateStats(t *testing.T) {
-	certRSA, _ := getEnvironments()
+// hostCollectorsOff disables collectors which report host dependent set of metrics.
+var hostCollectorsOff = map[string]config.CollectorConfig{
+	collectors.CPUName:     {Disabled: true},
+	collectors.LoadName:    {Disabled: true},
+	collectors.DiskName:    {Disabled: true},
+	collectors.NetworkName: {Disabled: true},
+}
 
-	tests := []struct {
-		name string
-	}{
-		{"runtime stats updates"},
+func TestAgent_RegisterCollector(t *testing.T) {
+	a := Create(config.Config{
+		PollInterval: time.Second,
+		Collectors: map[string]config.CollectorConfig{
+			collectors.SystemName: {Disabled: true},
+			collectors.RandomName: {Interval: time.Minute},
+		},
+	}, logger.CreateMock(), nil)
+	assert.Equal(t, []string{collectors.RuntimeName, collectors.CPUName, collectors.LoadName, collectors.DiskName,
+		collectors.NetworkName, collectors.RandomName}, a.collectors.Names())
+
+	assert.ErrorIs(t, a.RegisterCollector(collectors.CreateRandom()), collectors.ErrAlreadyRegistered)
+	assert.NoError(t, a.RegisterCollector(collectors.CreateSystem()))
+	assert.Len(t, a.collectors.Names(), 6)
+}
+
+func TestAgent_RegisterProcessCollector(t *testing.T) {
+	a := Create(config.Config{
+		PollInterval: time.Second,
+		Collectors:   hostCollectorsOff,
+		Processes:    []config.ProcessTarget{{Name: "db", PIDFile: "/run/db.pid"}},
+	}, logger.CreateMock(), nil)
+	assert.Equal(t, []string{collectors.RuntimeName, collectors.SystemName, collectors.RandomName, collectors.ProcessName}, a.collectors.Names())
+}
+
+func TestAgent_RegisterStatsDCollector(t *testing.T) {
+	a := Create(config.Config{
+		PollInterval:  time.Second,
+		Collectors:    hostCollectorsOff,
+		StatsDAddress: "127.0.0.1:0",
+	}, logger.CreateMock(), nil)
+	assert.Equal(t, []string{collectors.RuntimeName, collectors.SystemName, collectors.RandomName, statsd.CollectorName}, a.collectors.Names())
+}
+
+func TestAgent_PostStatsBatchStatsD(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var posted []networkmsg.Metric
+	mockClient := mocks.NewMockBaseClient(ctrl)
+	mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []networkmsg.Metric) error {
+		posted = metrics
+		return nil
+	})
+
+	a := Create(config.Config{Host: "/", Collectors: hostCollectorsOff}, logger.CreateMock(), mockClient)
+	listener := statsd.Create("", logger.CreateMock())
+	require.NoError(t, a.RegisterCollector(listener))
+
+	for _, line := range []string{"orders:1|c", "orders:2|c", "queue:7|g"} {
+		sample, err := statsd.ParseLine(line)
+		require.NoError(t, err)
+		listener.Add(sample)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			agent := CreateDefault(certRSA)
-			agent.UpdateStats()
-			pollCountOld := agent.pollCount.Load()
-			agent.UpdateStats()
-			assert.NotEqual(t, pollCountOld, agent.pollCount.Load())
-		})
+	a.Collect(context.Background())
+	require.NoError(t, a.PostStatsBatch(context.Background()))
+
+	for i := range posted {
+		assert.NotZero(t, posted[i].Timestamp, posted[i].ID)
+		posted[i].Timestamp = 0
 	}
+	assert.Contains(t, posted, networkmsg.CreateCounterMetrics("orders", 3))
+	assert.Contains(t, posted, networkmsg.CreateGaugeMetrics("queue", 7))
 }
 
-func TestAgent_UpdateExtraStats(t *testing.T) {
-	type fields struct {
-		extraStats metricsgetter.ExtraStats
-		logger     logger.BaseLogger
+func TestAgent_PostStatsBatchOutbox(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var posted [][]networkmsg.Metric
+	record := func(_ context.Context, metrics []networkmsg.Metric) error {
+		posted = append(posted, metrics)
+		return nil
 	}
-	tests := []struct {
-		name   string
-		fields fields
-	}{
-		{
-			name: "valid",
-			fields: fields{
-				extraStats: metricsgetter.ExtraStats{Data: make(map[string]float64)},
-				logger:     logger.CreateMock(),
-			},
-		},
+	mockClient := mocks.NewMockBaseClient(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).Return(fmt.Errorf("connection err")),
+		mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).DoAndReturn(record).Times(2),
+	)
+
+	dir := t.TempDir()
+	a := Create(config.Config{Host: "/", Collectors: hostCollectorsOff, OutboxPath: dir}, logger.CreateMock(), mockClient)
+	listener := statsd.Create("", logger.CreateMock())
+	require.NoError(t, a.RegisterCollector(listener))
+
+	post := func(line string) error {
+		sample, err := statsd.ParseLine(line)
+		require.NoError(t, err)
+		listener.Add(sample)
+		a.Collect(context.Background())
+		return a.PostStatsBatch(context.Background())
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			a := &Agent{
-				extraStats:      tt.fields.extraStats,
-				extraStatsMutex: sync.RWMutex{},
-				logger:          tt.fields.logger,
+
+	require.Error(t, post("orders:1|c"))
+	assert.Equal(t, 1, a.outbox.Len())
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, post("orders:2|c"))
+	assert.Equal(t, 0, a.outbox.Len())
+
+	// spooled batch is replayed first with its collection time.
+	require.Len(t, posted, 2)
+	orders := func(metrics []networkmsg.Metric) networkmsg.Metric {
+		for _, metric := range metrics {
+			if metric.ID == "orders" {
+				return metric
 			}
-			a.UpdateExtraStats()
-			assert.Equal(t, 3, len(a.extraStats.Data))
-		})
+		}
+		return networkmsg.Metric{}
 	}
+	first, second := orders(posted[0]), orders(posted[1])
+	require.NotNil(t, first.Delta)
+	require.NotNil(t, second.Delta)
+	assert.Equal(t, int64(1), *first.Delta)
+	assert.Equal(t, int64(2), *second.Delta)
+	assert.Less(t, first.Timestamp, second.Timestamp)
 }
 
 func TestAgent_PostJSONStatsBatch(t *testing.T) {
@@ -197,8 +276,7 @@ func TestAgent_PostJSONStatsBatch(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := Create(tt.fields.config, tt.fields.logger, tt.fields.client)
-			a.UpdateStats()
-			a.UpdateExtraStats()
+			a.Collect(tt.args.ctx)
 			tt.wantErr(t, a.PostStatsBatch(tt.args.ctx), fmt.Sprintf("PostStatsBatch(%v)", tt.args.ctx))
 		})
 	}
@@ -210,7 +288,7 @@ func TestAgent_PostJSONStats(t *testing.T) {
 
 	mockClient := mocks.NewMockBaseClient(ctrl)
 	gomock.InOrder(
-		mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).Return(nil).Times(64),
+		mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).Return(nil).Times(70),
 	)
 
 	type fields struct {
@@ -232,7 +310,8 @@ func TestAgent_PostJSONStats(t *testing.T) {
 			fields: fields{
 				logger: logger.CreateMock(),
 				config: config.Config{
-					Host: "/",
+					Host:       "/",
+					Collectors: hostCollectorsOff,
 				},
 				client: mockClient,
 			},
@@ -246,7 +325,8 @@ func TestAgent_PostJSONStats(t *testing.T) {
 			fields: fields{
 				logger: logger.CreateMock(),
 				config: config.Config{
-					Host: "/",
+					Host:       "/",
+					Collectors: hostCollectorsOff,
 				},
 				client: mockClient,
 			},
@@ -259,9 +339,76 @@ func TestAgent_PostJSONStats(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := Create(tt.fields.config, tt.fields.logger, tt.fields.client)
-			a.UpdateStats()
-			a.UpdateExtraStats()
+			a.Collect(tt.args.ctx)
 			a.PostJSONStats(tt.args.ctx)
 		})
 	}
 }
+
+func TestAgent_PostStatsBatchAgentLabel(t *testing.T) {
+	for _, agentLabel := range []bool{false, true} {
+		t.Run(fmt.Sprintf("agent label %t", agentLabel), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var posted []networkmsg.Metric
+			mockClient := mocks.NewMockBaseClient(ctrl)
+			mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []networkmsg.Metric) error {
+				posted = metrics
+				return nil
+			})
+
+			a := Create(config.Config{Host: "/", AgentID: "host-1", AgentLabel: agentLabel}, logger.CreateMock(), mockClient)
+			a.Collect(context.Background())
+			require.NoError(t, a.PostStatsBatch(context.Background()))
+
+			require.NotEmpty(t, posted)
+			for _, metric := range posted {
+				if agentLabel {
+					assert.Equal(t, "host-1", metric.Labels[networkmsg.AgentLabel], metric.ID)
+				} else {
+					assert.NotContains(t, metric.Labels, networkmsg.AgentLabel, metric.ID)
+				}
+			}
+			for _, metric := range a.collectors.Take() {
+				assert.NotContains(t, metric.Labels, networkmsg.AgentLabel, metric.ID)
+			}
+		})
+	}
+}
+
+func TestAgent_GCPausesHistogram(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var posted []networkmsg.Metric
+	mockClient := mocks.NewMockBaseClient(ctrl)
+	gomock.InOrder(
+		mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).Return(fmt.Errorf("connection err")),
+		mockClient.EXPECT().Post(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []networkmsg.Metric) error {
+			posted = metrics
+			return nil
+		}),
+	)
+
+	a := Create(config.Config{Host: "/"}, logger.CreateMock(), mockClient)
+	a.Collect(context.Background())
+	runtime.GC()
+	runtime.GC()
+	a.Collect(context.Background())
+	require.Error(t, a.PostStatsBatch(context.Background()))
+	require.NoError(t, a.PostStatsBatch(context.Background()))
+
+	var gcPauses *histogram.Histogram
+	for _, metric := range posted {
+		if metric.ID == "GCPauseSeconds" {
+			gcPauses = metric.Histogram
+		}
+	}
+	require.NotNil(t, gcPauses)
+	assert.GreaterOrEqual(t, gcPauses.Count, uint64(2))
+
+	for _, metric := range a.collectors.Take() {
+		assert.NotEqual(t, "GCPauseSeconds", metric.ID)
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -22,16 +23,24 @@ type DefaultClient struct {
 	hash    *hasher.Hasher
 	encoder *rsa.Encoder
 	IP      string
+	agentID string
 	host    string
 }
 
 // CreateDefault creates default http client. Receives logger and hasher in params.
-func CreateDefault(log logger.BaseLogger, hash *hasher.Hasher, encoder *rsa.Encoder, IP string, host string) BaseClient {
-	return &DefaultClient{client: &http.Client{},
+// Client presents certificate from tlsConfig to https server if tlsConfig is set.
+func CreateDefault(log logger.BaseLogger, hash *hasher.Hasher, encoder *rsa.Encoder, IP string, agentID string, host string, tlsConfig *tls.Config) BaseClient {
+	client := &http.Client{}
+	if tlsConfig != nil {
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+
+	return &DefaultClient{client: client,
 		log:     log,
 		hash:    hash,
 		encoder: encoder,
 		IP:      IP,
+		agentID: agentID,
 		host:    host,
 	}
 }
@@ -39,7 +48,7 @@ func CreateDefault(log logger.BaseLogger, hash *hasher.Hasher, encoder *rsa.Enco
 // Post sends data via http post request.
 //
 // Performs gzip compression and add hash sum for message validation if hashKey is set in hasher.
-// Uses retryer to repeat call in case of connection error.
+// Uses retryer to repeat call in case of connection error or non-2xx response status.
 func (c *DefaultClient) Post(ctx context.Context, metrics []networkmsg.Metric) error {
 	body, err := json.Marshal(metrics)
 	if err != nil {
@@ -59,7 +68,7 @@ func (c *DefaultClient) Post(ctx context.Context, metrics []networkmsg.Metric) e
 		}
 	}
 
-	encryptedBody, err := c.encoder.Encode(compressedBody)
+	encryptedBody, encryptedKey, err := c.encoder.Encode(compressedBody)
 	if err != nil {
 		return fmt.Errorf("defclient postJSON request: %w", err)
 	}
@@ -72,17 +81,18 @@ func (c *DefaultClient) Post(ctx context.Context, metrics []networkmsg.Metric) e
 	}
 
 	request := func(context context.Context) error {
-		return c.makeRequest(context, http.MethodPost, url, encryptedBody, hashValue)
+		return c.makeRequest(context, http.MethodPost, url, encryptedBody, encryptedKey, hashValue)
 	}
 
 	err = retryer.RetryCallWithTimeout(ctx, c.log, nil, nil, request)
 	if err != nil {
-		err = fmt.Errorf("couldn't send post request")
+		err = fmt.Errorf("couldn't send post request: %w", err)
 	}
 	return err
 }
 
-func (c *DefaultClient) makeRequest(ctx context.Context, method string, url string, data []byte, hashValue string) error {
+// makeRequest sends request and checks response status. Batch is considered delivered on 2xx status only.
+func (c *DefaultClient) makeRequest(ctx context.Context, method string, url string, data []byte, encryptedKey string, hashValue string) error {
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(data))
 	if err != nil {
 		return err
@@ -92,6 +102,10 @@ func (c *DefaultClient) makeRequest(ctx context.Context, method string, url stri
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Header.Set("Accept-Encoding", "gzip")
 	req.Header.Set("X-Real-IP", c.IP)
+	req.Header.Set(rsa.KeyHeader, encryptedKey)
+	if c.agentID != "" {
+		req.Header.Set(networkmsg.AgentIDHeader, c.agentID)
+	}
 
 	if hashValue != "" {
 		req.Header.Set(c.hash.GetHeader(), hashValue)
@@ -107,5 +121,8 @@ func (c *DefaultClient) makeRequest(ctx context.Context, method string, url stri
 		}
 	}()
 
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
 	return nil
 }
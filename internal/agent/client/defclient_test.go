@@ -2,18 +2,27 @@ package client
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/erupshis/metrics/internal/compressor"
 	"github.com/erupshis/metrics/internal/hasher"
 	"github.com/erupshis/metrics/internal/logger"
 	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/rsa"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-const certRSA = "../../../rsa/cert.pem"
+const (
+	certRSA = "../../../rsa/cert.pem"
+	keyRSA  = "../../../rsa/key.pem"
+)
 
 func TestDefaultClient_PostJSON(t *testing.T) {
 	log := logger.CreateMock()
@@ -91,3 +100,73 @@ func TestDefaultClient_PostJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultClient_PostAgentID(t *testing.T) {
+	encoder, err := rsa.CreateEncoder(certRSA)
+	require.NoError(t, err)
+
+	var agentID string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agentID = r.Header.Get(networkmsg.AgentIDHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	log := logger.CreateMock()
+	c := CreateDefault(log, hasher.CreateHasher("", hasher.SHA256, log), encoder, "127.0.0.1", "host-1", ts.URL, nil)
+
+	require.NoError(t, c.Post(context.Background(), []networkmsg.Metric{networkmsg.CreateCounterMetrics("val", 1)}))
+	assert.Equal(t, "host-1", agentID)
+}
+
+func TestDefaultClient_PostFailedStatus(t *testing.T) {
+	encoder, err := rsa.CreateEncoder(certRSA)
+	require.NoError(t, err)
+
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	log := logger.CreateMock()
+	c := CreateDefault(log, hasher.CreateHasher("", hasher.SHA256, log), encoder, "127.0.0.1", "", ts.URL, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = c.Post(ctx, []networkmsg.Metric{networkmsg.CreateCounterMetrics("val", 1)})
+	assert.Error(t, err, "batch isn't delivered")
+	assert.NotZero(t, requests.Load())
+}
+
+func TestDefaultClient_PostLargeBatch(t *testing.T) {
+	encoder, err := rsa.CreateEncoder(certRSA)
+	require.NoError(t, err)
+	decoder, err := rsa.CreateDecoder(keyRSA)
+	require.NoError(t, err)
+
+	// batch is much larger than RSA key size.
+	metrics := make([]networkmsg.Metric, 0, 1000)
+	for i := 0; i < cap(metrics); i++ {
+		metrics = append(metrics, networkmsg.CreateGaugeMetrics(fmt.Sprintf("gauge_%d", i), float64(i)))
+	}
+
+	var received []networkmsg.Metric
+	ts := httptest.NewServer(decoder.DecodeRSAHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err = compressor.GzipDecompress(body)
+		require.NoError(t, err)
+		received, err = networkmsg.ParsePostBatchValueMessage(body)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer ts.Close()
+
+	log := logger.CreateMock()
+	c := CreateDefault(log, hasher.CreateHasher("", hasher.SHA256, log), encoder, "127.0.0.1", "host-1", ts.URL, nil)
+
+	require.NoError(t, c.Post(context.Background(), metrics))
+	assert.Equal(t, metrics, received)
+}
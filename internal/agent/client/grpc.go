@@ -19,10 +19,11 @@ type Grpc struct {
 	client pb.MetricsClient
 	conn   *grpc.ClientConn
 
-	IP string
+	IP      string
+	agentID string
 }
 
-func CreateGRPC(address string, IP string, options ...grpc.DialOption) (BaseClient, error) {
+func CreateGRPC(address string, IP string, agentID string, options ...grpc.DialOption) (BaseClient, error) {
 	conn, err := grpc.Dial(address, options...)
 	if err != nil {
 		return nil, fmt.Errorf("create connection to filestorage: %w", err)
@@ -31,9 +32,10 @@ func CreateGRPC(address string, IP string, options ...grpc.DialOption) (BaseClie
 	client := pb.NewMetricsClient(conn)
 
 	return &Grpc{
-		client: client,
-		conn:   conn,
-		IP:     IP,
+		client:  client,
+		conn:    conn,
+		IP:      IP,
+		agentID: agentID,
 	}, nil
 }
 
@@ -45,6 +47,9 @@ func (s *Grpc) Post(ctx context.Context, metrics []networkmsg.Metric) error {
 	md := metadata.Pairs(
 		"X-Real-Ip", s.IP,
 	)
+	if s.agentID != "" {
+		md.Set(networkmsg.AgentIDHeader, s.agentID)
+	}
 
 	mdCtx := metadata.NewOutgoingContext(ctx, md)
 
@@ -14,16 +14,17 @@ import (
 
 // RestyClient object.
 type RestyClient struct {
-	client *resty.Client
-	log    logger.BaseLogger
-	hash   *hasher.Hasher
-	IP     string
-	host   string
+	client  *resty.Client
+	log     logger.BaseLogger
+	hash    *hasher.Hasher
+	IP      string
+	agentID string
+	host    string
 }
 
 // CreateResty creates resty http client. Receives logger and hasher in params.
-func CreateResty(log logger.BaseLogger, hash *hasher.Hasher, IP string, host string) BaseClient {
-	return &RestyClient{client: resty.New(), log: log, hash: hash, IP: IP}
+func CreateResty(log logger.BaseLogger, hash *hasher.Hasher, IP string, agentID string, host string) BaseClient {
+	return &RestyClient{client: resty.New(), log: log, hash: hash, IP: IP, agentID: agentID}
 }
 
 // PostJSON sends data via http post request.
@@ -48,6 +49,10 @@ func (c *RestyClient) Post(context context.Context, metrics []networkmsg.Metric)
 		SetHeader("Accept-Encoding", "gzip").
 		SetHeader("X-Real-IP", c.IP)
 
+	if c.agentID != "" {
+		request.SetHeader(networkmsg.AgentIDHeader, c.agentID)
+	}
+
 	if c.hash.GetKey() != "" {
 		hashValue, errHash := c.hash.HashMsg(body)
 		if errHash != nil {
@@ -64,6 +69,13 @@ func (c *RestyClient) Post(context context.Context, metrics []networkmsg.Metric)
 		url += "/updates/"
 	}
 
-	_, err = request.SetBody(compressedBody).Post(url)
-	return err
+	resp, err := request.SetBody(compressedBody).Post(url)
+	if err != nil {
+		return err
+	}
+
+	if resp.IsError() {
+		return fmt.Errorf("unexpected response status: %s", resp.Status())
+	}
+	return nil
 }
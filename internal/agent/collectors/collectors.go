@@ -0,0 +1,294 @@
+// Package collectors provides pluggable metrics collectors of the agent and the registry running them.
+// Every collector is run on its own interval, failures and panics of one collector don't affect others.
+// Registry keeps the last values of gauges and cumulative counters and accumulates delta counters and
+// histograms until they are taken for report.
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/erupshis/metrics/internal/ticker"
+)
+
+const (
+	gaugeType     = "gauge"
+	counterType   = "counter"
+	histogramType = "histogram"
+)
+
+// ErrAlreadyRegistered is returned on attempt to register collector with already used name.
+var ErrAlreadyRegistered = errors.New("collector is already registered")
+
+// Collector gathers metrics of some source.
+//
+// Collect is called from a single goroutine, so implementations may keep state between calls.
+// Gauges and cumulative counters are treated as current values, delta counters and histograms are
+// treated as observations since the previous call. Metrics returned together with error are kept.
+type Collector interface {
+	// Name returns unique name of collector used in agent's config.
+	Name() string
+	// Collect returns metrics gathered from the source.
+	Collect(ctx context.Context) ([]networkmsg.Metric, error)
+}
+
+// Service is implemented by collectors receiving metrics in background, e.g. from network listeners.
+// Registry serves them while collectors are run, Serve should block until context is canceled.
+type Service interface {
+	Serve(ctx context.Context) error
+}
+
+// entry is a registered collector with its interval.
+type entry struct {
+	collector Collector
+	interval  time.Duration
+}
+
+// Registry runs registered collectors and stores collected metrics until report. Safe for concurrent use.
+type Registry struct {
+	entries []entry
+	names   map[string]struct{}
+
+	// latest stores gauges and cumulative counters by series, pending accumulates delta counters and histograms.
+	latest  map[string]networkmsg.Metric
+	pending map[string]networkmsg.Metric
+	mu      sync.Mutex
+
+	logger logger.BaseLogger
+}
+
+// Create initializes and returns a new empty instance of Registry.
+func Create(logger logger.BaseLogger) *Registry {
+	return &Registry{
+		names:   make(map[string]struct{}),
+		latest:  make(map[string]networkmsg.Metric),
+		pending: make(map[string]networkmsg.Metric),
+		logger:  logger,
+	}
+}
+
+// Register adds collector run on interval. Name of collector must be unique.
+func (r *Registry) Register(collector Collector, interval time.Duration) error {
+	name := collector.Name()
+	if name == "" {
+		return fmt.Errorf("register collector: empty name")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("register collector '%s': interval should be positive", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		return fmt.Errorf("register collector '%s': %w", name, ErrAlreadyRegistered)
+	}
+	r.names[name] = struct{}{}
+	r.entries = append(r.entries, entry{collector: collector, interval: interval})
+	return nil
+}
+
+// Names returns names of registered collectors in registration order.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.entries))
+	for _, e := range r.entries {
+		names = append(names, e.collector.Name())
+	}
+	return names
+}
+
+// CollectAll runs every registered collector once.
+func (r *Registry) CollectAll(ctx context.Context) {
+	for _, e := range r.getEntries() {
+		r.collect(ctx, e.collector)
+	}
+}
+
+// Run collects metrics immediately and then on interval of every collector until context is canceled.
+// Collectors implementing Service are served meanwhile. Blocks until all collectors are stopped.
+func (r *Registry) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, e := range r.getEntries() {
+		if service, ok := e.collector.(Service); ok {
+			wg.Add(1)
+			go func(name string, service Service) {
+				defer wg.Done()
+
+				if err := service.Serve(ctx); err != nil {
+					r.logger.Info("[Registry:Run] collector '%s' service failed: %v", name, err)
+				}
+			}(e.collector.Name(), service)
+		}
+
+		wg.Add(1)
+		go func(e entry) {
+			defer wg.Done()
+
+			r.collect(ctx, e.collector)
+			ticker.Run(time.NewTicker(e.interval), ctx, func() { r.collect(ctx, e.collector) })
+		}(e)
+	}
+	wg.Wait()
+}
+
+// Take returns last values of gauges and cumulative counters and moves out delta counters and histograms
+// accumulated since the previous take. Metrics are sorted by type and series key.
+func (r *Registry) Take() []networkmsg.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	metrics := make([]networkmsg.Metric, 0, len(r.latest)+len(r.pending))
+	for _, metric := range r.latest {
+		metrics = append(metrics, metric)
+	}
+	for _, metric := range r.pending {
+		metrics = append(metrics, metric)
+	}
+	r.pending = make(map[string]networkmsg.Metric)
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return seriesID(&metrics[i]) < seriesID(&metrics[j])
+	})
+	return metrics
+}
+
+// Return merges back delta counters and histograms which were taken but not delivered.
+// Gauges and cumulative counters are skipped, fresher values are collected anyway.
+func (r *Registry) Return(metrics []networkmsg.Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range metrics {
+		if isAccumulated(&metrics[i]) {
+			r.store(metrics[i])
+		}
+	}
+}
+
+// getEntries returns copy of registered collectors.
+func (r *Registry) getEntries() []entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]entry(nil), r.entries...)
+}
+
+// collect runs collector isolating its errors and panics and stores gathered metrics.
+// Metrics without timestamp are stamped with the collection time.
+func (r *Registry) collect(ctx context.Context, collector Collector) {
+	metrics, err := safeCollect(ctx, collector)
+	if err != nil {
+		r.logger.Info("[Registry:collect] collector '%s' failed: %v", collector.Name(), err)
+	}
+
+	collected := time.Now().UnixMilli()
+	for i := range metrics {
+		if metrics[i].Timestamp == 0 {
+			metrics[i].Timestamp = collected
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, metric := range metrics {
+		if err = validate(&metric); err != nil {
+			r.logger.Info("[Registry:collect] collector '%s' metric skipped: %v", collector.Name(), err)
+			continue
+		}
+		r.store(metric)
+	}
+}
+
+// store keeps metric replacing current value or accumulating observations. Must be called under mu.
+// Accumulated metric keeps the latest collection time of its observations.
+func (r *Registry) store(metric networkmsg.Metric) {
+	id := seriesID(&metric)
+	if !isAccumulated(&metric) {
+		r.latest[id] = metric
+		return
+	}
+
+	stored, ok := r.pending[id]
+	if !ok {
+		if metric.Histogram != nil {
+			metric.Histogram = metric.Histogram.Clone()
+		}
+		r.pending[id] = metric
+		return
+	}
+
+	switch metric.MType {
+	case counterType:
+		sum := *stored.Delta + *metric.Delta
+		stored.Delta = &sum
+	case histogramType:
+		if err := stored.Histogram.Merge(metric.Histogram); err != nil {
+			r.logger.Info("[Registry:store] histogram '%s' replaced: %v", id, err)
+			stored.Histogram = metric.Histogram.Clone()
+		}
+	}
+	if metric.Timestamp > stored.Timestamp {
+		stored.Timestamp = metric.Timestamp
+	}
+	r.pending[id] = stored
+}
+
+// safeCollect calls collector converting panic into error.
+func safeCollect(ctx context.Context, collector Collector) (metrics []networkmsg.Metric, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			metrics, err = nil, fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return collector.Collect(ctx)
+}
+
+// validate checks that metric has name and value of its type.
+func validate(metric *networkmsg.Metric) error {
+	if metric.ID == "" {
+		return fmt.Errorf("empty metric name")
+	}
+
+	var ok bool
+	switch metric.MType {
+	case gaugeType:
+		ok = metric.Value != nil
+	case counterType:
+		ok = metric.Delta != nil
+	case histogramType:
+		ok = metric.Histogram != nil && metric.Histogram.Validate() == nil
+	default:
+		return fmt.Errorf("metric '%s' has unknown type '%s'", metric.ID, metric.MType)
+	}
+
+	if !ok {
+		return fmt.Errorf("metric '%s' has missing or invalid %s value", metric.ID, metric.MType)
+	}
+	return nil
+}
+
+// isAccumulated checks if metric carries observations since previous collecting rather than current value.
+func isAccumulated(metric *networkmsg.Metric) bool {
+	switch metric.MType {
+	case counterType:
+		return metric.Mode != networkmsg.CounterCumulative
+	case histogramType:
+		return true
+	default:
+		return false
+	}
+}
+
+// seriesID returns identifier of metric series unique across types.
+func seriesID(metric *networkmsg.Metric) string {
+	return metric.MType + "/" + metric.Key()
+}
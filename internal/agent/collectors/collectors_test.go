@@ -0,0 +1,202 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectorMock returns results of collect function.
+type collectorMock struct {
+	name    string
+	collect func() ([]networkmsg.Metric, error)
+	calls   atomic.Int64
+}
+
+func (c *collectorMock) Name() string {
+	return c.name
+}
+
+func (c *collectorMock) Collect(_ context.Context) ([]networkmsg.Metric, error) {
+	c.calls.Add(1)
+	return c.collect()
+}
+
+func createHistogram(t *testing.T, values ...float64) *histogram.Histogram {
+	h, err := histogram.New([]float64{1, 10})
+	require.NoError(t, err)
+	for _, value := range values {
+		h.Observe(value)
+	}
+	return h
+}
+
+// untimed checks that metrics are stamped with collection time and drops it for comparison of values.
+func untimed(t *testing.T, metrics []networkmsg.Metric) []networkmsg.Metric {
+	for i := range metrics {
+		assert.NotZero(t, metrics[i].Timestamp, "metric '%s' isn't stamped", metrics[i].ID)
+		metrics[i].Timestamp = 0
+	}
+	return metrics
+}
+
+func TestRegistry_Register(t *testing.T) {
+	registry := Create(logger.CreateMock())
+	collect := func() ([]networkmsg.Metric, error) { return nil, nil }
+
+	assert.NoError(t, registry.Register(&collectorMock{name: "first", collect: collect}, time.Second))
+	assert.NoError(t, registry.Register(&collectorMock{name: "second", collect: collect}, time.Second))
+	assert.ErrorIs(t, registry.Register(&collectorMock{name: "first", collect: collect}, time.Second), ErrAlreadyRegistered)
+	assert.Error(t, registry.Register(&collectorMock{name: "", collect: collect}, time.Second))
+	assert.Error(t, registry.Register(&collectorMock{name: "third", collect: collect}, 0))
+
+	assert.Equal(t, []string{"first", "second"}, registry.Names())
+}
+
+func TestRegistry_CollectAll(t *testing.T) {
+	registry := Create(logger.CreateMock())
+
+	deltas := int64(0)
+	require.NoError(t, registry.Register(&collectorMock{
+		name: "values",
+		collect: func() ([]networkmsg.Metric, error) {
+			deltas++
+			return []networkmsg.Metric{
+				networkmsg.CreateGaugeMetrics("Gauge", float64(deltas)),
+				networkmsg.CreateCumulativeCounterMetrics("Total", deltas*10),
+				networkmsg.CreateCounterMetrics("Delta", deltas),
+				networkmsg.CreateHistogramMetrics("Latency", createHistogram(t, float64(deltas))),
+			}, nil
+		},
+	}, time.Second))
+	require.NoError(t, registry.Register(&collectorMock{
+		name: "partial",
+		collect: func() ([]networkmsg.Metric, error) {
+			return []networkmsg.Metric{
+				networkmsg.CreateGaugeMetrics("Partial", 1),
+				{ID: "Broken", MType: "gauge"},
+				{ID: "Unknown", MType: "summary"},
+			}, fmt.Errorf("source is not available")
+		},
+	}, time.Second))
+	require.NoError(t, registry.Register(&collectorMock{
+		name: "panicking",
+		collect: func() ([]networkmsg.Metric, error) {
+			panic("unexpected")
+		},
+	}, time.Second))
+
+	registry.CollectAll(context.Background())
+	registry.CollectAll(context.Background())
+
+	metrics := untimed(t, registry.Take())
+	require.Len(t, metrics, 5)
+	assert.Equal(t, networkmsg.CreateCounterMetrics("Delta", 3), metrics[0])
+	assert.Equal(t, networkmsg.CreateCumulativeCounterMetrics("Total", 20), metrics[1])
+	assert.Equal(t, networkmsg.CreateGaugeMetrics("Gauge", 2), metrics[2])
+	assert.Equal(t, networkmsg.CreateGaugeMetrics("Partial", 1), metrics[3])
+	assert.Equal(t, networkmsg.CreateHistogramMetrics("Latency", createHistogram(t, 1, 2)), metrics[4])
+
+	// accumulated metrics are moved out, undelivered ones are merged back.
+	metrics = registry.Take()
+	require.Len(t, metrics, 3)
+	registry.Return(metrics)
+	registry.Return([]networkmsg.Metric{networkmsg.CreateCounterMetrics("Delta", 3)})
+	registry.CollectAll(context.Background())
+
+	metrics = untimed(t, registry.Take())
+	require.Len(t, metrics, 5)
+	assert.Equal(t, networkmsg.CreateCounterMetrics("Delta", 6), metrics[0])
+	assert.Equal(t, networkmsg.CreateGaugeMetrics("Gauge", 3), metrics[2])
+	assert.Equal(t, networkmsg.CreateHistogramMetrics("Latency", createHistogram(t, 3)), metrics[4])
+}
+
+func TestRegistry_CollectTimestamp(t *testing.T) {
+	registry := Create(logger.CreateMock())
+
+	explicit := networkmsg.CreateGaugeMetrics("Explicit", 1)
+	explicit.Timestamp = 1000
+	calls := 0
+	require.NoError(t, registry.Register(&collectorMock{
+		name: "values",
+		collect: func() ([]networkmsg.Metric, error) {
+			calls++
+			if calls > 1 {
+				return []networkmsg.Metric{networkmsg.CreateCounterMetrics("Delta", 1)}, nil
+			}
+			return []networkmsg.Metric{
+				explicit,
+				networkmsg.CreateGaugeMetrics("Gauge", 1),
+				networkmsg.CreateCounterMetrics("Delta", 1),
+			}, nil
+		},
+	}, time.Second))
+
+	before := time.Now().UnixMilli()
+	registry.CollectAll(context.Background())
+	collected := time.Now().UnixMilli()
+	time.Sleep(10 * time.Millisecond)
+	registry.CollectAll(context.Background())
+	recollected := time.Now().UnixMilli()
+	time.Sleep(10 * time.Millisecond)
+
+	// metrics keep time of collection rather than time of take, accumulated ones keep the latest collection.
+	metrics := registry.Take()
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "Delta", metrics[0].ID)
+	assert.Greater(t, metrics[0].Timestamp, collected)
+	assert.LessOrEqual(t, metrics[0].Timestamp, recollected)
+	assert.Equal(t, int64(1000), metrics[1].Timestamp)
+	assert.GreaterOrEqual(t, metrics[2].Timestamp, before)
+	assert.LessOrEqual(t, metrics[2].Timestamp, collected)
+}
+
+func TestRegistry_Run(t *testing.T) {
+	registry := Create(logger.CreateMock())
+
+	fast := &collectorMock{name: "fast", collect: func() ([]networkmsg.Metric, error) { return nil, nil }}
+	slow := &collectorMock{name: "slow", collect: func() ([]networkmsg.Metric, error) { return nil, nil }}
+	require.NoError(t, registry.Register(fast, 10*time.Millisecond))
+	require.NoError(t, registry.Register(slow, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	registry.Run(ctx)
+
+	assert.Greater(t, fast.calls.Load(), int64(2))
+	assert.Equal(t, int64(1), slow.calls.Load())
+}
+
+// serviceMock is a collector served in background until context is canceled.
+type serviceMock struct {
+	collectorMock
+	served atomic.Bool
+}
+
+func (s *serviceMock) Serve(ctx context.Context) error {
+	s.served.Store(true)
+	<-ctx.Done()
+	return nil
+}
+
+func TestRegistry_RunService(t *testing.T) {
+	registry := Create(logger.CreateMock())
+
+	service := &serviceMock{collectorMock: collectorMock{name: "service", collect: func() ([]networkmsg.Metric, error) { return nil, nil }}}
+	require.NoError(t, registry.Register(service, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	registry.Run(ctx)
+
+	assert.True(t, service.served.Load())
+	assert.Equal(t, int64(1), service.calls.Load())
+}
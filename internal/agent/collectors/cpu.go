@@ -0,0 +1,97 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/cpu"
+)
+
+// CPUName is a name of CPU collector.
+const CPUName = "cpu"
+
+const (
+	// cpuTotalMetricName is a name of gauge with utilization of all CPUs (percents).
+	cpuTotalMetricName = "CPUutilization1"
+	// cpuCoreMetricName is a name of gauge with utilization of CPU core (percents) labeled by core number.
+	cpuCoreMetricName = "CPUutilization"
+	// cpuLabel is a label name of CPU core number.
+	cpuLabel = "cpu"
+	// cpuTotalKey is a key of aggregated CPU times among previous readings.
+	cpuTotalKey = "total"
+)
+
+// CPU collects utilization of all CPUs and every core over the interval since previous collecting.
+// It doesn't block waiting for measurement, so the first collecting has no results.
+type CPU struct {
+	times    func(ctx context.Context, percpu bool) ([]cpu.TimesStat, error)
+	previous map[string]cpu.TimesStat
+}
+
+// CreateCPU returns a new instance of CPU collector.
+func CreateCPU() *CPU {
+	return &CPU{times: cpu.TimesWithContext, previous: make(map[string]cpu.TimesStat)}
+}
+
+// Name returns name of collector.
+func (c *CPU) Name() string {
+	return CPUName
+}
+
+// Collect reads CPU times and computes utilization from the difference with the previous reading.
+func (c *CPU) Collect(ctx context.Context) ([]networkmsg.Metric, error) {
+	var metrics []networkmsg.Metric
+	var errs []error
+
+	total, err := c.times(ctx, false)
+	if err == nil && len(total) == 0 {
+		err = fmt.Errorf("no data")
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read cpu times: %w", err))
+	} else if value, ok := c.utilization(cpuTotalKey, total[0]); ok {
+		metrics = append(metrics, networkmsg.CreateGaugeMetrics(cpuTotalMetricName, value))
+	}
+
+	cores, err := c.times(ctx, true)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read cpu cores times: %w", err))
+	}
+	for _, times := range cores {
+		if value, ok := c.utilization(times.CPU, times); ok {
+			metric := networkmsg.CreateGaugeMetrics(cpuCoreMetricName, value)
+			metric.Labels = map[string]string{cpuLabel: strings.TrimPrefix(times.CPU, "cpu")}
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// utilization returns percent of busy time since previous reading with the same key and keeps current reading.
+// Returns false if there is no previous reading or time didn't pass.
+func (c *CPU) utilization(key string, times cpu.TimesStat) (float64, bool) {
+	previous, ok := c.previous[key]
+	c.previous[key] = times
+	if !ok {
+		return 0, false
+	}
+
+	totalDelta := cpuTotal(times) - cpuTotal(previous)
+	idleDelta := times.Idle + times.Iowait - previous.Idle - previous.Iowait
+	if totalDelta <= 0 {
+		return 0, false
+	}
+
+	busy := (totalDelta - idleDelta) / totalDelta * 100
+	return math.Min(math.Max(busy, 0), 100), true
+}
+
+// cpuTotal returns total CPU time. Guest time is skipped because it is already accounted in user time.
+func cpuTotal(times cpu.TimesStat) float64 {
+	return times.User + times.System + times.Idle + times.Nice + times.Iowait + times.Irq + times.Softirq + times.Steal
+}
@@ -0,0 +1,71 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPU_Collect(t *testing.T) {
+	readings := [][]cpu.TimesStat{
+		{
+			{CPU: "cpu-total", User: 10, Idle: 10},
+			{CPU: "cpu0", User: 5, Idle: 5},
+			{CPU: "cpu1", User: 5, Idle: 5},
+		},
+		{
+			{CPU: "cpu-total", User: 15, System: 5, Idle: 15, Iowait: 5},
+			{CPU: "cpu0", User: 10, System: 5, Idle: 5},
+			{CPU: "cpu1", User: 5, Idle: 15, Iowait: 10},
+		},
+	}
+
+	reading := 0
+	collector := &CPU{
+		times: func(_ context.Context, percpu bool) ([]cpu.TimesStat, error) {
+			if percpu {
+				return readings[reading][1:], nil
+			}
+			return readings[reading][:1], nil
+		},
+		previous: make(map[string]cpu.TimesStat),
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	reading++
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	core0 := networkmsg.CreateGaugeMetrics("CPUutilization", 100)
+	core0.Labels = map[string]string{"cpu": "0"}
+	core1 := networkmsg.CreateGaugeMetrics("CPUutilization", 0)
+	core1.Labels = map[string]string{"cpu": "1"}
+	assert.Equal(t, []networkmsg.Metric{networkmsg.CreateGaugeMetrics("CPUutilization1", 50), core0, core1}, metrics)
+
+	// time didn't pass.
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	collector.times = func(context.Context, bool) ([]cpu.TimesStat, error) {
+		return nil, fmt.Errorf("not available")
+	}
+	_, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestCPU_CollectHost(t *testing.T) {
+	collector := CreateCPU()
+	_, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	_, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+}
@@ -0,0 +1,125 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// DiskName is a name of disk collector.
+const DiskName = "disk"
+
+const (
+	// mountpointLabel is a label name of filesystem mount point.
+	mountpointLabel = "mountpoint"
+	// deviceLabel is a label name of block device.
+	deviceLabel = "device"
+)
+
+// Disk collects usage gauges of every mounted physical filesystem labeled by mount point and
+// I/O cumulative counters of every block device labeled by device name.
+type Disk struct {
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+}
+
+// CreateDisk returns a new instance of Disk collector.
+func CreateDisk() *Disk {
+	return &Disk{
+		partitions: disk.PartitionsWithContext,
+		usage:      disk.UsageWithContext,
+		ioCounters: disk.IOCountersWithContext,
+	}
+}
+
+// Name returns name of collector.
+func (c *Disk) Name() string {
+	return DiskName
+}
+
+// Collect reads filesystems usage and block devices I/O stats.
+// Metrics which were read successfully are returned even on error.
+func (c *Disk) Collect(ctx context.Context) ([]networkmsg.Metric, error) {
+	metrics, err := c.collectUsage(ctx)
+	ioMetrics, ioErr := c.collectIO(ctx)
+	return append(metrics, ioMetrics...), errors.Join(err, ioErr)
+}
+
+// collectUsage reads usage of mounted physical filesystems. Filesystem mounted several times is reported once.
+func (c *Disk) collectUsage(ctx context.Context) ([]networkmsg.Metric, error) {
+	partitions, err := c.partitions(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("read partitions: %w", err)
+	}
+
+	var metrics []networkmsg.Metric
+	var errs []error
+	seen := make(map[string]struct{}, len(partitions))
+	for _, partition := range partitions {
+		if _, ok := seen[partition.Mountpoint]; ok {
+			continue
+		}
+		seen[partition.Mountpoint] = struct{}{}
+
+		usage, err := c.usage(ctx, partition.Mountpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read usage of '%s': %w", partition.Mountpoint, err))
+			continue
+		}
+
+		labels := map[string]string{mountpointLabel: partition.Mountpoint}
+		metrics = append(metrics,
+			labeledGauge("DiskTotalBytes", float64(usage.Total), labels),
+			labeledGauge("DiskUsedBytes", float64(usage.Used), labels),
+			labeledGauge("DiskFreeBytes", float64(usage.Free), labels),
+			labeledGauge("DiskUsedPercent", usage.UsedPercent, labels),
+		)
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// collectIO reads I/O stats of block devices.
+func (c *Disk) collectIO(ctx context.Context) ([]networkmsg.Metric, error) {
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read io counters: %w", err)
+	}
+
+	devices := make([]string, 0, len(counters))
+	for device := range counters {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	metrics := make([]networkmsg.Metric, 0, len(devices)*4)
+	for _, device := range devices {
+		stat := counters[device]
+		labels := map[string]string{deviceLabel: device}
+		metrics = append(metrics,
+			labeledCumulativeCounter("DiskReadBytes", stat.ReadBytes, labels),
+			labeledCumulativeCounter("DiskWriteBytes", stat.WriteBytes, labels),
+			labeledCumulativeCounter("DiskReads", stat.ReadCount, labels),
+			labeledCumulativeCounter("DiskWrites", stat.WriteCount, labels),
+		)
+	}
+	return metrics, nil
+}
+
+// labeledGauge creates gauge with labels.
+func labeledGauge(name string, value float64, labels map[string]string) networkmsg.Metric {
+	metric := networkmsg.CreateGaugeMetrics(name, value)
+	metric.Labels = labels
+	return metric
+}
+
+// labeledCumulativeCounter creates cumulative counter with labels.
+func labeledCumulativeCounter(name string, value uint64, labels map[string]string) networkmsg.Metric {
+	metric := networkmsg.CreateCumulativeCounterMetrics(name, int64(value))
+	metric.Labels = labels
+	return metric
+}
@@ -0,0 +1,58 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisk_Collect(t *testing.T) {
+	collector := &Disk{
+		partitions: func(context.Context, bool) ([]disk.PartitionStat, error) {
+			return []disk.PartitionStat{{Mountpoint: "/"}, {Mountpoint: "/"}, {Mountpoint: "/broken"}}, nil
+		},
+		usage: func(_ context.Context, path string) (*disk.UsageStat, error) {
+			if path == "/broken" {
+				return nil, fmt.Errorf("permission denied")
+			}
+			return &disk.UsageStat{Total: 100, Used: 25, Free: 75, UsedPercent: 25}, nil
+		},
+		ioCounters: func(context.Context, ...string) (map[string]disk.IOCountersStat, error) {
+			return map[string]disk.IOCountersStat{
+				"sdb": {ReadBytes: 1, WriteBytes: 2, ReadCount: 3, WriteCount: 4},
+				"sda": {ReadBytes: 5, WriteBytes: 6, ReadCount: 7, WriteCount: 8},
+			}, nil
+		},
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	assert.Error(t, err)
+
+	root := map[string]string{"mountpoint": "/"}
+	sda := map[string]string{"device": "sda"}
+	sdb := map[string]string{"device": "sdb"}
+	assert.Equal(t, []networkmsg.Metric{
+		labeledGauge("DiskTotalBytes", 100, root),
+		labeledGauge("DiskUsedBytes", 25, root),
+		labeledGauge("DiskFreeBytes", 75, root),
+		labeledGauge("DiskUsedPercent", 25, root),
+		labeledCumulativeCounter("DiskReadBytes", 5, sda),
+		labeledCumulativeCounter("DiskWriteBytes", 6, sda),
+		labeledCumulativeCounter("DiskReads", 7, sda),
+		labeledCumulativeCounter("DiskWrites", 8, sda),
+		labeledCumulativeCounter("DiskReadBytes", 1, sdb),
+		labeledCumulativeCounter("DiskWriteBytes", 2, sdb),
+		labeledCumulativeCounter("DiskReads", 3, sdb),
+		labeledCumulativeCounter("DiskWrites", 4, sdb),
+	}, metrics)
+}
+
+func TestDisk_CollectHost(t *testing.T) {
+	assert.NotPanics(t, func() {
+		_, _ = CreateDisk().Collect(context.Background())
+	})
+}
@@ -0,0 +1,41 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/load"
+)
+
+// LoadName is a name of load averages collector.
+const LoadName = "load"
+
+// Load collects host load averages over 1, 5 and 15 minutes. Load averages are not available on Windows.
+type Load struct {
+	avg func(ctx context.Context) (*load.AvgStat, error)
+}
+
+// CreateLoad returns a new instance of Load collector.
+func CreateLoad() *Load {
+	return &Load{avg: load.AvgWithContext}
+}
+
+// Name returns name of collector.
+func (c *Load) Name() string {
+	return LoadName
+}
+
+// Collect reads host load averages.
+func (c *Load) Collect(ctx context.Context) ([]networkmsg.Metric, error) {
+	avg, err := c.avg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read load averages: %w", err)
+	}
+
+	return []networkmsg.Metric{
+		networkmsg.CreateGaugeMetrics("Load1", avg.Load1),
+		networkmsg.CreateGaugeMetrics("Load5", avg.Load5),
+		networkmsg.CreateGaugeMetrics("Load15", avg.Load15),
+	}, nil
+}
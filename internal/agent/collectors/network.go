@@ -0,0 +1,55 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// NetworkName is a name of network collector.
+const NetworkName = "network"
+
+// interfaceLabel is a label name of network interface.
+const interfaceLabel = "interface"
+
+// Network collects traffic, packets, errors and drops cumulative counters of every network interface
+// labeled by interface name.
+type Network struct {
+	ioCounters func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+}
+
+// CreateNetwork returns a new instance of Network collector.
+func CreateNetwork() *Network {
+	return &Network{ioCounters: net.IOCountersWithContext}
+}
+
+// Name returns name of collector.
+func (c *Network) Name() string {
+	return NetworkName
+}
+
+// Collect reads I/O stats of network interfaces.
+func (c *Network) Collect(ctx context.Context) ([]networkmsg.Metric, error) {
+	counters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("read network io counters: %w", err)
+	}
+
+	metrics := make([]networkmsg.Metric, 0, len(counters)*8)
+	for _, stat := range counters {
+		labels := map[string]string{interfaceLabel: stat.Name}
+		metrics = append(metrics,
+			labeledCumulativeCounter("NetBytesSent", stat.BytesSent, labels),
+			labeledCumulativeCounter("NetBytesRecv", stat.BytesRecv, labels),
+			labeledCumulativeCounter("NetPacketsSent", stat.PacketsSent, labels),
+			labeledCumulativeCounter("NetPacketsRecv", stat.PacketsRecv, labels),
+			labeledCumulativeCounter("NetErrorsIn", stat.Errin, labels),
+			labeledCumulativeCounter("NetErrorsOut", stat.Errout, labels),
+			labeledCumulativeCounter("NetDropsIn", stat.Dropin, labels),
+			labeledCumulativeCounter("NetDropsOut", stat.Dropout, labels),
+		)
+	}
+	return metrics, nil
+}
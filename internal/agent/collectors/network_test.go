@@ -0,0 +1,66 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork_Collect(t *testing.T) {
+	collector := &Network{
+		ioCounters: func(context.Context, bool) ([]net.IOCountersStat, error) {
+			return []net.IOCountersStat{
+				{Name: "eth0", BytesSent: 1, BytesRecv: 2, PacketsSent: 3, PacketsRecv: 4, Errin: 5, Errout: 6, Dropin: 7, Dropout: 8},
+			}, nil
+		},
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	eth0 := map[string]string{"interface": "eth0"}
+	assert.Equal(t, []networkmsg.Metric{
+		labeledCumulativeCounter("NetBytesSent", 1, eth0),
+		labeledCumulativeCounter("NetBytesRecv", 2, eth0),
+		labeledCumulativeCounter("NetPacketsSent", 3, eth0),
+		labeledCumulativeCounter("NetPacketsRecv", 4, eth0),
+		labeledCumulativeCounter("NetErrorsIn", 5, eth0),
+		labeledCumulativeCounter("NetErrorsOut", 6, eth0),
+		labeledCumulativeCounter("NetDropsIn", 7, eth0),
+		labeledCumulativeCounter("NetDropsOut", 8, eth0),
+	}, metrics)
+
+	collector.ioCounters = func(context.Context, bool) ([]net.IOCountersStat, error) {
+		return nil, fmt.Errorf("not available")
+	}
+	_, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestLoad_Collect(t *testing.T) {
+	collector := &Load{
+		avg: func(context.Context) (*load.AvgStat, error) {
+			return &load.AvgStat{Load1: 1, Load5: 0.5, Load15: 0.25}, nil
+		},
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []networkmsg.Metric{
+		networkmsg.CreateGaugeMetrics("Load1", 1),
+		networkmsg.CreateGaugeMetrics("Load5", 0.5),
+		networkmsg.CreateGaugeMetrics("Load15", 0.25),
+	}, metrics)
+
+	collector.avg = func(context.Context) (*load.AvgStat, error) {
+		return nil, fmt.Errorf("not implemented")
+	}
+	_, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,281 @@
+package collectors
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/erupshis/metrics/internal/agent/config"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessName is a name of processes collector.
+const ProcessName = "process"
+
+const (
+	// processLabel is a label name of process target.
+	processLabel = "process"
+	// cgroupRoot is a mount point of control groups hierarchy.
+	cgroupRoot = "/sys/fs/cgroup"
+)
+
+// processStats reads stats of the process, implemented by process.Process.
+type processStats interface {
+	MemoryInfoWithContext(ctx context.Context) (*process.MemoryInfoStat, error)
+	TimesWithContext(ctx context.Context) (*cpu.TimesStat, error)
+	NumFDsWithContext(ctx context.Context) (int32, error)
+	NumThreadsWithContext(ctx context.Context) (int32, error)
+	IOCountersWithContext(ctx context.Context) (*process.IOCountersStat, error)
+}
+
+// Process collects stats of watched processes summed over processes of every target and labeled by target name:
+// count of processes, resident memory, open file descriptors and threads as gauges, CPU time and I/O bytes as
+// cumulative counters. Processes which exit between collectings decrease cumulative counters, server treats it as reset.
+type Process struct {
+	targets []config.ProcessTarget
+
+	pids       func(ctx context.Context) ([]int32, error)
+	name       func(ctx context.Context, pid int32) (string, error)
+	open       func(ctx context.Context, pid int32) (processStats, error)
+	readFile   func(name string) ([]byte, error)
+	cgroupRoot string
+}
+
+// CreateProcess returns a new instance of Process collector watching targets.
+func CreateProcess(targets []config.ProcessTarget) *Process {
+	return &Process{
+		targets: targets,
+		pids:    process.PidsWithContext,
+		name: func(ctx context.Context, pid int32) (string, error) {
+			p, err := process.NewProcessWithContext(ctx, pid)
+			if err != nil {
+				return "", err
+			}
+			return p.NameWithContext(ctx)
+		},
+		open: func(ctx context.Context, pid int32) (processStats, error) {
+			return process.NewProcessWithContext(ctx, pid)
+		},
+		readFile:   os.ReadFile,
+		cgroupRoot: cgroupRoot,
+	}
+}
+
+// Name returns name of collector.
+func (c *Process) Name() string {
+	return ProcessName
+}
+
+// Collect reads stats of processes of every target. Stats which were read successfully are returned even on error.
+func (c *Process) Collect(ctx context.Context) ([]networkmsg.Metric, error) {
+	var metrics []networkmsg.Metric
+	var errs []error
+
+	names := processNames{collector: c}
+	for _, target := range c.targets {
+		pids, err := c.resolve(ctx, target, &names)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve process target '%s': %w", target.Name, err))
+			continue
+		}
+
+		targetMetrics, err := c.collectTarget(ctx, target.Name, pids)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read process target '%s': %w", target.Name, err))
+		}
+		metrics = append(metrics, targetMetrics...)
+	}
+	return metrics, errors.Join(errs...)
+}
+
+// resolve returns PIDs of target processes.
+func (c *Process) resolve(ctx context.Context, target config.ProcessTarget, names *processNames) ([]int32, error) {
+	switch {
+	case target.PIDFile != "":
+		data, err := c.readFile(target.PIDFile)
+		if err != nil {
+			return nil, err
+		}
+		pid, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse pid file '%s': %w", target.PIDFile, err)
+		}
+		return []int32{int32(pid)}, nil
+
+	case target.Pattern != "":
+		all, err := names.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var pids []int32
+		for _, p := range all {
+			if ok, _ := path.Match(target.Pattern, p.name); ok {
+				pids = append(pids, p.pid)
+			}
+		}
+		return pids, nil
+
+	case target.Cgroup != "":
+		data, err := c.readFile(filepath.Join(c.cgroupRoot, filepath.Clean("/"+target.Cgroup), "cgroup.procs"))
+		if err != nil {
+			return nil, err
+		}
+		return parsePIDs(data)
+
+	default:
+		return nil, fmt.Errorf("missing selector")
+	}
+}
+
+// Stats of target processes in reporting order.
+var (
+	processGauges   = []string{"ProcessRSSBytes", "ProcessOpenFDs", "ProcessThreads"}
+	processCounters = []string{"ProcessCPUMilliseconds", "ProcessReadBytes", "ProcessWriteBytes"}
+)
+
+// processSums accumulates stats of target processes. Stat is reported if it was read for at least one process.
+type processSums struct {
+	values map[string]float64
+	read   map[string]bool
+	errs   []error
+	failed map[string]bool
+}
+
+// add sums stat value.
+func (s *processSums) add(stat string, value float64) {
+	s.values[stat] += value
+	s.read[stat] = true
+}
+
+// fail keeps the first error of the stat.
+func (s *processSums) fail(stat string, err error) {
+	if !s.failed[stat] {
+		s.failed[stat] = true
+		s.errs = append(s.errs, fmt.Errorf("%s: %w", stat, err))
+	}
+}
+
+// collectTarget reads stats of target processes and sums them. Processes which exited are skipped.
+func (c *Process) collectTarget(ctx context.Context, name string, pids []int32) ([]networkmsg.Metric, error) {
+	sums := processSums{values: map[string]float64{}, read: map[string]bool{}, failed: map[string]bool{}}
+	count := 0
+	for _, pid := range pids {
+		p, err := c.open(ctx, pid)
+		if err != nil {
+			if !errors.Is(err, process.ErrorProcessNotRunning) {
+				sums.fail("open", err)
+			}
+			continue
+		}
+		count++
+
+		if memory, err := p.MemoryInfoWithContext(ctx); err != nil {
+			sums.fail("ProcessRSSBytes", err)
+		} else {
+			sums.add("ProcessRSSBytes", float64(memory.RSS))
+		}
+
+		if fds, err := p.NumFDsWithContext(ctx); err != nil {
+			sums.fail("ProcessOpenFDs", err)
+		} else {
+			sums.add("ProcessOpenFDs", float64(fds))
+		}
+
+		if threads, err := p.NumThreadsWithContext(ctx); err != nil {
+			sums.fail("ProcessThreads", err)
+		} else {
+			sums.add("ProcessThreads", float64(threads))
+		}
+
+		if times, err := p.TimesWithContext(ctx); err != nil {
+			sums.fail("ProcessCPUMilliseconds", err)
+		} else {
+			sums.add("ProcessCPUMilliseconds", (times.User+times.System)*1000)
+		}
+
+		if io, err := p.IOCountersWithContext(ctx); err != nil {
+			sums.fail("ProcessIO", err)
+		} else {
+			sums.add("ProcessReadBytes", float64(io.ReadBytes))
+			sums.add("ProcessWriteBytes", float64(io.WriteBytes))
+		}
+	}
+
+	labels := map[string]string{processLabel: name}
+	metrics := []networkmsg.Metric{labeledGauge("ProcessCount", float64(count), labels)}
+	for _, stat := range processGauges {
+		if sums.read[stat] {
+			metrics = append(metrics, labeledGauge(stat, sums.values[stat], labels))
+		}
+	}
+	for _, stat := range processCounters {
+		if sums.read[stat] {
+			metrics = append(metrics, labeledCumulativeCounter(stat, uint64(sums.values[stat]), labels))
+		}
+	}
+	return metrics, errors.Join(sums.errs...)
+}
+
+// processName is a name of running process.
+type processName struct {
+	pid  int32
+	name string
+}
+
+// processNames lists names of running processes once per collecting.
+type processNames struct {
+	collector *Process
+	names     []processName
+	listed    bool
+}
+
+// get returns names of running processes. Processes which exited during listing are skipped.
+func (n *processNames) get(ctx context.Context) ([]processName, error) {
+	if n.listed {
+		return n.names, nil
+	}
+
+	pids, err := n.collector.pids(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list processes: %w", err)
+	}
+
+	for _, pid := range pids {
+		name, err := n.collector.name(ctx, pid)
+		if err != nil {
+			continue
+		}
+		n.names = append(n.names, processName{pid: pid, name: name})
+	}
+	n.listed = true
+	return n.names, nil
+}
+
+// parsePIDs parses PIDs listed one per line.
+func parsePIDs(data []byte) ([]int32, error) {
+	var pids []int32
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		pid, err := strconv.ParseInt(line, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parse pid '%s': %w", line, err)
+		}
+		pids = append(pids, int32(pid))
+	}
+	return pids, scanner.Err()
+}
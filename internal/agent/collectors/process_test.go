@@ -0,0 +1,123 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/agent/config"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processMock returns stats derived from PID, IO counters are not available for odd PIDs.
+type processMock struct {
+	pid int32
+}
+
+func (p processMock) MemoryInfoWithContext(context.Context) (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: uint64(p.pid) * 1000}, nil
+}
+
+func (p processMock) TimesWithContext(context.Context) (*cpu.TimesStat, error) {
+	return &cpu.TimesStat{User: float64(p.pid), System: 0.5}, nil
+}
+
+func (p processMock) NumFDsWithContext(context.Context) (int32, error) {
+	return p.pid, nil
+}
+
+func (p processMock) NumThreadsWithContext(context.Context) (int32, error) {
+	return 2, nil
+}
+
+func (p processMock) IOCountersWithContext(context.Context) (*process.IOCountersStat, error) {
+	if p.pid%2 == 1 {
+		return nil, fmt.Errorf("permission denied")
+	}
+	return &process.IOCountersStat{ReadBytes: uint64(p.pid), WriteBytes: uint64(p.pid) * 2}, nil
+}
+
+func TestProcess_Collect(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db.pid"), []byte("10\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pid"), []byte("db"), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "cgroup", "app.slice"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cgroup", "app.slice", "cgroup.procs"), []byte("20\n21\n99\n"), 0600))
+
+	names := map[int32]string{10: "postgres", 20: "nginx", 21: "nginx", 30: "sshd"}
+	listings := 0
+	collector := CreateProcess([]config.ProcessTarget{
+		{Name: "db", PIDFile: filepath.Join(dir, "db.pid")},
+		{Name: "web", Pattern: "ngin?"},
+		{Name: "app", Cgroup: "app.slice"},
+		{Name: "none", Pattern: "missing*"},
+		{Name: "broken", PIDFile: filepath.Join(dir, "broken.pid")},
+	})
+	collector.cgroupRoot = filepath.Join(dir, "cgroup")
+	collector.pids = func(context.Context) ([]int32, error) {
+		listings++
+		return []int32{10, 20, 21, 30}, nil
+	}
+	collector.name = func(_ context.Context, pid int32) (string, error) {
+		return names[pid], nil
+	}
+	collector.open = func(_ context.Context, pid int32) (processStats, error) {
+		if _, ok := names[pid]; !ok {
+			return nil, process.ErrorProcessNotRunning
+		}
+		return processMock{pid: pid}, nil
+	}
+
+	metrics, err := collector.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 1, listings)
+
+	web := map[string]string{"process": "web"}
+	want := []networkmsg.Metric{
+		labeledGauge("ProcessCount", 2, web),
+		labeledGauge("ProcessRSSBytes", 41000, web),
+		labeledGauge("ProcessOpenFDs", 41, web),
+		labeledGauge("ProcessThreads", 4, web),
+		labeledCumulativeCounter("ProcessCPUMilliseconds", 42000, web),
+		labeledCumulativeCounter("ProcessReadBytes", 20, web),
+		labeledCumulativeCounter("ProcessWriteBytes", 40, web),
+	}
+	got := map[string][]networkmsg.Metric{}
+	for _, metric := range metrics {
+		got[metric.Labels["process"]] = append(got[metric.Labels["process"]], metric)
+	}
+
+	assert.Equal(t, want, got["web"])
+	// cgroup contains the same processes as pattern and one exited process.
+	assert.Len(t, got["app"], len(want))
+	assert.Equal(t, labeledGauge("ProcessCount", 2, map[string]string{"process": "app"}), got["app"][0])
+	assert.Equal(t, []networkmsg.Metric{labeledGauge("ProcessCount", 0, map[string]string{"process": "none"})}, got["none"])
+	assert.Len(t, got["db"], len(want))
+	assert.Empty(t, got["broken"])
+}
+
+func TestProcess_CollectSelf(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "agent.pid")
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0600))
+
+	metrics, _ := CreateProcess([]config.ProcessTarget{{Name: "agent", PIDFile: pidFile}}).Collect(context.Background())
+	require.NotEmpty(t, metrics)
+	assert.Equal(t, labeledGauge("ProcessCount", 1, map[string]string{"process": "agent"}), metrics[0])
+}
+
+func TestParsePIDs(t *testing.T) {
+	pids, err := parsePIDs([]byte("1\n 2 \n\n3\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []int32{1, 2, 3}, pids)
+
+	_, err = parsePIDs([]byte("1\nabc\n"))
+	assert.Error(t, err)
+}
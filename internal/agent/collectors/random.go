@@ -0,0 +1,29 @@
+package collectors
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+// RandomName is a name of random collector.
+const RandomName = "random"
+
+// Random collects gauge with random value, it is useful for checking delivery of metrics.
+type Random struct{}
+
+// CreateRandom returns a new instance of Random collector.
+func CreateRandom() *Random {
+	return &Random{}
+}
+
+// Name returns name of collector.
+func (c *Random) Name() string {
+	return RandomName
+}
+
+// Collect returns gauge with random value.
+func (c *Random) Collect(_ context.Context) ([]networkmsg.Metric, error) {
+	return []networkmsg.Metric{networkmsg.CreateGaugeMetrics("RandomValue", rand.Float64())}, nil
+}
@@ -1,33 +1,29 @@
-// Package metricsgetter provides functionality to get  application's runtime and extra stats.
-//
-// Consists of maps with callback functions.
-package metricsgetter
+package collectors
 
 import (
+	"context"
 	"runtime"
 	"time"
 
-	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/networkmsg"
 )
 
-// GaugeMetricsGetter is map with callback functions as values.
-// Callbacks return float64 value.
-//
-// Example of use:
-//
-//	 type Metric struct {
-//			name string
-//			value float64
-//		}
-//
-//		var stats runtime.MemStats
-//		runtime.ReadMemStats(&stats)
-//		var metrics []Metric
-//		for name, valueGetter := range GaugeMetricsGetter {
-//			metrics = append(metrics, Metric{name, valueGetter(&a.stats)})
-//		}
-var GaugeMetricsGetter = map[string]func(stats *runtime.MemStats) float64{
+// RuntimeName is a name of runtime collector.
+const RuntimeName = "runtime"
+
+const (
+	// pollCountMetricName is a name of cumulative counter of runtime stats readings.
+	pollCountMetricName = "PollCount"
+	// gcPauseMetricName is a name of histogram metric with GC pauses durations (seconds).
+	gcPauseMetricName = "GCPauseSeconds"
+)
+
+// gcPauseBounds defines buckets upper bounds of GC pauses histogram (seconds).
+var gcPauseBounds = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1}
+
+// memStatsGauges maps gauge names on getters of their values from runtime.MemStats.
+var memStatsGauges = map[string]func(stats *runtime.MemStats) float64{
 	"Alloc":         func(stats *runtime.MemStats) float64 { return float64(stats.Alloc) },
 	"BuckHashSys":   func(stats *runtime.MemStats) float64 { return float64(stats.BuckHashSys) },
 	"Frees":         func(stats *runtime.MemStats) float64 { return float64(stats.Frees) },
@@ -57,53 +53,53 @@ var GaugeMetricsGetter = map[string]func(stats *runtime.MemStats) float64{
 	"TotalAlloc":    func(stats *runtime.MemStats) float64 { return float64(stats.TotalAlloc) },
 }
 
-// ExtraStats stores extra stats.
-type ExtraStats struct {
-	Data map[string]float64
+// Runtime collects Go runtime memory stats gauges, histogram of GC pauses happened since previous
+// collecting and cumulative counter of collectings.
+type Runtime struct {
+	stats     runtime.MemStats
+	lastNumGC uint32
+	pollCount int64
+}
+
+// CreateRuntime returns a new instance of Runtime collector.
+func CreateRuntime() *Runtime {
+	return &Runtime{}
+}
+
+// Name returns name of collector.
+func (c *Runtime) Name() string {
+	return RuntimeName
+}
+
+// Collect reads runtime stats.
+func (c *Runtime) Collect(_ context.Context) ([]networkmsg.Metric, error) {
+	runtime.ReadMemStats(&c.stats)
+	c.pollCount++
+
+	metrics := make([]networkmsg.Metric, 0, len(memStatsGauges)+2)
+	for name, valueGetter := range memStatsGauges {
+		metrics = append(metrics, networkmsg.CreateGaugeMetrics(name, valueGetter(&c.stats)))
+	}
+
+	metrics = append(metrics, networkmsg.CreateCumulativeCounterMetrics(pollCountMetricName, c.pollCount))
+	metrics = append(metrics, networkmsg.CreateHistogramMetrics(gcPauseMetricName, c.observeGCPauses()))
+	return metrics, nil
 }
 
-// AdditionalGaugeMetricsGetter is map with callback functions as values.
-// Callbacks return float64 value and error.
-//
-// Example of use:
-//
-//	 type Metric struct {
-//			name string
-//			value float64
-//		}
-//
-//		var metrics []Metric
-//		for name, valueGetter := range AdditionalGaugeMetricsGetter {
-//			metricVal,err := valueGetter()
-//			if err != nil {
-//				//Handle error
-//			}
-//			metrics = append(metrics, Metric{name, metricVal})
-//		}
-var AdditionalGaugeMetricsGetter = map[string]func() (float64, error){
-	"TotalMemory": func() (float64, error) {
-		vm, err := mem.VirtualMemory()
-		if err != nil {
-			return 0., err
-		}
+// observeGCPauses returns histogram of GC pauses happened since previous stats reading.
+// runtime.MemStats keeps only last 256 pauses, older ones are skipped.
+func (c *Runtime) observeGCPauses() *histogram.Histogram {
+	gcPauses, _ := histogram.New(gcPauseBounds)
 
-		totalMemory := vm.Total
-		return float64(totalMemory), nil
-	},
-	"FreeMemory": func() (float64, error) {
-		vm, err := mem.VirtualMemory()
-		if err != nil {
-			return 0., err
-		}
+	pausesCount := uint32(len(c.stats.PauseNs))
+	first := c.lastNumGC
+	if c.stats.NumGC-first > pausesCount {
+		first = c.stats.NumGC - pausesCount
+	}
 
-		freeMemory := vm.Free
-		return float64(freeMemory), nil
-	},
-	"CPUutilization1": func() (float64, error) {
-		cpuPercentages, err := cpu.Percent(time.Second, false)
-		if err != nil {
-			return 0., err
-		}
-		return cpuPercentages[0], nil
-	},
+	for n := first; n < c.stats.NumGC; n++ {
+		gcPauses.Observe(float64(c.stats.PauseNs[n%pausesCount]) / float64(time.Second))
+	}
+	c.lastNumGC = c.stats.NumGC
+	return gcPauses
 }
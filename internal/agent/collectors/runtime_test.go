@@ -0,0 +1,62 @@
+package collectors
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemStatsGauges(t *testing.T) {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+
+	assert.Equal(t, float64(stats.Alloc), memStatsGauges["Alloc"](&stats))
+	assert.Equal(t, float64(stats.BuckHashSys), memStatsGauges["BuckHashSys"](&stats))
+	assert.Equal(t, float64(stats.Frees), memStatsGauges["Frees"](&stats))
+	assert.Equal(t, stats.GCCPUFraction, memStatsGauges["GCCPUFraction"](&stats))
+	assert.Equal(t, float64(stats.GCSys), memStatsGauges["GCSys"](&stats))
+	assert.Equal(t, float64(stats.HeapAlloc), memStatsGauges["HeapAlloc"](&stats))
+	assert.Equal(t, float64(stats.HeapIdle), memStatsGauges["HeapIdle"](&stats))
+	assert.Equal(t, float64(stats.HeapInuse), memStatsGauges["HeapInuse"](&stats))
+	assert.Equal(t, float64(stats.HeapObjects), memStatsGauges["HeapObjects"](&stats))
+	assert.Equal(t, float64(stats.HeapReleased), memStatsGauges["HeapReleased"](&stats))
+	assert.Equal(t, float64(stats.HeapSys), memStatsGauges["HeapSys"](&stats))
+	assert.Equal(t, float64(stats.LastGC), memStatsGauges["LastGC"](&stats))
+	assert.Equal(t, float64(stats.Lookups), memStatsGauges["Lookups"](&stats))
+	assert.Equal(t, float64(stats.MCacheInuse), memStatsGauges["MCacheInuse"](&stats))
+	assert.Equal(t, float64(stats.MCacheSys), memStatsGauges["MCacheSys"](&stats))
+	assert.Equal(t, float64(stats.MSpanInuse), memStatsGauges["MSpanInuse"](&stats))
+	assert.Equal(t, float64(stats.MSpanSys), memStatsGauges["MSpanSys"](&stats))
+	assert.Equal(t, float64(stats.OtherSys), memStatsGauges["OtherSys"](&stats))
+}
+
+func TestRuntime_Collect(t *testing.T) {
+	collector := CreateRuntime()
+
+	metrics, err := collector.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metrics, len(memStatsGauges)+2)
+
+	runtime.GC()
+	runtime.GC()
+	metrics, err = collector.Collect(context.Background())
+	require.NoError(t, err)
+
+	found := 0
+	for _, metric := range metrics {
+		switch metric.ID {
+		case pollCountMetricName:
+			found++
+			assert.Equal(t, networkmsg.CreateCumulativeCounterMetrics(pollCountMetricName, 2), metric)
+		case gcPauseMetricName:
+			found++
+			assert.GreaterOrEqual(t, metric.Histogram.Count, uint64(2))
+			assert.Equal(t, gcPauseBounds, metric.Histogram.Bounds)
+		}
+	}
+	assert.Equal(t, 2, found)
+}
@@ -0,0 +1,58 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// SystemName is a name of system collector.
+const SystemName = "system"
+
+// System collects host memory and swap gauges.
+type System struct {
+	virtualMemory func(ctx context.Context) (*mem.VirtualMemoryStat, error)
+	swapMemory    func(ctx context.Context) (*mem.SwapMemoryStat, error)
+}
+
+// CreateSystem returns a new instance of System collector.
+func CreateSystem() *System {
+	return &System{virtualMemory: mem.VirtualMemoryWithContext, swapMemory: mem.SwapMemoryWithContext}
+}
+
+// Name returns name of collector.
+func (c *System) Name() string {
+	return SystemName
+}
+
+// Collect reads host memory and swap stats. Metrics which were read successfully are returned even on error.
+func (c *System) Collect(ctx context.Context) ([]networkmsg.Metric, error) {
+	var metrics []networkmsg.Metric
+	var errs []error
+
+	vm, err := c.virtualMemory(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read virtual memory: %w", err))
+	} else {
+		metrics = append(metrics,
+			networkmsg.CreateGaugeMetrics("TotalMemory", float64(vm.Total)),
+			networkmsg.CreateGaugeMetrics("FreeMemory", float64(vm.Free)),
+		)
+	}
+
+	swap, err := c.swapMemory(ctx)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("read swap memory: %w", err))
+	} else {
+		metrics = append(metrics,
+			networkmsg.CreateGaugeMetrics("TotalSwap", float64(swap.Total)),
+			networkmsg.CreateGaugeMetrics("UsedSwap", float64(swap.Used)),
+			networkmsg.CreateGaugeMetrics("FreeSwap", float64(swap.Free)),
+		)
+	}
+
+	return metrics, errors.Join(errs...)
+}
@@ -0,0 +1,44 @@
+package collectors
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystem_Collect(t *testing.T) {
+	metrics, err := CreateSystem().Collect(context.Background())
+	require.NoError(t, err)
+
+	var names []string
+	for _, metric := range metrics {
+		names = append(names, metric.ID)
+	}
+	assert.Equal(t, []string{"TotalMemory", "FreeMemory", "TotalSwap", "UsedSwap", "FreeSwap"}, names)
+
+	collector := &System{
+		virtualMemory: func(context.Context) (*mem.VirtualMemoryStat, error) { return nil, fmt.Errorf("not available") },
+		swapMemory: func(context.Context) (*mem.SwapMemoryStat, error) {
+			return &mem.SwapMemoryStat{Total: 3, Used: 1, Free: 2}, nil
+		},
+	}
+	metrics, err = collector.Collect(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, []networkmsg.Metric{
+		networkmsg.CreateGaugeMetrics("TotalSwap", 3),
+		networkmsg.CreateGaugeMetrics("UsedSwap", 1),
+		networkmsg.CreateGaugeMetrics("FreeSwap", 2),
+	}, metrics)
+}
+
+func TestRandom_Collect(t *testing.T) {
+	metrics, err := CreateRandom().Collect(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "RandomValue", metrics[0].ID)
+}
@@ -6,9 +6,12 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env"
+	"github.com/erupshis/metrics/internal/agent/identity"
 	"github.com/erupshis/metrics/internal/configutils"
 )
 
@@ -25,6 +28,57 @@ type Config struct {
 	CACertRSA      string        `json:"ca_crypto_cert"`  // CertRSA public certificate for connection.
 	RealIP         string        `json:"real_ip"`         // RealIP for client-server CIDR validation.
 	ClientType     string        `json:"client_type"`     // ClientType client type(http, grpc).
+	AgentID        string        `json:"agent_id"`        // AgentID stable agent identifier sent in header (metadata) of every report.
+	AgentIDPath    string        `json:"agent_id_path"`   // AgentIDPath file to persist generated agent identifier (user config dir by default).
+	AgentLabel     bool          `json:"agent_label"`     // AgentLabel adds 'agent' label with AgentID to every reported series.
+
+	Collectors map[string]CollectorConfig `json:"collectors"` // Collectors settings of metrics collectors by collector name.
+	Processes  []ProcessTarget            `json:"processes"`  // Processes watched by process collector.
+
+	StatsDAddress string `json:"statsd_address"` // StatsDAddress local UDP/TCP address of StatsD listener, disabled if empty.
+
+	OutboxPath    string        `json:"outbox_path"`     // OutboxPath directory to spool undelivered batches, disabled if empty.
+	OutboxMaxSize int64         `json:"outbox_max_size"` // OutboxMaxSize max total size of spooled batches (bytes).
+	OutboxMaxAge  time.Duration `json:"outbox_max_age"`  // OutboxMaxAge max age of spooled batches.
+
+	ClientCert string `json:"client_cert"` // ClientCert agent's certificate for mutual TLS verified by CACertRSA of server (empty - mTLS is off).
+	ClientKey  string `json:"client_key"`  // ClientKey private key of ClientCert.
+}
+
+// CollectorConfig stores settings of the metrics collector. Collectors are enabled by default.
+type CollectorConfig struct {
+	Disabled bool          `json:"disabled"` // Disabled switches collector off.
+	Interval time.Duration `json:"interval"` // Interval of collecting, poll interval is used if not set.
+}
+
+// ProcessTarget describes group of processes watched by agent. Exactly one selector should be set.
+type ProcessTarget struct {
+	Name    string `json:"name"`     // Name of target reported in 'process' label.
+	PIDFile string `json:"pid_file"` // PIDFile selects process by file with its PID.
+	Pattern string `json:"pattern"`  // Pattern selects processes by shell pattern of their names.
+	Cgroup  string `json:"cgroup"`   // Cgroup selects processes of control group by its path.
+}
+
+// Validate checks that target has name and exactly one valid selector.
+func (t ProcessTarget) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("process target has empty name")
+	}
+
+	selectors := 0
+	for _, selector := range []string{t.PIDFile, t.Pattern, t.Cgroup} {
+		if selector != "" {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		return fmt.Errorf("process target '%s' should have exactly one of pid file, pattern or cgroup", t.Name)
+	}
+
+	if _, err := path.Match(t.Pattern, ""); err != nil {
+		return fmt.Errorf("process target '%s' has malformed pattern: %w", t.Name, err)
+	}
+	return nil
 }
 
 // ConfigDefault create default settings config. For debug use only.
@@ -37,10 +91,14 @@ var ConfigDefault = Config{
 	CertRSA:        "rsa/cert.pem",
 	CACertRSA:      "rsa/ca_cert.pem",
 	ClientType:     "grpc",
+	OutboxMaxSize:  64 << 20,
+	OutboxMaxAge:   24 * time.Hour,
 }
 
 // Parse handling and reading settings from agent's launch flags and then environments,
 // validates Host param and adds 'http://' prefix if missing.
+// Generates and persists agent identifier if it is not set. Identifier is persisted in the user config directory
+// if the file path is not set.
 func Parse() (Config, error) {
 	var config = ConfigDefault
 	if err := configutils.CheckConfigFile(&config); err != nil {
@@ -55,12 +113,29 @@ func Parse() (Config, error) {
 
 	config.Host = configutils.AddHTTPPrefixIfNeed(config.Host)
 
+	for _, target := range config.Processes {
+		if err := target.Validate(); err != nil {
+			return config, fmt.Errorf("parse config: %w", err)
+		}
+	}
+
 	realIP, err := getRealIPAddr()
 	if err != nil {
 		return config, fmt.Errorf("real ip identification: %w", err)
 	}
 
 	config.RealIP = realIP
+
+	if config.AgentIDPath == "" {
+		config.AgentIDPath = identity.DefaultPath()
+	}
+
+	agentID, err := identity.Resolve(config.AgentID, config.AgentIDPath)
+	if err != nil {
+		return config, fmt.Errorf("agent id identification: %w", err)
+	}
+
+	config.AgentID = agentID
 	return config, nil
 }
 
@@ -70,9 +145,20 @@ const (
 	flagPollInterval   = "p"
 	flagRateLimit      = "l"
 	flagKey            = "k"
-	flagCertRSA        = "crypto-key"    // flagCertRSA public connection key.
-	flagCACertRSA      = "ca-crypto-key" // flagCACertRSA public connection ca cert.
-	flagClientType     = "client"        // flagClientType client type
+	flagCertRSA        = "crypto-key"      // flagCertRSA public connection key.
+	flagCACertRSA      = "ca-crypto-key"   // flagCACertRSA public connection ca cert.
+	flagClientType     = "client"          // flagClientType client type
+	flagAgentID        = "agent-id"        // flagAgentID agent identifier.
+	flagAgentIDPath    = "agent-id-path"   // flagAgentIDPath file to persist generated agent identifier.
+	flagAgentLabel     = "agent-label"     // flagAgentLabel adds agent label to reported series.
+	flagCollectors     = "collectors"      // flagCollectors collectors settings.
+	flagProcesses      = "processes"       // flagProcesses processes watched by agent.
+	flagStatsDAddress  = "statsd"          // flagStatsDAddress StatsD listener address.
+	flagOutboxPath     = "outbox"          // flagOutboxPath directory to spool undelivered batches.
+	flagOutboxMaxSize  = "outbox-max-size" // flagOutboxMaxSize max total size of spooled batches.
+	flagOutboxMaxAge   = "outbox-max-age"  // flagOutboxMaxAge max age of spooled batches.
+	flagClientCert     = "client-cert"     // flagClientCert agent's certificate for mutual TLS.
+	flagClientKey      = "client-key"      // flagClientKey private key of agent's certificate.
 )
 
 func checkFlags(config *Config) {
@@ -84,6 +170,31 @@ func checkFlags(config *Config) {
 	flag.StringVar(&config.CertRSA, flagCertRSA, config.CertRSA, "public RSA key path")
 	flag.StringVar(&config.CACertRSA, flagCACertRSA, config.CACertRSA, "public RSA CA cert path")
 	flag.StringVar(&config.ClientType, flagClientType, config.ClientType, "client type (grpc, http)")
+	flag.StringVar(&config.AgentID, flagAgentID, config.AgentID, "agent identifier (hostname with generated UUID by default)")
+	flag.StringVar(&config.AgentIDPath, flagAgentIDPath, config.AgentIDPath, "file to persist generated agent identifier (user config directory by default)")
+	flag.BoolVar(&config.AgentLabel, flagAgentLabel, config.AgentLabel, "add 'agent' label with agent identifier to every reported series")
+	flag.StringVar(&config.StatsDAddress, flagStatsDAddress, config.StatsDAddress, "StatsD listener address (UDP and TCP), e.g. '127.0.0.1:8125', disabled if empty")
+	flag.StringVar(&config.OutboxPath, flagOutboxPath, config.OutboxPath, "directory to spool undelivered batches, disabled if empty")
+	flag.Int64Var(&config.OutboxMaxSize, flagOutboxMaxSize, config.OutboxMaxSize, "max total size of spooled batches (bytes)")
+	flag.DurationVar(&config.OutboxMaxAge, flagOutboxMaxAge, config.OutboxMaxAge, "max age of spooled batches")
+	flag.StringVar(&config.ClientCert, flagClientCert, config.ClientCert, "agent's certificate path for mutual TLS, disabled if empty")
+	flag.StringVar(&config.ClientKey, flagClientKey, config.ClientKey, "agent's certificate private key path")
+	flag.Func(flagCollectors, "collectors settings, e.g. 'runtime=5s,system=off,random=on'", func(value string) error {
+		collectors, err := ParseCollectors(value, config.Collectors)
+		if err != nil {
+			return err
+		}
+		config.Collectors = collectors
+		return nil
+	})
+	flag.Func(flagProcesses, "watched processes, e.g. 'db=pidfile:/run/db.pid,web=pattern:nginx*,app=cgroup:/system.slice/app.service'", func(value string) error {
+		processes, err := ParseProcesses(value)
+		if err != nil {
+			return err
+		}
+		config.Processes = processes
+		return nil
+	})
 	flag.Parse()
 }
 
@@ -97,6 +208,17 @@ type envConfig struct {
 	CertRSA        string `env:"CRYPTO_KEY"`    // CertRSA private key for connection.
 	CACertRSA      string `env:"CA_CRYPTO_KEY"` // CertRSA private key for connection.
 	ClientType     string `env:"CLIENT_TYPE"`
+	AgentID        string `env:"AGENT_ID"`
+	AgentIDPath    string `env:"AGENT_ID_PATH"`
+	AgentLabel     string `env:"AGENT_LABEL"`
+	Collectors     string `env:"COLLECTORS"`
+	Processes      string `env:"PROCESSES"`
+	StatsDAddress  string `env:"STATSD_ADDRESS"`
+	OutboxPath     string `env:"OUTBOX_PATH"`
+	OutboxMaxSize  string `env:"OUTBOX_MAX_SIZE"`
+	OutboxMaxAge   string `env:"OUTBOX_MAX_AGE"`
+	ClientCert     string `env:"CLIENT_CERT"`
+	ClientKey      string `env:"CLIENT_KEY"`
 }
 
 func checkEnvironments(config *Config) error {
@@ -114,9 +236,117 @@ func checkEnvironments(config *Config) error {
 	configutils.SetEnvToParamIfNeed(&config.CertRSA, envs.CertRSA)
 	configutils.SetEnvToParamIfNeed(&config.CACertRSA, envs.CACertRSA)
 	configutils.SetEnvToParamIfNeed(&config.ClientType, envs.ClientType)
+	configutils.SetEnvToParamIfNeed(&config.AgentID, envs.AgentID)
+	configutils.SetEnvToParamIfNeed(&config.AgentIDPath, envs.AgentIDPath)
+	configutils.SetEnvToParamIfNeed(&config.AgentLabel, envs.AgentLabel)
+	configutils.SetEnvToParamIfNeed(&config.StatsDAddress, envs.StatsDAddress)
+	configutils.SetEnvToParamIfNeed(&config.OutboxPath, envs.OutboxPath)
+	configutils.SetEnvToParamIfNeed(&config.OutboxMaxSize, envs.OutboxMaxSize)
+	configutils.SetEnvToParamIfNeed(&config.OutboxMaxAge, envs.OutboxMaxAge)
+	configutils.SetEnvToParamIfNeed(&config.ClientCert, envs.ClientCert)
+	configutils.SetEnvToParamIfNeed(&config.ClientKey, envs.ClientKey)
+
+	if envs.Collectors != "" {
+		collectors, err := ParseCollectors(envs.Collectors, config.Collectors)
+		if err != nil {
+			return fmt.Errorf("parse config environments: %w", err)
+		}
+		config.Collectors = collectors
+	}
+
+	if envs.Processes != "" {
+		processes, err := ParseProcesses(envs.Processes)
+		if err != nil {
+			return fmt.Errorf("parse config environments: %w", err)
+		}
+		config.Processes = processes
+	}
 	return nil
 }
 
+// Process target selectors in spec.
+const (
+	selectorPIDFile = "pidfile"
+	selectorPattern = "pattern"
+	selectorCgroup  = "cgroup"
+)
+
+// ParseProcesses parses process targets from spec. Spec is a comma separated list of 'name=kind:selector' items,
+// where kind is 'pidfile', 'pattern' or 'cgroup', e.g. 'db=pidfile:/run/db.pid,web=pattern:nginx*'.
+func ParseProcesses(spec string) ([]ProcessTarget, error) {
+	var targets []ProcessTarget
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, selector, found := strings.Cut(item, "=")
+		kind, value, kindFound := strings.Cut(strings.TrimSpace(selector), ":")
+		if !found || !kindFound {
+			return nil, fmt.Errorf("process target '%s' should be in 'name=kind:selector' format", item)
+		}
+
+		target := ProcessTarget{Name: strings.TrimSpace(name)}
+		switch kind {
+		case selectorPIDFile:
+			target.PIDFile = value
+		case selectorPattern:
+			target.Pattern = value
+		case selectorCgroup:
+			target.Cgroup = value
+		default:
+			return nil, fmt.Errorf("process target '%s' has unknown selector kind '%s'", item, kind)
+		}
+
+		if err := target.Validate(); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// ParseCollectors applies collectors settings from spec on top of the current ones and returns the result.
+// Spec is a comma separated list of 'name=setting' pairs, setting is 'on', 'off' or collecting interval,
+// e.g. 'runtime=5s,system=off'. Current settings are not modified.
+func ParseCollectors(spec string, current map[string]CollectorConfig) (map[string]CollectorConfig, error) {
+	collectors := make(map[string]CollectorConfig, len(current))
+	for name, settings := range current {
+		collectors[name] = settings
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(item, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !found || name == "" || value == "" {
+			return nil, fmt.Errorf("collector setting '%s' should be in 'name=setting' format", item)
+		}
+
+		settings := collectors[name]
+		switch value {
+		case "on":
+			settings.Disabled = false
+		case "off":
+			settings.Disabled = true
+		default:
+			interval, err := time.ParseDuration(value)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("collector '%s' setting '%s' should be 'on', 'off' or positive interval", name, value)
+			}
+			settings.Disabled = false
+			settings.Interval = interval
+		}
+		collectors[name] = settings
+	}
+	return collectors, nil
+}
+
 // getRealIPAddr Gets first non-local loop Network interface address.
 func getRealIPAddr() (string, error) {
 	addresses, err := net.InterfaceAddrs()
@@ -150,6 +150,63 @@ func easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig1(in *jlex
 			out.Key = string(in.String())
 		case "crypto_key":
 			out.CertRSA = string(in.String())
+		case "agent_id":
+			out.AgentID = string(in.String())
+		case "agent_id_path":
+			out.AgentIDPath = string(in.String())
+		case "agent_label":
+			out.AgentLabel = bool(in.Bool())
+		case "collectors":
+			if in.IsNull() {
+				in.Skip()
+			} else {
+				in.Delim('{')
+				out.Collectors = make(map[string]CollectorConfig)
+				for !in.IsDelim('}') {
+					key := string(in.String())
+					in.WantColon()
+					var v1 CollectorConfig
+					easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig2(in, &v1)
+					(out.Collectors)[key] = v1
+					in.WantComma()
+				}
+				in.Delim('}')
+			}
+		case "statsd_address":
+			out.StatsDAddress = string(in.String())
+		case "outbox_path":
+			out.OutboxPath = string(in.String())
+		case "outbox_max_size":
+			out.OutboxMaxSize = int64(in.Int64())
+		case "outbox_max_age":
+			out.OutboxMaxAge, _ = time.ParseDuration(in.String())
+		case "client_cert":
+			out.ClientCert = string(in.String())
+		case "client_key":
+			out.ClientKey = string(in.String())
+		case "processes":
+			if in.IsNull() {
+				in.Skip()
+				out.Processes = nil
+			} else {
+				in.Delim('[')
+				if out.Processes == nil {
+					if !in.IsDelim(']') {
+						out.Processes = make([]ProcessTarget, 0, 1)
+					} else {
+						out.Processes = []ProcessTarget{}
+					}
+				} else {
+					out.Processes = (out.Processes)[:0]
+				}
+				for !in.IsDelim(']') {
+					var v3 ProcessTarget
+					easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig3(in, &v3)
+					out.Processes = append(out.Processes, v3)
+					in.WantComma()
+				}
+				in.Delim(']')
+			}
 		default:
 			in.SkipRecursive()
 		}
@@ -194,6 +251,88 @@ func easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig1(out *jwr
 		out.RawString(prefix)
 		out.String(string(in.CertRSA))
 	}
+	{
+		const prefix string = ",\"agent_id\":"
+		out.RawString(prefix)
+		out.String(string(in.AgentID))
+	}
+	{
+		const prefix string = ",\"agent_id_path\":"
+		out.RawString(prefix)
+		out.String(string(in.AgentIDPath))
+	}
+	{
+		const prefix string = ",\"agent_label\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.AgentLabel))
+	}
+	{
+		const prefix string = ",\"collectors\":"
+		out.RawString(prefix)
+		if in.Collectors == nil && (out.Flags&jwriter.NilMapAsEmpty) == 0 {
+			out.RawString(`null`)
+		} else {
+			out.RawByte('{')
+			v2First := true
+			for v2Name, v2Value := range in.Collectors {
+				if v2First {
+					v2First = false
+				} else {
+					out.RawByte(',')
+				}
+				out.String(string(v2Name))
+				out.RawByte(':')
+				easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig2(out, v2Value)
+			}
+			out.RawByte('}')
+		}
+	}
+	{
+		const prefix string = ",\"statsd_address\":"
+		out.RawString(prefix)
+		out.String(string(in.StatsDAddress))
+	}
+	{
+		const prefix string = ",\"outbox_path\":"
+		out.RawString(prefix)
+		out.String(string(in.OutboxPath))
+	}
+	{
+		const prefix string = ",\"outbox_max_size\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.OutboxMaxSize))
+	}
+	{
+		const prefix string = ",\"outbox_max_age\":"
+		out.RawString(prefix)
+		out.String(string(in.OutboxMaxAge.String()))
+	}
+	{
+		const prefix string = ",\"client_cert\":"
+		out.RawString(prefix)
+		out.String(string(in.ClientCert))
+	}
+	{
+		const prefix string = ",\"client_key\":"
+		out.RawString(prefix)
+		out.String(string(in.ClientKey))
+	}
+	{
+		const prefix string = ",\"processes\":"
+		out.RawString(prefix)
+		if in.Processes == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+			out.RawString("null")
+		} else {
+			out.RawByte('[')
+			for v4, v5 := range in.Processes {
+				if v4 > 0 {
+					out.RawByte(',')
+				}
+				easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig3(out, v5)
+			}
+			out.RawByte(']')
+		}
+	}
 	out.RawByte('}')
 }
 
@@ -220,3 +359,163 @@ func (v *Config) UnmarshalJSON(data []byte) error {
 func (v *Config) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig1(l, v)
 }
+func easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig2(in *jlexer.Lexer, out *CollectorConfig) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "disabled":
+			out.Disabled = bool(in.Bool())
+		case "interval":
+			out.Interval, _ = time.ParseDuration(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig2(out *jwriter.Writer, in CollectorConfig) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"disabled\":"
+		out.RawString(prefix[1:])
+		out.Bool(bool(in.Disabled))
+	}
+	{
+		const prefix string = ",\"interval\":"
+		out.RawString(prefix)
+		out.String(string(in.Interval.String()))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v CollectorConfig) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig2(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v CollectorConfig) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig2(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *CollectorConfig) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig2(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *CollectorConfig) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig2(l, v)
+}
+func easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig3(in *jlexer.Lexer, out *ProcessTarget) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "name":
+			out.Name = string(in.String())
+		case "pid_file":
+			out.PIDFile = string(in.String())
+		case "pattern":
+			out.Pattern = string(in.String())
+		case "cgroup":
+			out.Cgroup = string(in.String())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig3(out *jwriter.Writer, in ProcessTarget) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"name\":"
+		out.RawString(prefix[1:])
+		out.String(string(in.Name))
+	}
+	{
+		const prefix string = ",\"pid_file\":"
+		out.RawString(prefix)
+		out.String(string(in.PIDFile))
+	}
+	{
+		const prefix string = ",\"pattern\":"
+		out.RawString(prefix)
+		out.String(string(in.Pattern))
+	}
+	{
+		const prefix string = ",\"cgroup\":"
+		out.RawString(prefix)
+		out.String(string(in.Cgroup))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v ProcessTarget) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig3(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v ProcessTarget) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson6615c02eEncodeGithubComErupshisMetricsInternalAgentConfig3(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *ProcessTarget) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig3(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *ProcessTarget) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson6615c02eDecodeGithubComErupshisMetricsInternalAgentConfig3(l, v)
+}
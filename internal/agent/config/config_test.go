@@ -0,0 +1,169 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCollectors(t *testing.T) {
+	current := map[string]CollectorConfig{
+		"runtime": {Interval: time.Second},
+		"system":  {Disabled: true},
+	}
+
+	tests := []struct {
+		name    string
+		spec    string
+		want    map[string]CollectorConfig
+		wantErr bool
+	}{
+		{
+			name: "empty spec",
+			spec: "",
+			want: current,
+		},
+		{
+			name: "switch and set interval",
+			spec: "runtime=off, system=5s,random=on",
+			want: map[string]CollectorConfig{
+				"runtime": {Disabled: true, Interval: time.Second},
+				"system":  {Interval: 5 * time.Second},
+				"random":  {},
+			},
+		},
+		{
+			name:    "missing setting",
+			spec:    "runtime",
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			spec:    "=on",
+			wantErr: true,
+		},
+		{
+			name:    "incorrect interval",
+			spec:    "runtime=-1s",
+			wantErr: true,
+		},
+		{
+			name:    "incorrect setting",
+			spec:    "runtime=yes",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCollectors(tt.spec, current)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.Equal(t, map[string]CollectorConfig{"runtime": {Interval: time.Second}, "system": {Disabled: true}}, current)
+}
+
+func TestParseProcesses(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []ProcessTarget
+		wantErr bool
+	}{
+		{
+			name: "empty spec",
+			spec: "",
+		},
+		{
+			name: "all selectors",
+			spec: "db=pidfile:/run/db.pid, web=pattern:nginx*,app=cgroup:/system.slice/app.service",
+			want: []ProcessTarget{
+				{Name: "db", PIDFile: "/run/db.pid"},
+				{Name: "web", Pattern: "nginx*"},
+				{Name: "app", Cgroup: "/system.slice/app.service"},
+			},
+		},
+		{
+			name:    "missing selector kind",
+			spec:    "db=/run/db.pid",
+			wantErr: true,
+		},
+		{
+			name:    "unknown selector kind",
+			spec:    "db=file:/run/db.pid",
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			spec:    "=pattern:nginx",
+			wantErr: true,
+		},
+		{
+			name:    "empty selector",
+			spec:    "db=pidfile:",
+			wantErr: true,
+		},
+		{
+			name:    "malformed pattern",
+			spec:    "web=pattern:nginx[",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProcesses(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProcessTarget_Validate(t *testing.T) {
+	assert.NoError(t, ProcessTarget{Name: "db", PIDFile: "/run/db.pid"}.Validate())
+	assert.Error(t, ProcessTarget{Name: "db"}.Validate())
+	assert.Error(t, ProcessTarget{Name: "db", PIDFile: "/run/db.pid", Pattern: "db"}.Validate())
+}
+
+func TestConfig_UnmarshalJSONCollectors(t *testing.T) {
+	var config Config
+	require.NoError(t, config.UnmarshalJSON([]byte(`{"collectors":{"runtime":{"interval":"5s"},"system":{"disabled":true}},`+
+		`"processes":[{"name":"db","pid_file":"/run/db.pid"},{"name":"web","pattern":"nginx*"}]}`)))
+	assert.Equal(t, map[string]CollectorConfig{
+		"runtime": {Interval: 5 * time.Second},
+		"system":  {Disabled: true},
+	}, config.Collectors)
+
+	data, err := config.MarshalJSON()
+	require.NoError(t, err)
+
+	var restored Config
+	require.NoError(t, restored.UnmarshalJSON(data))
+	assert.Equal(t, config.Collectors, restored.Collectors)
+	assert.Equal(t, []ProcessTarget{{Name: "db", PIDFile: "/run/db.pid"}, {Name: "web", Pattern: "nginx*"}}, restored.Processes)
+}
+
+func TestConfig_UnmarshalJSONOutbox(t *testing.T) {
+	var config Config
+	require.NoError(t, config.UnmarshalJSON([]byte(`{"outbox_path":"/var/lib/agent/outbox","outbox_max_size":1024,"outbox_max_age":"12h"}`)))
+	assert.Equal(t, "/var/lib/agent/outbox", config.OutboxPath)
+	assert.Equal(t, int64(1024), config.OutboxMaxSize)
+	assert.Equal(t, 12*time.Hour, config.OutboxMaxAge)
+
+	data, err := config.MarshalJSON()
+	require.NoError(t, err)
+
+	var restored Config
+	require.NoError(t, restored.UnmarshalJSON(data))
+	assert.Equal(t, config, restored)
+}
@@ -0,0 +1,92 @@
+// Package identity resolves stable agent identifier attached to every report sent on server.
+package identity
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolve returns agent identifier.
+//
+// Explicitly configured id is returned as is. Otherwise identifier is read from the file by path.
+// If the file is missing, new identifier is generated from hostname and random UUID and persisted in the file,
+// so agent keeps the same identifier between restarts.
+func Resolve(id string, path string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return strings.TrimSpace(string(data)), nil
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("read agent id file '%s': %w", path, err)
+		}
+	}
+
+	id, err := Generate()
+	if err != nil {
+		return "", fmt.Errorf("generate agent id: %w", err)
+	}
+
+	if path == "" {
+		return id, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("persist agent id: %w", err)
+	}
+
+	if err = os.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("persist agent id: %w", err)
+	}
+
+	return id, nil
+}
+
+// fileName is a name of the file with persisted identifier in the default directory.
+const fileName = "agent_id"
+
+// DefaultPath returns path of the identifier file in 'metrics' subdirectory of the user config directory.
+// Empty path is returned if the user config directory is unknown, so generated identifier isn't persisted.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "metrics", fileName)
+}
+
+// Generate creates new identifier in format 'hostname-uuid'.
+func Generate() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "agent"
+	}
+
+	uuid, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+
+	return hostname + "-" + uuid, nil
+}
+
+// newUUID generates random UUID (version 4).
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("read random bytes: %w", err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
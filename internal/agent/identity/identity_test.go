@@ -0,0 +1,72 @@
+package identity
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var idPattern = regexp.MustCompile(`^.+-[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestResolve(t *testing.T) {
+	t.Run("configured id", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent_id")
+
+		id, err := Resolve("custom", path)
+		require.NoError(t, err)
+		assert.Equal(t, "custom", id)
+
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("generated id is persisted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sub", "agent_id")
+
+		id, err := Resolve("", path)
+		require.NoError(t, err)
+		assert.Regexp(t, idPattern, id)
+
+		idRepeated, err := Resolve("", path)
+		require.NoError(t, err)
+		assert.Equal(t, id, idRepeated)
+	})
+
+	t.Run("id from file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent_id")
+		require.NoError(t, os.WriteFile(path, []byte("stored\n"), 0644))
+
+		id, err := Resolve("", path)
+		require.NoError(t, err)
+		assert.Equal(t, "stored", id)
+	})
+
+	t.Run("without file", func(t *testing.T) {
+		id, err := Resolve("", "")
+		require.NoError(t, err)
+		assert.Regexp(t, idPattern, id)
+	})
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	path := DefaultPath()
+	assert.Equal(t, filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "metrics", "agent_id"), path)
+}
+
+func TestGenerate(t *testing.T) {
+	first, err := Generate()
+	require.NoError(t, err)
+
+	second, err := Generate()
+	require.NoError(t, err)
+
+	assert.Regexp(t, idPattern, first)
+	assert.NotEqual(t, first, second)
+}
@@ -0,0 +1,226 @@
+// Package outbox implements bounded on-disk queue of metrics batches which agent couldn't deliver on server.
+// Every batch is stored in its own file named by its spooling time, so batches survive agent's restarts
+// and are replayed in the order they were spooled. Queue is limited by total size and age of batches,
+// the oldest batches are evicted first.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+const (
+	// batchExt is an extension of spooled batch file.
+	batchExt = ".batch"
+	// tmpExt is an extension of batch file being written.
+	tmpExt = ".tmp"
+)
+
+// batchFile describes spooled batch.
+type batchFile struct {
+	name    string
+	spooled time.Time
+	size    int64
+}
+
+// Outbox is a bounded on-disk queue of undelivered batches. Safe for concurrent use.
+type Outbox struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	// batches are ordered from the oldest to the newest.
+	batches []batchFile
+	size    int64
+	mu      sync.Mutex
+
+	now    func() time.Time
+	logger logger.BaseLogger
+}
+
+// Create opens outbox in directory dir creating it if missing. Batches spooled before are loaded.
+// Zero maxSize (bytes) or maxAge disables the corresponding limit.
+func Create(dir string, maxSize int64, maxAge time.Duration, logger logger.BaseLogger) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create outbox dir: %w", err)
+	}
+
+	o := &Outbox{dir: dir, maxSize: maxSize, maxAge: maxAge, now: time.Now, logger: logger}
+	if err := o.load(); err != nil {
+		return nil, fmt.Errorf("load outbox: %w", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.evict()
+	return o, nil
+}
+
+// Len returns count of spooled batches.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.batches)
+}
+
+// Push spools batch of metrics. The oldest batches are evicted if limits are exceeded.
+func (o *Outbox) Push(metrics []networkmsg.Metric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("marshal batch: %w", err)
+	}
+	if o.maxSize > 0 && int64(len(data)) > o.maxSize {
+		return fmt.Errorf("batch size %d exceeds outbox size %d", len(data), o.maxSize)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// names have to be unique and ordered even if clock goes back.
+	spooled := o.now()
+	if len(o.batches) != 0 {
+		if last := o.batches[len(o.batches)-1].spooled; !spooled.After(last) {
+			spooled = last.Add(time.Nanosecond)
+		}
+	}
+
+	name := fmt.Sprintf("%020d%s", spooled.UnixNano(), batchExt)
+	tmpPath := filepath.Join(o.dir, name+tmpExt)
+	if err = os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	if err = os.Rename(tmpPath, filepath.Join(o.dir, name)); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write batch: %w", err)
+	}
+
+	o.batches = append(o.batches, batchFile{name: name, spooled: spooled, size: int64(len(data))})
+	o.size += int64(len(data))
+	o.evict()
+	return nil
+}
+
+// Replay sends spooled batches from the oldest one and removes delivered ones.
+// Replay stops on the first failed batch, which is kept to be sent next time. Returns count of delivered batches.
+// Unreadable batches are dropped.
+func (o *Outbox) Replay(ctx context.Context, send func(ctx context.Context, metrics []networkmsg.Metric) error) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.evict()
+
+	sent := 0
+	for len(o.batches) != 0 {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		batch := o.batches[0]
+		metrics, err := o.read(batch)
+		if err != nil {
+			o.logger.Info("[Outbox:Replay] batch '%s' is dropped: %v", batch.name, err)
+			o.remove()
+			continue
+		}
+
+		if err = send(ctx, metrics); err != nil {
+			return sent, fmt.Errorf("replay batch '%s': %w", batch.name, err)
+		}
+		o.remove()
+		sent++
+	}
+	return sent, nil
+}
+
+// load reads list of spooled batches from directory and removes batches which weren't written completely.
+func (o *Outbox) load() error {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		if strings.HasSuffix(name, tmpExt) {
+			_ = os.Remove(filepath.Join(o.dir, name))
+			continue
+		}
+
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(name, batchExt), 10, 64)
+		if !strings.HasSuffix(name, batchExt) || err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		o.batches = append(o.batches, batchFile{name: name, spooled: time.Unix(0, nanos), size: info.Size()})
+		o.size += info.Size()
+	}
+
+	sort.Slice(o.batches, func(i, j int) bool {
+		return o.batches[i].spooled.Before(o.batches[j].spooled)
+	})
+	return nil
+}
+
+// read returns metrics of spooled batch.
+func (o *Outbox) read(batch batchFile) ([]networkmsg.Metric, error) {
+	data, err := os.ReadFile(filepath.Join(o.dir, batch.name))
+	if err != nil {
+		return nil, err
+	}
+	return networkmsg.ParsePostBatchValueMessage(data)
+}
+
+// evict drops the oldest batches while they are older than max age or total size exceeds max size. Must be called under mu.
+func (o *Outbox) evict() {
+	border := o.now().Add(-o.maxAge)
+
+	evicted := 0
+	for len(o.batches) != 0 {
+		expired := o.maxAge > 0 && o.batches[0].spooled.Before(border)
+		overflowed := o.maxSize > 0 && o.size > o.maxSize
+		if !expired && !overflowed {
+			break
+		}
+
+		o.remove()
+		evicted++
+	}
+
+	if evicted != 0 {
+		o.logger.Info("[Outbox:evict] %d oldest batches are evicted by outbox limits.", evicted)
+	}
+}
+
+// remove deletes the oldest batch. Must be called under mu.
+func (o *Outbox) remove() {
+	batch := o.batches[0]
+	if err := os.Remove(filepath.Join(o.dir, batch.name)); err != nil && !os.IsNotExist(err) {
+		o.logger.Info("[Outbox:remove] remove batch '%s': %v", batch.name, err)
+	}
+
+	o.batches = o.batches[1:]
+	o.size -= batch.size
+}
@@ -0,0 +1,122 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batch creates batch with single gauge collected at timestamp.
+func batch(name string, timestamp int64) []networkmsg.Metric {
+	metric := networkmsg.CreateGaugeMetrics(name, 1)
+	metric.Timestamp = timestamp
+	return []networkmsg.Metric{metric}
+}
+
+func TestOutbox_PushReplay(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := Create(dir, 0, 0, logger.CreateMock())
+	require.NoError(t, err)
+
+	now := time.Now()
+	outbox.now = func() time.Time { return now }
+	require.NoError(t, outbox.Push(batch("first", 1)))
+	require.NoError(t, outbox.Push(batch("second", 2)))
+	require.NoError(t, outbox.Push(batch("third", 3)))
+	require.NoError(t, outbox.Push(nil))
+	assert.Equal(t, 3, outbox.Len())
+
+	var sent []networkmsg.Metric
+	calls := 0
+	send := func(_ context.Context, metrics []networkmsg.Metric) error {
+		calls++
+		if calls == 2 {
+			return fmt.Errorf("connection refused")
+		}
+		sent = append(sent, metrics...)
+		return nil
+	}
+
+	replayed, err := outbox.Replay(context.Background(), send)
+	assert.Error(t, err)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, 2, outbox.Len())
+
+	// outbox is restored after restart.
+	outbox, err = Create(dir, 0, 0, logger.CreateMock())
+	require.NoError(t, err)
+	replayed, err = outbox.Replay(context.Background(), send)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, 0, outbox.Len())
+
+	want := append(append(batch("first", 1), batch("second", 2)...), batch("third", 3)...)
+	assert.Equal(t, want, sent)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestOutbox_Limits(t *testing.T) {
+	batchSize := int64(len(networkmsg.CreatePostUpdateMessage(batch("metric", 1)[0])) + 2)
+
+	now := time.Now()
+	outbox, err := Create(t.TempDir(), 2*batchSize, time.Hour, logger.CreateMock())
+	require.NoError(t, err)
+	outbox.now = func() time.Time { return now }
+
+	// the oldest batch is evicted by size.
+	require.NoError(t, outbox.Push(batch("metric", 1)))
+	require.NoError(t, outbox.Push(batch("metric", 2)))
+	require.NoError(t, outbox.Push(batch("metric", 3)))
+	assert.Equal(t, 2, outbox.Len())
+
+	// batch larger than outbox is rejected.
+	assert.Error(t, outbox.Push(append(append(batch("metric", 4), batch("metric", 5)...), batch("metric", 6)...)))
+
+	// the rest are evicted by age.
+	now = now.Add(2 * time.Hour)
+	sent := 0
+	replayed, err := outbox.Replay(context.Background(), func(context.Context, []networkmsg.Metric) error {
+		sent++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, replayed)
+	assert.Equal(t, 0, sent)
+}
+
+func TestOutbox_ReplayBroken(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001.batch"), []byte("broken"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000002.batch.tmp"), []byte("[]"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+
+	outbox, err := Create(dir, 0, 0, logger.CreateMock())
+	require.NoError(t, err)
+	require.NoError(t, outbox.Push(batch("metric", 1)))
+	assert.Equal(t, 2, outbox.Len())
+
+	var sent []networkmsg.Metric
+	replayed, err := outbox.Replay(context.Background(), func(_ context.Context, metrics []networkmsg.Metric) error {
+		sent = append(sent, metrics...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	assert.Equal(t, batch("metric", 1), sent)
+
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000002.batch.tmp"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "notes.txt"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,108 @@
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+// Metric types of StatsD line protocol. Histograms and distributions are treated as timers.
+const (
+	typeCounter      = "c"
+	typeGauge        = "g"
+	typeTimer        = "ms"
+	typeHistogram    = "h"
+	typeDistribution = "d"
+	typeSet          = "s"
+)
+
+// Sample is a single measurement sent by application.
+type Sample struct {
+	Name     string
+	Type     string
+	Value    float64           // Value of counter, gauge or timer.
+	Member   string            // Member of set.
+	Relative bool              // Relative means that gauge value is a change of the current one.
+	Rate     float64           // Rate of sampling in (0, 1], counters and timers are scaled by it.
+	Labels   map[string]string // Labels parsed from DogStatsD tags.
+}
+
+// ParseLine parses measurement in 'name:value|type[|@rate][|#tag:value,...]' format.
+// Gauge values with sign are changes of the current value. Tags without value and unknown sections are skipped.
+func ParseLine(line string) (Sample, error) {
+	name, rest, found := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return Sample{}, fmt.Errorf("line '%s' should be in 'name:value|type' format", line)
+	}
+
+	sections := strings.Split(strings.TrimSpace(rest), "|")
+	if len(sections) < 2 {
+		return Sample{}, fmt.Errorf("line '%s' has missing type", line)
+	}
+
+	// StatsD names are usually dot separated, they are converted into valid metric names.
+	name = networkmsg.SanitizeName(name)
+	if !networkmsg.IsValidName(name) {
+		return Sample{}, fmt.Errorf("line '%s' has reserved name", line)
+	}
+
+	sample := Sample{Name: name, Type: sections[1], Rate: 1}
+	value := sections[0]
+	switch sample.Type {
+	case typeSet:
+		if value == "" {
+			return Sample{}, fmt.Errorf("line '%s' has empty set member", line)
+		}
+		sample.Member = value
+	case typeCounter, typeGauge, typeTimer, typeHistogram, typeDistribution:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+			return Sample{}, fmt.Errorf("line '%s' has incorrect value '%s'", line, value)
+		}
+		sample.Value = parsed
+		sample.Relative = sample.Type == typeGauge && (value[0] == '+' || value[0] == '-')
+	default:
+		return Sample{}, fmt.Errorf("line '%s' has unknown type '%s'", line, sample.Type)
+	}
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("line '%s' has incorrect sample rate '%s'", line, section)
+			}
+			sample.Rate = rate
+		case strings.HasPrefix(section, "#"):
+			sample.Labels = parseTags(section[1:])
+		}
+	}
+	return sample, nil
+}
+
+// parseTags converts comma separated 'name:value' tags into labels. Tag names are sanitized, reserved ones are skipped.
+func parseTags(tags string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(tags, ",") {
+		name, value, found := strings.Cut(tag, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			continue
+		}
+
+		name = networkmsg.SanitizeLabelName(name)
+		if !networkmsg.IsValidLabelName(name) {
+			continue
+		}
+		labels[name] = value
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
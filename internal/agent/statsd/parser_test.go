@@ -0,0 +1,94 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "counter with sanitized name",
+			line: "orders.created:3|c",
+			want: Sample{Name: "orders_created", Type: typeCounter, Value: 3, Rate: 1},
+		},
+		{
+			name: "sanitized and reserved tags",
+			line: "orders:1|c|#cloud.region:eu,__name__:x",
+			want: Sample{Name: "orders", Type: typeCounter, Value: 1, Rate: 1, Labels: map[string]string{"cloud_region": "eu"}},
+		},
+		{
+			name: "sampled counter with tags",
+			line: "orders:1|c|@0.5|#region:eu,env:prod,canary",
+			want: Sample{Name: "orders", Type: typeCounter, Value: 1, Rate: 0.5, Labels: map[string]string{"region": "eu", "env": "prod"}},
+		},
+		{
+			name: "gauge",
+			line: "queue:42.5|g",
+			want: Sample{Name: "queue", Type: typeGauge, Value: 42.5, Rate: 1},
+		},
+		{
+			name: "relative gauge",
+			line: "queue:-5|g",
+			want: Sample{Name: "queue", Type: typeGauge, Value: -5, Relative: true, Rate: 1},
+		},
+		{
+			name: "timer",
+			line: "request:320|ms",
+			want: Sample{Name: "request", Type: typeTimer, Value: 320, Rate: 1},
+		},
+		{
+			name: "set",
+			line: "users:alice|s",
+			want: Sample{Name: "users", Type: typeSet, Member: "alice", Rate: 1},
+		},
+		{
+			name:    "reserved name",
+			line:    "__orders:1|c",
+			wantErr: true,
+		},
+		{
+			name:    "missing value",
+			line:    "orders|c",
+			wantErr: true,
+		},
+		{
+			name:    "missing type",
+			line:    "orders:1",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			line:    "orders:1|x",
+			wantErr: true,
+		},
+		{
+			name:    "incorrect value",
+			line:    "orders:one|c",
+			wantErr: true,
+		},
+		{
+			name:    "incorrect sample rate",
+			line:    "orders:1|c|@2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,311 @@
+// Package statsd implements agent's listener of StatsD line protocol.
+// Applications on the same host push counters, gauges, timers and sets over UDP or TCP,
+// listener aggregates them between collectings and is run as a regular agent's collector.
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+// CollectorName is a name of StatsD collector.
+const CollectorName = "statsd"
+
+// maxPacketSize is a maximum size of UDP datagram and TCP line.
+const maxPacketSize = 64 * 1024
+
+// timerBounds defines buckets upper bounds of timers histograms (milliseconds).
+var timerBounds = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// series identifies aggregated metric by its name and labels.
+type series struct {
+	name   string
+	labels map[string]string
+}
+
+// gauge keeps current value of gauge between collectings to apply relative changes.
+type gauge struct {
+	series
+	value   float64
+	updated bool
+}
+
+// timer accumulates timings observations.
+type timer struct {
+	series
+	histogram *histogram.Histogram
+}
+
+// set accumulates unique members.
+type set struct {
+	series
+	members map[string]struct{}
+}
+
+// counter accumulates counter increments.
+type counter struct {
+	series
+	value float64
+}
+
+// Listener receives StatsD measurements over UDP and TCP on the same address and aggregates them.
+// Collect reports counters increments as delta counters, updated gauges, timers as histograms and
+// count of unique set members as gauges. Everything except gauges values is reset after collecting. Safe for concurrent use.
+type Listener struct {
+	address string
+
+	counters map[string]*counter
+	gauges   map[string]*gauge
+	timers   map[string]*timer
+	sets     map[string]*set
+	mu       sync.Mutex
+
+	logger logger.BaseLogger
+}
+
+// Create returns a new instance of Listener for address.
+func Create(address string, logger logger.BaseLogger) *Listener {
+	return &Listener{
+		address:  address,
+		counters: make(map[string]*counter),
+		gauges:   make(map[string]*gauge),
+		timers:   make(map[string]*timer),
+		sets:     make(map[string]*set),
+		logger:   logger,
+	}
+}
+
+// Name returns name of collector.
+func (l *Listener) Name() string {
+	return CollectorName
+}
+
+// Serve listens UDP and TCP address and handles measurements until context is canceled.
+func (l *Listener) Serve(ctx context.Context) error {
+	packetConn, err := net.ListenPacket("udp", l.address)
+	if err != nil {
+		return fmt.Errorf("listen udp '%s': %w", l.address, err)
+	}
+
+	// TCP is bound to the port chosen for UDP, so both are the same for zero port.
+	listener, err := net.Listen("tcp", packetConn.LocalAddr().String())
+	if err != nil {
+		_ = packetConn.Close()
+		return fmt.Errorf("listen tcp '%s': %w", l.address, err)
+	}
+
+	l.logger.Info("[Listener:Serve] StatsD listener is listening on '%s' (udp, tcp).", packetConn.LocalAddr().String())
+	return l.serve(ctx, packetConn, listener)
+}
+
+// serve handles measurements from connections until context is canceled, connections are closed on exit.
+func (l *Listener) serve(ctx context.Context, packetConn net.PacketConn, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = packetConn.Close()
+		_ = listener.Close()
+	}()
+
+	var udpErr, tcpErr error
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		udpErr = l.serveUDP(ctx, packetConn)
+	}()
+	go func() {
+		defer wg.Done()
+		tcpErr = l.serveTCP(ctx, listener, &wg)
+	}()
+	wg.Wait()
+
+	return errors.Join(udpErr, tcpErr)
+}
+
+// serveUDP handles datagrams, every datagram may carry several newline separated measurements.
+func (l *Listener) serveUDP(ctx context.Context, conn net.PacketConn) error {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("read udp: %w", err)
+		}
+		l.handle(buf[:n])
+	}
+}
+
+// serveTCP accepts connections and handles them in separate goroutines tracked by wg.
+func (l *Listener) serveTCP(ctx context.Context, listener net.Listener, wg *sync.WaitGroup) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept tcp: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn handles newline separated measurements of connection until it is closed or context is canceled.
+func (l *Listener) serveConn(ctx context.Context, conn net.Conn) {
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-connCtx.Done()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxPacketSize)
+	for scanner.Scan() {
+		l.handle(scanner.Bytes())
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		l.logger.Info("[Listener:serveConn] connection from '%s' failed: %v", conn.RemoteAddr().String(), err)
+	}
+}
+
+// handle parses newline separated measurements and aggregates them. Malformed lines are skipped.
+func (l *Listener) handle(data []byte) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		sample, err := ParseLine(string(line))
+		if err != nil {
+			l.logger.Info("[Listener:handle] measurement skipped: %v", err)
+			continue
+		}
+		l.Add(sample)
+	}
+}
+
+// Add aggregates sample until the next collecting.
+func (l *Listener) Add(sample Sample) {
+	key := networkmsg.SeriesKey(sample.Name, sample.Labels)
+	s := series{name: sample.Name, labels: sample.Labels}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch sample.Type {
+	case typeCounter:
+		c, ok := l.counters[key]
+		if !ok {
+			c = &counter{series: s}
+			l.counters[key] = c
+		}
+		c.value += sample.Value / sample.Rate
+
+	case typeGauge:
+		g, ok := l.gauges[key]
+		if !ok {
+			g = &gauge{series: s}
+			l.gauges[key] = g
+		}
+		if sample.Relative {
+			g.value += sample.Value
+		} else {
+			g.value = sample.Value
+		}
+		g.updated = true
+
+	case typeTimer, typeHistogram, typeDistribution:
+		t, ok := l.timers[key]
+		if !ok {
+			h, err := histogram.New(timerBounds)
+			if err != nil {
+				l.logger.Info("[Listener:Add] create timer histogram: %v", err)
+				return
+			}
+			t = &timer{series: s, histogram: h}
+			l.timers[key] = t
+		}
+		// sampled timing stands for several observations.
+		for i := 0; i < int(math.Max(1, math.Round(1/sample.Rate))); i++ {
+			t.histogram.Observe(sample.Value)
+		}
+
+	case typeSet:
+		st, ok := l.sets[key]
+		if !ok {
+			st = &set{series: s, members: make(map[string]struct{})}
+			l.sets[key] = st
+		}
+		st.members[sample.Member] = struct{}{}
+	}
+}
+
+// Collect returns measurements aggregated since the previous call sorted by type and series.
+func (l *Listener) Collect(_ context.Context) ([]networkmsg.Metric, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var metrics []networkmsg.Metric
+	for _, key := range sortedKeys(l.counters) {
+		c := l.counters[key]
+		if delta := int64(math.Round(c.value)); delta != 0 {
+			metrics = append(metrics, withLabels(networkmsg.CreateCounterMetrics(c.name, delta), c.labels))
+		}
+	}
+	for _, key := range sortedKeys(l.gauges) {
+		g := l.gauges[key]
+		if g.updated {
+			metrics = append(metrics, withLabels(networkmsg.CreateGaugeMetrics(g.name, g.value), g.labels))
+			g.updated = false
+		}
+	}
+	for _, key := range sortedKeys(l.timers) {
+		t := l.timers[key]
+		metrics = append(metrics, withLabels(networkmsg.CreateHistogramMetrics(t.name, t.histogram), t.labels))
+	}
+	for _, key := range sortedKeys(l.sets) {
+		st := l.sets[key]
+		metrics = append(metrics, withLabels(networkmsg.CreateGaugeMetrics(st.name, float64(len(st.members))), st.labels))
+	}
+
+	l.counters = make(map[string]*counter)
+	l.timers = make(map[string]*timer)
+	l.sets = make(map[string]*set)
+	return metrics, nil
+}
+
+// withLabels assigns labels to metric.
+func withLabels(metric networkmsg.Metric, labels map[string]string) networkmsg.Metric {
+	metric.Labels = labels
+	return metric
+}
+
+// sortedKeys returns sorted keys of aggregated series.
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
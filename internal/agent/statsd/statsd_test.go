@@ -0,0 +1,109 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListener_Collect(t *testing.T) {
+	listener := Create("", logger.CreateMock())
+	listener.handle([]byte("orders:1|c\norders:1|c|@0.5\norders:2|c|#region:eu\n" +
+		"queue:10|g\nqueue:+5|g\nqueue:-3|g\n" +
+		"request:20|ms\nrequest:200|ms|@0.5\n" +
+		"users:alice|s\nusers:bob|s\nusers:alice|s\n" +
+		"broken\n"))
+
+	metrics, err := listener.Collect(context.Background())
+	require.NoError(t, err)
+
+	timings, err := histogram.New(timerBounds)
+	require.NoError(t, err)
+	timings.Observe(20)
+	timings.Observe(200)
+	timings.Observe(200)
+
+	euOrders := networkmsg.CreateCounterMetrics("orders", 2)
+	euOrders.Labels = map[string]string{"region": "eu"}
+	assert.Equal(t, []networkmsg.Metric{
+		networkmsg.CreateCounterMetrics("orders", 3),
+		euOrders,
+		networkmsg.CreateGaugeMetrics("queue", 12),
+		networkmsg.CreateHistogramMetrics("request", timings),
+		networkmsg.CreateGaugeMetrics("users", 2),
+	}, metrics)
+
+	// gauges keep value for relative changes, the rest is reset.
+	metrics, err = listener.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	listener.handle([]byte("queue:+1|g"))
+	metrics, err = listener.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []networkmsg.Metric{networkmsg.CreateGaugeMetrics("queue", 13)}, metrics)
+}
+
+func TestListener_Serve(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	listener := Create("", logger.CreateMock())
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- listener.serve(ctx, packetConn, tcpListener) }()
+
+	udpConn, err := net.Dial("udp", packetConn.LocalAddr().String())
+	require.NoError(t, err)
+	defer udpConn.Close()
+	_, err = fmt.Fprint(udpConn, "orders:1|c\norders:2|c")
+	require.NoError(t, err)
+
+	tcpConn, err := net.Dial("tcp", tcpListener.Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+	_, err = fmt.Fprint(tcpConn, "orders:4|c\nqueue:7|g\n")
+	require.NoError(t, err)
+
+	var metrics []networkmsg.Metric
+	var orders int64
+	require.Eventually(t, func() bool {
+		collected, _ := listener.Collect(context.Background())
+		for _, metric := range collected {
+			if metric.ID == "orders" {
+				orders += *metric.Delta
+			} else {
+				metrics = append(metrics, metric)
+			}
+		}
+		return orders == 7 && len(metrics) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, networkmsg.CreateGaugeMetrics("queue", 7), metrics[0])
+
+	cancel()
+	select {
+	case err = <-served:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("listener is not stopped")
+	}
+}
+
+func TestListener_ServeAddressInUse(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer packetConn.Close()
+
+	err = Create(packetConn.LocalAddr().String(), logger.CreateMock()).Serve(context.Background())
+	assert.Error(t, err)
+}
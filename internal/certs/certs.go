@@ -0,0 +1,380 @@
+// Package certs implements certificate authority which issues certificates of servers and agents.
+// Authority keeps its certificate, private key, index of issued certificates and certificate revocation list (CRL)
+// in a single directory. Servers get RSA keys since the same key decrypts agents messages,
+// agents get ECDSA keys used for mutual TLS only.
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Files of authority in its directory.
+const (
+	CACertFile = "ca_cert.pem" // CACertFile certificate of authority to be trusted by servers and agents.
+	CRLFile    = "ca_crl.pem"  // CRLFile list of revoked certificates to be loaded by servers.
+	caKeyFile  = "ca_key.pem"
+	indexFile  = "index.json"
+)
+
+// Kinds of issued certificates.
+const (
+	KindServer = "server"
+	KindClient = "client"
+)
+
+// crlValidity is a period after which CRL should be updated.
+const crlValidity = 365 * 24 * time.Hour
+
+var errUnknownSerial = errors.New("certificate is not issued by authority")
+
+// Request describes certificate to be issued.
+type Request struct {
+	CommonName string
+	DNSNames   []string
+	IPs        []net.IP
+	Validity   time.Duration
+	Bits       int // Bits size of RSA key of server.
+}
+
+// Record describes issued certificate in index of authority.
+type Record struct {
+	Serial    string     `json:"serial"`
+	Kind      string     `json:"kind"`
+	Subject   string     `json:"subject"`
+	DNSNames  []string   `json:"dns_names,omitempty"`
+	IPs       []string   `json:"ip_addresses,omitempty"`
+	NotAfter  time.Time  `json:"not_after"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// index of issued certificates.
+type index struct {
+	CRLNumber    int64    `json:"crl_number"`
+	Certificates []Record `json:"certificates"`
+}
+
+// Authority issues and revokes certificates.
+type Authority struct {
+	dir  string
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// Init creates authority with subject in directory dir and writes its empty CRL, so servers may load it
+// before any certificate is revoked. Fails if authority already exists in directory.
+func Init(dir string, subject pkix.Name, validity time.Duration) (*Authority, error) {
+	if _, err := os.Stat(filepath.Join(dir, caKeyFile)); err == nil {
+		return nil, fmt.Errorf("authority is already initialized in '%s'", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create authority dir: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate authority key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now,
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("create authority cert: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse authority cert: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal authority key: %w", err)
+	}
+	if err = writePEM(filepath.Join(dir, caKeyFile), "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, err
+	}
+	if err = writePEM(filepath.Join(dir, CACertFile), "CERTIFICATE", der, 0644); err != nil {
+		return nil, err
+	}
+
+	authority := &Authority{dir: dir, cert: cert, key: key}
+	idx := &index{}
+	if err = authority.writeCRL(idx, now); err != nil {
+		return nil, err
+	}
+	if err = authority.writeIndex(idx); err != nil {
+		return nil, err
+	}
+	return authority, nil
+}
+
+// Open loads authority from directory dir.
+func Open(dir string) (*Authority, error) {
+	certBlock, err := readPEM(filepath.Join(dir, CACertFile))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse authority cert: %w", err)
+	}
+
+	keyBlock, err := readPEM(filepath.Join(dir, caKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse authority key: %w", err)
+	}
+
+	return &Authority{dir: dir, cert: cert, key: key}, nil
+}
+
+// IssueServer issues certificate with RSA key for server and writes them into certPath and keyPath.
+func (a *Authority) IssueServer(req Request, certPath string, keyPath string) (Record, error) {
+	key, err := rsa.GenerateKey(rand.Reader, req.Bits)
+	if err != nil {
+		return Record{}, fmt.Errorf("generate server key: %w", err)
+	}
+
+	keyDER := x509.MarshalPKCS1PrivateKey(key)
+	usage := x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	return a.issue(KindServer, req, key, usage, x509.ExtKeyUsageServerAuth, certPath, keyPath, "RSA PRIVATE KEY", keyDER)
+}
+
+// IssueClient issues certificate with ECDSA key for agent and writes them into certPath and keyPath.
+func (a *Authority) IssueClient(req Request, certPath string, keyPath string) (Record, error) {
+	if req.CommonName == "" {
+		return Record{}, fmt.Errorf("client certificate requires common name")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Record{}, fmt.Errorf("generate client key: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return Record{}, fmt.Errorf("marshal client key: %w", err)
+	}
+	return a.issue(KindClient, req, key, x509.KeyUsageDigitalSignature, x509.ExtKeyUsageClientAuth, certPath, keyPath, "EC PRIVATE KEY", keyDER)
+}
+
+// issue creates certificate for key signed by authority, writes certificate and key and adds certificate into index.
+func (a *Authority) issue(kind string, req Request, key crypto.Signer, usage x509.KeyUsage, extUsage x509.ExtKeyUsage,
+	certPath string, keyPath string, keyType string, keyDER []byte) (Record, error) {
+	idx, err := a.readIndex()
+	if err != nil {
+		return Record{}, err
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return Record{}, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(req.Validity)
+	if notAfter.After(a.cert.NotAfter) {
+		notAfter = a.cert.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   req.CommonName,
+			Organization: a.cert.Subject.Organization,
+			Country:      a.cert.Subject.Country,
+		},
+		DNSNames:    req.DNSNames,
+		IPAddresses: req.IPs,
+		NotBefore:   now,
+		NotAfter:    notAfter,
+		KeyUsage:    usage,
+		ExtKeyUsage: []x509.ExtKeyUsage{extUsage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, key.Public(), a.key)
+	if err != nil {
+		return Record{}, fmt.Errorf("create %s cert: %w", kind, err)
+	}
+
+	if err = writePEM(keyPath, keyType, keyDER, 0600); err != nil {
+		return Record{}, err
+	}
+	if err = writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return Record{}, err
+	}
+
+	record := Record{
+		Serial:   serial.Text(16),
+		Kind:     kind,
+		Subject:  req.CommonName,
+		DNSNames: req.DNSNames,
+		NotAfter: notAfter,
+	}
+	for _, ip := range req.IPs {
+		record.IPs = append(record.IPs, ip.String())
+	}
+
+	idx.Certificates = append(idx.Certificates, record)
+	if err = a.writeIndex(idx); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+// List returns issued certificates in order of issuing.
+func (a *Authority) List() ([]Record, error) {
+	idx, err := a.readIndex()
+	if err != nil {
+		return nil, err
+	}
+	return idx.Certificates, nil
+}
+
+// Revoke marks certificate with hex serial as revoked and rewrites CRL. Revoking of revoked certificate only rewrites CRL.
+func (a *Authority) Revoke(serial string) error {
+	idx, err := a.readIndex()
+	if err != nil {
+		return err
+	}
+
+	serial = strings.ToLower(strings.TrimPrefix(serial, "0x"))
+	found := false
+	now := time.Now()
+	for i := range idx.Certificates {
+		if idx.Certificates[i].Serial == serial {
+			found = true
+			if idx.Certificates[i].RevokedAt == nil {
+				idx.Certificates[i].RevokedAt = &now
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("revoke '%s': %w", serial, errUnknownSerial)
+	}
+
+	idx.CRLNumber++
+	if err = a.writeCRL(idx, now); err != nil {
+		return err
+	}
+	return a.writeIndex(idx)
+}
+
+// writeCRL writes list of revoked certificates from index signed by authority.
+func (a *Authority) writeCRL(idx *index, now time.Time) error {
+	var revoked []pkix.RevokedCertificate
+	for _, record := range idx.Certificates {
+		if record.RevokedAt == nil {
+			continue
+		}
+
+		serial, ok := new(big.Int).SetString(record.Serial, 16)
+		if !ok {
+			return fmt.Errorf("index has incorrect serial '%s'", record.Serial)
+		}
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: *record.RevokedAt})
+	}
+
+	template := &x509.RevocationList{
+		Number:              big.NewInt(idx.CRLNumber),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(crlValidity),
+		RevokedCertificates: revoked,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, a.cert, a.key)
+	if err != nil {
+		return fmt.Errorf("create CRL: %w", err)
+	}
+	return writePEM(filepath.Join(a.dir, CRLFile), "X509 CRL", der, 0644)
+}
+
+// readIndex reads index of issued certificates.
+func (a *Authority) readIndex() (*index, error) {
+	data, err := os.ReadFile(filepath.Join(a.dir, indexFile))
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+
+	idx := &index{}
+	if err = json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("parse index: %w", err)
+	}
+	return idx, nil
+}
+
+// writeIndex writes index of issued certificates.
+func (a *Authority) writeIndex(idx *index) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal index: %w", err)
+	}
+	if err = os.WriteFile(filepath.Join(a.dir, indexFile), data, 0644); err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+	return nil
+}
+
+// newSerial returns random 128 bit serial number.
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial: %w", err)
+	}
+	return serial, nil
+}
+
+// readPEM reads the first PEM block from file.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read '%s': %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("file '%s' contains no PEM data", path)
+	}
+	return block, nil
+}
+
+// writePEM writes PEM encoded block into file creating its directory if missing.
+func writePEM(path string, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create dir of '%s': %w", path, err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm); err != nil {
+		return fmt.Errorf("write '%s': %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthority(t *testing.T) {
+	dir := t.TempDir()
+	subject := pkix.Name{Organization: []string{"test"}, Country: []string{"RU"}}
+
+	_, err := Open(dir)
+	assert.Error(t, err, "authority isn't initialized")
+
+	_, err = Init(dir, subject, time.Hour)
+	require.NoError(t, err)
+	_, err = Init(dir, subject, time.Hour)
+	assert.Error(t, err, "authority is initialized twice")
+
+	authority, err := Open(dir)
+	require.NoError(t, err)
+
+	block, err := readPEM(filepath.Join(dir, CRLFile))
+	require.NoError(t, err, "empty CRL is written on init")
+	emptyCRL, err := x509.ParseRevocationList(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, emptyCRL.CheckSignatureFrom(authority.cert))
+	assert.Zero(t, emptyCRL.Number.Int64())
+	assert.Empty(t, emptyCRL.RevokedCertificates)
+
+	serverCert, serverKey := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	server, err := authority.IssueServer(Request{IPs: []net.IP{net.IPv4(127, 0, 0, 1)}, Validity: 24 * time.Hour, Bits: 1024}, serverCert, serverKey)
+	require.NoError(t, err)
+	assert.Equal(t, KindServer, server.Kind)
+	assert.Equal(t, []string{"127.0.0.1"}, server.IPs)
+	assert.False(t, server.NotAfter.After(authority.cert.NotAfter), "certificate outlives authority")
+
+	_, err = authority.IssueClient(Request{Validity: time.Hour}, filepath.Join(dir, "c.pem"), filepath.Join(dir, "c.key"))
+	assert.Error(t, err, "client without common name")
+
+	clientCert, clientKey := filepath.Join(dir, "clients", "agent_cert.pem"), filepath.Join(dir, "clients", "agent_key.pem")
+	client, err := authority.IssueClient(Request{CommonName: "agent", Validity: time.Hour}, clientCert, clientKey)
+	require.NoError(t, err)
+	assert.Equal(t, KindClient, client.Kind)
+	assert.Equal(t, "agent", client.Subject)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(authority.cert)
+	for _, tt := range []struct {
+		cert  string
+		key   string
+		usage x509.ExtKeyUsage
+	}{
+		{cert: serverCert, key: serverKey, usage: x509.ExtKeyUsageServerAuth},
+		{cert: clientCert, key: clientKey, usage: x509.ExtKeyUsageClientAuth},
+	} {
+		pair, err := tls.LoadX509KeyPair(tt.cert, tt.key)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		require.NoError(t, err)
+		_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{tt.usage}})
+		assert.NoError(t, err)
+	}
+
+	info, err := os.Stat(clientKey)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	records, err := authority.List()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, server.Serial, records[0].Serial)
+	assert.Equal(t, client.Serial, records[1].Serial)
+
+	assert.Error(t, authority.Revoke("abc"), "unknown serial")
+	require.NoError(t, authority.Revoke(client.Serial))
+
+	records, err = authority.List()
+	require.NoError(t, err)
+	assert.Nil(t, records[0].RevokedAt)
+	assert.NotNil(t, records[1].RevokedAt)
+
+	block, err = readPEM(filepath.Join(dir, CRLFile))
+	require.NoError(t, err)
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, crl.CheckSignatureFrom(authority.cert))
+	assert.Equal(t, int64(1), crl.Number.Int64(), "CRL number grows after the empty one")
+	require.Len(t, crl.RevokedCertificates, 1)
+	assert.Equal(t, client.Serial, crl.RevokedCertificates[0].SerialNumber.Text(16))
+}
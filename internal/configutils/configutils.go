@@ -14,7 +14,7 @@ import (
 )
 
 // SetEnvToParamIfNeed assigns environment value to param depends on param's type definition.
-// Accepts *int64, *string as params.
+// Accepts *int64, *time.Duration, *bool, *string as params.
 func SetEnvToParamIfNeed(param interface{}, val string) {
 	if val == "" {
 		return
@@ -33,6 +33,12 @@ func SetEnvToParamIfNeed(param interface{}, val string) {
 		} else {
 			panic(err)
 		}
+	case *bool:
+		if envVal, err := strconv.ParseBool(val); err == nil {
+			*param = envVal
+		} else {
+			panic(err)
+		}
 	case *string:
 		*param = val
 	default:
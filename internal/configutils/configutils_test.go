@@ -36,7 +36,14 @@ func TestSetEnvToParamIfNeed(t *testing.T) {
 		t.Errorf("Expected stringValue to remain 'testString', got '%s'", stringValue)
 	}
 
-	// Test case 4: Wrong input type, should panic with an error message
+	// Test case 4: Set bool parameter
+	var boolValue bool
+	SetEnvToParamIfNeed(&boolValue, "true")
+	if !boolValue {
+		t.Errorf("Expected boolValue to be true, got %t", boolValue)
+	}
+
+	// Test case 5: Wrong input type, should panic with an error message
 	defer func() {
 		if r := recover(); r == nil {
 			t.Errorf("Expected panic for wrong input type, but no panic occurred")
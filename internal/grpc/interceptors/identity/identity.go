@@ -0,0 +1,97 @@
+// Package identity provides interceptors which authorize gRPC calls by certificates of mutual TLS clients.
+package identity
+
+import (
+	"context"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/mtls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Validator authorizes calls of write methods by write permission and the rest by read permission.
+type Validator struct {
+	authorizer   *mtls.Authorizer
+	writeMethods map[string]struct{}
+}
+
+// Create returns validator, writeMethods are full names of methods which modify metrics.
+func Create(authorizer *mtls.Authorizer, writeMethods ...string) *Validator {
+	methods := make(map[string]struct{}, len(writeMethods))
+	for _, method := range writeMethods {
+		methods[method] = struct{}{}
+	}
+
+	return &Validator{
+		authorizer:   authorizer,
+		writeMethods: methods,
+	}
+}
+
+// StreamServer returns stream interceptor which rejects calls of clients without permission.
+// Identity of allowed client is put into stream context.
+func (v *Validator) StreamServer(logger logger.BaseLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		identity, err := v.authorize(ss.Context(), info.FullMethod, logger)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &identityStream{ServerStream: ss, ctx: mtls.WithIdentity(ss.Context(), identity)})
+	}
+}
+
+// UnaryServer returns unary interceptor which rejects calls of clients without permission.
+// Identity of allowed client is put into call context.
+func (v *Validator) UnaryServer(logger logger.BaseLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := v.authorize(ctx, info.FullMethod, logger)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(mtls.WithIdentity(ctx, identity), req)
+	}
+}
+
+// identityStream is a server stream with context carrying client identity.
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns context of the stream with client identity.
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+// authorize checks permission of the peer to call method and returns identity of the peer.
+func (v *Validator) authorize(ctx context.Context, method string, logger logger.BaseLogger) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "missing peer info")
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return "", status.Errorf(codes.Unauthenticated, "missing TLS info")
+	}
+
+	cert := mtls.PeerCertificate(&tlsInfo.State)
+	if cert == nil {
+		return "", status.Errorf(codes.Unauthenticated, "missing client certificate")
+	}
+
+	_, write := v.writeMethods[method]
+	identity, err := v.authorizer.Authorize(cert, write)
+	if err != nil {
+		logger.Info("[Validator:authorize] call of '%s' is denied: %v", method, err)
+		return "", status.Errorf(codes.PermissionDenied, "method '%s': %v", method, err)
+	}
+
+	return identity, nil
+}
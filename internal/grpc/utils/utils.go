@@ -1,22 +1,37 @@
 package utils
 
 import (
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/pb"
 )
 
 func ConvertMetricToGrpcFormat(metric *networkmsg.Metric) *pb.Metric {
-	if metric.MType == "gauge" {
+	switch metric.MType {
+	case "gauge":
 		return &pb.Metric{
-			Id:    metric.ID,
-			Type:  pb.Metric_GAUGE,
-			Value: *metric.Value,
+			Id:        metric.ID,
+			Type:      pb.Metric_GAUGE,
+			Value:     *metric.Value,
+			Labels:    metric.Labels,
+			Timestamp: metric.Timestamp,
 		}
-	} else {
+	case "histogram":
 		return &pb.Metric{
-			Id:    metric.ID,
-			Type:  pb.Metric_COUNTER,
-			Delta: *metric.Delta,
+			Id:        metric.ID,
+			Type:      pb.Metric_HISTOGRAM,
+			Histogram: convertHistogramToGrpcFormat(metric.Histogram),
+			Labels:    metric.Labels,
+			Timestamp: metric.Timestamp,
+		}
+	default:
+		return &pb.Metric{
+			Id:        metric.ID,
+			Type:      pb.Metric_COUNTER,
+			Delta:     *metric.Delta,
+			Labels:    metric.Labels,
+			Mode:      convertCounterModeToGrpcFormat(metric.Mode),
+			Timestamp: metric.Timestamp,
 		}
 	}
 }
@@ -25,18 +40,85 @@ func ConvertGrpcFormatToMetric(metric *pb.Metric) *networkmsg.Metric {
 	if metric.Type == pb.Metric_GAUGE {
 		value := metric.Value
 		return &networkmsg.Metric{
-			ID:    metric.Id,
-			MType: "gauge",
-			Value: &value,
+			ID:        metric.Id,
+			MType:     "gauge",
+			Value:     &value,
+			Labels:    metric.Labels,
+			Timestamp: metric.Timestamp,
 		}
 	} else if metric.Type == pb.Metric_COUNTER {
 		delta := metric.Delta
 		return &networkmsg.Metric{
-			ID:    metric.Id,
-			MType: "counter",
-			Delta: &delta,
+			ID:        metric.Id,
+			MType:     "counter",
+			Delta:     &delta,
+			Labels:    metric.Labels,
+			Mode:      convertGrpcFormatToCounterMode(metric.Mode),
+			Timestamp: metric.Timestamp,
+		}
+	} else if metric.Type == pb.Metric_HISTOGRAM {
+		return &networkmsg.Metric{
+			ID:        metric.Id,
+			MType:     "histogram",
+			Histogram: convertGrpcFormatToHistogram(metric.Histogram),
+			Labels:    metric.Labels,
+			Timestamp: metric.Timestamp,
 		}
 	}
 
 	return nil
 }
+
+// ConvertGrpcFormatToMetricType converts metric type into its name. Unknown type is converted into empty name.
+func ConvertGrpcFormatToMetricType(metricType pb.Metric_Type) string {
+	switch metricType {
+	case pb.Metric_GAUGE:
+		return "gauge"
+	case pb.Metric_COUNTER:
+		return "counter"
+	case pb.Metric_HISTOGRAM:
+		return "histogram"
+	default:
+		return ""
+	}
+}
+
+func convertCounterModeToGrpcFormat(mode string) pb.Metric_CounterMode {
+	if mode == networkmsg.CounterCumulative {
+		return pb.Metric_CUMULATIVE
+	}
+	return pb.Metric_DELTA
+}
+
+func convertGrpcFormatToCounterMode(mode pb.Metric_CounterMode) string {
+	if mode == pb.Metric_CUMULATIVE {
+		return networkmsg.CounterCumulative
+	}
+	return ""
+}
+
+func convertHistogramToGrpcFormat(value *histogram.Histogram) *pb.Histogram {
+	if value == nil {
+		return nil
+	}
+
+	return &pb.Histogram{
+		Bounds: value.Bounds,
+		Counts: value.Counts,
+		Count:  value.Count,
+		Sum:    value.Sum,
+	}
+}
+
+func convertGrpcFormatToHistogram(value *pb.Histogram) *histogram.Histogram {
+	if value == nil {
+		return nil
+	}
+
+	return &histogram.Histogram{
+		Bounds: value.Bounds,
+		Counts: value.Counts,
+		Count:  value.Count,
+		Sum:    value.Sum,
+	}
+}
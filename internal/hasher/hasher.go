@@ -45,8 +45,24 @@ func CreateHasher(hashKey string, hashType int, log logger.BaseLogger) *Hasher {
 // Handler middleware handler.
 // Validates incoming messages and check hash-sum.
 func (hr *Hasher) Handler(h http.Handler) http.Handler {
+	return hr.handler(h, false)
+}
+
+// RequireHandler middleware handler.
+// Validates incoming messages like Handler, but rejects messages without hash-sum if hash key was assigned.
+func (hr *Hasher) RequireHandler(h http.Handler) http.Handler {
+	return hr.handler(h, true)
+}
+
+// handler validates hash-sum of incoming messages. Messages without hash-sum are rejected if required.
+func (hr *Hasher) handler(h http.Handler, required bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		hashHeaderValue := r.Header.Get(hr.GetHeader())
+		if hashHeaderValue == "" && required && hr.key != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
 		if hashHeaderValue != "" {
 			var buf bytes.Buffer
 			_, err := io.Copy(&buf, r.Body)
@@ -450,3 +450,53 @@ func TestHasher_Handler(t *testing.T) {
 		})
 	}
 }
+
+func TestHasher_RequireHandler(t *testing.T) {
+	tests := []struct {
+		name            string
+		hashKey         string
+		hashHeaderValue string
+		wantStatusCode  int
+	}{
+		{
+			name:            "valid hash",
+			hashKey:         "123",
+			hashHeaderValue: "b325442b7351543173366c32ad347b7f2b643e6bdabe7aa3717c819caeb9726c",
+			wantStatusCode:  http.StatusOK,
+		},
+		{
+			name:            "invalid hash",
+			hashKey:         "123",
+			hashHeaderValue: "b325442b7351543173366c32ad347b7f2b643e6bdabe7aa3717c819caeb2726c",
+			wantStatusCode:  http.StatusBadRequest,
+		},
+		{
+			name:           "missing hash",
+			hashKey:        "123",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "missing hash with empty key",
+			wantStatusCode: http.StatusOK,
+		},
+	}
+	for _, ttCommon := range tests {
+		tt := ttCommon
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			hr := CreateHasher(tt.hashKey, SHA256, logger.CreateMock())
+
+			req := httptest.NewRequest("POST", "/", bytes.NewReader([]byte("{\"some message text\"}")))
+			if tt.hashHeaderValue != "" {
+				req.Header.Set(hr.GetHeader(), tt.hashHeaderValue)
+			}
+
+			rr := httptest.NewRecorder()
+			hr.RequireHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatusCode, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package histogram implements bucketed distribution of observed values.
+// Histogram keeps count of observations per bucket defined by ascending upper bounds,
+// total count and sum of observations. Histograms with the same bounds can be merged.
+package histogram
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Histogram represents distribution of observed values.
+//
+// Bucket i counts observations v with Bounds[i-1] < v <= Bounds[i].
+// The last bucket (len(Bounds)) counts observations greater than the last bound.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"` // ascending upper bounds of buckets.
+	Counts []uint64  `json:"counts"` // observations per bucket, has len(Bounds)+1 elements.
+	Count  uint64    `json:"count"`  // total number of observations.
+	Sum    float64   `json:"sum"`    // sum of observations.
+}
+
+// New creates empty histogram with the given buckets upper bounds.
+func New(bounds []float64) (*Histogram, error) {
+	h := &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Observe adds value in the histogram.
+func (h *Histogram) Observe(value float64) {
+	idx := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[idx]++
+	h.Count++
+	h.Sum += value
+}
+
+// Merge adds observations of other histogram. Histograms must have the same bounds.
+func (h *Histogram) Merge(other *Histogram) error {
+	if !h.hasSameBounds(other) {
+		return fmt.Errorf("merge histograms: bounds mismatch %v and %v", h.Bounds, other.Bounds)
+	}
+
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	return nil
+}
+
+// Clone returns deep copy of the histogram.
+func (h *Histogram) Clone() *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+}
+
+// Validate checks that bounds are finite and strictly ascending and counts are consistent with bounds and total count.
+func (h *Histogram) Validate() error {
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("invalid histogram: bound %d is not finite", i)
+		}
+
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return fmt.Errorf("invalid histogram: bounds are not strictly ascending")
+		}
+	}
+
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("invalid histogram: expected %d bucket counts, got %d", len(h.Bounds)+1, len(h.Counts))
+	}
+
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+
+	if total != h.Count {
+		return fmt.Errorf("invalid histogram: buckets total %d differs from count %d", total, h.Count)
+	}
+	return nil
+}
+
+// hasSameBounds checks that histograms have equal bounds.
+func (h *Histogram) hasSameBounds(other *Histogram) bool {
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return false
+	}
+
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return false
+		}
+	}
+	return true
+}
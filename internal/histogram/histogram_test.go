@@ -0,0 +1,99 @@
+package histogram
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		bounds  []float64
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{"valid", []float64{1, 2, 5}, assert.NoError},
+		{"without bounds", nil, assert.NoError},
+		{"not ascending bounds", []float64{1, 1}, assert.Error},
+		{"infinite bound", []float64{1, math.Inf(1)}, assert.Error},
+		{"NaN bound", []float64{math.NaN()}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := New(tt.bounds)
+			if !tt.wantErr(t, err) || err != nil {
+				return
+			}
+
+			assert.Len(t, h.Counts, len(tt.bounds)+1)
+		})
+	}
+}
+
+func TestHistogram_Observe(t *testing.T) {
+	h, err := New([]float64{1, 2, 5})
+	require.NoError(t, err)
+
+	for _, value := range []float64{0.5, 1, 1.5, 5, 7} {
+		h.Observe(value)
+	}
+
+	assert.Equal(t, []uint64{2, 1, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(5), h.Count)
+	assert.Equal(t, 15.0, h.Sum)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	h, err := New([]float64{1, 2})
+	require.NoError(t, err)
+	h.Observe(1)
+
+	other, err := New([]float64{1, 2})
+	require.NoError(t, err)
+	other.Observe(2)
+	other.Observe(3)
+
+	require.NoError(t, h.Merge(other))
+	assert.Equal(t, []uint64{1, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(3), h.Count)
+	assert.Equal(t, 6.0, h.Sum)
+
+	mismatched, err := New([]float64{1, 3})
+	require.NoError(t, err)
+	assert.Error(t, h.Merge(mismatched))
+	assert.Equal(t, uint64(3), h.Count)
+}
+
+func TestHistogram_Clone(t *testing.T) {
+	h, err := New([]float64{1})
+	require.NoError(t, err)
+	h.Observe(1)
+
+	clone := h.Clone()
+	clone.Observe(2)
+
+	assert.Equal(t, uint64(1), h.Count)
+	assert.Equal(t, []uint64{1, 0}, h.Counts)
+	assert.Equal(t, uint64(2), clone.Count)
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       Histogram
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{"valid", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Count: 3, Sum: 10}, assert.NoError},
+		{"wrong counts length", Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}, assert.Error},
+		{"wrong total count", Histogram{Bounds: []float64{1}, Counts: []uint64{1, 2}, Count: 1}, assert.Error},
+		{"not ascending bounds", Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.wantErr(t, tt.h.Validate())
+		})
+	}
+}
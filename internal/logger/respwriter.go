@@ -36,3 +36,8 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
 	r.responseData.status = statusCode
 }
+
+// Unwrap returns decorated http.ResponseWriter, it lets http.ResponseController reach its optional methods (e.g. Flush).
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,100 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var errRevoked = errors.New("certificate is revoked")
+
+// revocationList checks clients certificates against CRL file. File is reloaded once it is modified,
+// so certificates may be revoked without restart of server.
+type revocationList struct {
+	path    string
+	issuers []*x509.Certificate
+
+	modTime time.Time
+	revoked map[string]struct{}
+	mu      sync.Mutex
+}
+
+// loadRevocationList returns revocation list loaded from file signed by one of issuers.
+func loadRevocationList(path string, issuers []*x509.Certificate) (*revocationList, error) {
+	l := &revocationList{path: path, issuers: issuers}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// verify rejects revoked client certificate. Suits tls.Config.VerifyPeerCertificate.
+func (l *revocationList) verify(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// unreadable CRL fails verification, so revoked certificates aren't accepted.
+	if err := l.reload(); err != nil {
+		return err
+	}
+
+	for _, chain := range verifiedChains {
+		if len(chain) == 0 {
+			continue
+		}
+		if _, ok := l.revoked[chain[0].SerialNumber.String()]; ok {
+			return fmt.Errorf("'%s': %w", Identity(chain[0]), errRevoked)
+		}
+	}
+	return nil
+}
+
+// reload reads CRL if file was modified since the last reading. Must be called under mu or before sharing.
+func (l *revocationList) reload() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return fmt.Errorf("stat CRL: %w", err)
+	}
+	if l.revoked != nil && info.ModTime().Equal(l.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("read CRL: %w", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("parse CRL: %w", err)
+	}
+	if err = l.checkIssuer(crl); err != nil {
+		return err
+	}
+
+	revoked := make(map[string]struct{}, len(crl.RevokedCertificates))
+	for _, entry := range crl.RevokedCertificates {
+		revoked[entry.SerialNumber.String()] = struct{}{}
+	}
+
+	l.revoked = revoked
+	l.modTime = info.ModTime()
+	return nil
+}
+
+// checkIssuer checks that CRL is signed by one of issuers.
+func (l *revocationList) checkIssuer(crl *x509.RevocationList) error {
+	for _, issuer := range l.issuers {
+		if crl.CheckSignatureFrom(issuer) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("CRL '%s' is not signed by client CA", l.path)
+}
@@ -0,0 +1,81 @@
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/certs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerConfig_RevocationList(t *testing.T) {
+	dir := t.TempDir()
+	authority, err := certs.Init(dir, pkix.Name{Organization: []string{"test"}}, time.Hour)
+	require.NoError(t, err)
+
+	serverCert, serverKey := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_, err = authority.IssueServer(certs.Request{IPs: []net.IP{net.IPv4(127, 0, 0, 1)}, Validity: time.Hour, Bits: 1024}, serverCert, serverKey)
+	require.NoError(t, err)
+
+	issueClient := func(name string) (*tls.Config, string) {
+		certPath, keyPath := filepath.Join(dir, name+"_cert.pem"), filepath.Join(dir, name+"_key.pem")
+		record, err := authority.IssueClient(certs.Request{CommonName: name, Validity: time.Hour}, certPath, keyPath)
+		require.NoError(t, err)
+
+		config, err := ClientConfig(certPath, keyPath, filepath.Join(dir, certs.CACertFile), "127.0.0.1")
+		require.NoError(t, err)
+		return config, record.Serial
+	}
+	agent1, serial1 := issueClient("agent-1")
+	agent2, serial2 := issueClient("agent-2")
+
+	_, err = ServerConfig(serverCert, serverKey, filepath.Join(dir, certs.CACertFile), filepath.Join(dir, "missing_crl.pem"))
+	assert.Error(t, err, "CRL is missing")
+
+	crlPath := filepath.Join(dir, certs.CRLFile)
+	_, err = ServerConfig(serverCert, serverKey, filepath.Join(dir, certs.CACertFile), crlPath)
+	require.NoError(t, err, "empty CRL of initialized authority")
+
+	require.NoError(t, authority.Revoke(serial1))
+	serverConfig, err := ServerConfig(serverCert, serverKey, filepath.Join(dir, certs.CACertFile), crlPath)
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = serverConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(config *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	assert.Error(t, get(agent1), "revoked client")
+	assert.NoError(t, get(agent2), "valid client")
+
+	// CRL is reloaded once it's modified.
+	require.NoError(t, authority.Revoke(serial2))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(crlPath, later, later))
+	assert.Error(t, get(agent2), "client revoked after start of server")
+
+	// unreadable CRL rejects any client.
+	require.NoError(t, os.WriteFile(crlPath, []byte("broken"), 0644))
+	require.NoError(t, os.Chtimes(crlPath, later.Add(time.Minute), later.Add(time.Minute)))
+	agent3, _ := issueClient("agent-3")
+	assert.Error(t, get(agent3), "broken CRL")
+}
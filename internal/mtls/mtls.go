@@ -0,0 +1,225 @@
+// Package mtls provides mutual TLS configs for servers and agents and authorization of clients by certificates.
+// Client identity is taken from its verified certificate: subject common name or the first SAN if common name is empty.
+// Read and write permissions are granted to identities from allow-lists, empty allow-list grants permission to
+// any client with certificate signed by trusted CA.
+package mtls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+var (
+	errMissingCertificate = errors.New("client certificate is missing")
+	errNotAllowed         = errors.New("identity is not allowed")
+)
+
+// ServerConfig returns TLS config of server which requires clients certificates signed by CA from caPath.
+// Certificates revoked by CRL from crlPath are rejected, empty crlPath disables revocation check.
+func ServerConfig(certPath string, keyPath string, caPath string, crlPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load server cert: %w", err)
+	}
+
+	clientCAs, err := loadCerts(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("load client CA: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    certPool(clientCAs),
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if crlPath != "" {
+		crl, err := loadRevocationList(crlPath, clientCAs)
+		if err != nil {
+			return nil, fmt.Errorf("load client CRL: %w", err)
+		}
+		config.VerifyPeerCertificate = crl.verify
+	}
+	return config, nil
+}
+
+// ClientConfig returns TLS config of client which presents certificate and verifies server serverName by CA from caPath.
+func ClientConfig(certPath string, keyPath string, caPath string, serverName string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load client cert: %w", err)
+	}
+
+	rootCAs, err := loadCerts(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("load server CA: %w", err)
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      certPool(rootCAs),
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// loadCerts reads PEM encoded certificates from file.
+func loadCerts(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate from '%s': %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("file '%s' contains no certificates", path)
+	}
+	return certs, nil
+}
+
+// certPool returns pool of certificates.
+func certPool(certs []*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	return pool
+}
+
+// PeerCertificate returns verified certificate of the peer or nil if peer wasn't verified.
+func PeerCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// Identity returns identity of certificate's owner: subject common name or the first of DNS, URI, email and IP SANs.
+func Identity(cert *x509.Certificate) string {
+	if identities := names(cert); len(identities) != 0 {
+		return identities[0]
+	}
+	return ""
+}
+
+// names returns subject common name and SANs of certificate.
+func names(cert *x509.Certificate) []string {
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		identities = append(identities, ip.String())
+	}
+	return identities
+}
+
+// identityKey is a context key of verified client identity.
+type identityKey struct{}
+
+// WithIdentity returns copy of ctx with verified identity of the client.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns verified identity of the client put by authorizer's middleware or interceptors.
+// Returns false if client wasn't authorized by certificate.
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// Authorizer grants read and write permissions to clients by identities of their certificates.
+type Authorizer struct {
+	read  map[string]struct{}
+	write map[string]struct{}
+}
+
+// CreateAuthorizer returns authorizer with allow-lists of read and write identities.
+// Empty allow-list grants permission to any verified client.
+func CreateAuthorizer(read []string, write []string) *Authorizer {
+	return &Authorizer{read: toSet(read), write: toSet(write)}
+}
+
+// toSet converts list of identities into set.
+func toSet(identities []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(identities))
+	for _, identity := range identities {
+		set[identity] = struct{}{}
+	}
+	return set
+}
+
+// Authorize checks if owner of verified certificate has read or write permission.
+// Any of certificate's names may be listed in allow-list. Returns identity of the owner.
+func (a *Authorizer) Authorize(cert *x509.Certificate, write bool) (string, error) {
+	if cert == nil {
+		return "", errMissingCertificate
+	}
+
+	allowed := a.read
+	if write {
+		allowed = a.write
+	}
+
+	identity := Identity(cert)
+	if len(allowed) == 0 {
+		return identity, nil
+	}
+
+	for _, name := range names(cert) {
+		if _, ok := allowed[name]; ok {
+			return identity, nil
+		}
+	}
+	return identity, fmt.Errorf("'%s': %w", identity, errNotAllowed)
+}
+
+// Handler returns middleware which rejects requests of clients without read or write permission.
+// Identity of allowed client is put into request context.
+func (a *Authorizer) Handler(write bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, err := a.Authorize(PeerCertificate(r.TLS), write)
+			if err != nil {
+				if errors.Is(err, errMissingCertificate) {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+				} else {
+					http.Error(w, err.Error(), http.StatusForbidden)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package mtls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authority issues certificates for tests.
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func createAuthority(t *testing.T, dir string) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &authority{cert: cert, key: key, dir: dir}
+	ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+// issue creates certificate from template signed by authority and writes it with its key into files name.pem and name.key.
+func (a *authority) issue(t *testing.T, name string, template *x509.Certificate) (certPath string, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return a.write(t, name+".pem", "CERTIFICATE", der), a.write(t, name+".key", "EC PRIVATE KEY", keyDER)
+}
+
+func (a *authority) write(t *testing.T, name string, blockType string, der []byte) string {
+	path := filepath.Join(a.dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+func TestIdentity(t *testing.T) {
+	uri, err := url.Parse("spiffe://metrics/agent")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want string
+	}{
+		{name: "common name", cert: &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}, DNSNames: []string{"host-1"}}, want: "agent-1"},
+		{name: "dns", cert: &x509.Certificate{DNSNames: []string{"host-1"}, URIs: []*url.URL{uri}}, want: "host-1"},
+		{name: "uri", cert: &x509.Certificate{URIs: []*url.URL{uri}}, want: "spiffe://metrics/agent"},
+		{name: "ip", cert: &x509.Certificate{IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}, want: "127.0.0.1"},
+		{name: "empty", cert: &x509.Certificate{}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Identity(tt.cert))
+		})
+	}
+}
+
+func TestAuthorizer_Authorize(t *testing.T) {
+	uri, err := url.Parse("spiffe://metrics/writer")
+	require.NoError(t, err)
+
+	reader := &x509.Certificate{Subject: pkix.Name{CommonName: "reader"}}
+	writer := &x509.Certificate{Subject: pkix.Name{CommonName: "agent-1"}, URIs: []*url.URL{uri}}
+	authorizer := CreateAuthorizer(nil, []string{"spiffe://metrics/writer"})
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		write   bool
+		want    string
+		wantErr bool
+	}{
+		{name: "any identity reads", cert: reader, want: "reader"},
+		{name: "listed san writes", cert: writer, write: true, want: "agent-1"},
+		{name: "not listed identity writes", cert: reader, write: true, want: "reader", wantErr: true},
+		{name: "missing certificate", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := authorizer.Authorize(tt.cert, tt.write)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAuthorizer_Handler(t *testing.T) {
+	dir := t.TempDir()
+	ca := createAuthority(t, dir)
+	serverCert, serverKey := ca.issue(t, "server", &x509.Certificate{IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}})
+	writerCert, writerKey := ca.issue(t, "writer", &x509.Certificate{Subject: pkix.Name{CommonName: "writer"}})
+	readerCert, readerKey := ca.issue(t, "reader", &x509.Certificate{Subject: pkix.Name{CommonName: "reader"}})
+	stranger := createAuthority(t, t.TempDir())
+	strangerCert, strangerKey := stranger.issue(t, "writer", &x509.Certificate{Subject: pkix.Name{CommonName: "writer"}})
+
+	serverConfig, err := ServerConfig(serverCert, serverKey, filepath.Join(dir, "ca.pem"), "")
+	require.NoError(t, err)
+
+	authorizer := CreateAuthorizer([]string{"reader", "writer"}, []string{"writer"})
+	ts := httptest.NewUnstartedServer(authorizer.Handler(true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := IdentityFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "writer", identity)
+		w.WriteHeader(http.StatusOK)
+	})))
+	ts.TLS = serverConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	tests := []struct {
+		name    string
+		cert    string
+		key     string
+		code    int
+		wantErr bool
+	}{
+		{name: "allowed identity", cert: writerCert, key: writerKey, code: http.StatusOK},
+		{name: "not allowed identity", cert: readerCert, key: readerKey, code: http.StatusForbidden},
+		{name: "untrusted CA", cert: strangerCert, key: strangerKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := ClientConfig(tt.cert, tt.key, filepath.Join(dir, "ca.pem"), "127.0.0.1")
+			require.NoError(t, err)
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+			resp, err := client.Get(ts.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+
+	_, ok := IdentityFromContext(context.Background())
+	assert.False(t, ok)
+
+	// configs are not created from missing files.
+	_, err = ClientConfig("", "", filepath.Join(dir, "ca.pem"), "127.0.0.1")
+	assert.Error(t, err)
+	_, err = ServerConfig(serverCert, serverKey, filepath.Join(dir, "missing.pem"), "")
+	assert.Error(t, err)
+}
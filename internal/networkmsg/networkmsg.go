@@ -6,17 +6,43 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/mailru/easyjson"
 )
 
+const (
+	// AgentIDHeader is a HTTP header (gRPC metadata key) with identifier of the agent sent metrics.
+	AgentIDHeader = "X-Agent-ID"
+	// AgentLabel is a label name for identifier of the agent sent metric.
+	AgentLabel = "agent"
+)
+
+// Submission modes of counter value.
+const (
+	// CounterDelta mode means that counter value is an increment added to the stored counter (default).
+	CounterDelta = "delta"
+	// CounterCumulative mode means that counter value is a total since the sender start.
+	// Server computes increment from the previous value and treats decrease as the sender restart.
+	CounterCumulative = "cumulative"
+)
+
 // Metric definition of transferred data.
 //
 //go:generate easyjson -all networkmsg.go
 type Metric struct {
-	ID    string   `json:"id"`              // name
-	MType string   `json:"type"`            // defines type of metric (gauge/counter)
-	Delta *int64   `json:"delta,omitempty"` // value for counter type
-	Value *float64 `json:"value,omitempty"` // value for gauge type
+	ID        string               `json:"id"`                  // name
+	MType     string               `json:"type"`                // defines type of metric (gauge/counter/histogram)
+	Delta     *int64               `json:"delta,omitempty"`     // value for counter type
+	Value     *float64             `json:"value,omitempty"`     // value for gauge type
+	Histogram *histogram.Histogram `json:"histogram,omitempty"` // value for histogram type
+	Labels    map[string]string    `json:"labels,omitempty"`    // optional labels identifying series together with name
+	Mode      string               `json:"mode,omitempty"`      // submission mode for counter type (delta/cumulative), delta if empty
+	Timestamp int64                `json:"timestamp,omitempty"` // collection time (unix milliseconds), receiving time is used if empty
+}
+
+// Key returns series key of the metric built from its name and labels.
+func (m *Metric) Key() string {
+	return SeriesKey(m.ID, m.Labels)
 }
 
 // CreateCounterMetrics creates counter Metric entity.
@@ -29,6 +55,13 @@ func CreateCounterMetrics(name string, value int64) Metric {
 	}
 }
 
+// CreateCumulativeCounterMetrics creates counter Metric entity with total value since the sender start.
+func CreateCumulativeCounterMetrics(name string, value int64) Metric {
+	metric := CreateCounterMetrics(name, value)
+	metric.Mode = CounterCumulative
+	return metric
+}
+
 // CreateGaugeMetrics creates gauge Metric entity.
 func CreateGaugeMetrics(name string, value float64) Metric {
 	return Metric{
@@ -39,6 +72,15 @@ func CreateGaugeMetrics(name string, value float64) Metric {
 	}
 }
 
+// CreateHistogramMetrics creates histogram Metric entity.
+func CreateHistogramMetrics(name string, value *histogram.Histogram) Metric {
+	return Metric{
+		ID:        name,
+		MType:     "histogram",
+		Histogram: value,
+	}
+}
+
 // CreatePostUpdateMessage converts Metric entity into JSON format.
 func CreatePostUpdateMessage(data Metric) []byte {
 	out, err := easyjson.Marshal(data)
@@ -81,12 +123,22 @@ func ParsePostBatchValueMessage(message []byte) ([]Metric, error) {
 	return out, nil
 }
 
+// Validate checks that Metric data is correct, see isMetricValid.
+func Validate(m Metric) error {
+	_, err := isMetricValid(m)
+	return err
+}
+
 // isMetricValid validates that Metric data is correct.
 // Checks name and type on empty, check two delta and value fields filling at the same time.
+// Metric and label names have to be valid (see IsValidName and IsValidLabelName) to keep series keys unambiguous.
+// Histogram value is allowed for histogram type only and has to be consistent.
 func isMetricValid(m Metric) (bool, error) {
 	errMsg := ""
 	if m.ID == "" {
 		errMsg += "missing name "
+	} else if !IsValidName(m.ID) {
+		errMsg += fmt.Sprintf("invalid name '%s' ", m.ID)
 	}
 
 	if m.MType == "" {
@@ -97,6 +149,36 @@ func isMetricValid(m Metric) (bool, error) {
 		errMsg += " both values exists"
 	}
 
+	for name := range m.Labels {
+		if name == "" {
+			errMsg += " empty label name"
+		} else if !IsValidLabelName(name) {
+			errMsg += fmt.Sprintf(" invalid label name '%s'", name)
+		}
+	}
+
+	if m.Mode != "" {
+		if m.MType != "counter" {
+			errMsg += " mode for non-counter type"
+		} else if m.Mode != CounterDelta && m.Mode != CounterCumulative {
+			errMsg += " unknown counter mode"
+		}
+	}
+
+	if m.MType == "histogram" {
+		if m.Delta != nil || m.Value != nil {
+			errMsg += " scalar value for histogram"
+		}
+
+		if m.Histogram != nil {
+			if err := m.Histogram.Validate(); err != nil {
+				errMsg += " " + err.Error()
+			}
+		}
+	} else if m.Histogram != nil {
+		errMsg += " histogram value for scalar type"
+	}
+
 	if len(errMsg) != 0 {
 		return false, fmt.Errorf("%s", errMsg)
 	}
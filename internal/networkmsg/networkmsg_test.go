@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -115,6 +116,19 @@ func TestParsePostValueMessage(t *testing.T) {
 			},
 			wantErr: assert.NoError,
 		},
+		{
+			name: "valid with timestamp",
+			args: args{
+				message: []byte(`{"id":"counter_metric","type":"counter","delta":42,"timestamp":1700000000000}`),
+			},
+			want: Metric{
+				ID:        "counter_metric",
+				MType:     "counter",
+				Delta:     &delta,
+				Timestamp: 1700000000000,
+			},
+			wantErr: assert.NoError,
+		},
 		{
 			name: "incorrect json",
 			args: args{
@@ -195,6 +209,30 @@ func Test_isMetricValid(t *testing.T) {
 			want:    true,
 			wantErr: assert.NoError,
 		},
+		{
+			name: "valid cumulative counter",
+			args: args{
+				m: CreateCumulativeCounterMetrics("counter_metric", 42),
+			},
+			want:    true,
+			wantErr: assert.NoError,
+		},
+		{
+			name: "unknown counter mode",
+			args: args{
+				m: Metric{ID: "counter_metric", MType: "counter", Delta: &delta, Mode: "absolute"},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "mode for gauge",
+			args: args{
+				m: Metric{ID: "gauge_metric", MType: "gauge", Value: &value, Mode: CounterCumulative},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
 		{
 			name: "valid gauge",
 			args: args{
@@ -203,6 +241,46 @@ func Test_isMetricValid(t *testing.T) {
 			want:    true,
 			wantErr: assert.NoError,
 		},
+		{
+			name: "valid histogram",
+			args: args{
+				m: CreateHistogramMetrics("histogram_metric", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 2, Sum: 3}),
+			},
+			want:    true,
+			wantErr: assert.NoError,
+		},
+		{
+			name: "inconsistent histogram",
+			args: args{
+				m: CreateHistogramMetrics("histogram_metric", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 2}),
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "histogram with scalar value",
+			args: args{
+				m: Metric{
+					ID:    "histogram_metric",
+					MType: "histogram",
+					Value: &value,
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "gauge with histogram value",
+			args: args{
+				m: Metric{
+					ID:        "gauge_metric",
+					MType:     "gauge",
+					Histogram: &histogram.Histogram{Counts: []uint64{0}},
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
 		{
 			name: "missing name",
 			args: args{
@@ -227,6 +305,82 @@ func Test_isMetricValid(t *testing.T) {
 			want:    false,
 			wantErr: assert.Error,
 		},
+		{
+			name: "invalid name",
+			args: args{
+				m: Metric{
+					ID:    "counter{host=\"a\"}",
+					MType: "counter",
+					Delta: &delta,
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "reserved name",
+			args: args{
+				m: Metric{
+					ID:    "__counter",
+					MType: "counter",
+					Delta: &delta,
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "invalid label name",
+			args: args{
+				m: Metric{
+					ID:     "counter_metric",
+					MType:  "counter",
+					Delta:  &delta,
+					Labels: map[string]string{"host,zone": "a"},
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "reserved label name",
+			args: args{
+				m: Metric{
+					ID:     "counter_metric",
+					MType:  "counter",
+					Delta:  &delta,
+					Labels: map[string]string{"__name__": "a"},
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "colon in label name",
+			args: args{
+				m: Metric{
+					ID:     "counter_metric",
+					MType:  "counter",
+					Delta:  &delta,
+					Labels: map[string]string{"host:zone": "a"},
+				},
+			},
+			want:    false,
+			wantErr: assert.Error,
+		},
+		{
+			name: "valid names",
+			args: args{
+				m: Metric{
+					ID:     "http:requests_total2",
+					MType:  "counter",
+					Delta:  &delta,
+					Labels: map[string]string{"_host1": "a{b=\"c\"}"},
+				},
+			},
+			want:    true,
+			wantErr: assert.NoError,
+		},
 		{
 			name: "two values",
 			args: args{
@@ -281,6 +435,13 @@ func TestCreatePostUpdateMessage(t *testing.T) {
 			},
 			want: []byte(`{"id":"counter_metric","type":"counter","delta":42}`),
 		},
+		{
+			name: "valid with timestamp",
+			args: args{
+				data: Metric{ID: "gauge_metric", MType: "gauge", Value: new(float64), Timestamp: 1700000000000},
+			},
+			want: []byte(`{"id":"gauge_metric","type":"gauge","value":0,"timestamp":1700000000000}`),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
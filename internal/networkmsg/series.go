@@ -0,0 +1,170 @@
+package networkmsg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// reservedPrefix is a prefix of metric and label names reserved for internal use.
+const reservedPrefix = "__"
+
+// IsValidName checks that metric name matches [a-zA-Z_:][a-zA-Z0-9_:]* and has no reserved prefix '__'.
+// Valid names keep series keys unambiguous.
+func IsValidName(name string) bool {
+	return isValidName(name, true)
+}
+
+// IsValidLabelName checks that label name matches [a-zA-Z_][a-zA-Z0-9_]* and has no reserved prefix '__'.
+func IsValidLabelName(name string) bool {
+	return isValidName(name, false)
+}
+
+// isValidName checks name symbols. Colons are allowed for metric names only.
+func isValidName(name string, allowColon bool) bool {
+	if name == "" || strings.HasPrefix(name, reservedPrefix) {
+		return false
+	}
+
+	for i, ch := range name {
+		switch {
+		case ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z'):
+		case ch == ':' && allowColon:
+		case ch >= '0' && ch <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// SanitizeName converts name into metric name matching [a-zA-Z_:][a-zA-Z0-9_:]*.
+// Invalid characters are replaced by underscores.
+func SanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// SanitizeLabelName converts name into label name matching [a-zA-Z_][a-zA-Z0-9_]*.
+// Invalid characters are replaced by underscores.
+func SanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+// sanitize replaces invalid for name characters by underscores. Colons are allowed for metric names only.
+func sanitize(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	b.Grow(len(name) + 1)
+	for i, ch := range name {
+		switch {
+		case ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z'):
+			b.WriteRune(ch)
+		case ch == ':' && allowColon:
+			b.WriteRune(ch)
+		case ch >= '0' && ch <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(ch)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
+
+// SeriesKey builds unique series key from metric name and labels in format 'name{label1="value1",label2="value2"}'.
+// Labels are sorted by name. Metric without labels is identified by its name only.
+func SeriesKey(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+	sort.Strings(labelNames)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i, labelName := range labelNames {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(labelName)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(labels[labelName]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+
+	return sb.String()
+}
+
+// ParseSeriesKey splits series key built by SeriesKey into metric name and labels.
+// Key without labels part is returned as name with nil labels.
+func ParseSeriesKey(key string) (string, map[string]string, error) {
+	start := strings.IndexByte(key, '{')
+	if start == -1 || !strings.HasSuffix(key, "}") {
+		return key, nil, nil
+	}
+
+	name, body := key[:start], key[start+1:len(key)-1]
+	labels := map[string]string{}
+	for len(body) > 0 {
+		eq := strings.Index(body, `="`)
+		if eq <= 0 {
+			return key, nil, fmt.Errorf("parse series key '%s': missing label value", key)
+		}
+		labelName := body[:eq]
+		body = body[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(body); i++ {
+			ch := body[i]
+			if ch == '\\' && i+1 < len(body) {
+				i++
+				switch body[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(body[i])
+				}
+				continue
+			}
+
+			if ch == '"' {
+				body = body[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(ch)
+		}
+
+		if !closed {
+			return key, nil, fmt.Errorf("parse series key '%s': unterminated value of label '%s'", key, labelName)
+		}
+		labels[labelName] = value.String()
+
+		if len(body) > 0 {
+			if body[0] != ',' {
+				return key, nil, fmt.Errorf("parse series key '%s': unexpected symbol after label '%s'", key, labelName)
+			}
+			body = body[1:]
+		}
+	}
+
+	return name, labels, nil
+}
+
+// escapeLabelValue escapes backslash, double-quote and line feed symbols in label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,86 @@
+package networkmsg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric string
+		labels map[string]string
+		want   string
+	}{
+		{"without labels", "Alloc", nil, "Alloc"},
+		{"empty labels", "Alloc", map[string]string{}, "Alloc"},
+		{"single label", "Alloc", map[string]string{"host": "a"}, `Alloc{host="a"}`},
+		{"sorted labels", "Alloc", map[string]string{"zone": "eu", "host": "a"}, `Alloc{host="a",zone="eu"}`},
+		{"escaped value", "Alloc", map[string]string{"path": "c:\\\"x\"\n"}, `Alloc{path="c:\\\"x\"\n"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SeriesKey(tt.metric, tt.labels))
+		})
+	}
+}
+
+func TestParseSeriesKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		wantName   string
+		wantLabels map[string]string
+		wantErr    assert.ErrorAssertionFunc
+	}{
+		{"without labels", "Alloc", "Alloc", nil, assert.NoError},
+		{"with labels", `Alloc{host="a",zone="eu"}`, "Alloc", map[string]string{"host": "a", "zone": "eu"}, assert.NoError},
+		{"escaped value", `Alloc{path="c:\\\"x\"\n",host="a,b"}`, "Alloc", map[string]string{"path": "c:\\\"x\"\n", "host": "a,b"}, assert.NoError},
+		{"missing value", `Alloc{host}`, `Alloc{host}`, nil, assert.Error},
+		{"unterminated value", `Alloc{host="a}`, `Alloc{host="a}`, nil, assert.Error},
+		{"missing separator", `Alloc{host="a"zone="eu"}`, `Alloc{host="a"zone="eu"}`, nil, assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, labels, err := ParseSeriesKey(tt.key)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantLabels, labels)
+		})
+	}
+}
+
+func TestSeriesKeyRoundTrip(t *testing.T) {
+	labels := map[string]string{"host": `srv "1"`, "dc": "eu\\west", "note": "a\nb"}
+
+	name, parsedLabels, err := ParseSeriesKey(SeriesKey("metric", labels))
+	require.NoError(t, err)
+	assert.Equal(t, "metric", name)
+	assert.Equal(t, labels, parsedLabels)
+}
+
+func TestIsValidName(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantName  bool
+		wantLabel bool
+	}{
+		{"plain", "Alloc", true, true},
+		{"underscores and digits", "_cpu_1", true, true},
+		{"colon", "job:requests", true, false},
+		{"leading digit", "1cpu", false, false},
+		{"reserved prefix", "__name__", false, false},
+		{"series key symbols", `Alloc{host="a"}`, false, false},
+		{"dot", "orders.created", false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantName, IsValidName(tt.value))
+			assert.Equal(t, tt.wantLabel, IsValidLabelName(tt.value))
+		})
+	}
+}
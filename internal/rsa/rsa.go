@@ -1,11 +1,19 @@
 // Package rsa implements encoding/decoding client/server communication with RSA keys.
+//
+// Messages are encrypted with hybrid scheme: every message is encrypted with a random AES-256-GCM session key,
+// which is encrypted with RSA-OAEP (SHA-256) public key and sent together with the message in KeyHeader.
+// Encrypted message is a GCM nonce followed by ciphertext, so messages of any size are supported.
 package rsa
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -14,6 +22,12 @@ import (
 	"os"
 )
 
+// KeyHeader is a HTTP header with session key encrypted by RSA public key and encoded in base64.
+const KeyHeader = "X-Encrypted-Key"
+
+// sessionKeySize is a size of AES-256 session key.
+const sessionKeySize = 32
+
 var errInvalidPrivateKeyRSA = fmt.Errorf("RSA key is not set")
 
 // Encoder RSA message encryptor.
@@ -29,23 +43,53 @@ func CreateEncoder(certFilePath string) (*Encoder, error) {
 	}
 
 	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("decode RSA cert: PEM block is not found")
+	}
+
 	cert, err := x509.ParseCertificate(certBlock.Bytes)
 	if err != nil {
 		return nil, fmt.Errorf("parse RSA public key: %w", err)
 	}
 
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("parse RSA public key: unexpected key type %T", cert.PublicKey)
+	}
+
 	return &Encoder{
-		key: cert.PublicKey.(*rsa.PublicKey),
+		key: key,
 	}, nil
 }
 
-// Encode encrypts message using RSA public key.
-func (e *Encoder) Encode(msg []byte) ([]byte, error) {
-	if e.key == nil {
-		return nil, fmt.Errorf("RSA cert is not set")
+// Encode encrypts message using random session key. Returns encrypted message and session key encrypted
+// by RSA public key and encoded in base64, which has to be sent in KeyHeader.
+func (e *Encoder) Encode(msg []byte) ([]byte, string, error) {
+	if e == nil || e.key == nil {
+		return nil, "", fmt.Errorf("RSA cert is not set")
+	}
+
+	sessionKey := make([]byte, sessionKeySize)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, "", fmt.Errorf("generate session key: %w", err)
 	}
 
-	return rsa.EncryptPKCS1v15(rand.Reader, e.key, msg)
+	gcm, err := createGCM(sessionKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("generate nonce: %w", err)
+	}
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, e.key, sessionKey, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("encrypt session key: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, msg, nil), base64.StdEncoding.EncodeToString(encryptedKey), nil
 }
 
 // Decoder RSA message decryptor.
@@ -71,16 +115,53 @@ func CreateDecoder(keyFilePath string) (*Decoder, error) {
 	}, nil
 }
 
-// Decode encrypts message using RSA public key.
-func (e *Decoder) Decode(msg []byte) ([]byte, error) {
+// Decode decrypts message using session key encrypted by RSA public key and encoded in base64.
+func (e *Decoder) Decode(msg []byte, encryptedKey string) ([]byte, error) {
 	if e.key == nil {
 		return nil, errInvalidPrivateKeyRSA
 	}
 
-	return rsa.DecryptPKCS1v15(rand.Reader, e.key, msg)
+	keyData, err := base64.StdEncoding.DecodeString(encryptedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode session key: %w", err)
+	}
+
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, e.key, keyData, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt session key: %w", err)
+	}
+
+	gcm, err := createGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg) < gcm.NonceSize() {
+		return nil, fmt.Errorf("message is shorter than nonce")
+	}
+
+	decrypted, err := gcm.Open(make([]byte, 0, len(msg)), msg[:gcm.NonceSize()], msg[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt message: %w", err)
+	}
+	return decrypted, nil
+}
+
+// createGCM creates AES-GCM cipher with session key.
+func createGCM(sessionKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("create session cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create session cipher: %w", err)
+	}
+	return gcm, nil
 }
 
-// DecodeRSAHandler handler for body decoding using RSA private key.
+// DecodeRSAHandler handler for body decoding using RSA private key and session key from KeyHeader.
 func (e *Decoder) DecodeRSAHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var buf bytes.Buffer
@@ -93,7 +174,7 @@ func (e *Decoder) DecodeRSAHandler(next http.Handler) http.Handler {
 			_ = r.Body.Close()
 		}()
 
-		decryptedMessage, err := e.Decode(buf.Bytes())
+		decryptedMessage, err := e.Decode(buf.Bytes(), r.Header.Get(KeyHeader))
 		if err != nil {
 			if errors.Is(err, errInvalidPrivateKeyRSA) {
 				http.Error(w, "Error decrypting message", http.StatusInternalServerError)
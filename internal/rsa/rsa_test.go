@@ -5,6 +5,7 @@ import (
 	"crypto/rsa"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	"github.com/caarlos0/env"
@@ -174,6 +175,16 @@ func TestEncoder_Encode(t *testing.T) {
 				msg: []byte{},
 			},
 		},
+		{
+			name: "message larger than RSA key",
+			fields: fields{
+				keyPublic:  encoder.key,
+				keyPrivate: decoder.key,
+			},
+			args: args{
+				msg: bytes.Repeat([]byte("some message"), 100000),
+			},
+		},
 		{
 			name: "missing public key",
 			fields: fields{
@@ -203,7 +214,7 @@ func TestEncoder_Encode(t *testing.T) {
 			e := &Encoder{
 				key: tt.fields.keyPublic,
 			}
-			msgEncoded, err := e.Encode(tt.args.msg)
+			msgEncoded, encryptedKey, err := e.Encode(tt.args.msg)
 			if (err != nil) != tt.wantErrEncoder {
 				t.Errorf("Encode() error = %v, wantErr %v", err, tt.wantErrEncoder)
 				return
@@ -212,7 +223,7 @@ func TestEncoder_Encode(t *testing.T) {
 			de := &Decoder{
 				key: tt.fields.keyPrivate,
 			}
-			msgDecoded, err := de.Decode(msgEncoded)
+			msgDecoded, err := de.Decode(msgEncoded, encryptedKey)
 			if (err != nil) != tt.wantErrDecoder {
 				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErrDecoder)
 				return
@@ -223,6 +234,21 @@ func TestEncoder_Encode(t *testing.T) {
 	}
 }
 
+func TestEncoder_EncodeNil(t *testing.T) {
+	var e *Encoder
+	_, _, err := e.Encode([]byte("some message"))
+	assert.Error(t, err)
+}
+
+func TestCreateEncoderNotPEM(t *testing.T) {
+	path := t.TempDir() + "/cert.pem"
+	require.NoError(t, os.WriteFile(path, []byte("not a certificate"), 0666))
+
+	encoder, err := CreateEncoder(path)
+	assert.Error(t, err)
+	assert.Nil(t, encoder)
+}
+
 func TestDecoder_DecodeRSAHandler(t *testing.T) {
 	certRSA, keyRSA := getEnvironments()
 
@@ -323,7 +349,7 @@ func TestDecoder_DecodeRSAHandler(t *testing.T) {
 				key: tt.fields.keyPublic,
 			}
 
-			msgEncoded, err := e.Encode(tt.args.body)
+			msgEncoded, encryptedKey, err := e.Encode(tt.args.body)
 			if (err != nil) != tt.want.errEncoder {
 				t.Errorf("Encode() error = %v, wantErr %v", err, tt.want.errEncoder)
 				return
@@ -331,6 +357,7 @@ func TestDecoder_DecodeRSAHandler(t *testing.T) {
 			err = nil
 
 			req := httptest.NewRequest("POST", "/", bytes.NewBuffer(msgEncoded))
+			req.Header.Set(KeyHeader, encryptedKey)
 			defer func() {
 				_ = req.Body.Close()
 			}()
@@ -352,3 +379,49 @@ func TestDecoder_DecodeRSAHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestDecoder_DecodeTampered(t *testing.T) {
+	certRSA, keyRSA := getEnvironments()
+
+	encoder, err := CreateEncoder(certRSA)
+	require.NoError(t, err)
+	decoder, err := CreateDecoder(keyRSA)
+	require.NoError(t, err)
+
+	msgEncoded, encryptedKey, err := encoder.Encode([]byte("some message"))
+	require.NoError(t, err)
+
+	_, otherKey, err := encoder.Encode([]byte("some message"))
+	require.NoError(t, err)
+	_, err = decoder.Decode(msgEncoded, otherKey)
+	assert.Error(t, err)
+
+	_, err = decoder.Decode(msgEncoded, "")
+	assert.Error(t, err)
+
+	_, err = decoder.Decode(msgEncoded[:4], encryptedKey)
+	assert.Error(t, err)
+
+	msgEncoded[len(msgEncoded)-1] ^= 0xff
+	_, err = decoder.Decode(msgEncoded, encryptedKey)
+	assert.Error(t, err)
+}
+
+func TestDecoder_DecodeRSAHandlerMissingKey(t *testing.T) {
+	certRSA, keyRSA := getEnvironments()
+
+	encoder, err := CreateEncoder(certRSA)
+	require.NoError(t, err)
+	decoder, err := CreateDecoder(keyRSA)
+	require.NoError(t, err)
+
+	msgEncoded, _, err := encoder.Encode([]byte("some message"))
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	decoder.DecodeRSAHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rr, httptest.NewRequest("POST", "/", bytes.NewBuffer(msgEncoded)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
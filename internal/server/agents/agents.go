@@ -0,0 +1,146 @@
+// Package agents keeps track of agents reporting metrics on server.
+// For every agent identified by its id it stores the last time of report and the set of reported series.
+package agents
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erupshis/metrics/internal/mtls"
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+const (
+	gaugeType     = "gauge"
+	counterType   = "counter"
+	histogramType = "histogram"
+)
+
+// Info represents agent's state known by server.
+type Info struct {
+	ID         string    `json:"id"`
+	LastSeen   time.Time `json:"last_seen"`
+	Gauges     []string  `json:"gauges"`
+	Counters   []string  `json:"counters"`
+	Histograms []string  `json:"histograms"`
+}
+
+// agent stores reported series of the agent.
+type agent struct {
+	lastSeen   time.Time
+	gauges     map[string]struct{}
+	counters   map[string]struct{}
+	histograms map[string]struct{}
+}
+
+// Registry stores states of agents. Safe for concurrent use.
+type Registry struct {
+	agents map[string]*agent
+	mu     sync.RWMutex
+
+	now func() time.Time
+}
+
+// Create initializes and returns a new instance of Registry.
+func Create() *Registry {
+	return &Registry{agents: map[string]*agent{}, now: time.Now}
+}
+
+// Register updates last seen time of the agent and adds series of metrics of all types to the agent's set.
+// Reports without agent id are ignored, e.g. requests without AgentIDHeader sent without mutual TLS, so their series
+// aren't attributed to agents.
+func (r *Registry) Register(agentID string, metrics []networkmsg.Metric) {
+	if r == nil || agentID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.agents[agentID]
+	if !ok {
+		state = &agent{gauges: map[string]struct{}{}, counters: map[string]struct{}{}, histograms: map[string]struct{}{}}
+		r.agents[agentID] = state
+	}
+
+	state.lastSeen = r.now()
+	for i := range metrics {
+		switch metrics[i].MType {
+		case gaugeType:
+			state.gauges[metrics[i].Key()] = struct{}{}
+		case counterType:
+			state.counters[metrics[i].Key()] = struct{}{}
+		case histogramType:
+			state.histograms[metrics[i].Key()] = struct{}{}
+		}
+	}
+}
+
+// Identify returns id of the agent sent metrics. Verified identity of mutual TLS client is used if it's in ctx,
+// it also overwrites agent label of metrics, so client can't report series of another agent.
+// Without mutual TLS id declared by agent in AgentIDHeader is used.
+func Identify(ctx context.Context, declaredID string, metrics []networkmsg.Metric) string {
+	identity, ok := mtls.IdentityFromContext(ctx)
+	if !ok {
+		return declaredID
+	}
+
+	for i := range metrics {
+		if _, ok := metrics[i].Labels[networkmsg.AgentLabel]; ok {
+			metrics[i].Labels[networkmsg.AgentLabel] = identity
+		}
+	}
+	return identity
+}
+
+// Get returns state of the agent by id.
+func (r *Registry) Get(agentID string) (Info, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state, ok := r.agents[agentID]
+	if !ok {
+		return Info{}, false
+	}
+
+	return state.info(agentID), true
+}
+
+// GetAll returns states of all known agents sorted by id.
+func (r *Registry) GetAll() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]Info, 0, len(r.agents))
+	for id, state := range r.agents {
+		res = append(res, state.info(id))
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// info converts agent's state into Info.
+func (a *agent) info(id string) Info {
+	return Info{
+		ID:         id,
+		LastSeen:   a.lastSeen,
+		Gauges:     sortedKeys(a.gauges),
+		Counters:   sortedKeys(a.counters),
+		Histograms: sortedKeys(a.histograms),
+	}
+}
+
+// sortedKeys returns sorted keys of the set.
+func sortedKeys(set map[string]struct{}) []string {
+	res := make([]string, 0, len(set))
+	for key := range set {
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,78 @@
+package agents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/mtls"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	registry := Create()
+
+	now := time.Date(2023, 12, 20, 12, 0, 0, 0, time.UTC)
+	registry.now = func() time.Time { return now }
+
+	gauge := networkmsg.CreateGaugeMetrics("Alloc", 1)
+	gauge.Labels = map[string]string{networkmsg.AgentLabel: "b"}
+
+	registry.Register("b", []networkmsg.Metric{gauge, networkmsg.CreateCounterMetrics("PollCount", 1)})
+	registry.Register("", []networkmsg.Metric{networkmsg.CreateGaugeMetrics("Ignored", 1)})
+
+	now = now.Add(time.Minute)
+	registry.Register("a", []networkmsg.Metric{networkmsg.CreateGaugeMetrics("Alloc", 1)})
+	registry.Register("a", []networkmsg.Metric{networkmsg.CreateGaugeMetrics("Sys", 1)})
+	registry.Register("a", []networkmsg.Metric{{ID: "Latency", MType: "histogram"}})
+
+	assert.Equal(t, []Info{
+		{
+			ID:         "a",
+			LastSeen:   now,
+			Gauges:     []string{"Alloc", "Sys"},
+			Counters:   []string{},
+			Histograms: []string{"Latency"},
+		},
+		{
+			ID:         "b",
+			LastSeen:   now.Add(-time.Minute),
+			Gauges:     []string{`Alloc{agent="b"}`},
+			Counters:   []string{"PollCount"},
+			Histograms: []string{},
+		},
+	}, registry.GetAll())
+
+	info, ok := registry.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "a", info.ID)
+
+	_, ok = registry.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestRegistry_RegisterNil(t *testing.T) {
+	var registry *Registry
+	assert.NotPanics(t, func() {
+		registry.Register("a", []networkmsg.Metric{networkmsg.CreateGaugeMetrics("Alloc", 1)})
+	})
+}
+
+func TestIdentify(t *testing.T) {
+	createMetrics := func() []networkmsg.Metric {
+		labeled := networkmsg.CreateGaugeMetrics("Alloc", 1)
+		labeled.Labels = map[string]string{networkmsg.AgentLabel: "spoofed", "pool": "heap"}
+		return []networkmsg.Metric{labeled, networkmsg.CreateCounterMetrics("PollCount", 1)}
+	}
+
+	metrics := createMetrics()
+	assert.Equal(t, "spoofed", Identify(context.Background(), "spoofed", metrics))
+	assert.Equal(t, "spoofed", metrics[0].Labels[networkmsg.AgentLabel])
+
+	metrics = createMetrics()
+	assert.Equal(t, "agent-1", Identify(mtls.WithIdentity(context.Background(), "agent-1"), "spoofed", metrics))
+	assert.Equal(t, map[string]string{networkmsg.AgentLabel: "agent-1", "pool": "heap"}, metrics[0].Labels)
+	assert.Nil(t, metrics[1].Labels)
+}
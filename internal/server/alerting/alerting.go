@@ -0,0 +1,270 @@
+// Package alerting evaluates alerting rules over gauges and counters stored on server
+// and notifies HTTP webhooks about alerts state changes.
+// Every series selected by rule has its own alert which is pending while the rule condition is met for less than
+// rule's For duration, firing after that and resolved as soon as the condition is not met anymore.
+// Webhooks are notified when alert becomes firing and when firing alert is resolved.
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+)
+
+// Alert states.
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Source provides metrics for rules evaluation. It is implemented by memstorage.MemStorage.
+type Source interface {
+	GetAllGauges() map[string]interface{}
+	GetAllCounters() map[string]interface{}
+	GetGaugeHistory(name string, from, to time.Time) ([]history.Sample, error)
+	GetCounterHistory(name string, from, to time.Time) ([]history.Sample, error)
+}
+
+// Sender delivers notification to webhook.
+type Sender interface {
+	Send(ctx context.Context, webhook Webhook, notification Notification) error
+}
+
+// Alert represents state of rule evaluated for the series.
+// Value is the last value met the rule condition: metric value, rate or zero for absence.
+type Alert struct {
+	Rule     string    `json:"rule"`
+	Series   string    `json:"series"`
+	State    string    `json:"state"`
+	Value    float64   `json:"value"`
+	ActiveAt time.Time `json:"active_at"`
+}
+
+// Notification represents alert state change sent to webhooks.
+type Notification struct {
+	Alert
+	Timestamp   time.Time         `json:"ts"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	webhooks []Webhook
+}
+
+// alertState keeps alert with the rule it belongs to.
+type alertState struct {
+	alert Alert
+	rule  *Rule
+}
+
+// Engine evaluates rules and keeps states of alerts. Safe for concurrent use.
+type Engine struct {
+	rules          []Rule
+	webhooks       []Webhook
+	webhooksByName map[string]Webhook
+	source         Source
+	sender         Sender
+	log            logger.BaseLogger
+
+	alerts map[string]*alertState
+	mu     sync.Mutex
+}
+
+// Create initializes and returns a new instance of Engine evaluating rules over metrics from source.
+func Create(rules *Rules, source Source, sender Sender, log logger.BaseLogger) *Engine {
+	webhooksByName := make(map[string]Webhook, len(rules.Webhooks))
+	for _, webhook := range rules.Webhooks {
+		webhooksByName[webhook.Name] = webhook
+	}
+
+	return &Engine{
+		rules:          rules.Rules,
+		webhooks:       rules.Webhooks,
+		webhooksByName: webhooksByName,
+		source:         source,
+		sender:         sender,
+		log:            log,
+		alerts:         make(map[string]*alertState),
+	}
+}
+
+// Evaluate checks rules at the moment now, updates states of alerts and returns notifications about alerts
+// which became firing or resolved. Notifications are sorted by rule and series.
+func (e *Engine) Evaluate(now time.Time) []Notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var notifications []Notification
+	active := make(map[string]struct{})
+	for i := range e.rules {
+		rule := &e.rules[i]
+		for series, value := range e.evaluateRule(rule, now) {
+			key := rule.Name + "/" + series
+			active[key] = struct{}{}
+
+			state, ok := e.alerts[key]
+			if !ok {
+				state = &alertState{
+					alert: Alert{Rule: rule.Name, Series: series, State: StatePending, ActiveAt: now},
+					rule:  rule,
+				}
+				e.alerts[key] = state
+			}
+
+			state.alert.Value = value
+			if state.alert.State == StatePending && now.Sub(state.alert.ActiveAt) >= rule.For {
+				state.alert.State = StateFiring
+				e.log.Info("[Engine::Evaluate] alert '%s' of series '%s' is firing with value: %v", rule.Name, series, value)
+				notifications = append(notifications, e.createNotification(state, now))
+			}
+		}
+	}
+
+	for key, state := range e.alerts {
+		if _, ok := active[key]; ok {
+			continue
+		}
+
+		delete(e.alerts, key)
+		if state.alert.State == StateFiring {
+			state.alert.State = StateResolved
+			e.log.Info("[Engine::Evaluate] alert '%s' of series '%s' is resolved", state.alert.Rule, state.alert.Series)
+			notifications = append(notifications, e.createNotification(state, now))
+		}
+	}
+
+	sort.Slice(notifications, func(i, j int) bool {
+		if notifications[i].Rule != notifications[j].Rule {
+			return notifications[i].Rule < notifications[j].Rule
+		}
+		return notifications[i].Series < notifications[j].Series
+	})
+	return notifications
+}
+
+// Notify delivers notifications to webhooks of their rules and waits for all deliveries to finish.
+// Failed deliveries are logged.
+func (e *Engine) Notify(ctx context.Context, notifications []Notification) {
+	var wg sync.WaitGroup
+	for _, notification := range notifications {
+		for _, webhook := range notification.webhooks {
+			wg.Add(1)
+			go func(webhook Webhook, notification Notification) {
+				defer wg.Done()
+				if err := e.sender.Send(ctx, webhook, notification); err != nil {
+					e.log.Info("[Engine::Notify] failed to notify webhook '%s' about alert '%s' of series '%s': %v",
+						webhook.Name, notification.Rule, notification.Series, err)
+				}
+			}(webhook, notification)
+		}
+	}
+	wg.Wait()
+}
+
+// Alerts returns pending and firing alerts sorted by rule and series.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, state := range e.alerts {
+		alerts = append(alerts, state.alert)
+	}
+
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return alerts[i].Series < alerts[j].Series
+	})
+	return alerts
+}
+
+// createNotification creates notification about the current state of alert addressed to webhooks of its rule.
+func (e *Engine) createNotification(state *alertState, now time.Time) Notification {
+	notification := Notification{
+		Alert:       state.alert,
+		Timestamp:   now,
+		Annotations: state.rule.Annotations,
+	}
+
+	if len(state.rule.Webhooks) == 0 {
+		notification.webhooks = e.webhooks
+		return notification
+	}
+
+	for _, name := range state.rule.Webhooks {
+		notification.webhooks = append(notification.webhooks, e.webhooksByName[name])
+	}
+	return notification
+}
+
+// evaluateRule returns series which meet rule condition at the moment now with their values.
+func (e *Engine) evaluateRule(rule *Rule, now time.Time) map[string]float64 {
+	var values map[string]interface{}
+	getHistory := e.source.GetGaugeHistory
+	if rule.MType == counterType {
+		values = e.source.GetAllCounters()
+		getHistory = e.source.GetCounterHistory
+	} else {
+		values = e.source.GetAllGauges()
+	}
+
+	res := make(map[string]float64)
+	switch rule.Condition {
+	case ConditionThreshold:
+		for key, value := range values {
+			if v := toFloat(value); rule.Selector.Match(key) && compare(rule.Operator, v, rule.Threshold) {
+				res[key] = v
+			}
+		}
+
+	case ConditionRate:
+		for key := range values {
+			if !rule.Selector.Match(key) {
+				continue
+			}
+
+			samples, err := getHistory(key, now.Add(-rule.Window), now)
+			if err != nil {
+				continue
+			}
+
+			if rate := history.Rate(samples); compare(rule.Operator, rate, rule.Threshold) {
+				res[key] = rate
+			}
+		}
+
+	case ConditionAbsence:
+		for key := range values {
+			if !rule.Selector.Match(key) {
+				continue
+			}
+			if rule.Window == 0 {
+				return res
+			}
+
+			samples, err := getHistory(key, now.Add(-rule.Window), now)
+			if err == nil && len(samples) != 0 {
+				return res
+			}
+		}
+		res[networkmsg.SeriesKey(rule.Selector.Name, rule.Selector.Labels)] = 0
+	}
+	return res
+}
+
+// toFloat converts metric value returned by Source into float.
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case *float64:
+		return *v
+	case *int64:
+		return float64(*v)
+	}
+	return 0
+}
@@ -0,0 +1,241 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+	"github.com/erupshis/metrics/internal/server/query"
+	"github.com/stretchr/testify/assert"
+)
+
+// sourceMock provides metrics values and samples set by test.
+type sourceMock struct {
+	gauges   map[string]float64
+	counters map[string]int64
+	history  map[string][]history.Sample
+}
+
+func (s *sourceMock) GetAllGauges() map[string]interface{} {
+	res := make(map[string]interface{}, len(s.gauges))
+	for key, value := range s.gauges {
+		value := value
+		res[key] = &value
+	}
+	return res
+}
+
+func (s *sourceMock) GetAllCounters() map[string]interface{} {
+	res := make(map[string]interface{}, len(s.counters))
+	for key, value := range s.counters {
+		value := value
+		res[key] = &value
+	}
+	return res
+}
+
+func (s *sourceMock) GetGaugeHistory(name string, from, to time.Time) ([]history.Sample, error) {
+	if _, ok := s.gauges[name]; !ok {
+		return nil, fmt.Errorf("invalid gauge name '%s'", name)
+	}
+	return s.samples(name, from, to), nil
+}
+
+func (s *sourceMock) GetCounterHistory(name string, from, to time.Time) ([]history.Sample, error) {
+	if _, ok := s.counters[name]; !ok {
+		return nil, fmt.Errorf("invalid counter name '%s'", name)
+	}
+	return s.samples(name, from, to), nil
+}
+
+func (s *sourceMock) samples(name string, from, to time.Time) []history.Sample {
+	var res []history.Sample
+	for _, sample := range s.history[name] {
+		if !sample.Timestamp.Before(from) && !sample.Timestamp.After(to) {
+			res = append(res, sample)
+		}
+	}
+	return res
+}
+
+// senderMock records delivered notifications and fails delivery to webhooks from failing set.
+type senderMock struct {
+	sent    map[string][]Notification
+	failing map[string]struct{}
+	mu      sync.Mutex
+}
+
+func (s *senderMock) Send(_ context.Context, webhook Webhook, notification Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.failing[webhook.Name]; ok {
+		return errors.New("webhook unavailable")
+	}
+	if s.sent == nil {
+		s.sent = make(map[string][]Notification)
+	}
+	s.sent[webhook.Name] = append(s.sent[webhook.Name], notification)
+	return nil
+}
+
+func selector(name string, labels map[string]string) query.Query {
+	return query.Query{Name: name, Labels: labels}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	source := &sourceMock{
+		gauges:   map[string]float64{`HeapAlloc{host="a"}`: 50, `HeapAlloc{host="b"}`: 150},
+		counters: map[string]int64{"PollCount": 10},
+	}
+	rules := &Rules{
+		Rules: []Rule{
+			{
+				Name:        "HeapHigh",
+				MType:       gaugeType,
+				Selector:    selector("HeapAlloc", nil),
+				Condition:   ConditionThreshold,
+				Operator:    OpGreater,
+				Threshold:   100,
+				For:         time.Minute,
+				Annotations: map[string]string{"summary": "heap is high"},
+			},
+		},
+		Webhooks: []Webhook{{Name: "ops", URL: "http://localhost"}},
+	}
+	engine := Create(rules, source, &senderMock{}, logger.CreateMock())
+
+	// condition met less than for duration.
+	assert.Empty(t, engine.Evaluate(start))
+	assert.Equal(t, []Alert{{Rule: "HeapHigh", Series: `HeapAlloc{host="b"}`, State: StatePending, Value: 150, ActiveAt: start}}, engine.Alerts())
+
+	// condition met for duration.
+	source.gauges[`HeapAlloc{host="b"}`] = 170
+	notifications := engine.Evaluate(start.Add(time.Minute))
+	firing := Alert{Rule: "HeapHigh", Series: `HeapAlloc{host="b"}`, State: StateFiring, Value: 170, ActiveAt: start}
+	assert.Equal(t, []Notification{{
+		Alert:       firing,
+		Timestamp:   start.Add(time.Minute),
+		Annotations: map[string]string{"summary": "heap is high"},
+		webhooks:    rules.Webhooks,
+	}}, notifications)
+	assert.Equal(t, []Alert{firing}, engine.Alerts())
+
+	// firing alert isn't notified again.
+	assert.Empty(t, engine.Evaluate(start.Add(2*time.Minute)))
+
+	// another series becomes pending, firing one is resolved.
+	source.gauges[`HeapAlloc{host="a"}`] = 120
+	source.gauges[`HeapAlloc{host="b"}`] = 90
+	notifications = engine.Evaluate(start.Add(3 * time.Minute))
+	resolved := firing
+	resolved.State = StateResolved
+	assert.Equal(t, []Notification{{
+		Alert:       resolved,
+		Timestamp:   start.Add(3 * time.Minute),
+		Annotations: map[string]string{"summary": "heap is high"},
+		webhooks:    rules.Webhooks,
+	}}, notifications)
+	assert.Equal(t, []Alert{{Rule: "HeapHigh", Series: `HeapAlloc{host="a"}`, State: StatePending, Value: 120, ActiveAt: start.Add(3 * time.Minute)}}, engine.Alerts())
+
+	// pending alert is dropped silently.
+	source.gauges[`HeapAlloc{host="a"}`] = 80
+	assert.Empty(t, engine.Evaluate(start.Add(4*time.Minute)))
+	assert.Empty(t, engine.Alerts())
+}
+
+func TestEngine_EvaluateConditions(t *testing.T) {
+	now := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	source := &sourceMock{
+		gauges:   map[string]float64{"Alloc": 5},
+		counters: map[string]int64{`PollCount{host="a"}`: 100, `PollCount{host="b"}`: 10},
+		history: map[string][]history.Sample{
+			`PollCount{host="a"}`: {{Timestamp: now.Add(-time.Minute), Value: 40}, {Timestamp: now.Add(-10 * time.Second), Value: 100}},
+			`PollCount{host="b"}`: {{Timestamp: now.Add(-5 * time.Minute), Value: 10}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		rule Rule
+		want []Alert
+	}{
+		{
+			name: "threshold on counter",
+			rule: Rule{Name: "r", MType: counterType, Selector: selector("PollCount", map[string]string{"host": "a"}), Condition: ConditionThreshold, Operator: OpGreaterEqual, Threshold: 100},
+			want: []Alert{{Rule: "r", Series: `PollCount{host="a"}`, State: StateFiring, Value: 100, ActiveAt: now}},
+		},
+		{
+			name: "rate over window",
+			rule: Rule{Name: "r", MType: counterType, Selector: selector("PollCount", nil), Condition: ConditionRate, Operator: OpGreater, Threshold: 0.5, Window: 2 * time.Minute},
+			want: []Alert{{Rule: "r", Series: `PollCount{host="a"}`, State: StateFiring, Value: 1.2, ActiveAt: now}},
+		},
+		{
+			name: "absence of series",
+			rule: Rule{Name: "r", MType: gaugeType, Selector: selector("Heap*", map[string]string{"host": "a"}), Condition: ConditionAbsence},
+			want: []Alert{{Rule: "r", Series: `Heap*{host="a"}`, State: StateFiring, ActiveAt: now}},
+		},
+		{
+			name: "present series",
+			rule: Rule{Name: "r", MType: gaugeType, Selector: selector("Alloc", nil), Condition: ConditionAbsence},
+			want: []Alert{},
+		},
+		{
+			name: "absence of updates within window",
+			rule: Rule{Name: "r", MType: counterType, Selector: selector("PollCount", map[string]string{"host": "b"}), Condition: ConditionAbsence, Window: time.Minute},
+			want: []Alert{{Rule: "r", Series: `PollCount{host="b"}`, State: StateFiring, ActiveAt: now}},
+		},
+		{
+			name: "updates within window",
+			rule: Rule{Name: "r", MType: counterType, Selector: selector("PollCount", nil), Condition: ConditionAbsence, Window: time.Minute},
+			want: []Alert{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := Create(&Rules{Rules: []Rule{tt.rule}}, source, &senderMock{}, logger.CreateMock())
+			engine.Evaluate(now)
+
+			alerts := engine.Alerts()
+			if len(alerts) == 1 {
+				assert.InDelta(t, tt.want[0].Value, alerts[0].Value, 1e-9)
+				alerts[0].Value = tt.want[0].Value
+			}
+			assert.Equal(t, tt.want, alerts)
+		})
+	}
+}
+
+func TestEngine_Notify(t *testing.T) {
+	now := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	source := &sourceMock{gauges: map[string]float64{"Alloc": 5}}
+	rules := &Rules{
+		Rules: []Rule{
+			{Name: "AllocHigh", MType: gaugeType, Selector: selector("Alloc", nil), Condition: ConditionThreshold, Operator: OpGreater, Threshold: 1},
+			{Name: "HeapMissing", MType: gaugeType, Selector: selector("Heap", nil), Condition: ConditionAbsence, Webhooks: []string{"chat"}},
+		},
+		Webhooks: []Webhook{{Name: "ops", URL: "http://ops"}, {Name: "chat", URL: "http://chat"}, {Name: "down", URL: "http://down"}},
+	}
+
+	sender := &senderMock{failing: map[string]struct{}{"down": {}}}
+	engine := Create(rules, source, sender, logger.CreateMock())
+	engine.Notify(context.Background(), engine.Evaluate(now))
+
+	assert.Len(t, sender.sent, 2)
+	if assert.Len(t, sender.sent["ops"], 1) {
+		assert.Equal(t, "AllocHigh", sender.sent["ops"][0].Rule)
+	}
+	if assert.Len(t, sender.sent["chat"], 2) {
+		rulesNotified := []string{sender.sent["chat"][0].Rule, sender.sent["chat"][1].Rule}
+		assert.ElementsMatch(t, []string{"AllocHigh", "HeapMissing"}, rulesNotified)
+	}
+}
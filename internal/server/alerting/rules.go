@@ -0,0 +1,236 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/erupshis/metrics/internal/server/query"
+)
+
+// Conditions supported by rules.
+const (
+	// ConditionThreshold compares current value of every selected series with the threshold.
+	ConditionThreshold = "threshold"
+	// ConditionAbsence is met if no series is selected or, with non-zero window, no selected series was updated within window.
+	ConditionAbsence = "absence"
+	// ConditionRate compares per-second rate of change of every selected series over window with the threshold.
+	ConditionRate = "rate"
+)
+
+// Comparison operators supported by threshold and rate conditions.
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// Metric types supported by rules.
+const (
+	gaugeType   = "gauge"
+	counterType = "counter"
+)
+
+// Rule describes alerting condition on gauges or counters selected by name pattern and label filters.
+// Alert becomes firing if the condition is met continuously for For duration, until then it is pending.
+// Notifications are sent to webhooks listed in Webhooks or to all configured webhooks if the list is empty.
+type Rule struct {
+	Name        string
+	MType       string
+	Selector    query.Query
+	Condition   string
+	Operator    string
+	Threshold   float64
+	Window      time.Duration
+	For         time.Duration
+	Webhooks    []string
+	Annotations map[string]string
+}
+
+// Webhook describes HTTP endpoint receiving alerts notifications in JSON.
+type Webhook struct {
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Rules represents content of rules file.
+type Rules struct {
+	Rules    []Rule
+	Webhooks []Webhook
+}
+
+// rulesFile represents rules file in JSON. Durations are passed as duration strings, e.g. '5m'.
+type rulesFile struct {
+	Rules    []ruleConfig `json:"rules"`
+	Webhooks []Webhook    `json:"webhooks"`
+}
+
+// ruleConfig represents rule in rules file.
+type ruleConfig struct {
+	Name        string            `json:"name"`
+	MType       string            `json:"type"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Condition   string            `json:"condition"`
+	Operator    string            `json:"op,omitempty"`
+	Threshold   float64           `json:"threshold,omitempty"`
+	Window      string            `json:"window,omitempty"`
+	For         string            `json:"for,omitempty"`
+	Webhooks    []string          `json:"webhooks,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// LoadRules reads and validates rules file in JSON.
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rules file: %w", err)
+	}
+
+	return ParseRules(data)
+}
+
+// ParseRules parses and validates rules in JSON.
+func ParseRules(data []byte) (*Rules, error) {
+	var file rulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse rules: %w", err)
+	}
+
+	webhooks := make(map[string]struct{}, len(file.Webhooks))
+	for i, webhook := range file.Webhooks {
+		if webhook.Name == "" || webhook.URL == "" {
+			return nil, fmt.Errorf("webhook %d: missing name or url", i)
+		}
+		if _, ok := webhooks[webhook.Name]; ok {
+			return nil, fmt.Errorf("webhook '%s': duplicated name", webhook.Name)
+		}
+		webhooks[webhook.Name] = struct{}{}
+	}
+
+	rules := &Rules{Rules: make([]Rule, 0, len(file.Rules)), Webhooks: file.Webhooks}
+	names := make(map[string]struct{}, len(file.Rules))
+	for _, cfg := range file.Rules {
+		rule, err := parseRule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s': %w", cfg.Name, err)
+		}
+
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("rule '%s': duplicated name", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+
+		for _, webhook := range rule.Webhooks {
+			if _, ok := webhooks[webhook]; !ok {
+				return nil, fmt.Errorf("rule '%s': unknown webhook '%s'", rule.Name, webhook)
+			}
+		}
+		rules.Rules = append(rules.Rules, rule)
+	}
+	return rules, nil
+}
+
+// parseRule converts rule from file into validated rule.
+func parseRule(cfg ruleConfig) (Rule, error) {
+	if cfg.Name == "" {
+		return Rule{}, fmt.Errorf("missing name")
+	}
+	if cfg.MType != gaugeType && cfg.MType != counterType {
+		return Rule{}, fmt.Errorf("unsupported metric type '%s'", cfg.MType)
+	}
+
+	selector := query.Query{Name: cfg.Metric, Labels: cfg.Labels}
+	if err := selector.Validate(); err != nil {
+		return Rule{}, fmt.Errorf("metric selector: %w", err)
+	}
+
+	window, err := parseDuration(cfg.Window)
+	if err != nil {
+		return Rule{}, fmt.Errorf("incorrect window: %w", err)
+	}
+
+	forDuration, err := parseDuration(cfg.For)
+	if err != nil {
+		return Rule{}, fmt.Errorf("incorrect for: %w", err)
+	}
+
+	switch cfg.Condition {
+	case ConditionThreshold:
+		if !isOperator(cfg.Operator) {
+			return Rule{}, fmt.Errorf("unknown operator '%s'", cfg.Operator)
+		}
+	case ConditionRate:
+		if !isOperator(cfg.Operator) {
+			return Rule{}, fmt.Errorf("unknown operator '%s'", cfg.Operator)
+		}
+		if window == 0 {
+			return Rule{}, fmt.Errorf("missing window of rate condition")
+		}
+	case ConditionAbsence:
+	default:
+		return Rule{}, fmt.Errorf("unknown condition '%s'", cfg.Condition)
+	}
+
+	return Rule{
+		Name:        cfg.Name,
+		MType:       cfg.MType,
+		Selector:    selector,
+		Condition:   cfg.Condition,
+		Operator:    cfg.Operator,
+		Threshold:   cfg.Threshold,
+		Window:      window,
+		For:         forDuration,
+		Webhooks:    cfg.Webhooks,
+		Annotations: cfg.Annotations,
+	}, nil
+}
+
+// parseDuration parses non-negative duration. Empty value means zero duration.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("negative duration '%s'", value)
+	}
+	return duration, nil
+}
+
+// isOperator checks if comparison operator is supported.
+func isOperator(op string) bool {
+	switch op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+		return true
+	}
+	return false
+}
+
+// compare applies comparison operator to value and threshold.
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case OpGreater:
+		return value > threshold
+	case OpGreaterEqual:
+		return value >= threshold
+	case OpLess:
+		return value < threshold
+	case OpLessEqual:
+		return value <= threshold
+	case OpEqual:
+		return value == threshold
+	case OpNotEqual:
+		return value != threshold
+	}
+	return false
+}
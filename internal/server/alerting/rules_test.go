@@ -0,0 +1,165 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    *Rules
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			data: `{
+				"webhooks": [{"name": "ops", "url": "http://localhost/alerts", "headers": {"Authorization": "token"}}],
+				"rules": [
+					{"name": "HeapHigh", "type": "gauge", "metric": "Heap*", "labels": {"host": "a"}, "condition": "threshold", "op": ">", "threshold": 100, "for": "1m", "webhooks": ["ops"], "annotations": {"summary": "heap is high"}},
+					{"name": "PollStopped", "type": "counter", "metric": "PollCount", "condition": "absence", "window": "30s"},
+					{"name": "PollFast", "type": "counter", "metric": "PollCount", "condition": "rate", "op": ">=", "threshold": 10, "window": "5m"}
+				]
+			}`,
+			want: &Rules{
+				Webhooks: []Webhook{{Name: "ops", URL: "http://localhost/alerts", Headers: map[string]string{"Authorization": "token"}}},
+				Rules: []Rule{
+					{
+						Name:        "HeapHigh",
+						MType:       gaugeType,
+						Selector:    selector("Heap*", map[string]string{"host": "a"}),
+						Condition:   ConditionThreshold,
+						Operator:    OpGreater,
+						Threshold:   100,
+						For:         time.Minute,
+						Webhooks:    []string{"ops"},
+						Annotations: map[string]string{"summary": "heap is high"},
+					},
+					{
+						Name:      "PollStopped",
+						MType:     counterType,
+						Selector:  selector("PollCount", nil),
+						Condition: ConditionAbsence,
+						Window:    30 * time.Second,
+					},
+					{
+						Name:      "PollFast",
+						MType:     counterType,
+						Selector:  selector("PollCount", nil),
+						Condition: ConditionRate,
+						Operator:  OpGreaterEqual,
+						Threshold: 10,
+						Window:    5 * time.Minute,
+					},
+				},
+			},
+		},
+		{
+			name:    "invalid json",
+			data:    `{"rules": [`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid webhook without url",
+			data:    `{"webhooks": [{"name": "ops"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid duplicated webhook",
+			data:    `{"webhooks": [{"name": "ops", "url": "http://a"}, {"name": "ops", "url": "http://b"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid duplicated rule",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "absence"}, {"name": "a", "type": "gauge", "metric": "m", "condition": "absence"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid unknown webhook",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "absence", "webhooks": ["ops"]}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid metric type",
+			data:    `{"rules": [{"name": "a", "type": "histogram", "metric": "m", "condition": "absence"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid metric pattern",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m[", "condition": "absence"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid condition",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "spike"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid operator",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "threshold", "op": "=>"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid rate without window",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "rate", "op": ">"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid negative for",
+			data:    `{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "absence", "for": "-1m"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules([]byte(tt.data))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"name": "a", "type": "gauge", "metric": "m", "condition": "absence"}]}`), 0644))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	assert.Len(t, rules.Rules, 1)
+
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		op    string
+		value float64
+		want  bool
+	}{
+		{OpGreater, 2, true},
+		{OpGreater, 1, false},
+		{OpGreaterEqual, 1, true},
+		{OpLess, 0, true},
+		{OpLessEqual, 2, false},
+		{OpEqual, 1, true},
+		{OpNotEqual, 1, false},
+		{"unknown", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			assert.Equal(t, tt.want, compare(tt.op, tt.value, 1))
+		})
+	}
+}
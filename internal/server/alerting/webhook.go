@@ -0,0 +1,69 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/retryer"
+)
+
+// WebhookSender posts notifications in JSON to webhooks retrying failed attempts.
+type WebhookSender struct {
+	client    *http.Client
+	intervals []int
+	log       logger.BaseLogger
+}
+
+// CreateWebhookSender creates sender retrying failed posts with intervals in seconds.
+// Nil intervals means default intervals of retryer.
+func CreateWebhookSender(intervals []int, log logger.BaseLogger) *WebhookSender {
+	return &WebhookSender{
+		client:    &http.Client{},
+		intervals: intervals,
+		log:       log,
+	}
+}
+
+// Send posts notification to webhook. Network errors and non-2xx responses are retried.
+func (s *WebhookSender) Send(ctx context.Context, webhook Webhook, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	return retryer.RetryCallWithTimeout(ctx, s.log, s.intervals, nil, func(ctx context.Context) error {
+		return s.post(ctx, webhook, body)
+	})
+}
+
+// post makes single attempt to post notification body to webhook.
+func (s *WebhookSender) post(ctx context.Context, webhook Webhook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range webhook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post notification: %w", err)
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected response status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSender_Send(t *testing.T) {
+	now := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	notification := Notification{
+		Alert:       Alert{Rule: "HeapHigh", Series: "HeapAlloc", State: StateFiring, Value: 150, ActiveAt: now},
+		Timestamp:   now.Add(time.Minute),
+		Annotations: map[string]string{"summary": "heap is high"},
+	}
+
+	var attempts int32
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		received = body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	sender := CreateWebhookSender([]int{1, 1}, logger.CreateMock())
+	err := sender.Send(context.Background(), Webhook{Name: "ops", URL: ts.URL, Headers: map[string]string{"Authorization": "token"}}, notification)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+
+	var got Notification
+	require.NoError(t, json.Unmarshal(received, &got))
+	assert.Equal(t, notification, got)
+	assert.JSONEq(t, `{"rule":"HeapHigh","series":"HeapAlloc","state":"firing","value":150,"active_at":"2023-12-01T10:00:00Z","ts":"2023-12-01T10:01:00Z","annotations":{"summary":"heap is high"}}`, string(received))
+}
+
+func TestWebhookSender_SendFailed(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	sender := CreateWebhookSender([]int{1}, logger.CreateMock())
+	err := sender.Send(context.Background(), Webhook{Name: "ops", URL: ts.URL}, Notification{})
+	assert.EqualError(t, err, "unexpected response status: 400")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
@@ -11,6 +11,7 @@ package config
 import (
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env"
@@ -26,15 +27,52 @@ type Config struct {
 	PortGRPC      int64         `json:"p_grpc"`         // PortGRPC port for listening messages by grpc server.
 	LogLevel      string        `json:"log_level"`      // LogLevel is the log level for the metrics server (default: Info).
 	Restore       bool          `json:"restore"`        // Restore enables or disables restoring values from a file (default: true).
-	StoreInterval time.Duration `json:"store_interval"` // StoreInterval is the interval at which metrics are stored (default: 5 seconds).
+	StoreInterval time.Duration `json:"store_interval"` // StoreInterval is the interval at which metrics are stored (default: 5 seconds). 0 means synchronous storing.
 	StoragePath   string        `json:"storage_file"`   // StoragePath is the file storage path for metrics data.
+	StorageType   string        `json:"storage_type"`   // StorageType selects storage backend: database, file or kv (default: database if DSN is set, file otherwise).
 	DataBaseDSN   string        `json:"database_dsn"`   // DataBaseDSN is the DSN for connecting to the metrics database.
 	Key           string        `json:"hash_key"`       // Key is the authentication key for the metrics server.
 	CertRSA       string        `json:"crypto_cert"`    // CertRSA public cert for connection.
 	KeyRSA        string        `json:"crypto_key"`     // KeyRSA private key for connection.
 	TrustedSubnet string        `json:"trusted_subnet"` // TrustedSubnet CIDR settings.
+
+	HistoryLimit     int64         `json:"history_limit"`     // HistoryLimit max count of samples stored per metric (0 - history is off).
+	HistoryRetention time.Duration `json:"history_retention"` // HistoryRetention max age of samples stored per metric (0 - unlimited).
+
+	MetricTTL time.Duration `json:"metric_ttl"` // MetricTTL max time since the last update after which metric is removed (0 - metrics never expire).
+
+	AlertRulesPath string        `json:"alert_rules"`    // AlertRulesPath is the path of alerting rules file (empty - alerting is off).
+	AlertInterval  time.Duration `json:"alert_interval"` // AlertInterval is the interval of alerting rules evaluation (default: 10 seconds).
+
+	ReadPolicy  RoutePolicy `json:"read_policy"`  // ReadPolicy security requirements of HTTP read endpoints: list, value, ping, etc. (default: subnet).
+	WritePolicy RoutePolicy `json:"write_policy"` // WritePolicy security requirements of HTTP write endpoints: update, updates (default: subnet, encryption).
+
+	// ReadPolicyExempt read endpoints served without encryption and signature requirements of ReadPolicy, e.g. '/metrics'
+	// for scrapers or '/ui,/history,/agents' for the dashboard in browser. Path covers its subpaths, subnet and
+	// mutual TLS requirements are still applied (empty - none).
+	ReadPolicyExempt []string `json:"read_policy_exempt"`
+
+	ClientCA        string   `json:"client_ca"`        // ClientCA CA cert of agents certificates, enables mutual TLS on HTTP and gRPC servers (empty - mTLS is off).
+	ClientCRL       string   `json:"client_crl"`       // ClientCRL list of revoked agents certificates, reloaded on change (empty - revocation check is off).
+	ReadIdentities  []string `json:"read_identities"`  // ReadIdentities agents certificates identities allowed to read metrics (empty - any agent).
+	WriteIdentities []string `json:"write_identities"` // WriteIdentities agents certificates identities allowed to write metrics (empty - any agent).
+}
+
+// RoutePolicy defines security requirements of HTTP endpoints group.
+// Signature provided by client is validated even if it isn't required.
+type RoutePolicy struct {
+	TrustedSubnet bool `json:"trusted_subnet"` // TrustedSubnet requires client IP from TrustedSubnet.
+	Encryption    bool `json:"encryption"`     // Encryption requires request body encrypted with CertRSA.
+	Signature     bool `json:"signature"`      // Signature requires request body signed with Key.
 }
 
+// Storage backends available for StorageType.
+const (
+	StorageDataBase = "database" // StorageDataBase PostgreSQL storage defined by DataBaseDSN.
+	StorageFile     = "file"     // StorageFile JSON-lines file storage defined by StoragePath.
+	StorageKV       = "kv"       // StorageKV embedded key-value storage in a single file defined by StoragePath.
+)
+
 // Default configs preset.
 var Default = Config{
 	Host:          "localhost",
@@ -49,6 +87,14 @@ var Default = Config{
 	TrustedSubnet: "10.73.102.18/24",
 	PortHTTP:      8080,
 	PortGRPC:      8081,
+
+	HistoryLimit:     1000,
+	HistoryRetention: time.Hour,
+
+	AlertInterval: 10 * time.Second,
+
+	ReadPolicy:  RoutePolicy{TrustedSubnet: true},
+	WritePolicy: RoutePolicy{TrustedSubnet: true, Encryption: true},
 }
 
 // Parse reads and parses command line flags, updating the provided Config.
@@ -82,6 +128,20 @@ const (
 	flagCertRSA       = "crypto-cert" // flagCertRSA public connection cert.
 	flagKeyRSA        = "crypto-key"  // flagKeyRSA private connection key.
 	flagTrustedSubnet = "t"           // flagTrustedSubnet CIDR settings.
+
+	flagStorageType      = "storage-type"       // flagStorageType represents the storage backend.
+	flagHistoryLimit     = "history-limit"      // flagHistoryLimit max count of samples per metric.
+	flagHistoryRetention = "history-retention"  // flagHistoryRetention max age of samples per metric.
+	flagMetricTTL        = "metric-ttl"         // flagMetricTTL max time since the last update of metric.
+	flagAlertRulesPath   = "alert-rules"        // flagAlertRulesPath represents the alerting rules file path.
+	flagAlertInterval    = "alert-interval"     // flagAlertInterval represents the alerting rules evaluation interval.
+	flagReadPolicy       = "read-policy"        // flagReadPolicy represents the security requirements of read endpoints.
+	flagWritePolicy      = "write-policy"       // flagWritePolicy represents the security requirements of write endpoints.
+	flagReadPolicyExempt = "read-policy-exempt" // flagReadPolicyExempt represents the read endpoints exempted from body requirements.
+	flagClientCA         = "client-ca"          // flagClientCA represents the CA cert path of agents certificates.
+	flagReadIdentities   = "read-identities"    // flagReadIdentities represents the identities allowed to read metrics.
+	flagWriteIdentities  = "write-identities"   // flagWriteIdentities represents the identities allowed to write metrics.
+	flagClientCRL        = "client-crl"         // flagClientCRL represents the CRL path of agents certificates.
 )
 
 // checkFlags initializes and parses command line flags, updating the provided Config.
@@ -94,13 +154,54 @@ func checkFlags(config *Config) {
 	flag.BoolVar(&config.Restore, flagRestore, config.Restore, "restore values from file")
 
 	flag.StringVar(&config.StoragePath, flagStoragePath, config.StoragePath, "file storage path")
-	flag.DurationVar(&config.StoreInterval, flagStoreInterval, config.StoreInterval, "store interval val (sec)")
+	flag.StringVar(&config.StorageType, flagStorageType, config.StorageType, "storage backend: database, file or kv")
+	flag.DurationVar(&config.StoreInterval, flagStoreInterval, config.StoreInterval, "store interval val (sec), 0 - synchronous storing")
 
 	flag.StringVar(&config.DataBaseDSN, flagDataBaseDSN, config.DataBaseDSN, "database DSN")
 	flag.StringVar(&config.Key, flagKey, config.Key, "Auth key")
 	flag.StringVar(&config.CertRSA, flagCertRSA, config.CertRSA, "public RSA cert path")
 	flag.StringVar(&config.KeyRSA, flagKeyRSA, config.KeyRSA, "private RSA key path")
 	flag.StringVar(&config.TrustedSubnet, flagTrustedSubnet, config.TrustedSubnet, "CIDR - Classless Inter-Domain Routing")
+
+	flag.Int64Var(&config.HistoryLimit, flagHistoryLimit, config.HistoryLimit, "max count of samples stored per metric")
+	flag.DurationVar(&config.HistoryRetention, flagHistoryRetention, config.HistoryRetention, "max age of samples stored per metric")
+	flag.DurationVar(&config.MetricTTL, flagMetricTTL, config.MetricTTL, "metrics not updated within this time are removed, 0 - metrics never expire")
+	flag.StringVar(&config.AlertRulesPath, flagAlertRulesPath, config.AlertRulesPath, "alerting rules file path")
+	flag.DurationVar(&config.AlertInterval, flagAlertInterval, config.AlertInterval, "alerting rules evaluation interval")
+	flag.Func(flagReadPolicy, "read endpoints requirements, e.g. 'subnet,encryption,signature' or 'none'", func(value string) error {
+		policy, err := ParseRoutePolicy(value)
+		if err != nil {
+			return err
+		}
+		config.ReadPolicy = policy
+		return nil
+	})
+	flag.Func(flagWritePolicy, "write endpoints requirements, e.g. 'subnet,encryption,signature' or 'none'", func(value string) error {
+		policy, err := ParseRoutePolicy(value)
+		if err != nil {
+			return err
+		}
+		config.WritePolicy = policy
+		return nil
+	})
+	flag.Func(flagReadPolicyExempt, "comma separated read endpoints served without encryption and signature, e.g. '/metrics,/ui'", func(value string) error {
+		paths, err := ParseExemptPaths(value)
+		if err != nil {
+			return err
+		}
+		config.ReadPolicyExempt = paths
+		return nil
+	})
+	flag.StringVar(&config.ClientCA, flagClientCA, config.ClientCA, "CA cert path of agents certificates, enables mutual TLS")
+	flag.StringVar(&config.ClientCRL, flagClientCRL, config.ClientCRL, "CRL path of revoked agents certificates")
+	flag.Func(flagReadIdentities, "comma separated identities allowed to read metrics with mutual TLS", func(value string) error {
+		config.ReadIdentities = ParseIdentities(value)
+		return nil
+	})
+	flag.Func(flagWriteIdentities, "comma separated identities allowed to write metrics with mutual TLS", func(value string) error {
+		config.WriteIdentities = ParseIdentities(value)
+		return nil
+	})
 	flag.Parse()
 }
 
@@ -114,12 +215,26 @@ type envConfig struct {
 	LogLevel      string `env:"LOG_LEVEL"`         // LogLevel is the log level.
 	Restore       bool   `env:"RESTORE"`           // Restore is the data restoration setting.
 	StoragePath   string `env:"FILE_STORAGE_PATH"` // StoragePath is the file storage path.
+	StorageType   string `env:"STORAGE_TYPE"`      // StorageType is the storage backend.
 	StoreInterval string `env:"STORE_INTERVAL"`    // StoreInterval is the store interval.
 	DataBaseDSN   string `env:"DATABASE_DSN"`      // DataBaseDSN is the database DSN.
 	Key           string `env:"KEY"`               // Key is the hash key.
 	CertRSA       string `env:"CRYPTO_CERT"`       // CertRSA public cert for connection.
 	KeyRSA        string `env:"CRYPTO_KEY"`        // KeyRSA private key for connection.
 	TrustedSubnet string `env:"TRUSTED_SUBNET"`    // TrustedSubnet - cidr settings.
+
+	HistoryLimit     string `env:"HISTORY_LIMIT"`      // HistoryLimit max count of samples per metric.
+	HistoryRetention string `env:"HISTORY_RETENTION"`  // HistoryRetention max age of samples per metric.
+	MetricTTL        string `env:"METRIC_TTL"`         // MetricTTL max time since the last update of metric.
+	AlertRulesPath   string `env:"ALERT_RULES"`        // AlertRulesPath is the alerting rules file path.
+	AlertInterval    string `env:"ALERT_INTERVAL"`     // AlertInterval is the alerting rules evaluation interval.
+	ReadPolicy       string `env:"READ_POLICY"`        // ReadPolicy is the security requirements of read endpoints.
+	WritePolicy      string `env:"WRITE_POLICY"`       // WritePolicy is the security requirements of write endpoints.
+	ReadPolicyExempt string `env:"READ_POLICY_EXEMPT"` // ReadPolicyExempt is the read endpoints exempted from body requirements.
+	ClientCA         string `env:"CLIENT_CA"`          // ClientCA is the CA cert path of agents certificates.
+	ClientCRL        string `env:"CLIENT_CRL"`         // ClientCRL is the CRL path of agents certificates.
+	ReadIdentities   string `env:"READ_IDENTITIES"`    // ReadIdentities is the identities allowed to read metrics.
+	WriteIdentities  string `env:"WRITE_IDENTITIES"`   // WriteIdentities is the identities allowed to write metrics.
 }
 
 // checkEnvironments reads and parses environment variables, updating the provided Config.
@@ -135,14 +250,105 @@ func checkEnvironments(config *Config) error {
 	configutils.SetEnvToParamIfNeed(&config.PortGRPC, envs.PortGRPC)
 	configutils.SetEnvToParamIfNeed(&config.LogLevel, envs.LogLevel)
 	configutils.SetEnvToParamIfNeed(&config.StoragePath, envs.StoragePath)
+	configutils.SetEnvToParamIfNeed(&config.StorageType, envs.StorageType)
 	configutils.SetEnvToParamIfNeed(&config.StoreInterval, envs.StoreInterval)
 	configutils.SetEnvToParamIfNeed(&config.DataBaseDSN, envs.DataBaseDSN)
 	configutils.SetEnvToParamIfNeed(&config.Key, envs.Key)
 	configutils.SetEnvToParamIfNeed(&config.CertRSA, envs.CertRSA)
 	configutils.SetEnvToParamIfNeed(&config.KeyRSA, envs.KeyRSA)
 	configutils.SetEnvToParamIfNeed(&config.TrustedSubnet, envs.TrustedSubnet)
+	configutils.SetEnvToParamIfNeed(&config.HistoryLimit, envs.HistoryLimit)
+	configutils.SetEnvToParamIfNeed(&config.HistoryRetention, envs.HistoryRetention)
+	configutils.SetEnvToParamIfNeed(&config.MetricTTL, envs.MetricTTL)
+	configutils.SetEnvToParamIfNeed(&config.AlertRulesPath, envs.AlertRulesPath)
+	configutils.SetEnvToParamIfNeed(&config.AlertInterval, envs.AlertInterval)
+	configutils.SetEnvToParamIfNeed(&config.ClientCA, envs.ClientCA)
+	configutils.SetEnvToParamIfNeed(&config.ClientCRL, envs.ClientCRL)
 
 	config.Restore = envs.Restore || config.Restore
 
+	if envs.ReadPolicy != "" {
+		policy, err := ParseRoutePolicy(envs.ReadPolicy)
+		if err != nil {
+			return fmt.Errorf("parse config environments: %w", err)
+		}
+		config.ReadPolicy = policy
+	}
+
+	if envs.WritePolicy != "" {
+		policy, err := ParseRoutePolicy(envs.WritePolicy)
+		if err != nil {
+			return fmt.Errorf("parse config environments: %w", err)
+		}
+		config.WritePolicy = policy
+	}
+
+	if envs.ReadPolicyExempt != "" {
+		paths, err := ParseExemptPaths(envs.ReadPolicyExempt)
+		if err != nil {
+			return fmt.Errorf("parse config environments: %w", err)
+		}
+		config.ReadPolicyExempt = paths
+	}
+
+	if envs.ReadIdentities != "" {
+		config.ReadIdentities = ParseIdentities(envs.ReadIdentities)
+	}
+
+	if envs.WriteIdentities != "" {
+		config.WriteIdentities = ParseIdentities(envs.WriteIdentities)
+	}
+
 	return nil
 }
+
+// ParseIdentities parses comma separated list of certificates identities, e.g. 'agent-1,spiffe://metrics/agent-2'.
+func ParseIdentities(spec string) []string {
+	var identities []string
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			identities = append(identities, item)
+		}
+	}
+	return identities
+}
+
+// ParseExemptPaths parses comma separated list of endpoints paths exempted from route policy, e.g. '/metrics,/ui'.
+// Every path must be absolute.
+func ParseExemptPaths(spec string) ([]string, error) {
+	paths := ParseIdentities(spec)
+	for _, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("exempt path '%s' should start with '/'", path)
+		}
+	}
+	return paths, nil
+}
+
+// Route policy requirements in spec.
+const (
+	requirementNone       = "none"
+	requirementSubnet     = "subnet"
+	requirementEncryption = "encryption"
+	requirementSignature  = "signature"
+)
+
+// ParseRoutePolicy parses route policy from spec. Spec is a comma separated list of requirements:
+// 'subnet', 'encryption' and 'signature', e.g. 'subnet,signature'. Empty spec or 'none' means no requirements.
+func ParseRoutePolicy(spec string) (RoutePolicy, error) {
+	var policy RoutePolicy
+	for _, item := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(item) {
+		case "", requirementNone:
+		case requirementSubnet:
+			policy.TrustedSubnet = true
+		case requirementEncryption:
+			policy.Encryption = true
+		case requirementSignature:
+			policy.Signature = true
+		default:
+			return RoutePolicy{}, fmt.Errorf("route policy '%s' has unknown requirement '%s'", spec, item)
+		}
+	}
+	return policy, nil
+}
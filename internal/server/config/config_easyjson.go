@@ -162,12 +162,38 @@ func easyjson6615c02eDecodeGithubComErupshisMetricsInternalServerConfig2(in *jle
 			out.StoreInterval, _ = time.ParseDuration(in.String())
 		case "storage_file":
 			out.StoragePath = string(in.String())
+		case "storage_type":
+			out.StorageType = string(in.String())
 		case "database_dsn":
 			out.DataBaseDSN = string(in.String())
 		case "hash_key":
 			out.Key = string(in.String())
 		case "crypto_key":
 			out.KeyRSA = string(in.String())
+		case "history_limit":
+			out.HistoryLimit = int64(in.Int64())
+		case "history_retention":
+			out.HistoryRetention, _ = time.ParseDuration(in.String())
+		case "metric_ttl":
+			out.MetricTTL, _ = time.ParseDuration(in.String())
+		case "alert_rules":
+			out.AlertRulesPath = string(in.String())
+		case "alert_interval":
+			out.AlertInterval, _ = time.ParseDuration(in.String())
+		case "read_policy":
+			(out.ReadPolicy).UnmarshalEasyJSON(in)
+		case "write_policy":
+			(out.WritePolicy).UnmarshalEasyJSON(in)
+		case "read_policy_exempt":
+			out.ReadPolicyExempt = decodeStrings(in)
+		case "client_ca":
+			out.ClientCA = string(in.String())
+		case "client_crl":
+			out.ClientCRL = string(in.String())
+		case "read_identities":
+			out.ReadIdentities = decodeStrings(in)
+		case "write_identities":
+			out.WriteIdentities = decodeStrings(in)
 		default:
 			in.SkipRecursive()
 		}
@@ -207,6 +233,11 @@ func easyjson6615c02eEncodeGithubComErupshisMetricsInternalServerConfig2(out *jw
 		out.RawString(prefix)
 		out.String(string(in.StoragePath))
 	}
+	{
+		const prefix string = ",\"storage_type\":"
+		out.RawString(prefix)
+		out.String(string(in.StorageType))
+	}
 	{
 		const prefix string = ",\"database_dsn\":"
 		out.RawString(prefix)
@@ -222,6 +253,66 @@ func easyjson6615c02eEncodeGithubComErupshisMetricsInternalServerConfig2(out *jw
 		out.RawString(prefix)
 		out.String(string(in.KeyRSA))
 	}
+	{
+		const prefix string = ",\"history_limit\":"
+		out.RawString(prefix)
+		out.Int64(int64(in.HistoryLimit))
+	}
+	{
+		const prefix string = ",\"history_retention\":"
+		out.RawString(prefix)
+		out.String(string(in.HistoryRetention.String()))
+	}
+	{
+		const prefix string = ",\"metric_ttl\":"
+		out.RawString(prefix)
+		out.String(string(in.MetricTTL.String()))
+	}
+	{
+		const prefix string = ",\"alert_rules\":"
+		out.RawString(prefix)
+		out.String(string(in.AlertRulesPath))
+	}
+	{
+		const prefix string = ",\"alert_interval\":"
+		out.RawString(prefix)
+		out.String(string(in.AlertInterval.String()))
+	}
+	{
+		const prefix string = ",\"read_policy\":"
+		out.RawString(prefix)
+		(in.ReadPolicy).MarshalEasyJSON(out)
+	}
+	{
+		const prefix string = ",\"write_policy\":"
+		out.RawString(prefix)
+		(in.WritePolicy).MarshalEasyJSON(out)
+	}
+	{
+		const prefix string = ",\"read_policy_exempt\":"
+		out.RawString(prefix)
+		encodeStrings(out, in.ReadPolicyExempt)
+	}
+	{
+		const prefix string = ",\"client_ca\":"
+		out.RawString(prefix)
+		out.String(string(in.ClientCA))
+	}
+	{
+		const prefix string = ",\"client_crl\":"
+		out.RawString(prefix)
+		out.String(string(in.ClientCRL))
+	}
+	{
+		const prefix string = ",\"read_identities\":"
+		out.RawString(prefix)
+		encodeStrings(out, in.ReadIdentities)
+	}
+	{
+		const prefix string = ",\"write_identities\":"
+		out.RawString(prefix)
+		encodeStrings(out, in.WriteIdentities)
+	}
 	out.RawByte('}')
 }
 
@@ -248,3 +339,111 @@ func (v *Config) UnmarshalJSON(data []byte) error {
 func (v *Config) UnmarshalEasyJSON(l *jlexer.Lexer) {
 	easyjson6615c02eDecodeGithubComErupshisMetricsInternalServerConfig2(l, v)
 }
+func easyjson6615c02eDecodeGithubComErupshisMetricsInternalServerConfig3(in *jlexer.Lexer, out *RoutePolicy) {
+	isTopLevel := in.IsStart()
+	if in.IsNull() {
+		if isTopLevel {
+			in.Consumed()
+		}
+		in.Skip()
+		return
+	}
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.UnsafeFieldName(false)
+		in.WantColon()
+		if in.IsNull() {
+			in.Skip()
+			in.WantComma()
+			continue
+		}
+		switch key {
+		case "trusted_subnet":
+			out.TrustedSubnet = bool(in.Bool())
+		case "encryption":
+			out.Encryption = bool(in.Bool())
+		case "signature":
+			out.Signature = bool(in.Bool())
+		default:
+			in.SkipRecursive()
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	if isTopLevel {
+		in.Consumed()
+	}
+}
+func easyjson6615c02eEncodeGithubComErupshisMetricsInternalServerConfig3(out *jwriter.Writer, in RoutePolicy) {
+	out.RawByte('{')
+	first := true
+	_ = first
+	{
+		const prefix string = ",\"trusted_subnet\":"
+		out.RawString(prefix[1:])
+		out.Bool(bool(in.TrustedSubnet))
+	}
+	{
+		const prefix string = ",\"encryption\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.Encryption))
+	}
+	{
+		const prefix string = ",\"signature\":"
+		out.RawString(prefix)
+		out.Bool(bool(in.Signature))
+	}
+	out.RawByte('}')
+}
+
+// MarshalJSON supports json.Marshaler interface
+func (v RoutePolicy) MarshalJSON() ([]byte, error) {
+	w := jwriter.Writer{}
+	easyjson6615c02eEncodeGithubComErupshisMetricsInternalServerConfig3(&w, v)
+	return w.Buffer.BuildBytes(), w.Error
+}
+
+// MarshalEasyJSON supports easyjson.Marshaler interface
+func (v RoutePolicy) MarshalEasyJSON(w *jwriter.Writer) {
+	easyjson6615c02eEncodeGithubComErupshisMetricsInternalServerConfig3(w, v)
+}
+
+// UnmarshalJSON supports json.Unmarshaler interface
+func (v *RoutePolicy) UnmarshalJSON(data []byte) error {
+	r := jlexer.Lexer{Data: data}
+	easyjson6615c02eDecodeGithubComErupshisMetricsInternalServerConfig3(&r, v)
+	return r.Error()
+}
+
+// UnmarshalEasyJSON supports easyjson.Unmarshaler interface
+func (v *RoutePolicy) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	easyjson6615c02eDecodeGithubComErupshisMetricsInternalServerConfig3(l, v)
+}
+func decodeStrings(in *jlexer.Lexer) []string {
+	if in.IsNull() {
+		in.Skip()
+		return nil
+	}
+	in.Delim('[')
+	values := make([]string, 0, 4)
+	for !in.IsDelim(']') {
+		values = append(values, string(in.String()))
+		in.WantComma()
+	}
+	in.Delim(']')
+	return values
+}
+func encodeStrings(out *jwriter.Writer, values []string) {
+	if values == nil && (out.Flags&jwriter.NilSliceAsEmpty) == 0 {
+		out.RawString("null")
+		return
+	}
+	out.RawByte('[')
+	for i, v := range values {
+		if i > 0 {
+			out.RawByte(',')
+		}
+		out.String(string(v))
+	}
+	out.RawByte(']')
+}
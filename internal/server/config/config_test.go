@@ -0,0 +1,88 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoutePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    RoutePolicy
+		wantErr bool
+	}{
+		{name: "empty", spec: "", want: RoutePolicy{}},
+		{name: "none", spec: "none", want: RoutePolicy{}},
+		{name: "all", spec: "subnet, encryption,signature", want: RoutePolicy{TrustedSubnet: true, Encryption: true, Signature: true}},
+		{name: "signature only", spec: "signature", want: RoutePolicy{Signature: true}},
+		{name: "unknown requirement", spec: "subnet,tls", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRoutePolicy(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseIdentities(t *testing.T) {
+	assert.Equal(t, []string{"agent-1", "spiffe://metrics/agent-2"}, ParseIdentities(" agent-1,,spiffe://metrics/agent-2 "))
+	assert.Empty(t, ParseIdentities(""))
+}
+
+func TestParseExemptPaths(t *testing.T) {
+	paths, err := ParseExemptPaths(" /metrics,,/ui ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/metrics", "/ui"}, paths)
+
+	paths, err = ParseExemptPaths("")
+	require.NoError(t, err)
+	assert.Empty(t, paths)
+
+	_, err = ParseExemptPaths("/metrics,ui")
+	assert.Error(t, err)
+}
+
+func TestConfig_UnmarshalJSONIdentities(t *testing.T) {
+	config := Default
+	require.NoError(t, config.UnmarshalJSON([]byte(`{"client_ca":"rsa/ca_cert.pem","read_identities":["agent-1","agent-2"],"write_identities":["agent-1"]}`)))
+
+	assert.Equal(t, "rsa/ca_cert.pem", config.ClientCA)
+	assert.Equal(t, []string{"agent-1", "agent-2"}, config.ReadIdentities)
+	assert.Equal(t, []string{"agent-1"}, config.WriteIdentities)
+
+	data, err := config.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"read_identities":["agent-1","agent-2"],"write_identities":["agent-1"]`)
+}
+
+func TestConfig_UnmarshalJSONPolicies(t *testing.T) {
+	config := Default
+	require.NoError(t, config.UnmarshalJSON([]byte(`{"read_policy":{"trusted_subnet":false},"write_policy":{"trusted_subnet":true,"signature":true}}`)))
+
+	assert.Equal(t, RoutePolicy{}, config.ReadPolicy)
+	assert.Equal(t, RoutePolicy{TrustedSubnet: true, Encryption: true, Signature: true}, config.WritePolicy)
+
+	data, err := config.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"write_policy":{"trusted_subnet":true,"encryption":true,"signature":true}`)
+}
+
+func TestConfig_UnmarshalJSONPolicyExempt(t *testing.T) {
+	config := Default
+	require.NoError(t, config.UnmarshalJSON([]byte(`{"read_policy_exempt":["/metrics","/ui"]}`)))
+
+	assert.Equal(t, []string{"/metrics", "/ui"}, config.ReadPolicyExempt)
+
+	data, err := config.MarshalJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"read_policy_exempt":["/metrics","/ui"]`)
+}
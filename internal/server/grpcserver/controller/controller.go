@@ -2,27 +2,36 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 
 	"github.com/erupshis/metrics/internal/grpc/utils"
 	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/erupshis/metrics/internal/server/agents"
 	"github.com/erupshis/metrics/internal/server/memstorage"
 	"github.com/erupshis/metrics/internal/server/memstorage/data"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+	"github.com/erupshis/metrics/internal/server/watch"
 	"github.com/erupshis/metrics/pb"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Controller struct {
 	pb.UnimplementedMetricsServer
 
 	storage *memstorage.MemStorage
+	agents  *agents.Registry
 }
 
-func New(memStorage *memstorage.MemStorage) *Controller {
+func New(memStorage *memstorage.MemStorage, agentsRegistry *agents.Registry) *Controller {
 	return &Controller{
 		storage: memStorage,
+		agents:  agentsRegistry,
 	}
 }
 
@@ -35,15 +44,56 @@ func (s *Controller) Updates(stream pb.Metrics_UpdatesServer) error {
 			return err
 		}
 
-		s.storage.AddMetricMessageInStorage(utils.ConvertGrpcFormatToMetric(in.Metric))
+		if err = s.addMetric(stream.Context(), in.Metric); err != nil {
+			return err
+		}
 	}
 }
 
-func (s *Controller) Update(_ context.Context, in *pb.UpdateRequest) (*emptypb.Empty, error) {
-	s.storage.AddMetricMessageInStorage(utils.ConvertGrpcFormatToMetric(in.Metric))
+func (s *Controller) Update(ctx context.Context, in *pb.UpdateRequest) (*emptypb.Empty, error) {
+	if err := s.addMetric(ctx, in.Metric); err != nil {
+		return nil, err
+	}
 	return &emptypb.Empty{}, nil
 }
 
+// addMetric stores incoming metric and registers it for the agent sent it.
+func (s *Controller) addMetric(ctx context.Context, in *pb.Metric) error {
+	metric := utils.ConvertGrpcFormatToMetric(in)
+	if metric == nil {
+		return nil
+	}
+
+	if err := networkmsg.Validate(*metric); err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid metric: %v", err)
+	}
+
+	metrics := []networkmsg.Metric{*metric}
+	s.agents.Register(agents.Identify(ctx, getAgentID(ctx), metrics), metrics)
+	metric = &metrics[0]
+	if err := s.storage.AddMetricMessageInStorage(metric); err != nil {
+		if errors.Is(err, memstorage.ErrPersist) {
+			return status.Errorf(codes.Unavailable, "couldn't persist metric: %v", err)
+		}
+		return status.Errorf(codes.InvalidArgument, "couldn't add metric: %v", err)
+	}
+	return nil
+}
+
+// getAgentID extracts agent identifier from incoming metadata.
+func getAgentID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(networkmsg.AgentIDHeader)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
 func (s *Controller) Value(_ context.Context, in *pb.ValueRequest) (*pb.ValueResponse, error) {
 	metric := utils.ConvertGrpcFormatToMetric(in.Metric)
 	if metric == nil {
@@ -52,17 +102,23 @@ func (s *Controller) Value(_ context.Context, in *pb.ValueRequest) (*pb.ValueRes
 
 	switch metric.MType {
 	case data.GaugeType:
-		value, err := s.storage.GetGauge(metric.ID)
+		value, err := s.storage.GetGauge(metric.Key())
 		if err != nil {
 			return nil, status.Errorf(codes.NotFound, "metric not found: %v", err)
 		}
 		metric.Value = &value
 	case data.CounterType:
-		value, err := s.storage.GetCounter(metric.ID)
+		value, err := s.storage.GetCounter(metric.Key())
 		if err != nil {
 			return nil, status.Errorf(codes.NotFound, "metric not found: %v", err)
 		}
 		metric.Delta = &value
+	case data.HistogramType:
+		value, err := s.storage.GetHistogram(metric.Key())
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "metric not found: %v", err)
+		}
+		metric.Histogram = value
 	}
 
 	return &pb.ValueResponse{
@@ -70,9 +126,30 @@ func (s *Controller) Value(_ context.Context, in *pb.ValueRequest) (*pb.ValueRes
 	}, nil
 }
 
+// Delete removes the metric from storage. Metric is identified by its type, name and labels.
+func (s *Controller) Delete(_ context.Context, in *pb.DeleteRequest) (*emptypb.Empty, error) {
+	metric := utils.ConvertGrpcFormatToMetric(in.Metric)
+	if metric == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "couldn't convert incoming metric")
+	}
+
+	if err := s.storage.DeleteMetricMessageFromStorage(metric); err != nil {
+		switch {
+		case errors.Is(err, memstorage.ErrNotFound):
+			return nil, status.Errorf(codes.NotFound, "metric not found: %v", err)
+		case errors.Is(err, memstorage.ErrPersist):
+			return nil, status.Errorf(codes.Unavailable, "couldn't persist metric removal: %v", err)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "couldn't delete metric: %v", err)
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
 func (s *Controller) Values(_ *emptypb.Empty, stream pb.Metrics_ValuesServer) error {
 	for key, val := range s.storage.GetAllGauges() {
-		metric := networkmsg.CreateGaugeMetrics(key, val.(float64))
+		metric := networkmsg.CreateGaugeMetrics(key, *val.(*float64))
+		metric.ID, metric.Labels, _ = networkmsg.ParseSeriesKey(key)
 		err := stream.Send(&pb.ValuesResponse{
 			Metric: utils.ConvertMetricToGrpcFormat(&metric),
 		})
@@ -83,7 +160,20 @@ func (s *Controller) Values(_ *emptypb.Empty, stream pb.Metrics_ValuesServer) er
 	}
 
 	for key, val := range s.storage.GetAllCounters() {
-		metric := networkmsg.CreateCounterMetrics(key, val.(int64))
+		metric := networkmsg.CreateCounterMetrics(key, *val.(*int64))
+		metric.ID, metric.Labels, _ = networkmsg.ParseSeriesKey(key)
+		err := stream.Send(&pb.ValuesResponse{
+			Metric: utils.ConvertMetricToGrpcFormat(&metric),
+		})
+
+		if err != nil {
+			return status.Errorf(codes.Unknown, "sending metric issues")
+		}
+	}
+
+	for key, val := range s.storage.GetAllHistograms() {
+		metric := networkmsg.CreateHistogramMetrics(key, val)
+		metric.ID, metric.Labels, _ = networkmsg.ParseSeriesKey(key)
 		err := stream.Send(&pb.ValuesResponse{
 			Metric: utils.ConvertMetricToGrpcFormat(&metric),
 		})
@@ -96,6 +186,111 @@ func (s *Controller) Values(_ *emptypb.Empty, stream pb.Metrics_ValuesServer) er
 	return nil
 }
 
+// Watch streams resulting values of updated metrics selected by types and name patterns until the call is canceled.
+// Empty types or names don't limit the selection.
+func (s *Controller) Watch(in *pb.WatchRequest, stream pb.Metrics_WatchServer) error {
+	filter := watch.Filter{Names: in.Names}
+	for _, metricType := range in.Types {
+		valueType := utils.ConvertGrpcFormatToMetricType(metricType)
+		if valueType == "" {
+			return status.Errorf(codes.InvalidArgument, "unknown metric type '%s'", metricType)
+		}
+		filter.Types = append(filter.Types, valueType)
+	}
+	if err := filter.Validate(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "incorrect name pattern: %v", err)
+	}
+
+	subscription := s.storage.Subscribe(filter)
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case metric, ok := <-subscription.Updates():
+			if !ok {
+				return nil
+			}
+
+			if err := stream.Send(&pb.WatchResponse{Metric: utils.ConvertMetricToGrpcFormat(&metric)}); err != nil {
+				return status.Errorf(codes.Unknown, "sending metric issues")
+			}
+		}
+	}
+}
+
+// History returns samples of the gauge or counter registered in the requested range.
+// Samples history is not collected for other metric types, so they are rejected as invalid argument.
+func (s *Controller) History(_ context.Context, in *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	metric := utils.ConvertGrpcFormatToMetric(in.Metric)
+	if metric == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "couldn't convert incoming metric")
+	}
+
+	var from, to time.Time
+	if in.From != nil {
+		from = in.From.AsTime()
+	}
+	if in.To != nil {
+		to = in.To.AsTime()
+	}
+
+	var samples []history.Sample
+	var err error
+	switch metric.MType {
+	case data.GaugeType:
+		samples, err = s.storage.GetGaugeHistory(metric.Key(), from, to)
+	case data.CounterType:
+		samples, err = s.storage.GetCounterHistory(metric.Key(), from, to)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "history is available for gauges and counters only")
+	}
+
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "metric not found: %v", err)
+	}
+
+	res := &pb.HistoryResponse{
+		Metric:  in.Metric,
+		Samples: make([]*pb.Sample, 0, len(samples)),
+	}
+	for _, sample := range samples {
+		res.Samples = append(res.Samples, &pb.Sample{
+			Ts:    timestamppb.New(sample.Timestamp),
+			Value: sample.Value,
+		})
+	}
+
+	return res, nil
+}
+
+// Rate returns per-second rate of the counter computed over samples registered in the requested range.
+func (s *Controller) Rate(_ context.Context, in *pb.HistoryRequest) (*pb.RateResponse, error) {
+	metric := utils.ConvertGrpcFormatToMetric(in.Metric)
+	if metric == nil || metric.MType != data.CounterType {
+		return nil, status.Errorf(codes.InvalidArgument, "rate is available for counters only")
+	}
+
+	var from, to time.Time
+	if in.From != nil {
+		from = in.From.AsTime()
+	}
+	if in.To != nil {
+		to = in.To.AsTime()
+	}
+
+	rate, err := s.storage.GetCounterRate(metric.Key(), from, to)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "metric not found: %v", err)
+	}
+
+	return &pb.RateResponse{
+		Metric: in.Metric,
+		Rate:   rate,
+	}, nil
+}
+
 func (s *Controller) CheckStorage(ctx context.Context, _ *emptypb.Empty) (*pb.CheckStorageResponse, error) {
 	res, err := s.storage.IsAvailable(ctx)
 	if err != nil {
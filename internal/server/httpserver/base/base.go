@@ -6,22 +6,34 @@
 package base
 
 import (
-	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
-	"text/template"
+	"strings"
+	"time"
 
 	"github.com/erupshis/metrics/internal/compressor"
 	"github.com/erupshis/metrics/internal/hasher"
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/ipvalidator"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/mtls"
 	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/rsa"
+	"github.com/erupshis/metrics/internal/server/agents"
 	"github.com/erupshis/metrics/internal/server/config"
 	"github.com/erupshis/metrics/internal/server/memstorage"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+	"github.com/erupshis/metrics/internal/server/prometheus"
+	"github.com/erupshis/metrics/internal/server/query"
+	"github.com/erupshis/metrics/internal/server/watch"
+	"github.com/erupshis/metrics/internal/server/webui"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -29,25 +41,30 @@ import (
 type HTTPController struct {
 	config      *config.Config
 	storage     *memstorage.MemStorage
+	agents      *agents.Registry
 	logger      logger.BaseLogger
 	compressor  compressor.GzipHandler
 	hash        *hasher.Hasher
 	decoder     *rsa.Decoder
 	validatorIP *ipvalidator.ValidatorIP
+	authorizer  *mtls.Authorizer
 }
 
 // Create initializes and returns a new instance of HTTPController.
-// It takes a context, configuration, logger, MemStorage, and Hasher as parameters.
+// It takes a context, configuration, logger, MemStorage, agents Registry and Hasher as parameters.
+// Authorizer checks permissions of mutual TLS clients, nil authorizer disables the check.
 // If data restoration is enabled, it attempts to restore data from a file.
-func Create(config *config.Config, logger logger.BaseLogger, storage *memstorage.MemStorage, hash *hasher.Hasher, decoder *rsa.Decoder, validatorIP *ipvalidator.ValidatorIP) *HTTPController {
+func Create(config *config.Config, logger logger.BaseLogger, storage *memstorage.MemStorage, agentsRegistry *agents.Registry, hash *hasher.Hasher, decoder *rsa.Decoder, validatorIP *ipvalidator.ValidatorIP, authorizer *mtls.Authorizer) *HTTPController {
 	controller := &HTTPController{
 		config:      config,
 		storage:     storage,
+		agents:      agentsRegistry,
 		logger:      logger,
 		compressor:  compressor.GzipHandler{},
 		hash:        hash,
 		decoder:     decoder,
 		validatorIP: validatorIP,
+		authorizer:  authorizer,
 	}
 	return controller
 }
@@ -58,23 +75,43 @@ func (c *HTTPController) GetConfig() *config.Config {
 }
 
 // Route returns a new chi.Mux router configured with middleware and handlers for HTTPController.
+// Read and write endpoints are protected according to ReadPolicy and WritePolicy of config.
+// Read endpoints listed in ReadPolicyExempt of config are subjects of access restrictions of ReadPolicy only.
 func (c *HTTPController) Route() *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(c.logger.LogHandler)
-	r.Use(c.validatorIP.ValidateIPHandler)
-	r.Use(c.decoder.DecodeRSAHandler)
-	r.Use(c.hash.Handler)
-	r.Use(c.compressor.GzipHandle)
 
-	r.Get("/", c.ListHandler)
-	r.Get("/ping", c.checkStorageHandler)
+	read := c.policyHandlers(c.config.ReadPolicy, false)
+	write := c.policyHandlers(c.config.WritePolicy, true)
+
+	r.Group(func(r chi.Router) {
+		r.Use(c.exemptHandlers(read, c.accessHandlers(c.config.ReadPolicy, false), c.config.ReadPolicyExempt))
+
+		r.Get("/", c.ListHandler)
+		r.Get("/ping", c.checkStorageHandler)
+		r.Get("/history/{type}/{name}", c.historyHandler)
+		r.Get("/rate/{type}/{name}", c.rateHandler)
+		r.Get("/rates", c.ratesHandler)
+		r.Get("/agents", c.agentsHandler)
+		r.Get("/metrics", c.prometheusHandler)
+		r.Get("/watch", c.watchHandler)
+		r.Route("/ui", func(r chi.Router) {
+			r.Get("/api/values", c.valuesHandler)
+			r.Handle("/*", http.StripPrefix("/ui", webui.Handler()))
+		})
+	})
+
+	// value and update endpoints share path patterns, so policy is chosen per request.
 	r.Route("/{request}", func(r chi.Router) {
+		r.Use(c.requestHandlers(read, write))
+
 		r.Post("/", c.jsonHandler)
 		r.Route("/{type}", func(r chi.Router) {
 			r.HandleFunc("/", c.missingNameHandler)
 			r.Route("/{name}", func(r chi.Router) {
 				r.Get("/", c.getHandler)
+				r.Delete("/", c.deleteHandler)
 				r.Post("/{value}", c.postHandler)
 			})
 		})
@@ -84,6 +121,84 @@ func (c *HTTPController) Route() *chi.Mux {
 	return r
 }
 
+// policyHandlers returns middlewares enforcing policy on read or write endpoints: client access validation,
+// body decryption and hash-sum validation followed by gzip handling.
+func (c *HTTPController) policyHandlers(policy config.RoutePolicy, write bool) chi.Middlewares {
+	handlers := c.accessHandlers(policy, write)
+	if policy.Encryption {
+		handlers = append(handlers, c.decoder.DecodeRSAHandler)
+	}
+	if policy.Signature {
+		handlers = append(handlers, c.hash.RequireHandler)
+	} else {
+		handlers = append(handlers, c.hash.Handler)
+	}
+	return append(handlers, c.compressor.GzipHandle)
+}
+
+// requestHandlers returns middleware which passes read requests through read middlewares and the rest through write ones.
+func (c *HTTPController) requestHandlers(read, write chi.Middlewares) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		readNext, writeNext := read.Handler(next), write.Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isReadRequest(r) {
+				readNext.ServeHTTP(w, r)
+			} else {
+				writeNext.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// exemptHandlers returns middleware which passes requests of exempted paths and their subpaths through exempt
+// middlewares and the rest through policy ones.
+func (c *HTTPController) exemptHandlers(policy, exempt chi.Middlewares, paths []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		policyNext, exemptNext := policy.Handler(next), exempt.Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isExemptPath(r.URL.Path, paths) {
+				exemptNext.ServeHTTP(w, r)
+			} else {
+				policyNext.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// isExemptPath checks whether path is one of exempted paths or their subpaths.
+func isExemptPath(path string, paths []string) bool {
+	for _, exempt := range paths {
+		exempt = strings.TrimSuffix(exempt, "/")
+		if path == exempt || strings.HasPrefix(path, exempt+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadRequest checks whether request doesn't modify metrics.
+func isReadRequest(r *http.Request) bool {
+	switch chi.URLParam(r, "request") {
+	case getRequest, queryRequest:
+		return r.Method != http.MethodDelete
+	default:
+		return r.Method == http.MethodGet
+	}
+}
+
+// accessHandlers returns middlewares enforcing trusted subnet requirement of policy and
+// read or write permission of mutual TLS client.
+func (c *HTTPController) accessHandlers(policy config.RoutePolicy, write bool) chi.Middlewares {
+	handlers := chi.Middlewares{}
+	if c.authorizer != nil {
+		handlers = append(handlers, c.authorizer.Handler(write))
+	}
+	if policy.TrustedSubnet {
+		handlers = append(handlers, c.validatorIP.ValidateIPHandler)
+	}
+	return handlers
+}
+
 // badRequestHandler handles HTTP requests with a status of BadRequest (400).
 func (c *HTTPController) badRequestHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusBadRequest)
@@ -107,12 +222,15 @@ func (c *HTTPController) checkStorageHandler(w http.ResponseWriter, r *http.Requ
 }
 
 const (
-	postBatchRequest = "updates"
-	postRequest      = "update"
-	getRequest       = "value"
+	postBatchRequest   = "updates"
+	postRequest        = "update"
+	getRequest         = "value"
+	deleteBatchRequest = "deletes"
+	queryRequest       = "query"
 
-	gaugeType   = "gauge"
-	counterType = "counter"
+	gaugeType     = "gauge"
+	counterType   = "counter"
+	histogramType = "histogram"
 )
 
 // jsonHandler handles JSON requests and delegates to specific handlers based on the request type.
@@ -139,7 +257,9 @@ func (c *HTTPController) jsonHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		responseBody = c.jsonPostHandler(w, &metric)
+		metrics := []networkmsg.Metric{metric}
+		c.agents.Register(agents.Identify(r.Context(), r.Header.Get(networkmsg.AgentIDHeader), metrics), metrics)
+		responseBody = c.jsonPostHandler(w, &metrics[0])
 
 	case postBatchRequest:
 		data, err := networkmsg.ParsePostBatchValueMessage(buf.Bytes())
@@ -147,6 +267,7 @@ func (c *HTTPController) jsonHandler(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		c.agents.Register(agents.Identify(r.Context(), r.Header.Get(networkmsg.AgentIDHeader), data), data)
 		responseBody = c.jsonPostBatchHandler(w, data)
 
 	case getRequest:
@@ -156,6 +277,17 @@ func (c *HTTPController) jsonHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		responseBody = c.jsonGetHandler(w, &metric)
+
+	case deleteBatchRequest:
+		data, err := networkmsg.ParsePostBatchValueMessage(buf.Bytes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		responseBody = c.jsonDeleteBatchHandler(w, data)
+
+	case queryRequest:
+		responseBody = c.jsonQueryHandler(w, buf.Bytes())
 	}
 
 	if responseBody == nil {
@@ -167,9 +299,23 @@ func (c *HTTPController) jsonHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // jsonPostBatchHandler handles batch JSON requests and adds metrics to storage.
+// Metrics failed to be added are reported in response with BadRequest status, the rest of metrics are stored.
+// ServiceUnavailable status is used if any metric wasn't persisted in synchronous mode.
 func (c *HTTPController) jsonPostBatchHandler(w http.ResponseWriter, metrics []networkmsg.Metric) []byte {
+	errMsg := ""
+	status := http.StatusBadRequest
 	for _, metric := range metrics {
-		c.storage.AddMetricMessageInStorage(&metric)
+		if err := c.storage.AddMetricMessageInStorage(&metric); err != nil {
+			errMsg += err.Error() + "; "
+			if errors.Is(err, memstorage.ErrPersist) {
+				status = http.StatusServiceUnavailable
+			}
+		}
+	}
+
+	if errMsg != "" {
+		http.Error(w, errMsg, status)
+		return nil
 	}
 
 	w.Header().Add("Content-Type", "application/json")
@@ -178,28 +324,75 @@ func (c *HTTPController) jsonPostBatchHandler(w http.ResponseWriter, metrics []n
 
 // jsonPostHandler handles single JSON requests and adds a metric to storage.
 func (c *HTTPController) jsonPostHandler(w http.ResponseWriter, data *networkmsg.Metric) []byte {
-	c.storage.AddMetricMessageInStorage(data)
+	if err := c.storage.AddMetricMessageInStorage(data); err != nil {
+		http.Error(w, err.Error(), addMetricErrorStatus(err))
+		return nil
+	}
+
 	w.Header().Add("Content-Type", "application/json")
 	return networkmsg.CreatePostUpdateMessage(*data)
 }
 
+// addMetricErrorStatus returns response status for metric adding error.
+func addMetricErrorStatus(err error) int {
+	if errors.Is(err, memstorage.ErrPersist) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// jsonDeleteBatchHandler handles batch JSON requests and removes metrics from storage.
+// Missing metrics are skipped, so the request may be repeated safely.
+// Metrics failed to be removed are reported in response with BadRequest status,
+// ServiceUnavailable status is used if any removal wasn't persisted in synchronous mode.
+func (c *HTTPController) jsonDeleteBatchHandler(w http.ResponseWriter, metrics []networkmsg.Metric) []byte {
+	errMsg := ""
+	status := http.StatusBadRequest
+	for _, metric := range metrics {
+		err := c.storage.DeleteMetricMessageFromStorage(&metric)
+		if err == nil || errors.Is(err, memstorage.ErrNotFound) {
+			continue
+		}
+
+		errMsg += err.Error() + "; "
+		if errors.Is(err, memstorage.ErrPersist) {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	if errMsg != "" {
+		http.Error(w, errMsg, status)
+		return nil
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	return []byte("{}")
+}
+
 // jsonGetHandler handles JSON GET requests and retrieves metrics from storage.
 func (c *HTTPController) jsonGetHandler(w http.ResponseWriter, data *networkmsg.Metric) []byte {
 	switch data.MType {
 	case gaugeType:
-		value, err := c.storage.GetGauge(data.ID)
+		value, err := c.storage.GetGauge(data.Key())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return nil
 		}
 		data.Value = &value
 	case counterType:
-		value, err := c.storage.GetCounter(data.ID)
+		value, err := c.storage.GetCounter(data.Key())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return nil
 		}
 		data.Delta = &value
+	case histogramType:
+		value, err := c.storage.GetHistogram(data.Key())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return nil
+		}
+		data.Histogram = value
 	}
 
 	w.Header().Add("Content-Type", "application/json")
@@ -235,13 +428,18 @@ func (c *HTTPController) postCounterHandler(w http.ResponseWriter, r *http.Reque
 	c.logger.Info("[HTTPController::postCounterHandler] handle url post request for: '%s'(%s) value", name, value)
 	c.hash.WriteHashHeaderInResponseIfNeed(w, []byte{})
 
-	if val, err := strconv.ParseInt(value, 10, 64); err == nil {
-		c.storage.AddCounter(name, val)
-	} else {
+	val, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || !networkmsg.IsValidName(name) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	if err = c.storage.AddCounter(name, val); err != nil {
+		c.logger.Info("[HTTPController::postCounterHandler] failed to add counter '%s': %v", name, err)
+		w.WriteHeader(addMetricErrorStatus(err))
+		return
+	}
+
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 }
@@ -253,13 +451,18 @@ func (c *HTTPController) postGaugeHandler(w http.ResponseWriter, r *http.Request
 	c.logger.Info("[HTTPController::postGaugeHandler] handle url post request for: '%s'(%s) value", name, value)
 	c.hash.WriteHashHeaderInResponseIfNeed(w, []byte{})
 
-	if val, err := strconv.ParseFloat(value, 64); err == nil {
-		c.storage.AddGauge(name, val)
-	} else {
+	val, err := strconv.ParseFloat(value, 64)
+	if err != nil || !networkmsg.IsValidName(name) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	if err = c.storage.AddGauge(name, val); err != nil {
+		c.logger.Info("[HTTPController::postGaugeHandler] failed to add gauge '%s': %v", name, err)
+		w.WriteHeader(addMetricErrorStatus(err))
+		return
+	}
+
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 }
@@ -324,59 +527,509 @@ func (c *HTTPController) getGaugeHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// HTML METRICS LIST PROCESSING.
+// deleteHandler handles HTTP DELETE requests of metric based on the request and type.
+func (c *HTTPController) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	request, valueType, name := chi.URLParam(r, "request"), chi.URLParam(r, "type"), nameParam(r)
+
+	c.logger.Info("[HTTPController::deleteHandler] handle url delete request for: '%s'(%s)", name, valueType)
+	c.hash.WriteHashHeaderInResponseIfNeed(w, []byte{})
+
+	if request != getRequest {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch valueType {
+	case gaugeType:
+		err = c.storage.DeleteGauge(name)
+	case counterType:
+		err = c.storage.DeleteCounter(name)
+	case histogramType:
+		err = c.storage.DeleteHistogram(name)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		c.logger.Info("[HTTPController::deleteHandler] failed to delete %s '%s': %v", valueType, name, err)
+		w.WriteHeader(deleteMetricErrorStatus(err))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+}
+
+// deleteMetricErrorStatus returns response status for metric removal error.
+func deleteMetricErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, memstorage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, memstorage.ErrPersist):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// METRICS HISTORY PROCESSING.
+
+// historyResponse represents metric samples history in JSON response.
+type historyResponse struct {
+	ID      string           `json:"id"`
+	MType   string           `json:"type"`
+	Samples []history.Sample `json:"samples"`
+}
+
+// historyHandler handles HTTP GET requests for metric samples registered in range [from, to].
+// Range borders are passed in query params 'from' and 'to' in RFC3339 format or as unix time in seconds.
+func (c *HTTPController) historyHandler(w http.ResponseWriter, r *http.Request) {
+	valueType, name := chi.URLParam(r, "type"), nameParam(r)
+
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var samples []history.Sample
+	switch valueType {
+	case gaugeType:
+		samples, err = c.storage.GetGaugeHistory(name, from, to)
+	case counterType:
+		samples, err = c.storage.GetCounterHistory(name, from, to)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		c.logger.Info("[HTTPController::historyHandler] metric not found error: %v", err)
+		c.hash.WriteHashHeaderInResponseIfNeed(w, []byte{})
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-const tmplMap = `
-<html><body>
-<caption>GAUGES</caption>
-<table border = 2>
-{{- range $key, $value := .Gauges}}
-<tr><td>{{ $key }}</td><td>{{ $value }}</td></tr>
-{{- end}}
-</table>
+	responseBody, err := json.Marshal(historyResponse{ID: name, MType: valueType, Samples: samples})
+	if err != nil {
+		c.logger.Info("[HTTPController::historyHandler] failed to marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-<caption>COUNTERS</caption>
-<table border = 2>
-{{- range $key, $value := .Counters}}
-<tr><td>{{ $key }}</td><td>{{ $value }}</td></tr>
-{{- end}}
-</table>
-</body></html>
-`
+	w.Header().Add("Content-Type", "application/json")
+	c.hash.WriteHashHeaderInResponseIfNeed(w, responseBody)
+	if _, err = w.Write(responseBody); err != nil {
+		c.logger.Info("[HTTPController::historyHandler] failed to write body: %v", err)
+	}
+}
 
-type tmplData struct {
-	Gauges   map[string]interface{}
-	Counters map[string]interface{}
+// rateResponse represents computed per-second rate of counter in JSON response.
+type rateResponse struct {
+	ID    string  `json:"id"`
+	MType string  `json:"type"`
+	Rate  float64 `json:"rate"`
 }
 
-// ListHandler handles HTTP requests to display a list of gauges and counters in HTML format.
-func (c *HTTPController) ListHandler(w http.ResponseWriter, _ *http.Request) {
-	tmpl, err := template.New("mapTemplate").Parse(tmplMap)
+// rateHandler handles HTTP GET requests for per-second rate of the counter computed over samples registered in range [from, to].
+// Range borders are passed in query params the same way as for history requests.
+func (c *HTTPController) rateHandler(w http.ResponseWriter, r *http.Request) {
+	valueType, name := chi.URLParam(r, "type"), nameParam(r)
+	if valueType != counterType {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := parseTimeRange(r)
 	if err != nil {
-		c.logger.Info("[HTTPController:ListHandler] error parsing gauge template: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rate, err := c.storage.GetCounterRate(name, from, to)
+	if err != nil {
+		c.logger.Info("[HTTPController::rateHandler] metric not found error: %v", err)
+		c.hash.WriteHashHeaderInResponseIfNeed(w, []byte{})
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	gaugesMap := c.storage.GetAllGauges()
-	countersMap := c.storage.GetAllCounters()
+	c.writeJSON(w, "rateHandler", rateResponse{ID: name, MType: valueType, Rate: rate})
+}
 
-	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+// ratesHandler handles HTTP GET requests for per-second rates of all counters computed over samples registered in range [from, to].
+func (c *HTTPController) ratesHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	buf := bytes.Buffer{}
-	writer := bufio.NewWriter(&buf)
+	c.writeJSON(w, "ratesHandler", c.storage.GetAllCountersRates(from, to))
+}
 
-	if err = tmpl.Execute(writer, tmplData{gaugesMap, countersMap}); err != nil {
+// QUERIES PROCESSING.
+
+// queryRequestBody represents aggregation query in JSON request.
+// Range borders are passed the same way as for history requests, window is passed as duration string, e.g. '1m'.
+type queryRequestBody struct {
+	MType       string            `json:"type"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	From        string            `json:"from,omitempty"`
+	To          string            `json:"to,omitempty"`
+	Window      string            `json:"window,omitempty"`
+	OverTime    string            `json:"over_time,omitempty"`
+	Aggregation string            `json:"aggregation,omitempty"`
+	By          []string          `json:"by,omitempty"`
+}
+
+// queryResponse represents resulting series of aggregation query in JSON response.
+type queryResponse struct {
+	Series []query.Series `json:"series"`
+}
+
+// jsonQueryHandler handles JSON requests with aggregation queries over gauges or counters.
+// Series are selected by name pattern and label filters, reduced over time windows and aggregated across series.
+func (c *HTTPController) jsonQueryHandler(w http.ResponseWriter, body []byte) []byte {
+	var request queryRequestBody
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	q, err := parseQuery(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	var inputs []query.Input
+	switch request.MType {
+	case gaugeType:
+		inputs = queryInputs(c.storage.GetAllGauges(), c.storage.GetGaugeHistory, q)
+	case counterType:
+		inputs = queryInputs(c.storage.GetAllCounters(), c.storage.GetCounterHistory, q)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported metric type '%s'", request.MType), http.StatusBadRequest)
+		return nil
+	}
+
+	series, err := query.Execute(q, inputs, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	responseBody, err := json.Marshal(queryResponse{Series: series})
+	if err != nil {
+		c.logger.Info("[HTTPController::jsonQueryHandler] failed to marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	return responseBody
+}
+
+// parseQuery converts JSON request into validated query.
+func parseQuery(request queryRequestBody) (query.Query, error) {
+	from, err := parseTimeParam(request.From)
+	if err != nil {
+		return query.Query{}, fmt.Errorf("incorrect 'from' param: %w", err)
+	}
+
+	to, err := parseTimeParam(request.To)
+	if err != nil {
+		return query.Query{}, fmt.Errorf("incorrect 'to' param: %w", err)
+	}
+
+	var window time.Duration
+	if request.Window != "" {
+		if window, err = time.ParseDuration(request.Window); err != nil {
+			return query.Query{}, fmt.Errorf("incorrect 'window' param: %w", err)
+		}
+	}
+
+	q := query.Query{
+		Name:        request.Name,
+		Labels:      request.Labels,
+		From:        from,
+		To:          to,
+		Window:      window,
+		OverTime:    request.OverTime,
+		Aggregation: request.Aggregation,
+		By:          request.By,
+	}
+	return q, q.Validate()
+}
+
+// queryInputs collects current values of series selected by query and their samples registered in query range.
+// Series removed from storage while collecting are skipped.
+func queryInputs(values map[string]interface{}, getHistory func(name string, from, to time.Time) ([]history.Sample, error), q query.Query) []query.Input {
+	inputs := make([]query.Input, 0, len(values))
+	for key, value := range values {
+		if !q.Match(key) {
+			continue
+		}
+
+		input := query.Input{Key: key}
+		switch v := value.(type) {
+		case *float64:
+			input.Value = *v
+		case *int64:
+			input.Value = float64(*v)
+		}
+
+		if q.IsRange() {
+			samples, err := getHistory(key, q.From, q.To)
+			if err != nil {
+				continue
+			}
+			input.Samples = samples
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs
+}
+
+// writeJSON marshals response in JSON and writes it with hash header if needed.
+func (c *HTTPController) writeJSON(w http.ResponseWriter, handler string, response interface{}) {
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		c.logger.Info("[HTTPController::%s] failed to marshal response: %v", handler, err)
 		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	c.hash.WriteHashHeaderInResponseIfNeed(w, responseBody)
+	if _, err = w.Write(responseBody); err != nil {
+		c.logger.Info("[HTTPController::%s] failed to write body: %v", handler, err)
+	}
+}
+
+// nameParam returns unescaped metric name from URL. Names of labeled series contain characters which are escaped
+// in path, router matches escaped path in that case.
+func nameParam(r *http.Request) string {
+	name := chi.URLParam(r, "name")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
 	}
+	return name
+}
 
-	err = writer.Flush()
+// parseTimeRange parses range borders from query params 'from' and 'to'.
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(r.URL.Query().Get("from"))
 	if err != nil {
-		c.logger.Info("[HTTPController:ListHandler] flush writer failed: %v", err)
+		return time.Time{}, time.Time{}, fmt.Errorf("incorrect 'from' param: %w", err)
+	}
+
+	to, err := parseTimeParam(r.URL.Query().Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("incorrect 'to' param: %w", err)
+	}
+	return from, to, nil
+}
+
+// parseTimeParam parses time from RFC3339 format or unix time in seconds. Empty value means zero time.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
 	}
 
+	return time.Parse(time.RFC3339, value)
+}
+
+// UPDATES STREAMING.
+
+// watchKeepAliveInterval is an interval of comments sent in idle events stream to keep connection alive.
+const watchKeepAliveInterval = 15 * time.Second
+
+// watchHandler handles HTTP GET requests for the stream of updated metrics values in server-sent events format.
+// Every accepted update is sent as 'update' event with metric in JSON. Updates are filtered by query params
+// 'type' and 'name' (shell pattern of metric name), both params may be repeated.
+func (c *HTTPController) watchHandler(w http.ResponseWriter, r *http.Request) {
+	filter := watch.Filter{Types: r.URL.Query()["type"], Names: r.URL.Query()["name"]}
+	for _, valueType := range filter.Types {
+		if valueType != gaugeType && valueType != counterType && valueType != histogramType {
+			http.Error(w, fmt.Sprintf("unknown metric type '%s'", valueType), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := filter.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("incorrect 'name' param: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	subscription := c.storage.Subscribe(filter)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		c.logger.Info("[HTTPController::watchHandler] streaming is not supported: %v", err)
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	keepAlive := time.NewTicker(watchKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case metric, ok := <-subscription.Updates():
+			if !ok {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: update\ndata: %s\n\n", networkmsg.CreatePostUpdateMessage(metric))
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			c.logger.Info("[HTTPController::watchHandler] failed to write event: %v", err)
+			return
+		}
+	}
+}
+
+// AGENTS PROCESSING.
+
+// agentsHandler handles HTTP GET requests for the list of agents with their last seen time and reported series.
+func (c *HTTPController) agentsHandler(w http.ResponseWriter, _ *http.Request) {
+	responseBody, err := json.Marshal(c.agents.GetAll())
+	if err != nil {
+		c.logger.Info("[HTTPController::agentsHandler] failed to marshal response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	c.hash.WriteHashHeaderInResponseIfNeed(w, responseBody)
+	if _, err = w.Write(responseBody); err != nil {
+		c.logger.Info("[HTTPController::agentsHandler] failed to write body: %v", err)
+	}
+}
+
+// PROMETHEUS EXPOSITION PROCESSING.
+
+// prometheusHandler handles HTTP requests to render all gauges and counters in Prometheus text exposition format.
+func (c *HTTPController) prometheusHandler(w http.ResponseWriter, _ *http.Request) {
+	registry := prometheus.NewRegistry()
+
+	for key, value := range c.storage.GetAllGauges() {
+		name, labels := c.parseSeriesKey(key)
+		if err := registry.Add(name, prometheus.GaugeType, prometheus.Sample{Labels: labels, Value: *value.(*float64)}); err != nil {
+			c.logger.Info("[HTTPController:prometheusHandler] gauge skipped: %v", err)
+		}
+	}
+
+	for key, value := range c.storage.GetAllCounters() {
+		name, labels := c.parseSeriesKey(key)
+		if err := registry.Add(name, prometheus.CounterType, prometheus.Sample{Labels: labels, Value: float64(*value.(*int64))}); err != nil {
+			c.logger.Info("[HTTPController:prometheusHandler] counter skipped: %v", err)
+		}
+	}
+
+	for key, value := range c.storage.GetAllHistograms() {
+		name, labels := c.parseSeriesKey(key)
+		if err := registry.AddHistogram(name, labels, value); err != nil {
+			c.logger.Info("[HTTPController:prometheusHandler] histogram skipped: %v", err)
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if err := prometheus.Write(&buf, registry.Families()); err != nil {
+		c.logger.Info("[HTTPController:prometheusHandler] failed to render metrics: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", prometheus.ContentType)
 	c.hash.WriteHashHeaderInResponseIfNeed(w, buf.Bytes())
-	_, err = w.Write(buf.Bytes())
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		c.logger.Info("[HTTPController:prometheusHandler] failed to write body: %v", err)
+	}
+}
+
+// parseSeriesKey splits storage series key into metric name and labels.
+// Malformed key is treated as metric name without labels.
+func (c *HTTPController) parseSeriesKey(key string) (string, map[string]string) {
+	name, labels, err := networkmsg.ParseSeriesKey(key)
 	if err != nil {
+		c.logger.Info("[HTTPController:parseSeriesKey] %v", err)
+	}
+	return name, labels
+}
+
+// DASHBOARD PROCESSING.
+
+// valueResponse represents current value of the series in dashboard JSON response.
+// Histogram is set for histograms only, value is set for gauges and counters.
+type valueResponse struct {
+	Key       string               `json:"key"`
+	Name      string               `json:"name"`
+	Labels    map[string]string    `json:"labels,omitempty"`
+	MType     string               `json:"type"`
+	Value     float64              `json:"value"`
+	Histogram *histogram.Histogram `json:"histogram,omitempty"`
+}
+
+// ListHandler handles HTTP requests to display dashboard with the list of metrics.
+func (c *HTTPController) ListHandler(w http.ResponseWriter, _ *http.Request) {
+	page := webui.Index()
+
+	w.Header().Add("Content-Type", "text/html; charset=utf-8")
+	c.hash.WriteHashHeaderInResponseIfNeed(w, page)
+	if _, err := w.Write(page); err != nil {
 		c.logger.Info("[HTTPController:ListHandler] failed to write body: %v", err)
 	}
 }
+
+// valuesHandler handles HTTP GET requests for current values of all series sorted by type and series key.
+func (c *HTTPController) valuesHandler(w http.ResponseWriter, _ *http.Request) {
+	var values []valueResponse
+	add := func(key string, valueType string, value float64, hist *histogram.Histogram) {
+		name, labels := c.parseSeriesKey(key)
+		values = append(values, valueResponse{Key: key, Name: name, Labels: labels, MType: valueType, Value: value, Histogram: hist})
+	}
+
+	for key, value := range c.storage.GetAllGauges() {
+		add(key, gaugeType, *value.(*float64), nil)
+	}
+	for key, value := range c.storage.GetAllCounters() {
+		add(key, counterType, float64(*value.(*int64)), nil)
+	}
+	for key, value := range c.storage.GetAllHistograms() {
+		add(key, histogramType, 0, value)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].MType != values[j].MType {
+			return values[i].MType < values[j].MType
+		}
+		return values[i].Key < values[j].Key
+	})
+
+	if values == nil {
+		values = []valueResponse{}
+	}
+	c.writeJSON(w, "valuesHandler", values)
+}
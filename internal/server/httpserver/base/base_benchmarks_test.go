@@ -16,6 +16,7 @@ import (
 	"github.com/erupshis/metrics/internal/logger"
 	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/rsa"
+	"github.com/erupshis/metrics/internal/server/agents"
 	"github.com/erupshis/metrics/internal/server/httpserver/base"
 	"github.com/erupshis/metrics/internal/server/memstorage"
 	"github.com/erupshis/metrics/internal/server/memstorage/storagemngr"
@@ -87,7 +88,7 @@ func postURI(metrics []networkmsg.Metric) {
 		log.Info("rsa decoder: %v", err)
 	}
 	// Create a HTTPController instance.
-	baseController := base.Create(&cfg, log, storage, hashManager, decoder, ipvalidator.Create(nil))
+	baseController := base.Create(&cfg, log, storage, agents.Create(), hashManager, decoder, ipvalidator.Create(nil), nil)
 
 	for i := 0; i < len(metrics); i++ {
 		// Customize the request based on the metric type.
@@ -120,7 +121,7 @@ func postJSON(metrics []networkmsg.Metric) {
 		log.Info("rsa decoder: %v", err)
 	}
 	// Create a HTTPController instance.
-	baseController := base.Create(&cfg, log, storage, hashManager, decoder, ipvalidator.Create(nil))
+	baseController := base.Create(&cfg, log, storage, agents.Create(), hashManager, decoder, ipvalidator.Create(nil), nil)
 
 	for i := 0; i < len(metrics); i++ {
 		// Customize the request based on the metric type.
@@ -155,7 +156,7 @@ func postBatchJSON(metrics []networkmsg.Metric) {
 		log.Info("rsa decoder: %v", err)
 	}
 	// Create a HTTPController instance.
-	baseController := base.Create(&cfg, log, storage, hashManager, decoder, ipvalidator.Create(nil))
+	baseController := base.Create(&cfg, log, storage, agents.Create(), hashManager, decoder, ipvalidator.Create(nil), nil)
 
 	var req *http.Request
 	body, _ := json.Marshal(&metrics)
@@ -185,7 +186,7 @@ func BenchmarkBaseController_getMetrics(b *testing.B) {
 		log.Info("rsa decoder: %v", err)
 	}
 	// Create a HTTPController instance.
-	baseController := base.Create(&cfg, log, storage, hashManager, decoder, ipvalidator.Create(nil))
+	baseController := base.Create(&cfg, log, storage, agents.Create(), hashManager, decoder, ipvalidator.Create(nil), nil)
 
 	var req *http.Request
 	body, _ := json.Marshal(testSlice)
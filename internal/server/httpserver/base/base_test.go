@@ -1,21 +1,31 @@
 package base
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/erupshis/metrics/internal/compressor"
 	"github.com/erupshis/metrics/internal/hasher"
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/ipvalidator"
 	"github.com/erupshis/metrics/internal/logger"
 	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/rsa"
+	"github.com/erupshis/metrics/internal/server/agents"
 	"github.com/erupshis/metrics/internal/server/config"
 	"github.com/erupshis/metrics/internal/server/memstorage"
+	"github.com/erupshis/metrics/internal/server/prometheus"
+	"github.com/erupshis/metrics/mocks"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -45,10 +55,12 @@ type wantJSON struct {
 
 func TestJSONCounterBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   "../../../../rsa/key.pem",
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      "../../../../rsa/key.pem",
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
 	}
 
 	log := logger.CreateMock()
@@ -60,7 +72,7 @@ func TestJSONCounterBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 
 	var val1 int64 = 123
@@ -168,10 +180,12 @@ func TestJSONCounterBaseController(t *testing.T) {
 
 func TestJSONGaugeBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   keyRSA,
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
 	}
 
 	log := logger.CreateMock()
@@ -183,7 +197,7 @@ func TestJSONGaugeBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 
 	var float1 float64 = 123
@@ -303,18 +317,288 @@ func TestJSONGaugeBaseController(t *testing.T) {
 	runJSONTests(t, &gaugeTests, ts)
 }
 
+func TestJSONLabelsBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	labelsTests := []testJSON{
+		{
+			"gauge post for host a",
+			reqJSON{http.MethodPost, "/update/", `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}}`},
+		},
+		{
+			"gauge post for host b",
+			reqJSON{http.MethodPost, "/update/", `{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"b"}}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"Alloc","type":"gauge","value":2,"labels":{"host":"b"}}`},
+		},
+		{
+			"counter post batch for two hosts",
+			reqJSON{http.MethodPost, "/updates/", `[{"id":"PollCount","type":"counter","delta":3,"labels":{"host":"a"}},{"id":"PollCount","type":"counter","delta":5,"labels":{"host":"b"}}]`},
+			wantJSON{http.StatusOK, "application/json", `{}`},
+		},
+		{
+			"gauge get for host a",
+			reqJSON{http.MethodPost, "/value/", `{"id":"Alloc","type":"gauge","labels":{"host":"a"}}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"Alloc","type":"gauge","value":1,"labels":{"host":"a"}}`},
+		},
+		{
+			"counter get for host b",
+			reqJSON{http.MethodPost, "/value/", `{"id":"PollCount","type":"counter","labels":{"host":"b"}}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"PollCount","type":"counter","delta":5,"labels":{"host":"b"}}`},
+		},
+		{
+			"gauge get without labels",
+			reqJSON{http.MethodPost, "/value/", `{"id":"Alloc","type":"gauge"}`},
+			wantJSON{http.StatusNotFound, "text/plain; charset=utf-8", "invalid gauge name 'Alloc'\n"},
+		},
+		{
+			"gauge post with empty label name",
+			reqJSON{http.MethodPost, "/update/", `{"id":"Alloc","type":"gauge","value":1,"labels":{"":"a"}}`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", " empty label name\n"},
+		},
+	}
+
+	runJSONTests(t, &labelsTests, ts)
+}
+
+func TestJSONHistogramBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	histogramTests := []testJSON{
+		{
+			"histogram post",
+			reqJSON{http.MethodPost, "/update/", `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,0,1],"count":2,"sum":7.5}}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,0,1],"count":2,"sum":7.5}}`},
+		},
+		{
+			"histogram post merges buckets",
+			reqJSON{http.MethodPost, "/update/", `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[0,1,0],"count":1,"sum":2}}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,1,1],"count":3,"sum":9.5}}`},
+		},
+		{
+			"histogram get",
+			reqJSON{http.MethodPost, "/value/", `{"id":"Latency","type":"histogram"}`},
+			wantJSON{http.StatusOK, "application/json", `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,1,1],"count":3,"sum":9.5}}`},
+		},
+		{
+			"histogram post with other bounds",
+			reqJSON{http.MethodPost, "/update/", `{"id":"Latency","type":"histogram","histogram":{"bounds":[2],"counts":[1,0],"count":1,"sum":1}}`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "add histogram 'Latency': merge histograms: bounds mismatch [1 5] and [2]\n"},
+		},
+		{
+			"histogram get missing",
+			reqJSON{http.MethodPost, "/value/", `{"id":"Missing","type":"histogram"}`},
+			wantJSON{http.StatusNotFound, "text/plain; charset=utf-8", "invalid histogram name 'Missing'\n"},
+		},
+	}
+
+	runJSONTests(t, &histogramTests, ts)
+}
+
+func TestDeleteBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	require.NoError(t, storage.AddGauge("Alloc", 1))
+	require.NoError(t, storage.AddGauge(`Alloc{host="a"}`, 2))
+	require.NoError(t, storage.AddCounter("PollCount", 3))
+	require.NoError(t, storage.AddCounter(`PollCount{path="/a"}`, 4))
+	require.NoError(t, storage.AddHistogram("Latency", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+
+	labeled := url.PathEscape(`PollCount{path="/a"}`)
+	urlTests := []test{
+		{
+			"labeled counter delete",
+			req{http.MethodDelete, "/value/counter/" + labeled},
+			want{http.StatusOK, "", "text/plain; charset=utf-8"},
+		},
+		{
+			"deleted labeled counter get",
+			req{http.MethodGet, "/value/counter/" + labeled},
+			want{http.StatusNotFound, "", ""},
+		},
+		{
+			"gauge delete",
+			req{http.MethodDelete, "/value/gauge/Alloc"},
+			want{http.StatusOK, "", "text/plain; charset=utf-8"},
+		},
+		{
+			"deleted gauge get",
+			req{http.MethodGet, "/value/gauge/Alloc"},
+			want{http.StatusNotFound, "", ""},
+		},
+		{
+			"gauge delete missing",
+			req{http.MethodDelete, "/value/gauge/Alloc"},
+			want{http.StatusNotFound, "", ""},
+		},
+		{
+			"histogram delete",
+			req{http.MethodDelete, "/value/histogram/Latency"},
+			want{http.StatusOK, "", "text/plain; charset=utf-8"},
+		},
+		{
+			"delete unknown type",
+			req{http.MethodDelete, "/value/unknown/Alloc"},
+			want{http.StatusBadRequest, "", ""},
+		},
+		{
+			"delete wrong request",
+			req{http.MethodDelete, "/update/gauge/Alloc"},
+			want{http.StatusBadRequest, "", ""},
+		},
+	}
+	runTests(t, &urlTests, ts)
+
+	jsonTests := []testJSON{
+		{
+			"batch delete skips missing metrics",
+			reqJSON{http.MethodPost, "/deletes/", `[{"id":"Alloc","type":"gauge","labels":{"host":"a"}},{"id":"PollCount","type":"counter"},{"id":"Missing","type":"gauge"}]`},
+			wantJSON{http.StatusOK, "application/json", "{}"},
+		},
+		{
+			"batch delete unknown type",
+			reqJSON{http.MethodPost, "/deletes/", `[{"id":"Alloc","type":"unknown"}]`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "unknown type 'unknown' of metric 'Alloc'; \n"},
+		},
+		{
+			"batch delete invalid metric",
+			reqJSON{http.MethodPost, "/deletes/", `[{"type":"gauge"}]`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "found invalid metrics in message:  0: missing name  |\n"},
+		},
+	}
+	runJSONTests(t, &jsonTests, ts)
+
+	assert.Empty(t, storage.GetAllGauges())
+	assert.Empty(t, storage.GetAllCounters())
+	assert.Empty(t, storage.GetAllHistograms())
+}
+
+func TestSyncStoreBaseController(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	manager.EXPECT().SaveDataInStorage(gomock.Any(), gomock.Any()).Return(fmt.Errorf("manager err")).AnyTimes()
+
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storageCfg := config.Default
+	storageCfg.Restore = false
+	storageCfg.StoreInterval = 0
+	storage := memstorage.Create(context.Background(), &storageCfg, manager, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	jsonTests := []testJSON{
+		{
+			"counter post failed to persist",
+			reqJSON{http.MethodPost, "/update/", `{"id":"PollCount","type":"counter","delta":3}`},
+			wantJSON{http.StatusServiceUnavailable, "text/plain; charset=utf-8", "persist metric: save data: manager err\n"},
+		},
+		{
+			"batch post failed to persist",
+			reqJSON{http.MethodPost, "/updates/", `[{"id":"Alloc","type":"gauge","value":1}]`},
+			wantJSON{http.StatusServiceUnavailable, "text/plain; charset=utf-8", "persist metric: save data: manager err; \n"},
+		},
+	}
+	runJSONTests(t, &jsonTests, ts)
+
+	urlTests := []test{
+		{
+			"gauge post failed to persist",
+			req{http.MethodPost, "/update/gauge/someMetrics/1.5"},
+			want{http.StatusServiceUnavailable, "", ""},
+		},
+		{
+			"not persisted value is kept in memory",
+			req{http.MethodGet, "/value/gauge/someMetrics"},
+			want{http.StatusOK, "1.5", "text/plain; charset=utf-8"},
+		},
+	}
+	runTests(t, &urlTests, ts)
+}
+
 func runJSONTests(t *testing.T, tests *[]testJSON, ts *httptest.Server) {
 	for _, tt := range *tests {
 		t.Run(tt.name, func(t *testing.T) {
 			encoder, err := rsa.CreateEncoder(certRSA)
 			assert.NoError(t, err, "rsa encoder create error")
 
-			encryptedBody, err := encoder.Encode([]byte(tt.req.body))
+			encryptedBody, encryptedKey, err := encoder.Encode([]byte(tt.req.body))
 			assert.NoError(t, err)
 			body := bytes.NewBuffer(encryptedBody)
 
 			req, errReq := http.NewRequest(tt.req.method, ts.URL+tt.req.url, body)
 			require.NoError(t, errReq)
+			req.Header.Set(rsa.KeyHeader, encryptedKey)
 
 			req.Header.Add("Content-Type", "application/json")
 
@@ -353,10 +637,12 @@ type test struct {
 
 func TestBadRequestHandlerBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   keyRSA,
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
 	}
 
 	log := logger.CreateMock()
@@ -368,7 +654,7 @@ func TestBadRequestHandlerBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 
 	badRequestTests := []test{
@@ -394,10 +680,12 @@ func TestBadRequestHandlerBaseController(t *testing.T) {
 
 func TestListHandlerBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   keyRSA,
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.Default.ReadPolicy,
+		WritePolicy: config.Default.WritePolicy,
 	}
 
 	log := logger.CreateMock()
@@ -409,26 +697,98 @@ func TestListHandlerBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 
-	badRequestTests := []test{
-		// badRequestHandler
+	require.NoError(t, storage.AddGauge(`Alloc{host="a"}`, 2))
+	require.NoError(t, storage.AddCounter("PollCount", 3))
+	require.NoError(t, storage.AddHistogram("Latency", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+
+	tests := []struct {
+		name        string
+		url         string
+		code        int
+		contentType string
+		contains    string
+	}{
 		{
-			"list of params valid",
-			req{http.MethodGet, "/"},
-			want{http.StatusOK, "\n<html><body>\n<caption>GAUGES</caption>\n<table border = 2>\n</table>\n\n<caption>COUNTERS</caption>\n<table border = 2>\n</table>\n</body></html>\n", "text/html; charset=utf-8"},
+			name:        "dashboard page",
+			url:         "/",
+			code:        http.StatusOK,
+			contentType: "text/html; charset=utf-8",
+			contains:    `<script src="/ui/app.js"></script>`,
+		},
+		{
+			name:        "dashboard script",
+			url:         "/ui/app.js",
+			code:        http.StatusOK,
+			contentType: "text/javascript; charset=utf-8",
+			contains:    "/ui/api/values",
+		},
+		{
+			name:        "dashboard styles",
+			url:         "/ui/style.css",
+			code:        http.StatusOK,
+			contentType: "text/css; charset=utf-8",
+			contains:    "#sparkline",
+		},
+		{
+			name:        "values",
+			url:         "/ui/api/values",
+			code:        http.StatusOK,
+			contentType: "application/json",
+			contains: `[{"key":"PollCount","name":"PollCount","type":"counter","value":3},` +
+				`{"key":"Alloc{host=\"a\"}","name":"Alloc","labels":{"host":"a"},"type":"gauge","value":2},` +
+				`{"key":"Latency","name":"Latency","type":"histogram","value":0,"histogram":{"bounds":[1],"counts":[1,0],"count":1,"sum":1}}]`,
+		},
+		{
+			name:        "history of labeled series",
+			url:         "/history/gauge/" + url.PathEscape(`Alloc{host="a"}`),
+			code:        http.StatusOK,
+			contentType: "application/json",
+			contains:    `"id":"Alloc{host=\"a\"}","type":"gauge","samples":[{`,
+		},
+		{
+			name:        "agents",
+			url:         "/agents",
+			code:        http.StatusOK,
+			contentType: "application/json",
+			contains:    "[]",
+		},
+		{
+			name: "missing file",
+			url:  "/ui/missing.js",
+			code: http.StatusNotFound,
 		},
 	}
-	runTests(t, &badRequestTests, ts)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, errResp := ts.Client().Get(ts.URL + tt.url)
+			require.NoError(t, errResp)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			body, errBody := io.ReadAll(resp.Body)
+			require.NoError(t, errBody)
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, resp.Header.Get("Content-Type"))
+			}
+			assert.Contains(t, string(body), tt.contains)
+		})
+	}
 }
 
 func TestMissingNameBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   keyRSA,
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
 	}
 
 	log := logger.CreateMock()
@@ -440,7 +800,7 @@ func TestMissingNameBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 
 	missingNameTests := []test{
@@ -490,10 +850,12 @@ func TestMissingNameBaseController(t *testing.T) {
 
 func TestCounterBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   keyRSA,
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
 	}
 
 	log := logger.CreateMock()
@@ -505,7 +867,7 @@ func TestCounterBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 
 	counterTests := []test{
@@ -534,6 +896,11 @@ func TestCounterBaseController(t *testing.T) {
 			req{http.MethodPost, "/update/counter/someMetrics/345.1"},
 			want{http.StatusBadRequest, "", ""},
 		},
+		{
+			"counter post invalid case(invalid name)",
+			req{http.MethodPost, "/update/counter/some.Metrics/345"},
+			want{http.StatusBadRequest, "", ""},
+		},
 		{
 			"counter post invalid case(missing value)",
 			req{http.MethodPost, "/update/counter/someMetrics/"},
@@ -570,10 +937,12 @@ func TestCounterBaseController(t *testing.T) {
 
 func TestGaugeBaseController(t *testing.T) {
 	cfg := config.Config{
-		Host:     "localhost:8080",
-		LogLevel: "Info",
-		Key:      "",
-		KeyRSA:   keyRSA,
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
 	}
 
 	log := logger.CreateMock()
@@ -585,7 +954,7 @@ func TestGaugeBaseController(t *testing.T) {
 	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
 	assert.NoError(t, err, "rsa decoder create error")
 
-	ts := httptest.NewServer(Create(&cfg, log, storage, hash, decoder, ipvalidator.Create(nil)).Route())
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
 	defer ts.Close()
 	gaugeTests := []test{
 		{
@@ -674,12 +1043,13 @@ func runTests(t *testing.T, tests *[]test, ts *httptest.Server) {
 			encoder, err := rsa.CreateEncoder(certRSA)
 			assert.NoError(t, err, "rsa encoder create error")
 
-			encryptedBody, err := encoder.Encode(nil)
+			encryptedBody, encryptedKey, err := encoder.Encode(nil)
 			assert.NoError(t, err)
 			body := bytes.NewBuffer(encryptedBody)
 
 			req, errReq := http.NewRequest(tt.req.method, ts.URL+tt.req.url, body)
 			require.NoError(t, errReq)
+			req.Header.Set(rsa.KeyHeader, encryptedKey)
 
 			req.Header.Add("Content-Type", "html/text")
 			req.Header.Add("Accept-Encoding", "gzip")
@@ -700,3 +1070,543 @@ func runTests(t *testing.T, tests *[]test, ts *httptest.Server) {
 		})
 	}
 }
+
+func TestHistoryBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	storage.AddGauge("someGauge", 1.5)
+	storage.AddGauge("someGauge", 2.5)
+	storage.AddCounter("someCounter", 2)
+	storage.AddCounter("someCounter", 3)
+
+	historyTests := []struct {
+		name       string
+		url        string
+		wantCode   int
+		wantValues []float64
+	}{
+		{"gauge history valid", "/history/gauge/someGauge", http.StatusOK, []float64{1.5, 2.5}},
+		{"counter history valid", "/history/counter/someCounter", http.StatusOK, []float64{2, 5}},
+		{"counter history valid with range", "/history/counter/someCounter?from=0&to=2030-01-01T00:00:00Z", http.StatusOK, []float64{2, 5}},
+		{"counter history valid empty range", "/history/counter/someCounter?to=1", http.StatusOK, []float64{}},
+		{"history missing metric", "/history/gauge/missingGauge", http.StatusNotFound, nil},
+		{"history invalid type", "/history/histogram/someGauge", http.StatusBadRequest, nil},
+		{"history invalid range", "/history/gauge/someGauge?from=yesterday", http.StatusBadRequest, nil},
+	}
+	for _, tt := range historyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := rsa.CreateEncoder(certRSA)
+			assert.NoError(t, err, "rsa encoder create error")
+
+			encryptedBody, encryptedKey, err := encoder.Encode(nil)
+			assert.NoError(t, err)
+
+			req, errReq := http.NewRequest(http.MethodGet, ts.URL+tt.url, bytes.NewBuffer(encryptedBody))
+			require.NoError(t, errReq)
+			req.Header.Set(rsa.KeyHeader, encryptedKey)
+
+			resp, errResp := ts.Client().Do(req)
+			require.NoError(t, errResp)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var res historyResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+
+			values := make([]float64, 0)
+			for _, sample := range res.Samples {
+				values = append(values, sample.Value)
+			}
+			assert.Equal(t, tt.wantValues, values)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		})
+	}
+}
+
+func TestRateBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	require.NoError(t, storage.AddCounter("someCounter", 2))
+	require.NoError(t, storage.AddGauge("someGauge", 2))
+
+	urlTests := []test{
+		{
+			"counter rate with single sample",
+			req{http.MethodGet, "/rate/counter/someCounter"},
+			want{http.StatusOK, `{"id":"someCounter","type":"counter","rate":0}`, "application/json"},
+		},
+		{
+			"rate missing counter",
+			req{http.MethodGet, "/rate/counter/missingCounter"},
+			want{http.StatusNotFound, "", ""},
+		},
+		{
+			"rate invalid type",
+			req{http.MethodGet, "/rate/gauge/someGauge"},
+			want{http.StatusBadRequest, "", ""},
+		},
+		{
+			"rate invalid range",
+			req{http.MethodGet, "/rate/counter/someCounter?to=tomorrow"},
+			want{http.StatusBadRequest, "incorrect 'to' param: parsing time \"tomorrow\" as \"2006-01-02T15:04:05Z07:00\": cannot parse \"tomorrow\" as \"2006\"\n", "text/plain; charset=utf-8"},
+		},
+		{
+			"all counters rates",
+			req{http.MethodGet, "/rates?from=0"},
+			want{http.StatusOK, `{"someCounter":0}`, "application/json"},
+		},
+	}
+	runTests(t, &urlTests, ts)
+}
+
+func TestQueryBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	require.NoError(t, storage.AddGauge(`Alloc{host="a"}`, 1))
+	require.NoError(t, storage.AddGauge(`Alloc{host="a"}`, 3))
+	require.NoError(t, storage.AddGauge(`Alloc{host="b"}`, 5))
+	require.NoError(t, storage.AddGauge("HeapSys", 7))
+	require.NoError(t, storage.AddCounter("PollCount", 2))
+
+	jsonTests := []testJSON{
+		{
+			"query series over time",
+			reqJSON{http.MethodPost, "/query/", `{"type":"gauge","name":"Alloc","from":"0","to":"2100-01-01T00:00:00Z","over_time":"max"}`},
+			wantJSON{http.StatusOK, "application/json", `{"series":[` +
+				`{"name":"Alloc","labels":{"host":"a"},"points":[{"ts":"2100-01-01T00:00:00Z","value":3}]},` +
+				`{"name":"Alloc","labels":{"host":"b"},"points":[{"ts":"2100-01-01T00:00:00Z","value":5}]}]}`},
+		},
+		{
+			"query label filter",
+			reqJSON{http.MethodPost, "/query/", `{"type":"gauge","name":"Alloc","labels":{"host":"a"},"to":"2100-01-01T00:00:00Z","over_time":"avg"}`},
+			wantJSON{http.StatusOK, "application/json", `{"series":[{"name":"Alloc","labels":{"host":"a"},"points":[{"ts":"2100-01-01T00:00:00Z","value":2}]}]}`},
+		},
+		{
+			"query aggregation across series",
+			reqJSON{http.MethodPost, "/query/", `{"type":"gauge","name":"*","to":"2100-01-01T00:00:00Z","over_time":"last","aggregation":"sum"}`},
+			wantJSON{http.StatusOK, "application/json", `{"series":[{"name":"sum(*)","points":[{"ts":"2100-01-01T00:00:00Z","value":15}]}]}`},
+		},
+		{
+			"query counter",
+			reqJSON{http.MethodPost, "/query/", `{"type":"counter","name":"Poll*","to":"2100-01-01T00:00:00Z","over_time":"count"}`},
+			wantJSON{http.StatusOK, "application/json", `{"series":[{"name":"PollCount","points":[{"ts":"2100-01-01T00:00:00Z","value":1}]}]}`},
+		},
+		{
+			"query nothing matched",
+			reqJSON{http.MethodPost, "/query/", `{"type":"gauge","name":"Missing"}`},
+			wantJSON{http.StatusOK, "application/json", `{"series":[]}`},
+		},
+		{
+			"query unsupported type",
+			reqJSON{http.MethodPost, "/query/", `{"type":"histogram","name":"Alloc"}`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "unsupported metric type 'histogram'\n"},
+		},
+		{
+			"query unknown aggregation",
+			reqJSON{http.MethodPost, "/query/", `{"type":"gauge","name":"Alloc","aggregation":"median"}`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "invalid query: unknown aggregation 'median'\n"},
+		},
+		{
+			"query invalid window",
+			reqJSON{http.MethodPost, "/query/", `{"type":"gauge","name":"Alloc","window":"minute"}`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "incorrect 'window' param: time: invalid duration \"minute\"\n"},
+		},
+		{
+			"query invalid body",
+			reqJSON{http.MethodPost, "/query/", `{"type":`},
+			wantJSON{http.StatusBadRequest, "text/plain; charset=utf-8", "unexpected end of JSON input\n"},
+		},
+	}
+	runJSONTests(t, &jsonTests, ts)
+}
+
+func TestWatchBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+		// subscribers send no body, so the endpoint is exempted from encryption.
+		ReadPolicyExempt: []string{"/watch"},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	for _, url := range []string{"/watch?type=unknown", "/watch?name=Alloc["} {
+		resp, errResp := ts.Client().Get(ts.URL + url)
+		require.NoError(t, errResp)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, url)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/watch?type=gauge&name=Alloc", nil)
+	require.NoError(t, errReq)
+
+	resp, errResp := ts.Client().Do(req)
+	require.NoError(t, errResp)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	require.NoError(t, storage.AddCounter("Alloc", 1))
+	require.NoError(t, storage.AddGauge("Skipped", 1))
+	require.NoError(t, storage.AddGauge(`Alloc{host="a"}`, 2.5))
+
+	reader := bufio.NewReader(resp.Body)
+	var events []string
+	for len(events) < 3 {
+		line, errRead := reader.ReadString('\n')
+		require.NoError(t, errRead)
+		events = append(events, line)
+	}
+	assert.Equal(t, []string{"event: update\n", `data: {"id":"Alloc","type":"gauge","value":2.5,"labels":{"host":"a"}}` + "\n", "\n"}, events)
+}
+
+func TestPrometheusBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+		// scrapers send no body, so the endpoint is exempted from encryption.
+		ReadPolicyExempt: []string{"/metrics"},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	storage.AddGauge("Alloc", 1.5)
+	storage.AddGauge(`Alloc{host="b"}`, 2)
+	storage.AddGauge(`Alloc{host="a"}`, 2.5)
+	storage.AddGauge("Heap.Sys", 3)
+	storage.AddCounter("PollCount", 2)
+	storage.AddCounter("PollCount", 3)
+
+	req, errReq := http.NewRequest(http.MethodGet, ts.URL+"/metrics", nil)
+	require.NoError(t, errReq)
+
+	resp, errResp := ts.Client().Do(req)
+	require.NoError(t, errResp)
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, errBody := io.ReadAll(resp.Body)
+	require.NoError(t, errBody)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, prometheus.ContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "# TYPE Alloc gauge\n"+
+		"Alloc 1.5\n"+
+		"Alloc{host=\"a\"} 2.5\n"+
+		"Alloc{host=\"b\"} 2\n"+
+		"# TYPE Heap_Sys gauge\n"+
+		"Heap_Sys 3\n"+
+		"# TYPE PollCount_total counter\n"+
+		"PollCount_total 5\n", string(body))
+}
+
+func TestAgentsBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{Encryption: true},
+		WritePolicy: config.RoutePolicy{Encryption: true},
+	}
+
+	log := logger.CreateMock()
+
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	assert.NoError(t, err, "rsa decoder create error")
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(nil), nil).Route())
+	defer ts.Close()
+
+	encoder, err := rsa.CreateEncoder(certRSA)
+	require.NoError(t, err, "rsa encoder create error")
+
+	doRequest := func(method string, url string, body string, agentID string) *http.Response {
+		encryptedBody, encryptedKey, errEncode := encoder.Encode([]byte(body))
+		require.NoError(t, errEncode)
+
+		req, errReq := http.NewRequest(method, ts.URL+url, bytes.NewBuffer(encryptedBody))
+		require.NoError(t, errReq)
+		req.Header.Set(rsa.KeyHeader, encryptedKey)
+		if agentID != "" {
+			req.Header.Set(networkmsg.AgentIDHeader, agentID)
+		}
+
+		resp, errResp := ts.Client().Do(req)
+		require.NoError(t, errResp)
+		return resp
+	}
+
+	posts := []struct {
+		url     string
+		body    string
+		agentID string
+	}{
+		{"/updates/", `[{"id":"Alloc","type":"gauge","value":1},{"id":"PollCount","type":"counter","delta":1}]`, "host-b"},
+		{"/update/", `{"id":"Alloc","type":"gauge","value":2,"labels":{"agent":"host-a"}}`, "host-a"},
+		{"/update/", `{"id":"Anonymous","type":"gauge","value":2}`, ""},
+	}
+	for _, post := range posts {
+		resp := doRequest(http.MethodPost, post.url, post.body, post.agentID)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+
+	resp := doRequest(http.MethodGet, "/agents", "", "")
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var res []agents.Info
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.Len(t, res, 2)
+
+	assert.Equal(t, "host-a", res[0].ID)
+	assert.Equal(t, []string{`Alloc{agent="host-a"}`}, res[0].Gauges)
+	assert.Empty(t, res[0].Counters)
+	assert.False(t, res[0].LastSeen.IsZero())
+
+	assert.Equal(t, "host-b", res[1].ID)
+	assert.Equal(t, []string{"Alloc"}, res[1].Gauges)
+	assert.Equal(t, []string{"PollCount"}, res[1].Counters)
+}
+
+func TestRoutePoliciesBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:        "localhost:8080",
+		LogLevel:    "Info",
+		Key:         "123",
+		KeyRSA:      keyRSA,
+		ReadPolicy:  config.RoutePolicy{TrustedSubnet: true},
+		WritePolicy: config.RoutePolicy{TrustedSubnet: true, Encryption: true, Signature: true},
+	}
+
+	log := logger.CreateMock()
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	require.NoError(t, err)
+	encoder, err := rsa.CreateEncoder(certRSA)
+	require.NoError(t, err)
+
+	_, subnet, err := net.ParseCIDR("10.0.0.0/24")
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(subnet), nil).Route())
+	defer ts.Close()
+
+	require.NoError(t, storage.AddGauge("Alloc", 2))
+	update, err := json.Marshal(networkmsg.CreateGaugeMetrics("Alloc", 3))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      []byte
+		ip        string
+		encrypted bool
+		signed    bool
+		code      int
+	}{
+		{name: "list", method: http.MethodGet, url: "/", ip: "10.0.0.1", code: http.StatusOK},
+		{name: "agents", method: http.MethodGet, url: "/agents", ip: "10.0.0.1", code: http.StatusOK},
+		{name: "value", method: http.MethodGet, url: "/value/gauge/Alloc", ip: "10.0.0.1", code: http.StatusOK},
+		{name: "json value", method: http.MethodPost, url: "/value/", body: []byte(`{"id":"Alloc","type":"gauge"}`), ip: "10.0.0.1", code: http.StatusOK},
+		{name: "value from untrusted ip", method: http.MethodGet, url: "/value/gauge/Alloc", ip: "10.0.1.1", code: http.StatusForbidden},
+		{name: "metrics from untrusted ip", method: http.MethodGet, url: "/metrics", ip: "10.0.1.1", code: http.StatusForbidden},
+		{name: "update", method: http.MethodPost, url: "/update/", body: update, ip: "10.0.0.1", encrypted: true, signed: true, code: http.StatusOK},
+		{name: "update without encryption", method: http.MethodPost, url: "/update/", body: update, ip: "10.0.0.1", signed: true, code: http.StatusBadRequest},
+		{name: "update without signature", method: http.MethodPost, url: "/update/", body: update, ip: "10.0.0.1", encrypted: true, code: http.StatusBadRequest},
+		{name: "update from untrusted ip", method: http.MethodPost, url: "/update/", body: update, ip: "10.0.1.1", encrypted: true, signed: true, code: http.StatusForbidden},
+		{name: "url update without encryption", method: http.MethodPost, url: "/update/gauge/Alloc/4", ip: "10.0.0.1", code: http.StatusBadRequest},
+		{name: "delete without encryption", method: http.MethodDelete, url: "/value/gauge/Alloc", ip: "10.0.0.1", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := tt.body
+			req, errReq := http.NewRequest(tt.method, ts.URL+tt.url, nil)
+			require.NoError(t, errReq)
+			req.Header.Set("X-Real-IP", tt.ip)
+			req.Header.Set("Content-Type", "application/json")
+
+			if tt.signed {
+				hashValue, errHash := hash.HashMsg(body)
+				require.NoError(t, errHash)
+				req.Header.Set(hash.GetHeader(), hashValue)
+			}
+			if tt.encrypted {
+				encryptedBody, encryptedKey, errEncode := encoder.Encode(body)
+				require.NoError(t, errEncode)
+				body = encryptedBody
+				req.Header.Set(rsa.KeyHeader, encryptedKey)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+
+			resp, errResp := ts.Client().Do(req)
+			require.NoError(t, errResp)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+}
+
+func TestReadPolicyExemptBaseController(t *testing.T) {
+	cfg := config.Config{
+		Host:             "localhost:8080",
+		LogLevel:         "Info",
+		Key:              "123",
+		KeyRSA:           keyRSA,
+		ReadPolicy:       config.RoutePolicy{TrustedSubnet: true, Encryption: true, Signature: true},
+		WritePolicy:      config.RoutePolicy{TrustedSubnet: true, Encryption: true, Signature: true},
+		ReadPolicyExempt: []string{"/metrics", "/ui/"},
+	}
+
+	log := logger.CreateMock()
+	storage := memstorage.Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	hash := hasher.CreateHasher(cfg.Key, hasher.SHA256, log)
+
+	decoder, err := rsa.CreateDecoder(cfg.KeyRSA)
+	require.NoError(t, err)
+
+	_, subnet, err := net.ParseCIDR("10.0.0.0/24")
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(Create(&cfg, log, storage, agents.Create(), hash, decoder, ipvalidator.Create(subnet), nil).Route())
+	defer ts.Close()
+
+	require.NoError(t, storage.AddGauge("Alloc", 2))
+
+	tests := []struct {
+		name string
+		url  string
+		ip   string
+		code int
+	}{
+		{name: "exempted metrics", url: "/metrics", ip: "10.0.0.1", code: http.StatusOK},
+		{name: "exempted dashboard", url: "/ui/app.js", ip: "10.0.0.1", code: http.StatusOK},
+		{name: "exempted dashboard api", url: "/ui/api/values", ip: "10.0.0.1", code: http.StatusOK},
+		{name: "exempted metrics from untrusted ip", url: "/metrics", ip: "10.0.1.1", code: http.StatusForbidden},
+		{name: "list", url: "/", ip: "10.0.0.1", code: http.StatusBadRequest},
+		{name: "watch", url: "/watch", ip: "10.0.0.1", code: http.StatusBadRequest},
+		{name: "agents", url: "/agents", ip: "10.0.0.1", code: http.StatusBadRequest},
+		{name: "history", url: "/history/gauge/Alloc", ip: "10.0.0.1", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, errReq := http.NewRequest(http.MethodGet, ts.URL+tt.url, nil)
+			require.NoError(t, errReq)
+			req.Header.Set("X-Real-IP", tt.ip)
+
+			resp, errResp := ts.Client().Do(req)
+			require.NoError(t, errResp)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+
+	assert.True(t, isExemptPath("/ui", cfg.ReadPolicyExempt), "exempted path without trailing slash")
+	assert.False(t, isExemptPath("/metricsx", cfg.ReadPolicyExempt), "path with exempted prefix")
+}
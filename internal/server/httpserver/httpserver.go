@@ -32,8 +32,16 @@ func NewServer(host string, router *chi.Mux, info string) *Server {
 	}
 }
 
+// Serve accepts connections on listener, connections are served over TLS if TLSConfig is set.
 func (s *Server) Serve(lis net.Listener) error {
-	if err := s.Server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	serve := s.Server.Serve
+	if s.TLSConfig != nil {
+		serve = func(lis net.Listener) error {
+			return s.Server.ServeTLS(lis, "", "")
+		}
+	}
+
+	if err := serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
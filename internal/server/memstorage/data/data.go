@@ -1,6 +1,7 @@
 package data
 
 const (
-	GaugeType   = "gauge"
-	CounterType = "counter"
+	GaugeType     = "gauge"
+	CounterType   = "counter"
+	HistogramType = "histogram"
 )
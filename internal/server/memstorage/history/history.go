@@ -0,0 +1,126 @@
+// Package history provides bounded storage of timestamped metric samples.
+// The Ring type keeps the latest samples of a single metric limited both by count and by age.
+package history
+
+import (
+	"time"
+)
+
+// Sample represents a metric value registered at the specific moment.
+type Sample struct {
+	Timestamp time.Time `json:"ts"`    // Timestamp moment of the value registration.
+	Value     float64   `json:"value"` // Value metric value at the moment.
+}
+
+// Ring is a fixed capacity circular buffer of samples ordered by time.
+// Ring is not safe for concurrent use, synchronization is on the caller side.
+type Ring struct {
+	samples   []Sample
+	start     int
+	size      int
+	retention time.Duration
+}
+
+// NewRing creates ring which stores no more than limit samples.
+// Samples older than retention relative to the latest one are dropped. Zero retention disables age limit.
+func NewRing(limit int, retention time.Duration) *Ring {
+	if limit < 1 {
+		limit = 1
+	}
+
+	return &Ring{
+		samples:   make([]Sample, limit),
+		retention: retention,
+	}
+}
+
+// Add inserts sample in the ring keeping samples chronologically ordered, overwriting the oldest one
+// if the ring is full. Sample registered before the latest stored one is inserted at its moment,
+// sample older than all samples of the full ring is dropped. Samples of the same moment keep order of adding.
+func (r *Ring) Add(sample Sample) {
+	// logical position of the first sample registered after the new one.
+	pos := r.size
+	for pos > 0 && r.at(pos-1).Timestamp.After(sample.Timestamp) {
+		pos--
+	}
+
+	if r.size == len(r.samples) {
+		if pos == 0 {
+			return
+		}
+
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+		pos--
+	}
+
+	for i := r.size; i > pos; i-- {
+		r.samples[(r.start+i)%len(r.samples)] = r.at(i - 1)
+	}
+	r.samples[(r.start+pos)%len(r.samples)] = sample
+	r.size++
+
+	r.Prune(r.at(r.size - 1).Timestamp)
+}
+
+// at returns sample by its logical position in the ring.
+func (r *Ring) at(pos int) Sample {
+	return r.samples[(r.start+pos)%len(r.samples)]
+}
+
+// Prune drops samples older than retention relative to the moment now.
+func (r *Ring) Prune(now time.Time) {
+	if r.retention <= 0 {
+		return
+	}
+
+	border := now.Add(-r.retention)
+	for r.size > 0 && r.samples[r.start].Timestamp.Before(border) {
+		r.start = (r.start + 1) % len(r.samples)
+		r.size--
+	}
+}
+
+// Len returns count of samples stored in the ring.
+func (r *Ring) Len() int {
+	return r.size
+}
+
+// Samples returns copy of samples in range [from, to] in chronological order.
+// Zero from or to means the range is not limited from the corresponding side.
+func (r *Ring) Samples(from, to time.Time) []Sample {
+	res := make([]Sample, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		sample := r.samples[(r.start+i)%len(r.samples)]
+		if !from.IsZero() && sample.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && sample.Timestamp.After(to) {
+			continue
+		}
+
+		res = append(res, sample)
+	}
+
+	return res
+}
+
+// All returns copy of all samples in chronological order.
+func (r *Ring) All() []Sample {
+	return r.Samples(time.Time{}, time.Time{})
+}
+
+// Rate returns average per-second change of value between the first and the last of chronologically ordered samples.
+// Zero is returned if there are less than two samples or all of them are registered at the same moment.
+func Rate(samples []Sample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.Timestamp.Sub(first.Timestamp).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return (last.Value - first.Value) / elapsed
+}
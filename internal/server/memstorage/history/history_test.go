@@ -0,0 +1,221 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRing_Add(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	type args struct {
+		limit     int
+		retention time.Duration
+		samples   []Sample
+	}
+	tests := []struct {
+		name string
+		args args
+		want []Sample
+	}{
+		{
+			name: "valid less than limit",
+			args: args{
+				limit:     3,
+				retention: 0,
+				samples:   []Sample{{start, 1}, {start.Add(time.Second), 2}},
+			},
+			want: []Sample{{start, 1}, {start.Add(time.Second), 2}},
+		},
+		{
+			name: "valid overwrite oldest",
+			args: args{
+				limit:     2,
+				retention: 0,
+				samples:   []Sample{{start, 1}, {start.Add(time.Second), 2}, {start.Add(2 * time.Second), 3}},
+			},
+			want: []Sample{{start.Add(time.Second), 2}, {start.Add(2 * time.Second), 3}},
+		},
+		{
+			name: "valid retention by age",
+			args: args{
+				limit:     10,
+				retention: time.Minute,
+				samples:   []Sample{{start, 1}, {start.Add(30 * time.Second), 2}, {start.Add(80 * time.Second), 3}},
+			},
+			want: []Sample{{start.Add(30 * time.Second), 2}, {start.Add(80 * time.Second), 3}},
+		},
+		{
+			name: "valid out of order inserted sorted",
+			args: args{
+				limit:     3,
+				retention: 0,
+				samples:   []Sample{{start, 1}, {start.Add(2 * time.Second), 2}, {start.Add(time.Second), 3}},
+			},
+			want: []Sample{{start, 1}, {start.Add(time.Second), 3}, {start.Add(2 * time.Second), 2}},
+		},
+		{
+			name: "valid out of order in full ring",
+			args: args{
+				limit:     3,
+				retention: 0,
+				samples: []Sample{
+					{start, 1}, {start.Add(2 * time.Second), 2}, {start.Add(4 * time.Second), 3},
+					{start.Add(3 * time.Second), 4}, {start.Add(time.Second), 5},
+				},
+			},
+			want: []Sample{{start.Add(2 * time.Second), 2}, {start.Add(3 * time.Second), 4}, {start.Add(4 * time.Second), 3}},
+		},
+		{
+			name: "valid out of order same moment",
+			args: args{
+				limit:     3,
+				retention: 0,
+				samples:   []Sample{{start, 1}, {start.Add(2 * time.Second), 2}, {start, 3}},
+			},
+			want: []Sample{{start, 1}, {start, 3}, {start.Add(2 * time.Second), 2}},
+		},
+		{
+			name: "valid out of order beyond retention",
+			args: args{
+				limit:     10,
+				retention: time.Minute,
+				samples:   []Sample{{start.Add(2 * time.Minute), 1}, {start, 2}, {start.Add(90 * time.Second), 3}},
+			},
+			want: []Sample{{start.Add(90 * time.Second), 3}, {start.Add(2 * time.Minute), 1}},
+		},
+		{
+			name: "valid zero limit",
+			args: args{
+				limit:     0,
+				retention: 0,
+				samples:   []Sample{{start, 1}, {start.Add(time.Second), 2}},
+			},
+			want: []Sample{{start.Add(time.Second), 2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRing(tt.args.limit, tt.args.retention)
+			for _, sample := range tt.args.samples {
+				r.Add(sample)
+			}
+
+			assert.Equal(t, len(tt.want), r.Len())
+			assert.Equal(t, tt.want, r.All())
+		})
+	}
+}
+
+func TestRing_Samples(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRing(10, 0)
+	for i := 0; i < 5; i++ {
+		r.Add(Sample{start.Add(time.Duration(i) * time.Second), float64(i)})
+	}
+
+	type args struct {
+		from time.Time
+		to   time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want []float64
+	}{
+		{
+			name: "valid unbounded",
+			args: args{},
+			want: []float64{0, 1, 2, 3, 4},
+		},
+		{
+			name: "valid from",
+			args: args{from: start.Add(3 * time.Second)},
+			want: []float64{3, 4},
+		},
+		{
+			name: "valid to",
+			args: args{to: start.Add(time.Second)},
+			want: []float64{0, 1},
+		},
+		{
+			name: "valid from and to",
+			args: args{from: start.Add(time.Second), to: start.Add(2 * time.Second)},
+			want: []float64{1, 2},
+		},
+		{
+			name: "valid empty range",
+			args: args{from: start.Add(time.Hour)},
+			want: []float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := make([]float64, 0)
+			for _, sample := range r.Samples(tt.args.from, tt.args.to) {
+				values = append(values, sample.Value)
+			}
+
+			assert.Equal(t, tt.want, values)
+		})
+	}
+}
+
+func TestRing_Prune(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	r := NewRing(10, time.Minute)
+	r.Add(Sample{start, 1})
+	r.Add(Sample{start.Add(time.Second), 2})
+
+	r.Prune(start.Add(30 * time.Second))
+	assert.Equal(t, 2, r.Len())
+
+	r.Prune(start.Add(time.Minute + 500*time.Millisecond))
+	assert.Equal(t, []Sample{{start.Add(time.Second), 2}}, r.All())
+
+	r.Prune(start.Add(time.Hour))
+	assert.Equal(t, 0, r.Len())
+}
+
+func TestRate(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		samples []Sample
+		want    float64
+	}{
+		{
+			name:    "valid growing",
+			samples: []Sample{{start, 10}, {start.Add(5 * time.Second), 20}, {start.Add(10 * time.Second), 40}},
+			want:    3,
+		},
+		{
+			name:    "valid decreasing",
+			samples: []Sample{{start, 10}, {start.Add(2 * time.Second), 6}},
+			want:    -2,
+		},
+		{
+			name:    "valid single sample",
+			samples: []Sample{{start, 10}},
+			want:    0,
+		},
+		{
+			name:    "valid no samples",
+			samples: nil,
+			want:    0,
+		},
+		{
+			name:    "valid same moment",
+			samples: []Sample{{start, 10}, {start, 20}},
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Rate(tt.samples))
+		})
+	}
+}
@@ -6,44 +6,115 @@ package memstorage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/logger"
 	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/server/config"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
 	"github.com/erupshis/metrics/internal/server/memstorage/storagemngr"
+	"github.com/erupshis/metrics/internal/server/watch"
 )
 
 const (
-	gaugeType   = "gauge"
-	counterType = "counter"
+	gaugeType     = "gauge"
+	counterType   = "counter"
+	histogramType = "histogram"
+
+	// deltaSavesLimit is a number of incremental saves after which the full snapshot is saved again.
+	// It keeps append-only storages (e.g. file) compact.
+	deltaSavesLimit = 100
+
+	// writeThroughTimeout limits persisting of metrics in synchronous mode, so stuck storage doesn't block requests.
+	writeThroughTimeout = 10 * time.Second
 )
 
+// ErrNotFound is returned by metrics deleting methods if the metric is missing in storage.
+var ErrNotFound = errors.New("metric not found")
+
+// ErrPersist is returned by metrics adding methods in synchronous mode if the metric wasn't persisted in storage.
+// The metric value is kept in memory and is going to be persisted with the next successful save.
+var ErrPersist = errors.New("persist metric")
+
 // gauge represents a floating-point metric value.
 type gauge = float64
 
 // counter represents an integer metric value.
 type counter = int64
 
-// MemStorage is an in-memory storage structure for gauge and counter metrics.
+// MemStorage is an in-memory storage structure for gauge, counter and histogram metrics.
+// It keeps the latest value of each metric and the bounded history of gauge and counter samples.
 // It also includes a StorageManager for handling data persistence.
+// Metrics changed or deleted since the last successful save are tracked to persist only them.
+// Metrics not updated within TTL are removed by ExpireMetrics.
+// The last totals of cumulative counters reported by senders are kept to compute increments.
+// Resulting values of updated metrics are published to subscribers.
 type MemStorage struct {
-	gaugeMetrics map[string]gauge
-	muGauge      sync.RWMutex
-
-	counterMetrics map[string]counter
-	muCounter      sync.RWMutex
+	gaugeMetrics  map[string]gauge
+	gaugeHistory  map[string]*history.Ring
+	gaugeUpdates  map[string]time.Time
+	changedGauges map[string]struct{}
+	deletedGauges map[string]struct{}
+	muGauge       sync.RWMutex
+
+	counterMetrics  map[string]counter
+	counterHistory  map[string]*history.Ring
+	counterUpdates  map[string]time.Time
+	counterTotals   map[string]counter
+	changedCounters map[string]struct{}
+	deletedCounters map[string]struct{}
+	muCounter       sync.RWMutex
+
+	histogramMetrics  map[string]*histogram.Histogram
+	histogramUpdates  map[string]time.Time
+	changedHistograms map[string]struct{}
+	deletedHistograms map[string]struct{}
+	muHistogram       sync.RWMutex
+
+	historyLimit     int
+	historyRetention time.Duration
+	metricTTL        time.Duration
+
+	updates *watch.Hub
 
 	manager storagemngr.StorageManager
+	// syncSave enables persisting of every added metric before adding methods return.
+	syncSave bool
+
+	// snapshotSaved is false until the full snapshot is saved successfully and after any saving error.
+	snapshotSaved bool
+	deltaSaves    int
+	muSave        sync.Mutex
 }
 
 // Create initializes and returns a new instance of MemStorage with the provided StorageManager.
 func Create(ctx context.Context, cfg *config.Config, manager storagemngr.StorageManager, logger logger.BaseLogger) *MemStorage {
 	storage := &MemStorage{
-		gaugeMetrics:   make(map[string]gauge),
-		counterMetrics: make(map[string]counter),
-		manager:        manager,
+		gaugeMetrics:      make(map[string]gauge),
+		gaugeHistory:      make(map[string]*history.Ring),
+		gaugeUpdates:      make(map[string]time.Time),
+		changedGauges:     make(map[string]struct{}),
+		deletedGauges:     make(map[string]struct{}),
+		counterMetrics:    make(map[string]counter),
+		counterHistory:    make(map[string]*history.Ring),
+		counterUpdates:    make(map[string]time.Time),
+		counterTotals:     make(map[string]counter),
+		changedCounters:   make(map[string]struct{}),
+		deletedCounters:   make(map[string]struct{}),
+		histogramMetrics:  make(map[string]*histogram.Histogram),
+		histogramUpdates:  make(map[string]time.Time),
+		changedHistograms: make(map[string]struct{}),
+		historyLimit:      int(cfg.HistoryLimit),
+		historyRetention:  cfg.HistoryRetention,
+		metricTTL:         cfg.MetricTTL,
+		updates:           watch.Create(watch.DefaultBufferSize),
+		manager:           manager,
+		syncSave:          cfg.StoreInterval == 0 && manager != nil,
 	}
 
 	if !cfg.Restore {
@@ -67,17 +138,89 @@ func (m *MemStorage) RestoreData(ctx context.Context) error {
 		return fmt.Errorf("restore data: %w", err)
 	}
 
+	now := time.Now()
 	for key, val := range gauges {
-		m.AddGauge(key, val)
+		m.addGauge(key, val, now)
 	}
 
 	for key, val := range counters {
-		m.AddCounter(key, val)
+		m.addCounter(key, val, now)
+	}
+
+	histograms, err := m.manager.RestoreHistogramsFromStorage(ctx)
+	if err != nil {
+		return fmt.Errorf("restore histograms: %w", err)
+	}
+
+	m.muHistogram.Lock()
+	if m.histogramMetrics == nil {
+		m.histogramMetrics = make(map[string]*histogram.Histogram, len(histograms))
+	}
+	for key, val := range histograms {
+		m.histogramMetrics[key] = val
+		touch(&m.histogramUpdates, key)
+	}
+	m.muHistogram.Unlock()
+
+	totals, err := m.manager.RestoreCounterTotalsFromStorage(ctx)
+	if err != nil {
+		return fmt.Errorf("restore counter totals: %w", err)
+	}
+
+	m.muCounter.Lock()
+	if m.counterTotals == nil {
+		m.counterTotals = make(map[string]counter, len(totals))
+	}
+	for key, total := range totals {
+		// totals of counters missing in storage may be left by counters deleted before the last save.
+		if _, ok := m.counterMetrics[key]; ok {
+			m.counterTotals[key] = total
+		}
+	}
+	m.muCounter.Unlock()
+
+	if !m.isHistoryEnabled() {
+		return nil
 	}
 
+	gaugesHistory, countersHistory, err := m.manager.RestoreHistoryFromStorage(ctx)
+	if err != nil {
+		return fmt.Errorf("restore history: %w", err)
+	}
+
+	m.muGauge.Lock()
+	m.restoreHistory(m.gaugeHistory, gaugesHistory, func(key string) bool {
+		_, ok := m.gaugeMetrics[key]
+		return ok
+	})
+	m.muGauge.Unlock()
+
+	m.muCounter.Lock()
+	m.restoreHistory(m.counterHistory, countersHistory, func(key string) bool {
+		_, ok := m.counterMetrics[key]
+		return ok
+	})
+	m.muCounter.Unlock()
+
 	return nil
 }
 
+// restoreHistory replaces rings in dest by samples from src.
+// History of metrics missing in storage is skipped, it may be left by metrics deleted before the last history save.
+func (m *MemStorage) restoreHistory(dest map[string]*history.Ring, src map[string][]history.Sample, exists func(key string) bool) {
+	for key, samples := range src {
+		if !exists(key) {
+			continue
+		}
+
+		ring := m.createRing()
+		for _, sample := range samples {
+			ring.Add(sample)
+		}
+		dest[key] = ring
+	}
+}
+
 // IsAvailable checks the availability of the associated StorageManager.
 func (m *MemStorage) IsAvailable(ctx context.Context) (bool, error) {
 	if m.manager == nil {
@@ -86,23 +229,238 @@ func (m *MemStorage) IsAvailable(ctx context.Context) (bool, error) {
 	return m.manager.CheckConnection(ctx)
 }
 
-// SaveData saves the current in-memory metrics data using the associated StorageManager.
+// SaveData saves in-memory metrics data using the associated StorageManager.
+// Metrics deleted since the last successful save are removed from storage first.
+// The full snapshot is saved on the first call, after failed saves and periodically to compact storage.
+// Otherwise only gauges, counters, histograms and samples history of metrics changed since the last successful save are persisted.
 func (m *MemStorage) SaveData(ctx context.Context) error {
+	return m.save(ctx)
+}
+
+// writeThrough persists changed metrics and their samples history if synchronous mode is enabled.
+// Persisting is limited by writeThroughTimeout.
+func (m *MemStorage) writeThrough() error {
+	if !m.syncSave {
+		return nil
+	}
+
+	// caller's request may be canceled, but storage shouldn't be left half-written, so request context isn't used.
+	ctx, cancel := context.WithTimeout(context.Background(), writeThroughTimeout)
+	defer cancel()
+
+	if err := m.save(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrPersist, err)
+	}
+	return nil
+}
+
+// save persists full snapshot or changed metrics only.
+func (m *MemStorage) save(ctx context.Context) error {
 	if m.manager == nil {
 		return fmt.Errorf("storage manager is not initialized")
 	}
 
-	if err := m.manager.SaveMetricsInStorage(ctx, m.GetAllGauges(), m.GetAllCounters()); err != nil {
-		return fmt.Errorf("save data: %w", err)
+	m.muSave.Lock()
+	defer m.muSave.Unlock()
+
+	full := !m.snapshotSaved || m.deltaSaves >= deltaSavesLimit
+	if err := m.saveData(ctx, full); err != nil {
+		m.snapshotSaved = false
+		return err
+	}
+
+	if full {
+		m.snapshotSaved = true
+		m.deltaSaves = 0
+	} else {
+		m.deltaSaves++
+	}
+	return nil
+}
+
+// saveData removes deleted metrics and persists either all metrics or only changed ones. Caller must hold muSave.
+func (m *MemStorage) saveData(ctx context.Context, full bool) error {
+	if err := m.deleteData(ctx); err != nil {
+		return err
+	}
+
+	gauges := m.takeGauges(full)
+	counters, totals := m.takeCounters(full)
+	data := &storagemngr.Data{
+		Gauges:        gauges,
+		Counters:      counters,
+		CounterTotals: totals,
+		Histograms:    m.takeHistograms(full),
+	}
+
+	if m.isHistoryEnabled() {
+		if full {
+			data.GaugesHistory, data.CountersHistory = m.GetAllGaugesHistory(), m.GetAllCountersHistory()
+		} else if len(gauges) != 0 || len(counters) != 0 {
+			m.muGauge.RLock()
+			data.GaugesHistory = copyHistoryOf(m.gaugeHistory, gauges)
+			m.muGauge.RUnlock()
+
+			m.muCounter.RLock()
+			data.CountersHistory = copyHistoryOf(m.counterHistory, counters)
+			m.muCounter.RUnlock()
+		}
+	}
+
+	if full {
+		if err := m.manager.SaveDataInStorage(ctx, data); err != nil {
+			return fmt.Errorf("save data: %w", err)
+		}
+	} else if len(data.Gauges) != 0 || len(data.Counters) != 0 || len(data.Histograms) != 0 {
+		if err := m.manager.SaveDataDeltaInStorage(ctx, data); err != nil {
+			return fmt.Errorf("save data delta: %w", err)
+		}
 	}
 	return nil
 }
 
+// deleteData removes metrics deleted since the previous call from storage.
+// Deletions are kept for the next call on failure unless the metric was added again.
+func (m *MemStorage) deleteData(ctx context.Context) error {
+	m.muGauge.Lock()
+	gauges := takeSet(&m.deletedGauges)
+	m.muGauge.Unlock()
+
+	m.muCounter.Lock()
+	counters := takeSet(&m.deletedCounters)
+	m.muCounter.Unlock()
+
+	m.muHistogram.Lock()
+	histograms := takeSet(&m.deletedHistograms)
+	m.muHistogram.Unlock()
+
+	if len(gauges) == 0 && len(counters) == 0 && len(histograms) == 0 {
+		return nil
+	}
+
+	if err := m.manager.DeleteMetricsFromStorage(ctx, gauges, counters, histograms); err != nil {
+		m.muGauge.Lock()
+		returnDeleted(&m.deletedGauges, gauges, m.gaugeMetrics)
+		m.muGauge.Unlock()
+
+		m.muCounter.Lock()
+		returnDeleted(&m.deletedCounters, counters, m.counterMetrics)
+		m.muCounter.Unlock()
+
+		m.muHistogram.Lock()
+		returnDeleted(&m.deletedHistograms, histograms, m.histogramMetrics)
+		m.muHistogram.Unlock()
+
+		return fmt.Errorf("delete data: %w", err)
+	}
+	return nil
+}
+
+// takeGauges returns copies of all gauges or gauges changed since previous call and resets changes tracking.
+func (m *MemStorage) takeGauges(all bool) map[string]interface{} {
+	m.muGauge.Lock()
+	defer m.muGauge.Unlock()
+	return takeChanged(m.gaugeMetrics, &m.changedGauges, all)
+}
+
+// takeCounters returns copies of all counters or counters changed since previous call and resets changes tracking.
+// The last totals of returned cumulative counters are taken together with values to keep them consistent.
+func (m *MemStorage) takeCounters(all bool) (map[string]interface{}, map[string]int64) {
+	m.muCounter.Lock()
+	defer m.muCounter.Unlock()
+
+	counters := takeChanged(m.counterMetrics, &m.changedCounters, all)
+	totals := make(map[string]int64)
+	for key := range counters {
+		if total, ok := m.counterTotals[key]; ok {
+			totals[key] = total
+		}
+	}
+	return counters, totals
+}
+
+// takeHistograms returns copies of all histograms or histograms changed since previous call and resets changes tracking.
+func (m *MemStorage) takeHistograms(all bool) map[string]*histogram.Histogram {
+	m.muHistogram.Lock()
+	defer m.muHistogram.Unlock()
+
+	var result map[string]*histogram.Histogram
+	if all {
+		result = make(map[string]*histogram.Histogram, len(m.histogramMetrics))
+		for k, v := range m.histogramMetrics {
+			result[k] = v.Clone()
+		}
+	} else {
+		result = make(map[string]*histogram.Histogram, len(m.changedHistograms))
+		for k := range m.changedHistograms {
+			if v, ok := m.histogramMetrics[k]; ok {
+				result[k] = v.Clone()
+			}
+		}
+	}
+
+	m.changedHistograms = make(map[string]struct{})
+	return result
+}
+
 // AddCounter adds the specified value to the counter metric with the given name.
-func (m *MemStorage) AddCounter(name string, value counter) {
+// In synchronous mode the metric is persisted before return.
+func (m *MemStorage) AddCounter(name string, value counter) error {
+	m.addCounter(name, value, time.Now())
+	return m.writeThrough()
+}
+
+// addCounter adds the specified value to the counter metric in memory only. History sample is registered at moment at.
+func (m *MemStorage) addCounter(name string, value counter, at time.Time) {
+	m.muCounter.Lock()
+	defer m.muCounter.Unlock()
+	m.increaseCounter(name, value, at)
+}
+
+// AddCumulativeCounter registers the total value of the counter metric with the given name reported by sender.
+// The increment since the previous report is added to the counter. Total less than the previous one
+// means the sender was restarted and counter was reset, so the whole total is added.
+// The last totals are persisted with counters, so increments are computed correctly after server restart.
+// In synchronous mode the metric is persisted before return.
+func (m *MemStorage) AddCumulativeCounter(name string, total counter) error {
+	m.addCumulativeCounter(name, total, time.Now())
+	return m.writeThrough()
+}
+
+// addCumulativeCounter adds increment of the counter total in memory only. History sample is registered at moment at.
+func (m *MemStorage) addCumulativeCounter(name string, total counter, at time.Time) {
 	m.muCounter.Lock()
 	defer m.muCounter.Unlock()
+
+	if m.counterTotals == nil {
+		m.counterTotals = make(map[string]counter)
+	}
+
+	last, known := m.counterTotals[name]
+	_, exists := m.counterMetrics[name]
+
+	increment := total
+	switch {
+	case exists && !known:
+		// the counter was accumulated by delta reports or its total wasn't stored, the total is taken as a baseline.
+		increment = 0
+	case exists && total >= last:
+		increment = total - last
+	}
+
+	m.counterTotals[name] = total
+	m.increaseCounter(name, increment, at)
+}
+
+// increaseCounter adds the specified value to the counter metric. Caller must hold the write lock of counters.
+func (m *MemStorage) increaseCounter(name string, value counter, at time.Time) {
 	m.counterMetrics[name] += value
+	touch(&m.counterUpdates, name)
+	markChanged(&m.changedCounters, name)
+	m.addSample(m.counterHistory, name, float64(m.counterMetrics[name]), at)
+	m.publish(name, func(id string) networkmsg.Metric {
+		return networkmsg.CreateCounterMetrics(id, m.counterMetrics[name])
+	})
 }
 
 // GetCounter retrieves the value of the counter metric with the given name.
@@ -123,11 +481,38 @@ func (m *MemStorage) GetAllCounters() map[string]interface{} {
 	return copyMapPredefinedSizePointers(m.counterMetrics)
 }
 
+// DeleteCounter removes the counter metric with the given name and its history.
+// In synchronous mode the removal is persisted before return.
+func (m *MemStorage) DeleteCounter(name string) error {
+	m.muCounter.Lock()
+	ok := deleteMetric(m.counterMetrics, m.counterHistory, m.counterUpdates, &m.deletedCounters, name)
+	delete(m.counterTotals, name)
+	m.muCounter.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: counter '%s'", ErrNotFound, name)
+	}
+	return m.writeThrough()
+}
+
 // AddGauge adds the specified value to the gauge metric with the given name.
-func (m *MemStorage) AddGauge(name string, value gauge) {
+// In synchronous mode the metric is persisted before return.
+func (m *MemStorage) AddGauge(name string, value gauge) error {
+	m.addGauge(name, value, time.Now())
+	return m.writeThrough()
+}
+
+// addGauge sets the specified value to the gauge metric in memory only. History sample is registered at moment at.
+func (m *MemStorage) addGauge(name string, value gauge, at time.Time) {
 	m.muGauge.Lock()
 	defer m.muGauge.Unlock()
 	m.gaugeMetrics[name] = value
+	touch(&m.gaugeUpdates, name)
+	markChanged(&m.changedGauges, name)
+	m.addSample(m.gaugeHistory, name, value, at)
+	m.publish(name, func(id string) networkmsg.Metric {
+		return networkmsg.CreateGaugeMetrics(id, value)
+	})
 }
 
 // GetGauge retrieves the value of the gauge metric with the given name.
@@ -149,26 +534,439 @@ func (m *MemStorage) GetAllGauges() map[string]interface{} {
 	return copyMapPredefinedSizePointers(m.gaugeMetrics)
 }
 
+// DeleteGauge removes the gauge metric with the given name and its history.
+// In synchronous mode the removal is persisted before return.
+func (m *MemStorage) DeleteGauge(name string) error {
+	m.muGauge.Lock()
+	ok := deleteMetric(m.gaugeMetrics, m.gaugeHistory, m.gaugeUpdates, &m.deletedGauges, name)
+	m.muGauge.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: gauge '%s'", ErrNotFound, name)
+	}
+	return m.writeThrough()
+}
+
+// AddHistogram merges the specified histogram into the histogram metric with the given name.
+// Histogram is added as is if the metric is missing. Bounds of existing and added histograms have to match.
+// In synchronous mode the metric is persisted before return.
+func (m *MemStorage) AddHistogram(name string, value *histogram.Histogram) error {
+	if err := m.addHistogram(name, value); err != nil {
+		return err
+	}
+	return m.writeThrough()
+}
+
+// addHistogram merges the specified histogram into the histogram metric in memory only.
+func (m *MemStorage) addHistogram(name string, value *histogram.Histogram) error {
+	if err := value.Validate(); err != nil {
+		return fmt.Errorf("add histogram '%s': %w", name, err)
+	}
+
+	m.muHistogram.Lock()
+	defer m.muHistogram.Unlock()
+
+	if m.histogramMetrics == nil {
+		m.histogramMetrics = make(map[string]*histogram.Histogram)
+	}
+
+	stored, ok := m.histogramMetrics[name]
+	if !ok {
+		stored = value.Clone()
+		m.histogramMetrics[name] = stored
+	} else if err := stored.Merge(value); err != nil {
+		return fmt.Errorf("add histogram '%s': %w", name, err)
+	}
+
+	touch(&m.histogramUpdates, name)
+	markChanged(&m.changedHistograms, name)
+	m.publish(name, func(id string) networkmsg.Metric {
+		return networkmsg.CreateHistogramMetrics(id, stored.Clone())
+	})
+	return nil
+}
+
+// GetHistogram retrieves a copy of the histogram metric with the given name.
+func (m *MemStorage) GetHistogram(name string) (*histogram.Histogram, error) {
+	m.muHistogram.RLock()
+	defer m.muHistogram.RUnlock()
+
+	if value, inMap := m.histogramMetrics[name]; inMap {
+		return value.Clone(), nil
+	}
+	return nil, fmt.Errorf("invalid histogram name '%s'", name)
+}
+
+// GetAllHistograms returns a map containing copies of all histogram metrics.
+func (m *MemStorage) GetAllHistograms() map[string]*histogram.Histogram {
+	m.muHistogram.RLock()
+	defer m.muHistogram.RUnlock()
+
+	result := make(map[string]*histogram.Histogram, len(m.histogramMetrics))
+	for k, v := range m.histogramMetrics {
+		result[k] = v.Clone()
+	}
+	return result
+}
+
+// DeleteHistogram removes the histogram metric with the given name.
+// In synchronous mode the removal is persisted before return.
+func (m *MemStorage) DeleteHistogram(name string) error {
+	m.muHistogram.Lock()
+	ok := deleteMetric(m.histogramMetrics, nil, m.histogramUpdates, &m.deletedHistograms, name)
+	m.muHistogram.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: histogram '%s'", ErrNotFound, name)
+	}
+	return m.writeThrough()
+}
+
+// ExpireMetrics removes metrics not updated within TTL before now. Nothing is removed if TTL is not set.
+// It returns the number of removed metrics. In synchronous mode the removal is persisted before return.
+func (m *MemStorage) ExpireMetrics(now time.Time) (int, error) {
+	if m.metricTTL <= 0 {
+		return 0, nil
+	}
+
+	border := now.Add(-m.metricTTL)
+
+	m.muGauge.Lock()
+	expired := expireMetrics(m.gaugeMetrics, m.gaugeHistory, m.gaugeUpdates, &m.deletedGauges, border)
+	m.muGauge.Unlock()
+
+	m.muCounter.Lock()
+	expired += expireMetrics(m.counterMetrics, m.counterHistory, m.counterUpdates, &m.deletedCounters, border)
+	for name := range m.counterTotals {
+		if _, ok := m.counterMetrics[name]; !ok {
+			delete(m.counterTotals, name)
+		}
+	}
+	m.muCounter.Unlock()
+
+	m.muHistogram.Lock()
+	expiredHistograms := expireMetrics(m.histogramMetrics, nil, m.histogramUpdates, &m.deletedHistograms, border)
+	m.muHistogram.Unlock()
+
+	expired += expiredHistograms
+	if expired == 0 {
+		return 0, nil
+	}
+	return expired, m.writeThrough()
+}
+
+// GetCounterHistory returns samples of the counter metric with the given name registered in range [from, to].
+// Zero from or to means the range is not limited from the corresponding side.
+func (m *MemStorage) GetCounterHistory(name string, from, to time.Time) ([]history.Sample, error) {
+	m.muCounter.RLock()
+	defer m.muCounter.RUnlock()
+
+	if _, inMap := m.counterMetrics[name]; !inMap {
+		return nil, fmt.Errorf("invalid counter name '%s'", name)
+	}
+	return m.getSamples(m.counterHistory, name, from, to), nil
+}
+
+// GetCounterRate returns average per-second change of the counter metric with the given name
+// computed over samples registered in range [from, to]. Zero from or to means the range is not limited
+// from the corresponding side. Rate is zero if less than two samples are stored.
+func (m *MemStorage) GetCounterRate(name string, from, to time.Time) (float64, error) {
+	samples, err := m.GetCounterHistory(name, from, to)
+	if err != nil {
+		return 0, err
+	}
+	return history.Rate(samples), nil
+}
+
+// GetAllCountersRates returns average per-second change of all counter metrics
+// computed over samples registered in range [from, to].
+func (m *MemStorage) GetAllCountersRates(from, to time.Time) map[string]float64 {
+	m.muCounter.RLock()
+	defer m.muCounter.RUnlock()
+
+	result := make(map[string]float64, len(m.counterMetrics))
+	for name := range m.counterMetrics {
+		result[name] = history.Rate(m.getSamples(m.counterHistory, name, from, to))
+	}
+	return result
+}
+
+// GetAllCountersHistory returns a copy of samples of all counter metrics.
+func (m *MemStorage) GetAllCountersHistory() map[string][]history.Sample {
+	m.muCounter.RLock()
+	defer m.muCounter.RUnlock()
+	return copyHistory(m.counterHistory)
+}
+
+// GetGaugeHistory returns samples of the gauge metric with the given name registered in range [from, to].
+// Zero from or to means the range is not limited from the corresponding side.
+func (m *MemStorage) GetGaugeHistory(name string, from, to time.Time) ([]history.Sample, error) {
+	m.muGauge.RLock()
+	defer m.muGauge.RUnlock()
+
+	if _, inMap := m.gaugeMetrics[name]; !inMap {
+		return nil, fmt.Errorf("invalid gauge name '%s'", name)
+	}
+	return m.getSamples(m.gaugeHistory, name, from, to), nil
+}
+
+// GetAllGaugesHistory returns a copy of samples of all gauge metrics.
+func (m *MemStorage) GetAllGaugesHistory() map[string][]history.Sample {
+	m.muGauge.RLock()
+	defer m.muGauge.RUnlock()
+	return copyHistory(m.gaugeHistory)
+}
+
+// HISTORY HANDLING.
+
+// isHistoryEnabled checks if samples history should be collected.
+func (m *MemStorage) isHistoryEnabled() bool {
+	return m.historyLimit > 0
+}
+
+// createRing creates samples ring with storage's retention settings.
+func (m *MemStorage) createRing() *history.Ring {
+	return history.NewRing(m.historyLimit, m.historyRetention)
+}
+
+// addSample registers current value of metric in history at moment at. Caller must hold the write lock of the metric type.
+func (m *MemStorage) addSample(rings map[string]*history.Ring, name string, value float64, at time.Time) {
+	if !m.isHistoryEnabled() {
+		return
+	}
+
+	ring, ok := rings[name]
+	if !ok {
+		ring = m.createRing()
+		rings[name] = ring
+	}
+	ring.Add(history.Sample{Timestamp: at, Value: value})
+}
+
+// getSamples returns samples of metric from range [from, to] not older than retention.
+// Caller must hold at least the read lock of the metric type.
+func (m *MemStorage) getSamples(rings map[string]*history.Ring, name string, from, to time.Time) []history.Sample {
+	ring, ok := rings[name]
+	if !ok {
+		return []history.Sample{}
+	}
+
+	if m.historyRetention > 0 {
+		border := time.Now().Add(-m.historyRetention)
+		if from.Before(border) {
+			from = border
+		}
+	}
+	return ring.Samples(from, to)
+}
+
+// copyHistory creates and returns a new map with all samples copied from the provided rings.
+func copyHistory(rings map[string]*history.Ring) map[string][]history.Sample {
+	result := make(map[string][]history.Sample, len(rings))
+	for k, ring := range rings {
+		result[k] = ring.All()
+	}
+	return result
+}
+
+// copyHistoryOf returns a copy of samples of metrics with the specified keys.
+func copyHistoryOf(rings map[string]*history.Ring, keys map[string]interface{}) map[string][]history.Sample {
+	result := make(map[string][]history.Sample, len(keys))
+	for k := range keys {
+		if ring, ok := rings[k]; ok {
+			result[k] = ring.All()
+		}
+	}
+	return result
+}
+
+// Subscribe subscribes on resulting values of updated metrics selected by filter.
+// Subscription has to be closed when updates are not needed anymore.
+func (m *MemStorage) Subscribe(filter watch.Filter) *watch.Subscription {
+	return m.updates.Subscribe(filter)
+}
+
+// publish sends resulting value of metric stored under series key to subscribers.
+// Update is created by create from the metric name only if anybody is subscribed.
+// Caller must hold the write lock of the metric type to keep updates order.
+func (m *MemStorage) publish(key string, create func(id string) networkmsg.Metric) {
+	if m.updates == nil || !m.updates.HasSubscriptions() {
+		return
+	}
+
+	name, labels, err := networkmsg.ParseSeriesKey(key)
+	if err != nil {
+		return
+	}
+
+	metric := create(name)
+	metric.Labels = labels
+	m.updates.Publish(metric)
+}
+
 // AddMetricMessageInStorage adds a metric to storage based on the metric type.
-func (m *MemStorage) AddMetricMessageInStorage(data *networkmsg.Metric) {
+// Metric is stored under series key built from its name and labels.
+// Counter value is handled as increment or as sender's total depending on the counter mode.
+// History sample is registered at collection time of the metric if it is set and not in the future.
+// Resulting value of the metric is written back in data.
+func (m *MemStorage) AddMetricMessageInStorage(data *networkmsg.Metric) error {
+	key := data.Key()
+	at := sampleTime(data.Timestamp, time.Now())
+	var err error
 	switch data.MType {
 	case gaugeType:
 		valueIn := new(float64)
 		if data.Value != nil {
 			valueIn = data.Value
 		}
-		m.AddGauge(data.ID, *valueIn)
-		valueOut, _ := m.GetGauge(data.ID)
+		m.addGauge(key, *valueIn, at)
+		err = m.writeThrough()
+		valueOut, _ := m.GetGauge(key)
 		data.Value = &valueOut
 	case counterType:
 		valueIn := new(int64)
 		if data.Delta != nil {
 			valueIn = data.Delta
 		}
-		m.AddCounter(data.ID, *valueIn)
-		value, _ := m.GetCounter(data.ID)
+		if data.Mode == networkmsg.CounterCumulative {
+			m.addCumulativeCounter(key, *valueIn, at)
+		} else {
+			m.addCounter(key, *valueIn, at)
+		}
+		err = m.writeThrough()
+		value, _ := m.GetCounter(key)
 		data.Delta = &value
+	case histogramType:
+		if data.Histogram == nil {
+			return fmt.Errorf("missing value of histogram '%s'", key)
+		}
+
+		if err = m.AddHistogram(key, data.Histogram); err != nil && !errors.Is(err, ErrPersist) {
+			return err
+		}
+		data.Histogram, _ = m.GetHistogram(key)
 	}
+
+	return err
+}
+
+// DeleteMetricMessageFromStorage removes a metric from storage based on the metric type.
+// Metric is identified by series key built from its name and labels.
+func (m *MemStorage) DeleteMetricMessageFromStorage(data *networkmsg.Metric) error {
+	key := data.Key()
+	switch data.MType {
+	case gaugeType:
+		return m.DeleteGauge(key)
+	case counterType:
+		return m.DeleteCounter(key)
+	case histogramType:
+		return m.DeleteHistogram(key)
+	default:
+		return fmt.Errorf("unknown type '%s' of metric '%s'", data.MType, key)
+	}
+}
+
+// sampleTime converts collection timestamp (unix milliseconds) into history sample moment.
+// Missing timestamp and timestamp in the future are replaced by now.
+// Timestamp older than the latest sample of the metric is inserted in history at its moment.
+func sampleTime(timestamp int64, now time.Time) time.Time {
+	if timestamp <= 0 {
+		return now
+	}
+
+	at := time.UnixMilli(timestamp)
+	if at.After(now) {
+		return now
+	}
+	return at
+}
+
+// CHANGES TRACKING.
+
+// touch registers the current time as the last update time of metric. Caller must hold the write lock of the metric type.
+func touch(updates *map[string]time.Time, name string) {
+	if *updates == nil {
+		*updates = make(map[string]time.Time)
+	}
+	(*updates)[name] = time.Now()
+}
+
+// deleteMetric removes metric with its history and update time and registers it in deleted set.
+// It reports whether the metric existed. Caller must hold the write lock of the metric type.
+func deleteMetric[V any](metrics map[string]V, rings map[string]*history.Ring, updates map[string]time.Time, deleted *map[string]struct{}, name string) bool {
+	if _, ok := metrics[name]; !ok {
+		return false
+	}
+
+	delete(metrics, name)
+	delete(rings, name)
+	delete(updates, name)
+	markChanged(deleted, name)
+	return true
+}
+
+// expireMetrics removes metrics updated before border and returns their count.
+// Caller must hold the write lock of the metric type.
+func expireMetrics[V any](metrics map[string]V, rings map[string]*history.Ring, updates map[string]time.Time, deleted *map[string]struct{}, border time.Time) int {
+	expired := 0
+	for name := range metrics {
+		// metrics without registered update time are considered as fresh ones.
+		if updated, ok := updates[name]; ok && updated.Before(border) {
+			deleteMetric(metrics, rings, updates, deleted, name)
+			expired++
+		}
+	}
+	return expired
+}
+
+// takeSet returns keys of the set and resets it. Caller must hold the write lock of the metric type.
+func takeSet(set *map[string]struct{}) []string {
+	keys := make([]string, 0, len(*set))
+	for k := range *set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	*set = make(map[string]struct{})
+	return keys
+}
+
+// returnDeleted registers keys in deleted set again except metrics added after removal.
+// Caller must hold the write lock of the metric type.
+func returnDeleted[V any](deleted *map[string]struct{}, keys []string, metrics map[string]V) {
+	for _, k := range keys {
+		if _, ok := metrics[k]; !ok {
+			markChanged(deleted, k)
+		}
+	}
+}
+
+// markChanged registers name in changed metrics set. Caller must hold the write lock of the metric type.
+func markChanged(changed *map[string]struct{}, name string) {
+	if *changed == nil {
+		*changed = make(map[string]struct{})
+	}
+	(*changed)[name] = struct{}{}
+}
+
+// takeChanged returns copies of all metrics or metrics registered in changed set as pointers and resets the set.
+// Caller must hold the write lock of the metric type.
+func takeChanged[V any](metrics map[string]V, changed *map[string]struct{}, all bool) map[string]interface{} {
+	var result map[string]interface{}
+	if all {
+		result = copyMapPredefinedSizePointers(metrics)
+	} else {
+		result = make(map[string]interface{}, len(*changed))
+		for k := range *changed {
+			if v, ok := metrics[k]; ok {
+				v := v
+				result[k] = &v
+			}
+		}
+	}
+
+	*changed = make(map[string]struct{})
+	return result
 }
 
 // The following functions create copies of maps with specific pointer handling.
@@ -7,15 +7,33 @@ import (
 	"testing"
 	"time"
 
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/server/config"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
 	"github.com/erupshis/metrics/internal/server/memstorage/storagemngr"
+	"github.com/erupshis/metrics/internal/server/watch"
 	"github.com/erupshis/metrics/mocks"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// dataLen matches saved data with the specified numbers of gauges, counters and histograms.
+type dataLen struct {
+	gauges, counters, histograms int
+}
+
+func (m dataLen) Matches(x interface{}) bool {
+	data, ok := x.(*storagemngr.Data)
+	return ok && len(data.Gauges) == m.gauges && len(data.Counters) == m.counters && len(data.Histograms) == m.histograms
+}
+
+func (m dataLen) String() string {
+	return fmt.Sprintf("has %d gauges, %d counters and %d histograms", m.gauges, m.counters, m.histograms)
+}
+
 func TestCreateStorage(t *testing.T) {
 	storage := Create(context.Background(), &config.Default, nil, logger.CreateMock())
 
@@ -300,8 +318,8 @@ func TestMemStorage_SaveData(t *testing.T) {
 
 	manager := mocks.NewMockStorageManager(ctrl)
 	gomock.InOrder(
-		manager.EXPECT().SaveMetricsInStorage(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
-		manager.EXPECT().SaveMetricsInStorage(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("manager err")),
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), gomock.Any()).Return(nil),
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), gomock.Any()).Return(fmt.Errorf("manager err")),
 	)
 
 	type fields struct {
@@ -378,6 +396,8 @@ func TestMemStorage_RestoreData(t *testing.T) {
 			map[string]float64{"gauge1": 1.1, "gauge2": 2.2},
 			map[string]int64{"counter1": 1, "counter3": 3},
 			nil),
+		manager.EXPECT().RestoreHistogramsFromStorage(context.Background()).Return(map[string]*histogram.Histogram{}, nil),
+		manager.EXPECT().RestoreCounterTotalsFromStorage(context.Background()).Return(map[string]int64{"counter1": 5, "deleted": 7}, nil),
 		manager.EXPECT().RestoreDataFromStorage(context.Background()).Return(
 			nil,
 			nil,
@@ -392,6 +412,7 @@ func TestMemStorage_RestoreData(t *testing.T) {
 	type want struct {
 		gaugeMetrics   map[string]gauge
 		counterMetrics map[string]counter
+		counterTotals  map[string]counter
 		wantErr        bool
 	}
 	tests := []struct {
@@ -409,6 +430,7 @@ func TestMemStorage_RestoreData(t *testing.T) {
 			want: want{
 				gaugeMetrics:   map[string]float64{"gauge1": 1.1, "gauge2": 2.2},
 				counterMetrics: map[string]int64{"counter1": 1, "counter3": 3},
+				counterTotals:  map[string]int64{"counter1": 5},
 				wantErr:        false,
 			},
 		},
@@ -443,10 +465,649 @@ func TestMemStorage_RestoreData(t *testing.T) {
 
 			assert.Equal(t, tt.want.gaugeMetrics, m.gaugeMetrics)
 			assert.Equal(t, tt.want.counterMetrics, m.counterMetrics)
+			assert.Equal(t, tt.want.counterTotals, m.counterTotals)
+		})
+	}
+}
+
+func TestMemStorage_CumulativeCounterAfterRestart(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ptrInt := func(v int64) interface{} { return &v }
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	gomock.InOrder(
+		manager.EXPECT().RestoreDataFromStorage(gomock.Any()).Return(map[string]float64{}, map[string]int64{"counter1": 10}, nil),
+		manager.EXPECT().RestoreHistogramsFromStorage(gomock.Any()).Return(map[string]*histogram.Histogram{}, nil),
+		manager.EXPECT().RestoreCounterTotalsFromStorage(gomock.Any()).Return(map[string]int64{"counter1": 10}, nil),
+		// total is saved together with counter value.
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{},
+			Counters:      map[string]interface{}{"counter1": ptrInt(15)},
+			CounterTotals: map[string]int64{"counter1": 15},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(nil),
+	)
+
+	cfg := config.Default
+	cfg.HistoryLimit = 0
+	storage := Create(context.Background(), &cfg, manager, logger.CreateMock())
+
+	metric := networkmsg.CreateCumulativeCounterMetrics("counter1", 15)
+	require.NoError(t, storage.AddMetricMessageInStorage(&metric))
+	assert.Equal(t, int64(15), *metric.Delta, "increment is computed from the restored total")
+
+	require.NoError(t, storage.SaveData(context.Background()))
+}
+
+func TestMemStorage_GetGaugeHistory(t *testing.T) {
+	storage := Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	start := time.Now()
+	storage.AddGauge("metric1", 1.1)
+	storage.AddGauge("metric1", 2.2)
+	storage.AddGauge("metric1", 3.3)
+
+	type args struct {
+		name string
+		from time.Time
+		to   time.Time
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []float64
+		wantErr bool
+	}{
+		{"valid unbounded", args{"metric1", time.Time{}, time.Time{}}, []float64{1.1, 2.2, 3.3}, false},
+		{"valid from", args{"metric1", start, time.Time{}}, []float64{1.1, 2.2, 3.3}, false},
+		{"valid empty range", args{"metric1", time.Time{}, start.Add(-time.Second)}, []float64{}, false},
+		{"invalid name", args{"metric2", time.Time{}, time.Time{}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := storage.GetGaugeHistory(tt.args.name, tt.args.from, tt.args.to)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetGaugeHistory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			values := make([]float64, 0)
+			for _, sample := range samples {
+				values = append(values, sample.Value)
+			}
+			assert.Equal(t, tt.want, values)
 		})
 	}
 }
 
+func TestMemStorage_AddMetricMessageTimestamp(t *testing.T) {
+	storage := Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	collected := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+
+	gauge := networkmsg.CreateGaugeMetrics("metric1", 1)
+	gauge.Timestamp = collected.UnixMilli()
+	require.NoError(t, storage.AddMetricMessageInStorage(&gauge))
+
+	future := networkmsg.CreateCounterMetrics("metric2", 1)
+	future.Timestamp = time.Now().Add(time.Hour).UnixMilli()
+	require.NoError(t, storage.AddMetricMessageInStorage(&future))
+
+	samples, err := storage.GetGaugeHistory("metric1", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.True(t, collected.Equal(samples[0].Timestamp))
+
+	samples, err = storage.GetCounterHistory("metric2", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.False(t, samples[0].Timestamp.After(time.Now()))
+}
+
+func TestMemStorage_AddMetricMessageOutOfOrder(t *testing.T) {
+	storage := Create(context.Background(), &config.Default, nil, logger.CreateMock())
+	collected := time.Now().Add(-10 * time.Minute).Truncate(time.Millisecond)
+
+	for i, offset := range []time.Duration{0, 2 * time.Minute, time.Minute} {
+		counter := networkmsg.CreateCounterMetrics("metric1", 10)
+		counter.Timestamp = collected.Add(offset).UnixMilli()
+		require.NoError(t, storage.AddMetricMessageInStorage(&counter), "delivery %d", i)
+	}
+
+	samples, err := storage.GetCounterHistory("metric1", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	for i, offset := range []time.Duration{0, time.Minute, 2 * time.Minute} {
+		assert.True(t, collected.Add(offset).Equal(samples[i].Timestamp), "sample %d is registered at collection moment", i)
+	}
+	assert.Equal(t, []float64{10, 30, 20}, []float64{samples[0].Value, samples[1].Value, samples[2].Value},
+		"late sample is inserted at its moment")
+
+	rate, err := storage.GetCounterRate("metric1", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.InDelta(t, float64(10)/120, rate, 1e-9)
+}
+
+func TestMemStorage_GetCounterHistory(t *testing.T) {
+	cfg := config.Default
+	cfg.HistoryLimit = 2
+	storage := Create(context.Background(), &cfg, nil, logger.CreateMock())
+	storage.AddCounter("metric1", 1)
+	storage.AddCounter("metric1", 2)
+	storage.AddCounter("metric1", 3)
+
+	tests := []struct {
+		name    string
+		req     string
+		want    []float64
+		wantErr bool
+	}{
+		{"valid limited by count", "metric1", []float64{3, 6}, false},
+		{"invalid name", "metric2", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := storage.GetCounterHistory(tt.req, time.Time{}, time.Time{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetCounterHistory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			values := make([]float64, 0)
+			for _, sample := range samples {
+				values = append(values, sample.Value)
+			}
+			assert.Equal(t, tt.want, values)
+		})
+	}
+}
+
+func TestMemStorage_AddCumulativeCounter(t *testing.T) {
+	cfg := config.Default
+	cfg.Restore = false
+	storage := Create(context.Background(), &cfg, nil, logger.CreateMock())
+
+	tests := []struct {
+		name  string
+		total int64
+		want  int64
+	}{
+		{"new series", 5, 5},
+		{"increment", 8, 8},
+		{"same total", 8, 8},
+		{"reset after sender restart", 2, 10},
+		{"increment after reset", 6, 14},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := networkmsg.CreateCumulativeCounterMetrics("PollCount", tt.total)
+			require.NoError(t, storage.AddMetricMessageInStorage(&metric))
+			assert.Equal(t, tt.want, *metric.Delta)
+		})
+	}
+
+	// delta submission of the same series is added as is.
+	metric := networkmsg.CreateCounterMetrics("PollCount", 1)
+	require.NoError(t, storage.AddMetricMessageInStorage(&metric))
+	assert.Equal(t, int64(15), *metric.Delta)
+
+	// total of restored counter is taken as a baseline.
+	storage.addCounter("Restored", 100, time.Now())
+	require.NoError(t, storage.AddCumulativeCounter("Restored", 40))
+	require.NoError(t, storage.AddCumulativeCounter("Restored", 45))
+	value, err := storage.GetCounter("Restored")
+	require.NoError(t, err)
+	assert.Equal(t, int64(105), value)
+
+	// deleted counter starts from scratch.
+	require.NoError(t, storage.DeleteCounter("Restored"))
+	require.NoError(t, storage.AddCumulativeCounter("Restored", 50))
+	value, err = storage.GetCounter("Restored")
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), value)
+}
+
+func TestMemStorage_GetCounterRate(t *testing.T) {
+	cfg := config.Default
+	cfg.Restore = false
+	storage := Create(context.Background(), &cfg, nil, logger.CreateMock())
+	storage.AddCounter("metric1", 10)
+	storage.AddCounter("metric2", 1)
+
+	now := time.Now()
+	storage.counterHistory["metric1"] = storage.createRing()
+	for i, value := range []float64{10, 20, 40, 70} {
+		storage.counterHistory["metric1"].Add(history.Sample{Timestamp: now.Add(time.Duration(i-3) * 10 * time.Second), Value: value})
+	}
+
+	rate, err := storage.GetCounterRate("metric1", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, rate)
+
+	rate, err = storage.GetCounterRate("metric1", now.Add(-15*time.Second), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, rate)
+
+	_, err = storage.GetCounterRate("missing", time.Time{}, time.Time{})
+	assert.Error(t, err)
+
+	assert.Equal(t, map[string]float64{"metric1": 2, "metric2": 0}, storage.GetAllCountersRates(time.Time{}, time.Time{}))
+}
+
+func TestMemStorage_HistoryDisabled(t *testing.T) {
+	cfg := config.Default
+	cfg.HistoryLimit = 0
+	storage := Create(context.Background(), &cfg, nil, logger.CreateMock())
+	storage.AddGauge("metric1", 1.1)
+
+	samples, err := storage.GetGaugeHistory("metric1", time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	assert.Empty(t, storage.GetAllGaugesHistory())
+}
+
+func TestMemStorage_SaveAndRestoreHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ts := time.Now()
+	gaugesHistory := map[string][]history.Sample{"gauge1": {{Timestamp: ts, Value: 1.1}}}
+	countersHistory := map[string][]history.Sample{"counter1": {{Timestamp: ts, Value: 1}}}
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	gomock.InOrder(
+		manager.EXPECT().RestoreDataFromStorage(gomock.Any()).Return(
+			map[string]float64{"gauge1": 1.1},
+			map[string]int64{"counter1": 1},
+			nil),
+		manager.EXPECT().RestoreHistogramsFromStorage(gomock.Any()).Return(map[string]*histogram.Histogram{}, nil),
+		manager.EXPECT().RestoreCounterTotalsFromStorage(gomock.Any()).Return(map[string]int64{}, nil),
+		manager.EXPECT().RestoreHistoryFromStorage(gomock.Any()).Return(gaugesHistory, countersHistory, nil),
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Equal(t, gaugesHistory, data.GaugesHistory)
+				assert.Equal(t, countersHistory, data.CountersHistory)
+				return nil
+			}),
+		// only history of changed metrics is saved together with them.
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), dataLen{gauges: 1}).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				require.Contains(t, data.GaugesHistory, "gauge1")
+				assert.Len(t, data.GaugesHistory["gauge1"], 2)
+				assert.Empty(t, data.CountersHistory)
+				return fmt.Errorf("manager err")
+			}),
+		// full history after error.
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Len(t, data.GaugesHistory, 1)
+				assert.Len(t, data.CountersHistory, 1)
+				return nil
+			}),
+	)
+
+	storage := Create(context.Background(), &config.Default, manager, logger.CreateMock())
+	assert.Equal(t, gaugesHistory, storage.GetAllGaugesHistory())
+	assert.Equal(t, countersHistory, storage.GetAllCountersHistory())
+
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	// nothing changed, nothing is saved.
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	storage.AddGauge("gauge1", 2.2)
+	require.Error(t, storage.SaveData(context.Background()))
+	require.NoError(t, storage.SaveData(context.Background()))
+}
+
+func TestMemStorage_SaveDataDelta(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ptrFloat := func(v float64) interface{} { return &v }
+	ptrInt := func(v int64) interface{} { return &v }
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	gomock.InOrder(
+		// first save is full.
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{"gauge1": ptrFloat(1), "gauge2": ptrFloat(2)},
+			Counters:      map[string]interface{}{"counter1": ptrInt(3)},
+			CounterTotals: map[string]int64{},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(nil),
+		// only changed metrics are saved, histograms are not changed.
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{"gauge2": ptrFloat(5)},
+			Counters:      map[string]interface{}{},
+			CounterTotals: map[string]int64{},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(nil),
+		// failed delta.
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{},
+			Counters:      map[string]interface{}{"counter1": ptrInt(4)},
+			CounterTotals: map[string]int64{},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(fmt.Errorf("manager err")),
+		// full save after error.
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{"gauge1": ptrFloat(1), "gauge2": ptrFloat(5)},
+			Counters:      map[string]interface{}{"counter1": ptrInt(4)},
+			CounterTotals: map[string]int64{},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(nil),
+		// only changed histogram is saved.
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), dataLen{histograms: 1}).Return(nil),
+	)
+
+	cfg := config.Default
+	cfg.Restore = false
+	cfg.HistoryLimit = 0
+	storage := Create(context.Background(), &cfg, manager, logger.CreateMock())
+
+	storage.AddGauge("gauge1", 1)
+	storage.AddGauge("gauge2", 2)
+	storage.AddCounter("counter1", 3)
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	storage.AddGauge("gauge2", 5)
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	// nothing changed.
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	storage.AddCounter("counter1", 1)
+	require.Error(t, storage.SaveData(context.Background()))
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	require.NoError(t, storage.AddHistogram("histogram1", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+	require.NoError(t, storage.SaveData(context.Background()))
+}
+
+func TestMemStorage_SyncSave(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ptrFloat := func(v float64) interface{} { return &v }
+	ptrInt := func(v int64) interface{} { return &v }
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	gomock.InOrder(
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), dataLen{counters: 1}).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Equal(t, map[string]interface{}{"counter1": ptrInt(1)}, data.Counters)
+				assert.Len(t, data.CountersHistory, 1)
+				return nil
+			}),
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), dataLen{counters: 1}).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Equal(t, map[string]interface{}{"counter1": ptrInt(3)}, data.Counters)
+				return fmt.Errorf("manager err")
+			}),
+		// full snapshot after failed write.
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), dataLen{gauges: 1, counters: 1}).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Equal(t, map[string]interface{}{"gauge1": ptrFloat(1.5)}, data.Gauges)
+				assert.Equal(t, map[string]interface{}{"counter1": ptrInt(3)}, data.Counters)
+				assert.Len(t, data.GaugesHistory, 1)
+				assert.Len(t, data.CountersHistory, 1)
+				return nil
+			}),
+		// history of the updated gauge is written through with it.
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), dataLen{gauges: 1}).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Equal(t, map[string]interface{}{"gauge1": ptrFloat(2.5)}, data.Gauges)
+				assert.Len(t, data.GaugesHistory["gauge1"], 2)
+				assert.Empty(t, data.CountersHistory)
+				return nil
+			}),
+		// every histogram update persists only its series with bounded context.
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), dataLen{histograms: 1}).
+			DoAndReturn(func(ctx context.Context, data *storagemngr.Data) error {
+				_, ok := ctx.Deadline()
+				assert.True(t, ok, "write through has deadline")
+				assert.Contains(t, data.Histograms, "histogram1")
+				return nil
+			}),
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), dataLen{histograms: 1}).
+			DoAndReturn(func(_ context.Context, data *storagemngr.Data) error {
+				assert.Contains(t, data.Histograms, "histogram2")
+				return nil
+			}),
+	)
+
+	cfg := config.Default
+	cfg.Restore = false
+	cfg.StoreInterval = 0
+	storage := Create(context.Background(), &cfg, manager, logger.CreateMock())
+
+	require.NoError(t, storage.AddCounter("counter1", 1))
+
+	metric := networkmsg.CreateCounterMetrics("counter1", 2)
+	err := storage.AddMetricMessageInStorage(&metric)
+	assert.ErrorIs(t, err, ErrPersist)
+	value, err := storage.GetCounter("counter1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), value, "value is kept in memory")
+
+	require.NoError(t, storage.AddGauge("gauge1", 1.5))
+	require.NoError(t, storage.AddGauge("gauge1", 2.5))
+
+	require.NoError(t, storage.AddHistogram("histogram1", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+	require.NoError(t, storage.AddHistogram("histogram2", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+}
+
+func TestMemStorage_DeleteMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ptrFloat := func(v float64) interface{} { return &v }
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	gomock.InOrder(
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), dataLen{gauges: 2, counters: 1, histograms: 1}).Return(nil),
+		// failed removal is repeated on the next save.
+		manager.EXPECT().DeleteMetricsFromStorage(gomock.Any(), []string{"gauge1"}, []string{"counter1"}, []string{"histogram1"}).Return(fmt.Errorf("manager err")),
+		manager.EXPECT().DeleteMetricsFromStorage(gomock.Any(), []string{"gauge1"}, []string{"counter1"}, []string{"histogram1"}).Return(nil),
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{"gauge2": ptrFloat(2)},
+			Counters:      map[string]interface{}{},
+			CounterTotals: map[string]int64{},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(nil),
+		// metric added again after removal is deleted and saved.
+		manager.EXPECT().DeleteMetricsFromStorage(gomock.Any(), []string{"gauge2"}, []string{}, []string{}).Return(nil),
+		manager.EXPECT().SaveDataDeltaInStorage(gomock.Any(), &storagemngr.Data{
+			Gauges:        map[string]interface{}{"gauge2": ptrFloat(3)},
+			Counters:      map[string]interface{}{},
+			CounterTotals: map[string]int64{},
+			Histograms:    map[string]*histogram.Histogram{},
+		}).Return(nil),
+	)
+
+	cfg := config.Default
+	cfg.Restore = false
+	cfg.HistoryLimit = 0
+	storage := Create(context.Background(), &cfg, manager, logger.CreateMock())
+
+	require.NoError(t, storage.AddGauge("gauge1", 1))
+	require.NoError(t, storage.AddGauge("gauge2", 2))
+	require.NoError(t, storage.AddCounter("counter1", 1))
+	require.NoError(t, storage.AddHistogram("histogram1", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	require.NoError(t, storage.DeleteGauge("gauge1"))
+	require.NoError(t, storage.DeleteCounter("counter1"))
+	histogramMetric := networkmsg.CreateHistogramMetrics("histogram1", nil)
+	require.NoError(t, storage.DeleteMetricMessageFromStorage(&histogramMetric))
+
+	assert.ErrorIs(t, storage.DeleteGauge("gauge1"), ErrNotFound)
+	assert.ErrorIs(t, storage.DeleteCounter("missing"), ErrNotFound)
+	assert.ErrorIs(t, storage.DeleteHistogram("histogram1"), ErrNotFound)
+	unknownMetric := networkmsg.Metric{ID: "gauge2", MType: "unknown"}
+	assert.Error(t, storage.DeleteMetricMessageFromStorage(&unknownMetric))
+
+	_, err := storage.GetGauge("gauge1")
+	assert.Error(t, err)
+	_, err = storage.GetGaugeHistory("gauge1", time.Time{}, time.Time{})
+	assert.Error(t, err)
+	assert.Empty(t, storage.GetAllCounters())
+	assert.Empty(t, storage.GetAllHistograms())
+
+	require.Error(t, storage.SaveData(context.Background()))
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	require.NoError(t, storage.DeleteGauge("gauge2"))
+	require.NoError(t, storage.AddGauge("gauge2", 3))
+	require.NoError(t, storage.SaveData(context.Background()))
+}
+
+func TestMemStorage_ExpireMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	manager := mocks.NewMockStorageManager(ctrl)
+	gomock.InOrder(
+		manager.EXPECT().SaveDataInStorage(gomock.Any(), dataLen{gauges: 2, counters: 1, histograms: 1}).Return(nil),
+		// removed histograms are deleted without rewriting of the rest ones.
+		manager.EXPECT().DeleteMetricsFromStorage(gomock.Any(), []string{"gauge1", "gauge2"}, []string{"counter1"}, []string{"histogram1"}).Return(nil),
+	)
+
+	cfg := config.Default
+	cfg.Restore = false
+	cfg.HistoryLimit = 0
+	cfg.MetricTTL = time.Minute
+	storage := Create(context.Background(), &cfg, manager, logger.CreateMock())
+
+	require.NoError(t, storage.AddGauge("gauge1", 1))
+	require.NoError(t, storage.AddGauge("gauge2", 2))
+	require.NoError(t, storage.AddCounter("counter1", 1))
+	require.NoError(t, storage.AddHistogram("histogram1", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 1}))
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	expired, err := storage.ExpireMetrics(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, expired, "metrics are updated within TTL")
+
+	expired, err = storage.ExpireMetrics(time.Now().Add(2 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 4, expired)
+	assert.Empty(t, storage.GetAllGauges())
+	assert.Empty(t, storage.GetAllCounters())
+	assert.Empty(t, storage.GetAllHistograms())
+	require.NoError(t, storage.SaveData(context.Background()))
+
+	// TTL is not set.
+	cfg.MetricTTL = 0
+	storage = Create(context.Background(), &cfg, nil, logger.CreateMock())
+	require.NoError(t, storage.AddGauge("gauge1", 1))
+	expired, err = storage.ExpireMetrics(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 0, expired)
+}
+
+func TestMemStorage_AddHistogram(t *testing.T) {
+	storage := Create(context.Background(), &config.Default, nil, logger.CreateMock())
+
+	first, err := histogram.New([]float64{1, 5})
+	require.NoError(t, err)
+	first.Observe(0.5)
+	first.Observe(3)
+
+	second, err := histogram.New([]float64{1, 5})
+	require.NoError(t, err)
+	second.Observe(7)
+
+	mismatched, err := histogram.New([]float64{1, 10})
+	require.NoError(t, err)
+
+	require.NoError(t, storage.AddHistogram("hist", first))
+	require.NoError(t, storage.AddHistogram("hist", second))
+	assert.Error(t, storage.AddHistogram("hist", mismatched))
+	assert.Error(t, storage.AddHistogram("broken", &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}))
+
+	value, err := storage.GetHistogram("hist")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 1, 1}, value.Counts)
+	assert.Equal(t, uint64(3), value.Count)
+	assert.Equal(t, 10.5, value.Sum)
+
+	// stored histogram isn't affected by changes of added and returned ones.
+	first.Observe(1)
+	value.Observe(1)
+	stored, err := storage.GetHistogram("hist")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), stored.Count)
+
+	_, err = storage.GetHistogram("broken")
+	assert.Error(t, err)
+	assert.Len(t, storage.GetAllHistograms(), 1)
+}
+
+func TestMemStorage_AddHistogramMessage(t *testing.T) {
+	storage := Create(context.Background(), &config.Default, nil, logger.CreateMock())
+
+	value, err := histogram.New([]float64{1})
+	require.NoError(t, err)
+	value.Observe(2)
+
+	metric := networkmsg.CreateHistogramMetrics("hist", value)
+	require.NoError(t, storage.AddMetricMessageInStorage(&metric))
+
+	metric = networkmsg.CreateHistogramMetrics("hist", value)
+	require.NoError(t, storage.AddMetricMessageInStorage(&metric))
+	assert.Equal(t, uint64(2), metric.Histogram.Count)
+
+	metric = networkmsg.CreateHistogramMetrics("hist", nil)
+	assert.Error(t, storage.AddMetricMessageInStorage(&metric))
+}
+
+func TestMemStorage_Subscribe(t *testing.T) {
+	cfg := config.Default
+	cfg.Restore = false
+	storage := Create(context.Background(), &cfg, nil, logger.CreateMock())
+
+	subscription := storage.Subscribe(watch.Filter{Names: []string{"Alloc", "PollCount", "hist"}})
+	defer subscription.Close()
+
+	gauge := networkmsg.CreateGaugeMetrics("Alloc", 1.5)
+	gauge.Labels = map[string]string{"host": "a"}
+	require.NoError(t, storage.AddMetricMessageInStorage(&gauge))
+	require.NoError(t, storage.AddGauge("Skipped", 1))
+	require.NoError(t, storage.AddCounter("PollCount", 2))
+	require.NoError(t, storage.AddCounter("PollCount", 3))
+
+	value, err := histogram.New([]float64{1})
+	require.NoError(t, err)
+	value.Observe(2)
+	require.NoError(t, storage.AddHistogram("hist", value))
+	require.NoError(t, storage.AddHistogram("hist", value))
+
+	wantGauge := networkmsg.CreateGaugeMetrics("Alloc", 1.5)
+	wantGauge.Labels = map[string]string{"host": "a"}
+	wantHistogram := value.Clone()
+	require.NoError(t, wantHistogram.Merge(value))
+
+	want := []networkmsg.Metric{
+		wantGauge,
+		networkmsg.CreateCounterMetrics("PollCount", 2),
+		networkmsg.CreateCounterMetrics("PollCount", 5),
+		networkmsg.CreateHistogramMetrics("hist", value),
+		networkmsg.CreateHistogramMetrics("hist", wantHistogram),
+	}
+	require.Len(t, subscription.Updates(), len(want))
+	for _, metric := range want {
+		assert.Equal(t, metric, <-subscription.Updates())
+	}
+}
+
 func BenchmarkMemstorage_copyMapFloat(b *testing.B) {
 	size := 1000
 	testMap := generateRandomMapFloat(size)
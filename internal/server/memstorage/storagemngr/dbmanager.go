@@ -6,13 +6,21 @@ package storagemngr
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
 	"github.com/erupshis/metrics/internal/retryer"
 	"github.com/erupshis/metrics/internal/server/config"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -22,19 +30,30 @@ import (
 
 // Constants defining schema and table names.
 const (
-	schemaName    = "metrics"
-	gaugesTable   = "gauges"
-	countersTable = "counters"
-
-	insertStmt = "insert"
-	updateStmt = "update"
-	existStmt  = "exist"
-
-	createDatabaseError = "create db: %w"
-	saveMetricError     = "save metric: %w"
-	saveMetricsError    = "save metrics in db: %w"
-	restoreMetricsError = "restore metrics from db: %w"
-	restoreDataError    = "restore data from db response: %w"
+	schemaName      = "metrics"
+	gaugesTable     = "gauges"
+	countersTable   = "counters"
+	historyTable    = "history"
+	histogramsTable = "histograms"
+	totalsTable     = "counter_totals"
+
+	metricsInsertChunkSize   = 1000
+	historyInsertChunkSize   = 1000
+	histogramInsertChunkSize = 1000
+	metricsDeleteChunkSize   = 1000
+
+	createDatabaseError    = "create db: %w"
+	saveMetricsError       = "save metrics in db: %w"
+	restoreMetricsError    = "restore metrics from db: %w"
+	restoreDataError       = "restore data from db response: %w"
+	deleteMetricsError     = "delete metrics from db: %w"
+	saveHistogramsError    = "save histograms in db: %w"
+	restoreHistogramsError = "restore histograms from db: %w"
+	saveHistoryError       = "save history in db: %w"
+	restoreHistoryError    = "restore history from db: %w"
+
+	saveCounterTotalsError    = "save counter totals: %w"
+	restoreCounterTotalsError = "restore counter totals: %w"
 )
 
 // DatabaseErrorsToRetry is a list of database errors that are considered retryable.
@@ -54,6 +73,21 @@ var DatabaseErrorsToRetry = []error{
 type DataBaseManager struct {
 	database *sql.DB
 	log      logger.BaseLogger
+
+	muHistory    sync.Mutex
+	historySaved map[historyKey][]time.Time // ordered timestamps of the stored samples of metrics.
+}
+
+// historyKey identifies samples history of the metric in the database.
+type historyKey struct {
+	valueType string
+	name      string
+}
+
+// historyRow is a sample of the metric inserted in the history table.
+type historyRow struct {
+	name   string
+	sample history.Sample
 }
 
 // CreateDataBaseManager creates a new instance of DataBaseManager, initializes the database, and performs migrations.
@@ -104,85 +138,210 @@ func (m *DataBaseManager) CheckConnection(ctx context.Context) (bool, error) {
 	return true, nil
 }
 
-// SaveMetricsInStorage saves gauge and counter metric values in the PostgreSQL database.
-func (m *DataBaseManager) SaveMetricsInStorage(ctx context.Context, gaugesValues map[string]interface{}, countersValues map[string]interface{}) error {
-	// m.log.Info(logSaveMetricsInStorageStart)
+// SaveDataInStorage saves all metrics data in the PostgreSQL database in one transaction.
+// Samples older than the oldest one in the provided history are removed from the database.
+func (m *DataBaseManager) SaveDataInStorage(ctx context.Context, data *Data) error {
+	return m.saveData(ctx, data, true)
+}
 
-	tx, err := m.database.BeginTx(ctx, nil)
-	if err != nil {
-		return fmt.Errorf(saveMetricsError, err)
-	}
+// SaveDataDeltaInStorage saves data of changed metrics in the PostgreSQL database in one transaction.
+// Rows of other metrics are not affected, outdated samples are removed on the next SaveDataInStorage call.
+func (m *DataBaseManager) SaveDataDeltaInStorage(ctx context.Context, data *Data) error {
+	return m.saveData(ctx, data, false)
+}
 
-	if err = m.saveMetrics(ctx, tx, gaugesTable, gaugesValues); err != nil {
-		_ = tx.Rollback()
-		return fmt.Errorf(saveMetricsError, err)
-	}
+// saveData upserts metrics, counter totals and histograms and inserts samples history which was not saved previously.
+// History is kept untouched if it isn't provided.
+func (m *DataBaseManager) saveData(ctx context.Context, data *Data, removeOutdated bool) error {
+	var saved map[historyKey][]time.Time
+	exec := func(context context.Context, tx *sql.Tx) error {
+		if err := saveMetrics(context, tx, gaugesTable, data.Gauges); err != nil {
+			return fmt.Errorf(saveMetricsError, err)
+		}
+		if err := saveMetrics(context, tx, countersTable, data.Counters); err != nil {
+			return fmt.Errorf(saveMetricsError, err)
+		}
+		if err := saveTotals(context, tx, data.CounterTotals); err != nil {
+			return fmt.Errorf(saveCounterTotalsError, err)
+		}
+		if err := saveHistograms(context, tx, data.Histograms); err != nil {
+			return fmt.Errorf(saveHistogramsError, err)
+		}
+		if data.GaugesHistory == nil && data.CountersHistory == nil {
+			return nil
+		}
 
-	if err = m.saveMetrics(ctx, tx, countersTable, countersValues); err != nil {
-		_ = tx.Rollback()
-		return fmt.Errorf(saveMetricsError, err)
+		// timestamps of the stored samples are collected anew by every attempt of transaction.
+		saved = map[historyKey][]time.Time{}
+		if err := m.storeHistory(context, tx, data, removeOutdated, saved); err != nil {
+			return fmt.Errorf(saveHistoryError, err)
+		}
+		return nil
+	}
+	if err := m.inTx(ctx, exec); err != nil {
+		return err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf(saveMetricsError, err)
+	m.muHistory.Lock()
+	defer m.muHistory.Unlock()
+	if m.historySaved == nil {
+		m.historySaved = map[historyKey][]time.Time{}
+	}
+	for key, timestamps := range saved {
+		m.historySaved[key] = timestamps
 	}
 
-	// m.log.Info(logSaveMetricsInStorageCompleted)
 	return nil
 }
 
+// inTx executes statements in one transaction. Statements can't be retried inside the transaction aborted by
+// an error, so the failed transaction is rolled back and retried as a whole.
+func (m *DataBaseManager) inTx(ctx context.Context, exec func(context.Context, *sql.Tx) error) error {
+	call := func(context context.Context) error {
+		tx, err := m.database.BeginTx(context, nil)
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+
+		if err = exec(context, tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("commit transaction: %w", err)
+		}
+		return nil
+	}
+	return retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, call)
+}
+
 // RestoreDataFromStorage retrieves and restores stored metric data from the PostgreSQL database.
 func (m *DataBaseManager) RestoreDataFromStorage(ctx context.Context) (map[string]float64, map[string]int64, error) {
-	gauges := map[string]float64{}
-	counters := map[string]int64{}
+	var gauges map[string]float64
+	var counters map[string]int64
 
 	m.log.Info("[DataBaseManager:RestoreDataFromStorage] start transaction")
-	tx, err := m.database.BeginTx(ctx, nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf(restoreMetricsError, err)
+	exec := func(context context.Context, tx *sql.Tx) error {
+		gauges = map[string]float64{}
+		counters = map[string]int64{}
+		if err := m.restoreDataInMap(context, tx, gaugesTable, gauges); err != nil {
+			return err
+		}
+		return m.restoreDataInMap(context, tx, countersTable, counters)
 	}
-
-	if err = m.restoreDataInMap(ctx, tx, gaugesTable, gauges); err != nil {
-		_ = tx.Rollback()
+	if err := m.inTx(ctx, exec); err != nil {
 		return nil, nil, fmt.Errorf(restoreMetricsError, err)
 	}
 
-	if err = m.restoreDataInMap(ctx, tx, countersTable, counters); err != nil {
-		_ = tx.Rollback()
-		return nil, nil, fmt.Errorf(restoreMetricsError, err)
+	m.log.Info("[DataBaseManager:RestoreDataFromStorage] transaction completed")
+	return gauges, counters, nil
+}
+
+// DeleteMetricsFromStorage removes gauge, counter and histogram metrics with the specified keys
+// and samples history of removed gauges and counters from the PostgreSQL database in one transaction.
+func (m *DataBaseManager) DeleteMetricsFromStorage(ctx context.Context, gaugeKeys []string, counterKeys []string, histogramKeys []string) error {
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	deletes := []struct {
+		table  string
+		keys   []string
+		filter sq.Sqlizer
+	}{
+		{gaugesTable, gaugeKeys, nil},
+		{countersTable, counterKeys, nil},
+		{histogramsTable, histogramKeys, nil},
+		{totalsTable, counterKeys, nil},
+		{historyTable, gaugeKeys, sq.Eq{"type": gaugeType}},
+		{historyTable, counterKeys, sq.Eq{"type": counterType}},
+	}
+	exec := func(context context.Context, tx *sql.Tx) error {
+		for _, del := range deletes {
+			if err := deleteRows(context, tx, psql, del.table, del.keys, del.filter); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := m.inTx(ctx, exec); err != nil {
+		return fmt.Errorf(deleteMetricsError, err)
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return nil, nil, fmt.Errorf(restoreMetricsError, err)
+	m.muHistory.Lock()
+	defer m.muHistory.Unlock()
+	for _, key := range gaugeKeys {
+		delete(m.historySaved, historyKey{valueType: gaugeType, name: key})
+	}
+	for _, key := range counterKeys {
+		delete(m.historySaved, historyKey{valueType: counterType, name: key})
 	}
 
-	m.log.Info("[DataBaseManager:RestoreDataFromStorage] transaction completed")
-	return gauges, counters, nil
+	return nil
 }
 
-// restoreDataInMap populates the provided mapDest with data from the specified database table.
-func (m *DataBaseManager) restoreDataInMap(ctx context.Context, tx *sql.Tx, tableName string, mapDest interface{}) error {
-	var err error
-	var rows *sql.Rows
-	if rows != nil {
-		// get rid of static check problem
-		err = rows.Err()
+// deleteRows removes rows with the specified ids from the table in chunks. Optional filter narrows removed rows.
+func deleteRows(ctx context.Context, tx *sql.Tx, psql sq.StatementBuilderType, table string, keys []string, filter sq.Sqlizer) error {
+	for start := 0; start < len(keys); start += metricsDeleteChunkSize {
+		end := start + metricsDeleteChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
 
+		builder := psql.Delete(schemaName + "." + table).Where(sq.Eq{"id": keys[start:end]})
+		if filter != nil {
+			builder = builder.Where(filter)
+		}
+
+		sqlDelete, args, err := builder.ToSql()
+		if err != nil {
+			return fmt.Errorf("squirrel sql statement: %w", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, sqlDelete, args...); err != nil {
+			return fmt.Errorf("delete rows from '%s': %w", table, err)
+		}
 	}
 
-	if err != nil {
-		return err
+	return nil
+}
+
+// saveHistograms upserts histogram metric values in chunks.
+func saveHistograms(ctx context.Context, tx *sql.Tx, histograms map[string]*histogram.Histogram) error {
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	// the same rows order in concurrent transactions prevents deadlocks.
+	sort.Strings(keys)
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	for start := 0; start < len(keys); start += histogramInsertChunkSize {
+		end := start + histogramInsertChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		if err := upsertHistograms(ctx, tx, psql, keys[start:end], histograms); err != nil {
+			return err
+		}
 	}
 
+	return nil
+}
+
+// RestoreHistogramsFromStorage retrieves stored histogram metric values from the PostgreSQL database.
+func (m *DataBaseManager) RestoreHistogramsFromStorage(ctx context.Context) (map[string]*histogram.Histogram, error) {
+	histograms := map[string]*histogram.Histogram{}
+
+	var rows *sql.Rows
 	query := func(context context.Context) error {
-		sqlSelect, _, errQuery := sq.Select("*").From(schemaName + "." + tableName).ToSql()
+		sqlSelect, _, errQuery := sq.Select("id", "value").
+			From(schemaName + "." + histogramsTable).
+			ToSql()
 		if errQuery != nil {
-			return fmt.Errorf("restore metrics: %w", errQuery)
+			return fmt.Errorf("squirrel sql statement: %w", errQuery)
 		}
 
-		rows, errQuery = tx.QueryContext(ctx, sqlSelect)
+		rows, errQuery = m.database.QueryContext(context, sqlSelect)
 		if rows != nil {
 			// get rid of static check problem
 			_ = rows.Err()
@@ -190,9 +349,9 @@ func (m *DataBaseManager) restoreDataInMap(ctx context.Context, tx *sql.Tx, tabl
 		return errQuery
 	}
 
-	err = retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, query)
+	err := retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, query)
 	if err != nil {
-		return fmt.Errorf(restoreDataError, err)
+		return nil, fmt.Errorf(restoreHistogramsError, err)
 	}
 	defer func() {
 		if err = rows.Close(); err != nil {
@@ -201,212 +360,415 @@ func (m *DataBaseManager) restoreDataInMap(ctx context.Context, tx *sql.Tx, tabl
 	}()
 
 	for rows.Next() {
-		switch dest := mapDest.(type) {
-		case map[string]float64:
-			var name string
-			var value float64
-			err = rows.Scan(&name, &value)
-			if err != nil {
-				return fmt.Errorf(restoreDataError, err)
-			}
-
-			dest[name] = value
-		case map[string]int64:
-			var name string
-			var value int64
-			err = rows.Scan(&name, &value)
-			if err != nil {
-				return fmt.Errorf(restoreDataError, err)
-			}
+		var key string
+		var value []byte
+		if err = rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf(restoreHistogramsError, err)
+		}
 
-			dest[name] = value
-		default:
-			panic("Unknown value type")
+		var hist histogram.Histogram
+		if err = json.Unmarshal(value, &hist); err != nil {
+			return nil, fmt.Errorf(restoreHistogramsError, err)
 		}
+		histograms[key] = &hist
 	}
 
-	err = rows.Err()
-	if err != nil {
-		return fmt.Errorf(restoreDataError, err)
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf(restoreHistogramsError, err)
 	}
-	return nil
+	return histograms, nil
 }
 
-// saveMetrics saves the provided metricsValues in the specified database table using a transaction.
-func (m *DataBaseManager) saveMetrics(ctx context.Context, tx *sql.Tx, metricTable string, metricsValues map[string]interface{}) error {
-	requestStmts, err := createDatabaseStmts(ctx, tx, metricTable)
+// upsertHistograms inserts histograms with the specified keys or replaces values of already stored ones.
+func upsertHistograms(ctx context.Context, tx *sql.Tx, psql sq.StatementBuilderType, keys []string, histograms map[string]*histogram.Histogram) error {
+	builder := psql.Insert(schemaName+"."+histogramsTable).Columns("id", "name", "labels", "value")
+	for _, key := range keys {
+		name, labels, err := splitSeriesKey(key)
+		if err != nil {
+			return fmt.Errorf("upsert histogram '%s': %w", key, err)
+		}
+
+		value, err := json.Marshal(histograms[key])
+		if err != nil {
+			return fmt.Errorf("marshal histogram '%s': %w", key, err)
+		}
+
+		builder = builder.Values(key, name, labels, string(value))
+	}
+
+	sqlInsert, args, err := builder.Suffix("ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value").ToSql()
 	if err != nil {
-		return fmt.Errorf("create stmt: %w", err)
+		return fmt.Errorf("squirrel sql statement: %w", err)
 	}
-	defer closeDatabaseStmts(requestStmts)
 
-	for key, value := range metricsValues {
-		if err = m.saveMetric(ctx, requestStmts, key, value); err != nil {
-			return fmt.Errorf("use stmt: %w", err)
+	_, err = tx.ExecContext(ctx, sqlInsert, args...)
+	return err
+}
+
+// storeHistory inserts new samples of gauges and counters and optionally removes outdated ones.
+// Timestamps of the provided samples are put in saved.
+func (m *DataBaseManager) storeHistory(ctx context.Context, tx *sql.Tx, data *Data, removeOutdated bool, saved map[historyKey][]time.Time) error {
+	typedHistory := []struct {
+		valueType      string
+		metricsHistory map[string][]history.Sample
+	}{
+		{gaugeType, data.GaugesHistory},
+		{counterType, data.CountersHistory},
+	}
+	for _, typed := range typedHistory {
+		if err := m.saveHistory(ctx, tx, typed.valueType, typed.metricsHistory, saved); err != nil {
+			return err
+		}
+
+		if !removeOutdated {
+			continue
+		}
+
+		if err := deleteOutdatedSamples(ctx, tx, typed.valueType, typed.metricsHistory); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-// saveMetric saves a single metric with the specified name and value using database statements.
-func (m *DataBaseManager) saveMetric(ctx context.Context, stmts map[string]*sql.Stmt, name string, value interface{}) error {
-	exists, err := m.checkMetricExists(ctx, stmts[existStmt], name, value)
-	if err != nil {
-		return fmt.Errorf(saveMetricError, err)
+// saveTotals upserts counter totals in chunks.
+func saveTotals(ctx context.Context, tx *sql.Tx, totals map[string]int64) error {
+	keys := make([]string, 0, len(totals))
+	for key := range totals {
+		keys = append(keys, key)
 	}
+	// the same rows order in concurrent transactions prevents deadlocks.
+	sort.Strings(keys)
 
-	if exists {
-		err = m.updateMetric(ctx, stmts[updateStmt], name, value)
-	} else {
-		err = m.insertMetric(ctx, stmts[insertStmt], name, value)
-	}
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	for start := 0; start < len(keys); start += metricsInsertChunkSize {
+		end := start + metricsInsertChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
 
-	if err != nil {
-		return fmt.Errorf(saveMetricError, err)
+		builder := psql.Insert(schemaName+"."+totalsTable).Columns("id", "value")
+		for _, key := range keys[start:end] {
+			builder = builder.Values(key, totals[key])
+		}
+
+		sqlInsert, args, err := builder.Suffix("ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value").ToSql()
+		if err != nil {
+			return fmt.Errorf("squirrel sql statement: %w", err)
+		}
+
+		if _, err = tx.ExecContext(ctx, sqlInsert, args...); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// checkMetricExists checks if a metric with the specified name already exists in the database.
-func (m *DataBaseManager) checkMetricExists(ctx context.Context, stmt *sql.Stmt, name string, _ interface{}) (bool, error) {
-	var exists bool
-	var err error
+// RestoreCounterTotalsFromStorage retrieves stored totals of cumulative counters from the PostgreSQL database.
+func (m *DataBaseManager) RestoreCounterTotalsFromStorage(ctx context.Context) (map[string]int64, error) {
+	var totals map[string]int64
+	exec := func(context context.Context, tx *sql.Tx) error {
+		totals = map[string]int64{}
+		return m.restoreDataInMap(context, tx, totalsTable, totals)
+	}
+	if err := m.inTx(ctx, exec); err != nil {
+		return nil, fmt.Errorf(restoreCounterTotalsError, err)
+	}
+	return totals, nil
+}
+
+// RestoreHistoryFromStorage retrieves stored metric samples history from the PostgreSQL database.
+func (m *DataBaseManager) RestoreHistoryFromStorage(ctx context.Context) (map[string][]history.Sample, map[string][]history.Sample, error) {
+	gaugesHistory := map[string][]history.Sample{}
+	countersHistory := map[string][]history.Sample{}
 
+	var rows *sql.Rows
 	query := func(context context.Context) error {
-		return stmt.QueryRowContext(ctx, name).Scan(&exists)
+		sqlSelect, _, errQuery := sq.Select("id", "type", "ts", "value").
+			From(schemaName + "." + historyTable).
+			OrderBy("ts").
+			ToSql()
+		if errQuery != nil {
+			return fmt.Errorf("squirrel sql statement: %w", errQuery)
+		}
+
+		rows, errQuery = m.database.QueryContext(context, sqlSelect)
+		if rows != nil {
+			// get rid of static check problem
+			_ = rows.Err()
+		}
+		return errQuery
 	}
-	err = retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, query)
+
+	err := retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, query)
 	if err != nil {
-		err = fmt.Errorf("exists metric check: %w", err)
+		return nil, nil, fmt.Errorf(restoreHistoryError, err)
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			m.log.Info("close query res: %v", err)
+		}
+	}()
+
+	for rows.Next() {
+		var name, valueType string
+		var sample history.Sample
+		if err = rows.Scan(&name, &valueType, &sample.Timestamp, &sample.Value); err != nil {
+			return nil, nil, fmt.Errorf(restoreHistoryError, err)
+		}
+
+		switch valueType {
+		case gaugeType:
+			gaugesHistory[name] = append(gaugesHistory[name], sample)
+		case counterType:
+			countersHistory[name] = append(countersHistory[name], sample)
+		}
 	}
 
-	return exists, err
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf(restoreHistoryError, err)
+	}
+	return gaugesHistory, countersHistory, nil
 }
 
-// insertMetric inserts a new metric with the specified name and value into the database.
-func (m *DataBaseManager) insertMetric(ctx context.Context, stmt *sql.Stmt, name string, value interface{}) error {
-	var err error
-	tableName := getMetricsTableName(value)
-	if tableName == gaugesTable {
-		exec := func(context context.Context) error {
-			_, err = stmt.ExecContext(context, name, *value.(*float64))
-			return err
+// saveHistory inserts samples of metrics with the specified value type which were not saved previously,
+// including samples registered out of order before the saved ones. Timestamps of the provided samples are put in saved.
+func (m *DataBaseManager) saveHistory(ctx context.Context, tx *sql.Tx, valueType string, metricsHistory map[string][]history.Sample, saved map[historyKey][]time.Time) error {
+	var rows []historyRow
+	m.muHistory.Lock()
+	for name, samples := range metricsHistory {
+		if len(samples) == 0 {
+			continue
 		}
-		err = retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, exec)
-	} else {
-		exec := func(context context.Context) error {
-			_, err = stmt.ExecContext(context, name, *value.(*int64))
-			return err
+
+		key := historyKey{valueType: valueType, name: name}
+		stored := m.historySaved[key]
+		timestamps := make([]time.Time, 0, len(samples))
+		for _, sample := range samples {
+			// both samples and stored timestamps are ordered, so stored ones are walked once.
+			for len(stored) > 0 && stored[0].Before(sample.Timestamp) {
+				stored = stored[1:]
+			}
+			if len(stored) > 0 && stored[0].Equal(sample.Timestamp) {
+				stored = stored[1:]
+			} else {
+				rows = append(rows, historyRow{name: name, sample: sample})
+			}
+			timestamps = append(timestamps, sample.Timestamp)
 		}
-		err = retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, exec)
+		saved[key] = timestamps
 	}
+	m.muHistory.Unlock()
 
-	if err != nil {
-		return fmt.Errorf("insert new metric name '%s', value '%s', table '%v': %w", name, value, tableName, err)
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	for start := 0; start < len(rows); start += historyInsertChunkSize {
+		end := start + historyInsertChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		if err := insertSamples(ctx, tx, psql, valueType, rows[start:end]); err != nil {
+			return fmt.Errorf("insert %s samples: %w", valueType, err)
+		}
 	}
+
 	return nil
 }
 
-// updateMetric updates an existing metric with the specified name and value in the database.
-func (m *DataBaseManager) updateMetric(ctx context.Context, stmt *sql.Stmt, name string, value interface{}) error {
-	var err error
-	tableName := getMetricsTableName(value)
-	if tableName == gaugesTable {
-		exec := func(context context.Context) error {
-			_, err = stmt.ExecContext(context, *value.(*float64), name)
-			return err
+// deleteOutdatedSamples removes samples of metrics with the specified value type registered before the oldest
+// sample in the provided history. Metrics are handled in chunks by one statement per chunk.
+func deleteOutdatedSamples(ctx context.Context, tx *sql.Tx, valueType string, metricsHistory map[string][]history.Sample) error {
+	names := make([]string, 0, len(metricsHistory))
+	for name, samples := range metricsHistory {
+		if len(samples) > 0 {
+			names = append(names, name)
 		}
-		err = retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, exec)
-	} else {
-		exec := func(context context.Context) error {
-			_, err = stmt.ExecContext(context, *value.(*int64), name)
-			return err
-		}
-		err = retryer.RetryCallWithTimeout(ctx, m.log, nil, DatabaseErrorsToRetry, exec)
 	}
+	sort.Strings(names)
 
-	if err != nil {
-		return fmt.Errorf("update metric name '%s', value '%s', table '%v': %w", name, value, tableName, err)
+	for start := 0; start < len(names); start += metricsDeleteChunkSize {
+		end := start + metricsDeleteChunkSize
+		if end > len(names) {
+			end = len(names)
+		}
+
+		var sb strings.Builder
+		args := []interface{}{valueType}
+		sb.WriteString("DELETE FROM " + schemaName + "." + historyTable + " AS h USING (VALUES ")
+		for i, name := range names[start:end] {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(&sb, "($%d, $%d::timestamptz)", len(args)+1, len(args)+2)
+			args = append(args, name, metricsHistory[name][0].Timestamp)
+		}
+		sb.WriteString(") AS b (id, border) WHERE h.type = $1 AND h.id = b.id AND h.ts < b.border")
+		if _, err := tx.ExecContext(ctx, sb.String(), args...); err != nil {
+			return fmt.Errorf("delete outdated %s samples: %w", valueType, err)
+		}
 	}
+
 	return nil
 }
 
-// getMetricsTableName determines the database table name based on the type of the metric value.
-func getMetricsTableName(value interface{}) string {
-	switch value.(type) {
-	case *int64:
-		return countersTable
-	case *float64:
-		return gaugesTable
-	default:
-		panic("unknown value type")
+// insertSamples inserts samples of metrics with the specified value type skipping already stored ones.
+func insertSamples(ctx context.Context, tx *sql.Tx, psql sq.StatementBuilderType, valueType string, rows []historyRow) error {
+	builder := psql.Insert(schemaName+"."+historyTable).Columns("id", "type", "ts", "value")
+	for _, row := range rows {
+		builder = builder.Values(row.name, valueType, row.sample.Timestamp, row.sample.Value)
 	}
+
+	sqlInsert, args, err := builder.Suffix("ON CONFLICT DO NOTHING").ToSql()
+	if err != nil {
+		return fmt.Errorf("squirrel sql statement: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, sqlInsert, args...)
+	return err
 }
 
-// createDatabaseStmts prepares and returns a map of SQL statements for the specified metric table.
-func createDatabaseStmts(ctx context.Context, tx *sql.Tx, metricTable string) (map[string]*sql.Stmt, error) {
-	existStmtBody, err := createExistsStmt(ctx, tx, metricTable)
+// restoreDataInMap populates the provided mapDest with data from the specified database table.
+func (m *DataBaseManager) restoreDataInMap(ctx context.Context, tx *sql.Tx, tableName string, mapDest interface{}) error {
+	var err error
+	var rows *sql.Rows
+	if rows != nil {
+		// get rid of static check problem
+		err = rows.Err()
+
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("prepare metric exists statement: %w", err)
+		return err
 	}
 
-	insertStmtBody, err := createInsertStmt(ctx, tx, metricTable)
+	sqlSelect, _, err := sq.Select("id", "value").From(schemaName + "." + tableName).ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("prepare metric insert statement: %w", err)
+		return fmt.Errorf("restore metrics: %w", err)
 	}
 
-	updateStmtBody, err := createUpdateStmt(ctx, tx, metricTable)
+	rows, err = tx.QueryContext(ctx, sqlSelect)
 	if err != nil {
-		return nil, fmt.Errorf("prepare metric update statement: %w", err)
+		return fmt.Errorf(restoreDataError, err)
 	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			m.log.Info("close query res: %v", err)
+		}
+	}()
 
-	return map[string]*sql.Stmt{
-		existStmt:  existStmtBody,
-		insertStmt: insertStmtBody,
-		updateStmt: updateStmtBody,
-	}, nil
-}
+	for rows.Next() {
+		switch dest := mapDest.(type) {
+		case map[string]float64:
+			var name string
+			var value float64
+			err = rows.Scan(&name, &value)
+			if err != nil {
+				return fmt.Errorf(restoreDataError, err)
+			}
 
-// createExistsStmt prepares and returns an SQL statement to check if a metric exists in the database.
-func createExistsStmt(ctx context.Context, tx *sql.Tx, metricTable string) (*sql.Stmt, error) {
-	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+			dest[name] = value
+		case map[string]int64:
+			var name string
+			var value int64
+			err = rows.Scan(&name, &value)
+			if err != nil {
+				return fmt.Errorf(restoreDataError, err)
+			}
 
-	sqlExist, _, err := psql.Select("1").From(schemaName + "." + metricTable).Where("id = ?").ToSql()
-	if err != nil {
-		return nil, fmt.Errorf("squirrel sql statement: %w", err)
+			dest[name] = value
+		default:
+			panic("Unknown value type")
+		}
+	}
 
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf(restoreDataError, err)
 	}
-	return tx.PrepareContext(ctx, "SELECT EXISTS("+sqlExist+")")
+	return nil
 }
 
-// createInsertStmt prepares and returns an SQL statement to insert a new metric into the database.
-func createInsertStmt(ctx context.Context, tx *sql.Tx, metricTable string) (*sql.Stmt, error) {
-	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+// saveMetrics saves the provided metricsValues in the specified database table.
+// Metrics are upserted in chunks, each chunk is a single INSERT ... ON CONFLICT DO UPDATE statement.
+func saveMetrics(ctx context.Context, tx *sql.Tx, metricTable string, metricsValues map[string]interface{}) error {
+	keys := make([]string, 0, len(metricsValues))
+	for key := range metricsValues {
+		keys = append(keys, key)
+	}
+	// the same rows order in concurrent transactions prevents deadlocks.
+	sort.Strings(keys)
 
-	sqlInsert, _, err := psql.Insert(schemaName+"."+metricTable).Columns("id", "value").Values("(?, ?)", "val").ToSql()
-	if err != nil {
-		return nil, fmt.Errorf("squirrel sql statement: %w", err)
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	for start := 0; start < len(keys); start += metricsInsertChunkSize {
+		end := start + metricsInsertChunkSize
+		if end > len(keys) {
+			end = len(keys)
+		}
 
+		if err := upsertMetrics(ctx, tx, psql, metricTable, keys[start:end], metricsValues); err != nil {
+			return fmt.Errorf("upsert metrics in '%s': %w", metricTable, err)
+		}
 	}
-	return tx.PrepareContext(ctx, sqlInsert)
+
+	return nil
 }
 
-// createUpdateStmt prepares and returns an SQL statement to update an existing metric in the database.
-func createUpdateStmt(ctx context.Context, tx *sql.Tx, metricTable string) (*sql.Stmt, error) {
-	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+// upsertMetrics inserts metrics with the specified keys or updates values of already stored ones.
+// Metric name and labels are stored in separate columns as well.
+func upsertMetrics(ctx context.Context, tx *sql.Tx, psql sq.StatementBuilderType, metricTable string, keys []string, metricsValues map[string]interface{}) error {
+	builder := psql.Insert(schemaName+"."+metricTable).Columns("id", "name", "labels", "value")
+	for _, key := range keys {
+		name, labels, err := splitSeriesKey(key)
+		if err != nil {
+			return fmt.Errorf("upsert metric '%s': %w", key, err)
+		}
 
-	sqlUpdate, _, err := psql.Update(schemaName+"."+metricTable).Set("value", "?").Where("id = ?").ToSql()
+		value, err := getMetricValue(metricsValues[key])
+		if err != nil {
+			return fmt.Errorf("upsert metric '%s': %w", key, err)
+		}
+
+		builder = builder.Values(key, name, labels, value)
+	}
+
+	sqlInsert, args, err := builder.Suffix("ON CONFLICT (id) DO UPDATE SET value = EXCLUDED.value").ToSql()
+	if err != nil {
+		return fmt.Errorf("squirrel sql statement: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, sqlInsert, args...)
+	return err
+}
+
+// splitSeriesKey splits series key into metric name and labels in JSON format.
+func splitSeriesKey(key string) (string, string, error) {
+	name, labels, err := networkmsg.ParseSeriesKey(key)
 	if err != nil {
-		return nil, fmt.Errorf("squirrel sql statement: %w", err)
+		return "", "", fmt.Errorf("split series key: %w", err)
+	}
+
+	if labels == nil {
+		return name, "{}", nil
+	}
 
+	labelsJSON, err := json.Marshal(labels)
+	if err != nil {
+		return "", "", fmt.Errorf("marshal labels: %w", err)
 	}
-	return tx.PrepareContext(ctx, sqlUpdate)
+	return name, string(labelsJSON), nil
 }
 
-// closeDatabaseStmts closes all the SQL statements in the provided map.
-func closeDatabaseStmts(stmts map[string]*sql.Stmt) {
-	for _, stmt := range stmts {
-		_ = stmt.Close()
+// getMetricValue dereferences metric value stored in memstorage.
+func getMetricValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case *int64:
+		return *v, nil
+	case *float64:
+		return *v, nil
+	case int64, float64:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unknown value type %T", value)
 	}
 }
@@ -2,14 +2,21 @@ package storagemngr
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
 )
 
 const (
@@ -20,11 +27,21 @@ const (
 	scanMetricError  = "scan metric: %w"
 
 	openFileError = "open file: %w"
+
+	walFileSuffix = ".wal"
+	tmpFileSuffix = ".tmp"
 )
 
+// Types of file records.
 const (
-	gaugeType   = "gauge"
-	counterType = "counter"
+	gaugeType          = "gauge"
+	counterType        = "counter"
+	histogramType      = "histogram"
+	counterTotalType   = "counter_total"
+	gaugeHistoryType   = "gauge_history"
+	counterHistoryType = "counter_history"
+	snapshotType       = "snapshot"
+	commitType         = "commit"
 )
 
 // fileWriter is responsible for writing metric data to a file.
@@ -39,12 +56,34 @@ type fileScanner struct {
 	scanner *bufio.Scanner
 }
 
+// fileData is metrics data restored from snapshot and WAL files.
+type fileData struct {
+	gauges          map[string]float64
+	counters        map[string]int64
+	totals          map[string]int64
+	histograms      map[string]*histogram.Histogram
+	gaugesHistory   map[string][]history.Sample
+	countersHistory map[string][]history.Sample
+}
+
 // FileManager provides functionality to manage metric storage in a file.
+//
+// Metrics data is kept in snapshot file and append-only write-ahead log (WAL) placed next to it.
+// Full saves replace snapshot atomically and discard WAL, delta saves and removals are appended to WAL
+// as batches of records closed by commit record.
+// On restore committed WAL batches not included in snapshot are replayed on top of it, unfinished batch is skipped.
 type FileManager struct {
 	path    string
 	logger  logger.BaseLogger
 	writer  *fileWriter
 	scanner *fileScanner
+
+	// walSeq is a sequence number of the last batch appended to WAL, walSize is a size of WAL part ending with
+	// the last committed batch. They are loaded from files on the first access if storage wasn't restored.
+	walSeq    uint64
+	walSize   int64
+	walLoaded bool
+	muWAL     sync.Mutex
 }
 
 // CreateFileManager creates a new instance of FileManager with the specified data path and logger.
@@ -63,96 +102,454 @@ func (fm *FileManager) CheckConnection(_ context.Context) (bool, error) {
 	return true, nil
 }
 
-// SaveMetricsInStorage saves gauge and counter metric values in the file.
-func (fm *FileManager) SaveMetricsInStorage(_ context.Context, gaugeValues map[string]interface{}, counterValues map[string]interface{}) error {
-	if !fm.IsFileOpen() {
-		if err := fm.OpenFile(fm.path, true); err != nil {
-			return fmt.Errorf("cannot open file '%s' to save metrics: %w", fm.path, err)
+// SaveDataInStorage saves snapshot of all metrics data in the file.
+// Snapshot is written in temporary file and renamed, so the previous snapshot stays intact if saving fails.
+// Stored samples history is moved in the new snapshot if history isn't provided.
+// WAL is discarded after snapshot is saved, its records are skipped on restore even if removal fails.
+func (fm *FileManager) SaveDataInStorage(_ context.Context, data *Data) error {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
+
+	// snapshot has to cover batches of WAL written before, so their sequence number is loaded first.
+	if err := fm.loadWAL(); err != nil {
+		return fmt.Errorf("save snapshot in file '%s': %w", fm.path, err)
+	}
+
+	if data.GaugesHistory == nil && data.CountersHistory == nil {
+		stored, _, err := fm.restoreData()
+		if err != nil {
+			return fmt.Errorf("save snapshot in file '%s': read history: %w", fm.path, err)
 		}
-		defer func() {
-			if err := fm.CloseFile(); err != nil {
-				fm.logger.Info("[FileManager::SaveMetricsInStorage] failed to close file: %v", err)
-			}
-		}()
+
+		withHistory := *data
+		withHistory.GaugesHistory, withHistory.CountersHistory = stored.gaugesHistory, stored.countersHistory
+		data = &withHistory
 	}
 
-	for name, val := range gaugeValues {
-		if err := fm.WriteMetric(name, val); err != nil {
-			fm.logger.Info("[FileManager::SaveMetricsInStorage] failed to write gauge metric in file. err: %v", err)
+	err := writeFileAtomically(fm.path, func(writer *bufio.Writer) error {
+		encoder := json.NewEncoder(writer)
+		if err := encoder.Encode(&MetricData{ValueType: snapshotType, Seq: fm.walSeq}); err != nil {
+			return fmt.Errorf("write snapshot header: %w", err)
 		}
+		return writeData(encoder, data, 0)
+	})
+	if err != nil {
+		return fmt.Errorf("save snapshot in file '%s': %w", fm.path, err)
+	}
+
+	if err = os.Remove(fm.walPath()); err != nil && !os.IsNotExist(err) {
+		fm.logger.Info("[FileManager::SaveDataInStorage] failed to remove WAL: %v", err)
+	} else {
+		fm.walSize = 0
 	}
 
-	for name, val := range counterValues {
-		if err := fm.WriteMetric(name, val); err != nil {
-			fm.logger.Info("[FileManager::SaveMetricsInStorage] failed to write counter metric in file. err: %v", err)
+	fm.logger.Info("[FileManager::SaveDataInStorage] storage successfully saved in file: %s", fm.path)
+	return nil
+}
+
+// SaveDataDeltaInStorage appends data of changed metrics to the WAL file as one batch.
+// WAL is synced on disk before return.
+func (fm *FileManager) SaveDataDeltaInStorage(_ context.Context, data *Data) error {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
+
+	err := fm.appendWAL(func(encoder *json.Encoder, seq uint64) error {
+		return writeData(encoder, data, seq)
+	})
+	if err != nil {
+		return fmt.Errorf("save data delta: %w", err)
+	}
+
+	fm.logger.Info("[FileManager::SaveDataDeltaInStorage] storage delta successfully saved in file: %s", fm.walPath())
+	return nil
+}
+
+// DeleteMetricsFromStorage appends removal records of gauges, counters and histograms to the WAL file as one batch.
+// Removal of gauge or counter drops its samples history and total as well.
+func (fm *FileManager) DeleteMetricsFromStorage(_ context.Context, gaugeKeys []string, counterKeys []string, histogramKeys []string) error {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
+
+	err := fm.appendWAL(func(encoder *json.Encoder, seq uint64) error {
+		deletes := []struct {
+			valueType string
+			keys      []string
+		}{{gaugeType, gaugeKeys}, {counterType, counterKeys}, {histogramType, histogramKeys}}
+
+		for _, d := range deletes {
+			for _, key := range d.keys {
+				record, err := newRecord(key, d.valueType, seq)
+				if err != nil {
+					return err
+				}
+
+				record.Deleted = true
+				if err = encoder.Encode(record); err != nil {
+					return fmt.Errorf(writeMetricError, err)
+				}
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete metrics: %w", err)
 	}
 
-	fm.logger.Info("[FileManager::SaveMetricsInStorage] storage successfully saved in file: %s", fm.path)
+	fm.logger.Info("[FileManager::DeleteMetricsFromStorage] metrics successfully deleted from file: %s", fm.path)
 	return nil
 }
 
-// RestoreDataFromStorage reads metric data from the file and restores it.
-func (fm *FileManager) RestoreDataFromStorage(_ context.Context) (map[string]float64, map[string]int64, error) {
-	gauges := map[string]float64{}
-	counters := map[string]int64{}
+// appendWAL appends batch of records written by write with the next sequence number and its commit record to the WAL file.
+// Unfinished batch left by crash or failed append is truncated first. WAL is synced on disk before return. Caller must hold muWAL.
+func (fm *FileManager) appendWAL(write func(encoder *json.Encoder, seq uint64) error) error {
+	if err := fm.loadWAL(); err != nil {
+		return err
+	}
 
-	if !fm.IsFileOpen() {
-		if err := fm.OpenFile(fm.path, false); err != nil {
-			return gauges, counters, fmt.Errorf("cannot open file '%s' to read metrics: %w", fm.path, err)
+	path := fm.walPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create WAL directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("cannot open WAL file '%s': %w", path, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fm.logger.Info("[FileManager::appendWAL] failed to close file: %v", err)
+		}
+	}()
+
+	if err = file.Truncate(fm.walSize); err != nil {
+		return fmt.Errorf("truncate WAL file '%s': %w", path, err)
+	}
+
+	if _, err = file.Seek(fm.walSize, io.SeekStart); err != nil {
+		return fmt.Errorf("seek WAL file '%s': %w", path, err)
+	}
+
+	// sequence number isn't reused even if batch isn't written.
+	fm.walSeq++
+	batch := bytes.Buffer{}
+	encoder := json.NewEncoder(&batch)
+	if err = write(encoder, fm.walSeq); err != nil {
+		return fmt.Errorf("append WAL file '%s': %w", path, err)
+	}
+
+	if err = encoder.Encode(&MetricData{ValueType: commitType, Seq: fm.walSeq}); err != nil {
+		return fmt.Errorf("append WAL file '%s': %w", path, err)
+	}
+
+	if _, err = file.Write(batch.Bytes()); err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		if errTruncate := file.Truncate(fm.walSize); errTruncate != nil {
+			fm.logger.Info("[FileManager::appendWAL] failed to truncate unfinished batch: %v", errTruncate)
 		}
-		defer func() {
-			if err := fm.CloseFile(); err != nil {
-				fm.logger.Info("[FileManager::RestoreDataFromStorage] failed to close file: %v", err)
+		return fmt.Errorf("append WAL file '%s': %w", path, err)
+	}
+
+	fm.walSize += int64(batch.Len())
+	return nil
+}
+
+// loadWAL reads the last WAL sequence number and size of committed WAL part from files if they aren't loaded yet.
+// Caller must hold muWAL.
+func (fm *FileManager) loadWAL() error {
+	if fm.walLoaded {
+		return nil
+	}
+
+	if _, _, err := fm.restoreData(); err != nil {
+		return fmt.Errorf("load WAL: %w", err)
+	}
+	return nil
+}
+
+// writeData writes records of metrics data with sequence number seq.
+func writeData(encoder *json.Encoder, data *Data, seq uint64) error {
+	for _, values := range []map[string]interface{}{data.Gauges, data.Counters} {
+		for key, value := range values {
+			record, err := newMetricRecord(key, value, seq)
+			if err != nil {
+				return err
+			}
+
+			if err = encoder.Encode(record); err != nil {
+				return fmt.Errorf(writeMetricError, err)
 			}
-		}()
+		}
+	}
+
+	for key, total := range data.CounterTotals {
+		record, err := newRecord(key, counterTotalType, seq)
+		if err != nil {
+			return err
+		}
+
+		record.Value = strconv.FormatInt(total, 10)
+		if err = encoder.Encode(record); err != nil {
+			return fmt.Errorf(writeMetricError, err)
+		}
 	}
 
-	failedToReadMetricsCount := 0
-	metric, err := fm.ScanMetric()
-	for metric != nil {
+	for key, value := range data.Histograms {
+		record, err := newRecord(key, histogramType, seq)
 		if err != nil {
-			fm.logger.Info("[FileManager::RestoreDataFromStorage] failed to scan metric '%s' from file '%s'", metric.Name, fm.path)
-			failedToReadMetricsCount++
+			return err
+		}
 
-		} else {
-			fm.parseMetric(metric, &gauges, &counters)
+		record.Histogram = value
+		if err = encoder.Encode(record); err != nil {
+			return fmt.Errorf(writeMetricError, err)
+		}
+	}
+
+	histories := []struct {
+		valueType string
+		history   map[string][]history.Sample
+	}{{gaugeHistoryType, data.GaugesHistory}, {counterHistoryType, data.CountersHistory}}
+
+	for _, h := range histories {
+		for key, samples := range h.history {
+			record, err := newRecord(key, h.valueType, seq)
+			if err != nil {
+				return err
+			}
+
+			record.Samples = samples
+			if err = encoder.Encode(record); err != nil {
+				return fmt.Errorf(writeMetricError, err)
+			}
 		}
+	}
+	return nil
+}
+
+// RestoreDataFromStorage reads gauge and counter metric values from the snapshot file and replays WAL on top of it.
+// Missing files are not considered as an error. Unfinished last batch of WAL is skipped as it may be left by crash.
+func (fm *FileManager) RestoreDataFromStorage(_ context.Context) (map[string]float64, map[string]int64, error) {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
 
-		metric, err = fm.ScanMetric()
+	data, failedToReadMetricsCount, err := fm.restoreData()
+	if err != nil {
+		return data.gauges, data.counters, err
 	}
 
-	fm.logger.Info("[FileManager::restoreDataFromFileIfNeed] storage successfully restored from file: '%s', failed to read metrics: '%d'",
+	fm.logger.Info("[FileManager::RestoreDataFromStorage] storage successfully restored from file: '%s', failed to read metrics: '%d'",
 		fm.path, failedToReadMetricsCount)
 
-	err = nil
 	if failedToReadMetricsCount > 0 {
 		err = fmt.Errorf("some metrics weren't read from file, count: '%d'", failedToReadMetricsCount)
 	}
 
-	return gauges, counters, err
+	return data.gauges, data.counters, err
+}
+
+// RestoreHistogramsFromStorage reads histogram metric values from the snapshot and WAL files.
+func (fm *FileManager) RestoreHistogramsFromStorage(_ context.Context) (map[string]*histogram.Histogram, error) {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
+
+	data, _, err := fm.restoreData()
+	return data.histograms, err
+}
+
+// RestoreCounterTotalsFromStorage reads totals of cumulative counters from the snapshot and WAL files.
+func (fm *FileManager) RestoreCounterTotalsFromStorage(_ context.Context) (map[string]int64, error) {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
+
+	data, _, err := fm.restoreData()
+	return data.totals, err
+}
+
+// RestoreHistoryFromStorage reads metric samples history from the snapshot and WAL files.
+func (fm *FileManager) RestoreHistoryFromStorage(_ context.Context) (map[string][]history.Sample, map[string][]history.Sample, error) {
+	fm.muWAL.Lock()
+	defer fm.muWAL.Unlock()
+
+	data, _, err := fm.restoreData()
+	return data.gaugesHistory, data.countersHistory, err
 }
 
-// parseMetric parses the MetricData and updates the provided gauge and counter maps accordingly.
-func (fm *FileManager) parseMetric(metric *MetricData, gauges *map[string]float64, counters *map[string]int64) {
-	switch metric.ValueType {
+// restoreData reads snapshot and WAL files and sets the last WAL sequence number and size of its committed part.
+// Caller must hold muWAL. It returns restored data and count of records failed to read.
+func (fm *FileManager) restoreData() (*fileData, int, error) {
+	data := &fileData{
+		gauges:          map[string]float64{},
+		counters:        map[string]int64{},
+		totals:          map[string]int64{},
+		histograms:      map[string]*histogram.Histogram{},
+		gaugesHistory:   map[string][]history.Sample{},
+		countersHistory: map[string][]history.Sample{},
+	}
+
+	snapshotSeq, _, failedSnapshot, err := fm.replayFile(fm.path, 0, data)
+	if err != nil {
+		return data, failedSnapshot, err
+	}
+
+	walSeq, walSize, failedWAL, err := fm.replayFile(fm.walPath(), snapshotSeq, data)
+	if err != nil {
+		return data, failedSnapshot + failedWAL, err
+	}
+
+	fm.walSeq = snapshotSeq
+	if walSeq > fm.walSeq {
+		fm.walSeq = walSeq
+	}
+	fm.walSize = walSize
+	fm.walLoaded = true
+
+	return data, failedSnapshot + failedWAL, nil
+}
+
+// replayFile applies records of the file to data.
+// Records without sequence number are snapshot ones and are applied at once. Other records are applied by batches
+// on commit record if sequence number of batch is greater than minSeq. Records following the last complete
+// snapshot record or commit are considered as crash leftover and are skipped.
+// It returns the greatest met sequence number, size of file part ending with the last complete batch or snapshot record
+// and count of records failed to read.
+func (fm *FileManager) replayFile(path string, minSeq uint64, data *fileData) (uint64, int64, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, 0, nil
+		}
+		return 0, 0, 0, fmt.Errorf("cannot open file '%s' to read metrics: %w", path, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			fm.logger.Info("[FileManager::replayFile] failed to close file: %v", err)
+		}
+	}()
+
+	var lastSeq uint64
+	var offset, size int64
+	failedCount := 0
+	// records and failures which aren't committed yet.
+	pending := map[uint64][]*MetricData{}
+	pendingFailed := 0
+	unfinished := false
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// record without line end is unfinished.
+			unfinished = len(line) != 0
+			break
+		}
+		if err != nil {
+			return lastSeq, size, failedCount, fmt.Errorf("read metrics file '%s': %w", path, err)
+		}
+		offset += int64(len(line))
+
+		var record MetricData
+		if err = json.Unmarshal(line, &record); err != nil {
+			pendingFailed++
+			continue
+		}
+
+		switch {
+		case record.ValueType == snapshotType:
+			lastSeq = record.Seq
+		case record.ValueType == commitType:
+			if record.Seq > minSeq {
+				for _, batchRecord := range pending[record.Seq] {
+					if !applyRecord(batchRecord, data) {
+						failedCount++
+					}
+				}
+			}
+			delete(pending, record.Seq)
+			if record.Seq > lastSeq {
+				lastSeq = record.Seq
+			}
+		case record.Seq != 0:
+			pending[record.Seq] = append(pending[record.Seq], &record)
+			continue
+		default:
+			if !applyRecord(&record, data) {
+				failedCount++
+			}
+		}
+
+		// records read before complete snapshot record or commit aren't crash leftover.
+		failedCount += pendingFailed
+		pendingFailed = 0
+		size = offset
+	}
+
+	if unfinished || size != offset || len(pending) != 0 {
+		fm.logger.Info("[FileManager::replayFile] unfinished records are skipped in file '%s'", path)
+	}
+	return lastSeq, size, failedCount, nil
+}
+
+// walPath returns path to the write-ahead log file.
+func (fm *FileManager) walPath() string {
+	return fm.path + walFileSuffix
+}
+
+// applyRecord applies record to data. Removal of gauge or counter drops its samples history and total as well.
+// It returns false if record is invalid.
+func applyRecord(record *MetricData, data *fileData) bool {
+	key := networkmsg.SeriesKey(record.Name, record.Labels)
+	switch record.ValueType {
 	case gaugeType:
-		value, err := strconv.ParseFloat(metric.Value, 64)
+		if record.Deleted {
+			delete(data.gauges, key)
+			delete(data.gaugesHistory, key)
+			return true
+		}
+
+		value, err := strconv.ParseFloat(record.Value, 64)
 		if err != nil {
-			fm.logger.Info("[FileManager::RestoreDataFromStorage] failed to parse float64 value for '%s'", metric.Name)
-			return
+			return false
 		}
-		(*gauges)[metric.Name] = value
+		data.gauges[key] = value
 	case counterType:
-		value, err := strconv.ParseInt(metric.Value, 10, 64)
+		if record.Deleted {
+			delete(data.counters, key)
+			delete(data.countersHistory, key)
+			delete(data.totals, key)
+			return true
+		}
+
+		value, err := strconv.ParseInt(record.Value, 10, 64)
+		if err != nil {
+			return false
+		}
+		data.counters[key] = value
+	case counterTotalType:
+		value, err := strconv.ParseInt(record.Value, 10, 64)
 		if err != nil {
-			fm.logger.Info("[FileManager::RestoreDataFromStorage] failed to parse int64 value for '%s'", metric.Name)
-			return
+			return false
+		}
+		data.totals[key] = value
+	case histogramType:
+		if record.Deleted {
+			delete(data.histograms, key)
+			return true
+		}
+
+		if record.Histogram == nil || record.Histogram.Validate() != nil {
+			return false
 		}
-		(*counters)[metric.Name] = value
+		data.histograms[key] = record.Histogram
+	case gaugeHistoryType:
+		data.gaugesHistory[key] = record.Samples
+	case counterHistoryType:
+		data.countersHistory[key] = record.Samples
 	default:
-		panic("wrong metric type")
+		return false
 	}
+	return true
 }
 
 // IsFileOpen checks if the file is open.
@@ -162,13 +559,22 @@ func (fm *FileManager) IsFileOpen() bool {
 
 // OpenFile opens or creates a file for writing or reading metrics.
 func (fm *FileManager) OpenFile(path string, withTrunc bool) error {
+	var flag int
+	if withTrunc {
+		flag = os.O_TRUNC
+	}
+	return fm.openFile(path, flag)
+}
+
+// openFile opens or creates a file for writing with extra writer flag (e.g. os.O_TRUNC or os.O_APPEND) or reading metrics.
+func (fm *FileManager) openFile(path string, writerFlag int) error {
 	fm.path = path
 
 	if err := os.MkdirAll(filepath.Dir(fm.path), 0755); err != nil {
 		return fmt.Errorf(openFileError, err)
 	}
 
-	if err := fm.initWriter(withTrunc); err != nil {
+	if err := fm.initWriter(writerFlag); err != nil {
 		return fmt.Errorf(openFileError, err)
 	}
 
@@ -193,15 +599,9 @@ func (fm *FileManager) CloseFile() error {
 	return err
 }
 
-// initWriter initializes the file writer.
-func (fm *FileManager) initWriter(withTrunc bool) error {
-	var flag int
-	flag = os.O_WRONLY | os.O_CREATE
-	if withTrunc {
-		flag |= os.O_TRUNC
-	}
-
-	file, err := os.OpenFile(fm.path, flag, 0666)
+// initWriter initializes the file writer with extra open flag.
+func (fm *FileManager) initWriter(extraFlag int) error {
+	file, err := os.OpenFile(fm.path, os.O_WRONLY|os.O_CREATE|extraFlag, 0666)
 	if err != nil {
 		return fmt.Errorf(initWriterError, err)
 	}
@@ -211,53 +611,125 @@ func (fm *FileManager) initWriter(withTrunc bool) error {
 }
 
 // WriteMetric writes a metric to the file.
-func (fm *FileManager) WriteMetric(name string, value interface{}) error {
+// Series key of the metric is split into name and labels.
+func (fm *FileManager) WriteMetric(key string, value interface{}) error {
 	if !fm.IsFileOpen() {
 		return fmt.Errorf("failed writing metric. file is not open")
 	}
 
-	var data []byte
-	var err error
+	data, err := marshalMetric(key, value, 0)
+	if err != nil {
+		return err
+	}
 
+	data = append(data, '\n')
+	if _, err = fm.write(data); err != nil {
+		return fmt.Errorf(writeMetricError, err)
+	}
+
+	err = fm.flushWriter()
+	if err != nil {
+		return fmt.Errorf(writeMetricError, err)
+	}
+	return nil
+}
+
+// marshalMetric converts metric to JSON record. Series key of the metric is split into name and labels.
+func marshalMetric(key string, value interface{}, seq uint64) ([]byte, error) {
+	metric, err := newMetricRecord(key, value, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(metric)
+	if err != nil {
+		return nil, fmt.Errorf(writeMetricError, err)
+	}
+	return data, nil
+}
+
+// newMetricRecord returns record of gauge or counter value depending on value type.
+func newMetricRecord(key string, value interface{}, seq uint64) (*MetricData, error) {
+	var record *MetricData
+	var err error
 	switch valType := value.(type) {
 	case *int64:
-		metric := MetricData{
-			name,
-			counterType,
-			strconv.FormatInt(*valType, 10),
+		if record, err = newRecord(key, counterType, seq); err == nil {
+			record.Value = strconv.FormatInt(*valType, 10)
 		}
-
-		data, err = json.Marshal(&metric)
-
 	case *float64:
-		metric := MetricData{
-			name,
-			gaugeType,
-			strconv.FormatFloat(*valType, 'f', -1, 64),
+		if record, err = newRecord(key, gaugeType, seq); err == nil {
+			record.Value = strconv.FormatFloat(*valType, 'f', -1, 64)
 		}
+	default:
+		err = fmt.Errorf(writeMetricError, fmt.Errorf("unknown value type of '%s'", key))
+	}
+	return record, err
+}
 
-		data, err = json.Marshal(&metric)
+// newRecord returns record of the specified type with name and labels split from series key.
+func newRecord(key string, valueType string, seq uint64) (*MetricData, error) {
+	name, labels, err := networkmsg.ParseSeriesKey(key)
+	if err != nil {
+		return nil, fmt.Errorf(writeMetricError, err)
+	}
+	return &MetricData{Name: name, ValueType: valueType, Labels: labels, Seq: seq}, nil
+}
 
-	default:
-		err = fmt.Errorf("unknown value type")
+// writeFileAtomically writes file content in temporary file synced on disk and renames it to path.
+// The file at path is either left untouched or fully replaced.
+func writeFileAtomically(path string, write func(writer *bufio.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
 	}
 
+	tmpPath := path + tmpFileSuffix
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
-		return fmt.Errorf(writeMetricError, err)
+		return fmt.Errorf("open temporary file: %w", err)
 	}
 
-	data = append(data, '\n')
-	if _, err = fm.write(data); err != nil {
-		return fmt.Errorf(writeMetricError, err)
+	writer := bufio.NewWriter(file)
+	if err = write(writer); err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
 	}
 
-	err = fm.flushWriter()
 	if err != nil {
-		return fmt.Errorf(writeMetricError, err)
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("write temporary file: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("replace file: %w", err)
+	}
+
+	// rename is durable only after the directory entry is synced.
+	if err = syncDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("sync directory: %w", err)
 	}
 	return nil
 }
 
+// syncDir flushes directory entries on disk.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	err = dir.Sync()
+	if errClose := dir.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
 // write writes data to the file.
 func (fm *FileManager) write(data []byte) (int, error) {
 	return fm.writer.writer.Write(data)
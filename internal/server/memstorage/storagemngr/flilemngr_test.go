@@ -4,10 +4,14 @@ import (
 	"context"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/erupshis/metrics/internal/histogram"
 	"github.com/erupshis/metrics/internal/logger"
 	"github.com/erupshis/metrics/internal/server/config"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -151,7 +155,7 @@ func TestFileManager_initWriterAndScanner(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			fm.path = tt.fields.path
-			if err := fm.initWriter(false); (err != nil) != tt.wantErr {
+			if err := fm.initWriter(0); (err != nil) != tt.wantErr {
 				t.Errorf("initWriter() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			if err := fm.initScanner(); (err != nil) != tt.wantErr {
@@ -247,104 +251,130 @@ func TestFileManager_WriteAndScanMetricOnClosed(t *testing.T) {
 	}
 }
 
-func TestFileManager_parseMetric(t *testing.T) {
-	_ = os.RemoveAll(testFolder)
-
-	log := logger.CreateMock()
-	defer log.Sync()
-	fm := createFileManagerTest(testConfig.StoragePath, log)
+func TestFileManager_applyRecord(t *testing.T) {
+	ts := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	latency := &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}
 
-	type args struct {
-		metric   *MetricData
-		gauges   map[string]float64
-		counters map[string]int64
-	}
-	type want struct {
-		gauges   map[string]float64
-		counters map[string]int64
-	}
 	tests := []struct {
-		name string
-		args args
-		want want
+		name   string
+		record *MetricData
+		want   *fileData
+		wantOk bool
 	}{
 		{
-			name: "int64 valid",
-			args: args{
-				metric: &MetricData{
-					Name:      "int64 metric",
-					ValueType: counterType,
-					Value:     "123",
-				},
-				gauges:   map[string]float64{},
-				counters: map[string]int64{},
-			},
-			want: want{
-				gauges:   map[string]float64{},
-				counters: map[string]int64{"int64 metric": 123},
-			},
+			name:   "int64 valid",
+			record: &MetricData{Name: "int64 metric", ValueType: counterType, Value: "123"},
+			want:   &fileData{counters: map[string]int64{"int64 metric": 123}},
+			wantOk: true,
 		},
 		{
-			name: "float64 valid",
-			args: args{
-				metric: &MetricData{
-					Name:      "float64 metric",
-					ValueType: gaugeType,
-					Value:     "123",
-				},
-				gauges:   map[string]float64{},
-				counters: map[string]int64{},
-			},
-			want: want{
-				gauges:   map[string]float64{"float64 metric": 123},
-				counters: map[string]int64{},
-			},
+			name:   "float64 valid",
+			record: &MetricData{Name: "float64 metric", ValueType: gaugeType, Value: "123"},
+			want:   &fileData{gauges: map[string]float64{"float64 metric": 123}},
+			wantOk: true,
 		},
 		{
-			name: "int64 incorrect metric value",
-			args: args{
-				metric: &MetricData{
-					Name:      "int64 metric",
-					ValueType: counterType,
-					Value:     "asd",
-				},
-				gauges:   map[string]float64{},
-				counters: map[string]int64{},
-			},
-			want: want{
-				gauges:   map[string]float64{},
-				counters: map[string]int64{},
-			},
+			name:   "float64 valid with labels",
+			record: &MetricData{Name: "float64 metric", ValueType: gaugeType, Value: "123", Labels: map[string]string{"host": "a"}},
+			want:   &fileData{gauges: map[string]float64{`float64 metric{host="a"}`: 123}},
+			wantOk: true,
 		},
 		{
-			name: "float64 incorrect metric value",
-			args: args{
-				metric: &MetricData{
-					Name:      "float64 metric",
-					ValueType: gaugeType,
-					Value:     "asd",
-				},
-				gauges:   map[string]float64{},
-				counters: map[string]int64{},
-			},
-			want: want{
-				gauges:   map[string]float64{},
-				counters: map[string]int64{},
-			},
+			name:   "total valid",
+			record: &MetricData{Name: "counter", ValueType: counterTotalType, Value: "10"},
+			want:   &fileData{totals: map[string]int64{"counter": 10}},
+			wantOk: true,
+		},
+		{
+			name:   "histogram valid",
+			record: &MetricData{Name: "latency", ValueType: histogramType, Histogram: latency},
+			want:   &fileData{histograms: map[string]*histogram.Histogram{"latency": latency}},
+			wantOk: true,
+		},
+		{
+			name:   "gauge history valid",
+			record: &MetricData{Name: "gauge", ValueType: gaugeHistoryType, Samples: []history.Sample{{Timestamp: ts, Value: 1.5}}},
+			want:   &fileData{gaugesHistory: map[string][]history.Sample{"gauge": {{Timestamp: ts, Value: 1.5}}}},
+			wantOk: true,
+		},
+		{
+			name:   "counter removal drops history and total",
+			record: &MetricData{Name: "counter", ValueType: counterType, Deleted: true},
+			want:   &fileData{},
+			wantOk: true,
+		},
+		{
+			name:   "int64 incorrect metric value",
+			record: &MetricData{Name: "int64 metric", ValueType: counterType, Value: "asd"},
+			want:   &fileData{},
+		},
+		{
+			name:   "float64 incorrect metric value",
+			record: &MetricData{Name: "float64 metric", ValueType: gaugeType, Value: "asd"},
+			want:   &fileData{},
+		},
+		{
+			name:   "invalid histogram",
+			record: &MetricData{Name: "latency", ValueType: histogramType, Histogram: &histogram.Histogram{Bounds: []float64{1}}},
+			want:   &fileData{},
+		},
+		{
+			name:   "unknown type",
+			record: &MetricData{Name: "metric", ValueType: "unknown", Value: "1"},
+			want:   &fileData{},
 		},
 	}
 	for _, ttCommon := range tests {
 		tt := ttCommon
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			fm.parseMetric(tt.args.metric, &tt.args.gauges, &tt.args.counters)
 
-			assert.True(t, reflect.DeepEqual(tt.args.gauges, tt.want.gauges))
-			assert.True(t, reflect.DeepEqual(tt.args.counters, tt.want.counters))
+			data := newFileDataTest()
+			data.countersHistory["counter"] = []history.Sample{{Timestamp: ts, Value: 1}}
+			if tt.record.ValueType != counterTotalType {
+				data.totals["counter"] = 5
+			}
+
+			want := newFileDataTest()
+			for k, v := range tt.want.gauges {
+				want.gauges[k] = v
+			}
+			for k, v := range tt.want.counters {
+				want.counters[k] = v
+			}
+			for k, v := range tt.want.totals {
+				want.totals[k] = v
+			}
+			for k, v := range tt.want.histograms {
+				want.histograms[k] = v
+			}
+			for k, v := range tt.want.gaugesHistory {
+				want.gaugesHistory[k] = v
+			}
+			if !tt.record.Deleted {
+				want.countersHistory["counter"] = data.countersHistory["counter"]
+				if tt.record.ValueType != counterTotalType {
+					want.totals["counter"] = 5
+				}
+			}
+
+			assert.Equal(t, tt.wantOk, applyRecord(tt.record, data))
+			assert.Equal(t, want, data)
 		})
 	}
 }
 
+func newFileDataTest() *fileData {
+	return &fileData{
+		gauges:          map[string]float64{},
+		counters:        map[string]int64{},
+		totals:          map[string]int64{},
+		histograms:      map[string]*histogram.Histogram{},
+		gaugesHistory:   map[string][]history.Sample{},
+		countersHistory: map[string][]history.Sample{},
+	}
+}
+
 func TestFileManager_SaveAndReadFile(t *testing.T) {
 	_ = os.RemoveAll(testFolder)
 	gauge := float64(123)
@@ -354,8 +384,6 @@ func TestFileManager_SaveAndReadFile(t *testing.T) {
 
 	log := logger.CreateMock()
 
-	fm := createFileManagerTest(path, log)
-
 	type args struct {
 		gauges   map[string]interface{}
 		counters map[string]interface{}
@@ -363,6 +391,7 @@ func TestFileManager_SaveAndReadFile(t *testing.T) {
 	type want struct {
 		gauges   map[string]float64
 		counters map[string]int64
+		err      bool
 	}
 	tests := []struct {
 		name string
@@ -403,6 +432,17 @@ func TestFileManager_SaveAndReadFile(t *testing.T) {
 				counters: map[string]int64{"counter metric": int64(12)},
 			},
 		},
+		{
+			name: "labeled series valid",
+			args: args{
+				gauges:   map[string]interface{}{`float64 metric{host="a"}`: &gauge, `float64 metric{host="b"}`: &gauge},
+				counters: map[string]interface{}{`counter metric{host="a",zone="eu"}`: &counter},
+			},
+			want: want{
+				gauges:   map[string]float64{`float64 metric{host="a"}`: 123, `float64 metric{host="b"}`: 123},
+				counters: map[string]int64{`counter metric{host="a",zone="eu"}`: int64(12)},
+			},
+		},
 		{
 			name: "nothing to save",
 			args: args{
@@ -423,14 +463,20 @@ func TestFileManager_SaveAndReadFile(t *testing.T) {
 			want: want{
 				gauges:   map[string]float64{},
 				counters: map[string]int64{},
+				err:      true,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			_ = os.RemoveAll(path)
-			err := fm.SaveMetricsInStorage(context.Background(), tt.args.gauges, tt.args.counters)
-			require.NoError(t, err)
+			fm := createFileManagerTest(path, log)
+			err := fm.SaveDataInStorage(context.Background(), &Data{Gauges: tt.args.gauges, Counters: tt.args.counters})
+			if tt.want.err {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
 			require.NoError(t, fm.Close())
 
 			gauges, counters, err := fm.RestoreDataFromStorage(context.Background())
@@ -441,3 +487,424 @@ func TestFileManager_SaveAndReadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestFileManager_SaveDataDelta(t *testing.T) {
+	_ = os.RemoveAll(testFolder)
+
+	fm := createFileManagerTest(testFolder+"/delta", logger.CreateMock())
+
+	gauge1, gauge2, gauge2Changed := 1.5, 2.5, 3.5
+	counter1, counter1Changed := int64(1), int64(7)
+	latency := &histogram.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 0, 2}, Count: 3, Sum: 20.5}
+	latencyChanged := &histogram.Histogram{Bounds: []float64{1, 5}, Counts: []uint64{2, 0, 2}, Count: 4, Sum: 21}
+	ts := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{
+		Gauges:          map[string]interface{}{"gauge1": &gauge1, `gauge2{host="a"}`: &gauge2},
+		Counters:        map[string]interface{}{"counter1": &counter1},
+		CounterTotals:   map[string]int64{"counter1": 1},
+		Histograms:      map[string]*histogram.Histogram{"latency": latency},
+		GaugesHistory:   map[string][]history.Sample{"gauge1": {{Timestamp: ts, Value: 1.5}}},
+		CountersHistory: map[string][]history.Sample{"counter1": {{Timestamp: ts, Value: 1}}},
+	}))
+	require.NoError(t, fm.SaveDataDeltaInStorage(context.Background(), &Data{
+		Gauges:        map[string]interface{}{`gauge2{host="a"}`: &gauge2Changed},
+		GaugesHistory: map[string][]history.Sample{`gauge2{host="a"}`: {{Timestamp: ts, Value: 3.5}}},
+	}))
+	require.NoError(t, fm.SaveDataDeltaInStorage(context.Background(), &Data{
+		Counters:      map[string]interface{}{"counter1": &counter1Changed},
+		CounterTotals: map[string]int64{"counter1": 7},
+		Histograms:    map[string]*histogram.Histogram{`latency{host="a"}`: latencyChanged},
+	}))
+
+	// a new manager replays WAL.
+	fm = createFileManagerTest(testFolder+"/delta", logger.CreateMock())
+	gauges, counters, err := fm.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5, `gauge2{host="a"}`: 3.5}, gauges)
+	assert.Equal(t, map[string]int64{"counter1": 7}, counters)
+
+	totals, err := fm.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"counter1": 7}, totals)
+
+	histograms, err := fm.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*histogram.Histogram{"latency": latency, `latency{host="a"}`: latencyChanged}, histograms)
+
+	gaugesHistory, countersHistory, err := fm.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]history.Sample{
+		"gauge1":           {{Timestamp: ts, Value: 1.5}},
+		`gauge2{host="a"}`: {{Timestamp: ts, Value: 3.5}},
+	}, gaugesHistory)
+	assert.Equal(t, map[string][]history.Sample{"counter1": {{Timestamp: ts, Value: 1}}}, countersHistory)
+
+	// full save compacts the file and discards WAL.
+	require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{
+		Gauges:          map[string]interface{}{"gauge1": &gauge1},
+		GaugesHistory:   map[string][]history.Sample{},
+		CountersHistory: map[string][]history.Sample{},
+	}))
+	_, err = os.Stat(fm.walPath())
+	assert.True(t, os.IsNotExist(err))
+
+	gauges, counters, err = fm.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5}, gauges)
+	assert.Empty(t, counters)
+
+	histograms, err = fm.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, histograms)
+
+	totals, err = fm.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, totals)
+}
+
+func TestFileManager_SaveDataKeepsHistory(t *testing.T) {
+	_ = os.RemoveAll(testFolder)
+	ts := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	fm := createFileManagerTest(testFolder+"/history", logger.CreateMock())
+
+	gauge := 1.5
+	gaugesHistory := map[string][]history.Sample{"gauge": {{Timestamp: ts, Value: 1.5}}}
+	require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{
+		Gauges:          map[string]interface{}{"gauge": &gauge},
+		GaugesHistory:   gaugesHistory,
+		CountersHistory: map[string][]history.Sample{},
+	}))
+
+	// history isn't provided, stored one is kept.
+	gauge = 2.5
+	require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{Gauges: map[string]interface{}{"gauge": &gauge}}))
+
+	restoredGauges, restoredCounters, err := createFileManagerTest(fm.path, logger.CreateMock()).RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, gaugesHistory, restoredGauges)
+	assert.Empty(t, restoredCounters)
+}
+
+func TestFileManager_DeleteMetrics(t *testing.T) {
+	_ = os.RemoveAll(testFolder)
+
+	fm := createFileManagerTest(testFolder+"/delete", logger.CreateMock())
+
+	gauge1, gauge2 := 1.5, 2.5
+	counter1, counter2 := int64(1), int64(2)
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{
+		Gauges:        map[string]interface{}{"gauge1": &gauge1, `gauge2{host="a"}`: &gauge2},
+		Counters:      map[string]interface{}{"counter1": &counter1, `counter2{host="a"}`: &counter2},
+		CounterTotals: map[string]int64{"counter1": 10, `counter2{host="a"}`: 20},
+		Histograms: map[string]*histogram.Histogram{
+			"histogram1": {Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5},
+			"histogram2": {Bounds: []float64{1}, Counts: []uint64{0, 1}, Count: 1, Sum: 2},
+		},
+		GaugesHistory:   map[string][]history.Sample{"gauge1": {{Timestamp: ts, Value: 1.5}}, `gauge2{host="a"}`: {{Timestamp: ts, Value: 2.5}}},
+		CountersHistory: map[string][]history.Sample{"counter1": {{Timestamp: ts, Value: 1}}},
+	}))
+
+	require.NoError(t, fm.DeleteMetricsFromStorage(context.Background(),
+		[]string{`gauge2{host="a"}`, "missing"}, []string{"counter1"}, []string{"histogram1"}))
+
+	// removal is replayed from WAL by a new manager.
+	fm = createFileManagerTest(testFolder+"/delete", logger.CreateMock())
+	gauges, counters, err := fm.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5}, gauges)
+	assert.Equal(t, map[string]int64{`counter2{host="a"}`: 2}, counters)
+
+	totals, err := fm.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{`counter2{host="a"}`: 20}, totals)
+
+	histograms, err := fm.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, histograms, 1)
+	assert.Contains(t, histograms, "histogram2")
+
+	gaugesHistory, countersHistory, err := fm.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]history.Sample{"gauge1": {{Timestamp: ts, Value: 1.5}}}, gaugesHistory)
+	assert.Empty(t, countersHistory)
+
+	// metric added after removal is restored.
+	gauge2Changed := 3.5
+	require.NoError(t, fm.SaveDataDeltaInStorage(context.Background(), &Data{
+		Gauges: map[string]interface{}{`gauge2{host="a"}`: &gauge2Changed},
+	}))
+	gauges, _, err = fm.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5, `gauge2{host="a"}`: 3.5}, gauges)
+}
+
+func TestFileManager_WALRecovery(t *testing.T) {
+	gauge1, gauge2, gauge3 := 1.0, 2.0, 3.0
+	counter := int64(5)
+
+	save := func(t *testing.T, fm *FileManager, gauge *float64) {
+		require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{
+			Gauges:   map[string]interface{}{"gauge": gauge},
+			Counters: map[string]interface{}{"counter": &counter},
+		}))
+	}
+	saveDelta := func(t *testing.T, fm *FileManager, gauge *float64) {
+		require.NoError(t, fm.SaveDataDeltaInStorage(context.Background(), &Data{Gauges: map[string]interface{}{"gauge": gauge}}))
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		prepare    func(t *testing.T, fm *FileManager)
+		wantGauges map[string]float64
+		wantErr    bool
+	}{
+		{
+			name: "wal replayed on top of snapshot",
+			path: testFolder + "/wal/replay",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				saveDelta(t, fm, &gauge3)
+			},
+			wantGauges: map[string]float64{"gauge": 3},
+		},
+		{
+			name: "unfinished last wal record",
+			path: testFolder + "/wal/torn",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				appendToFile(t, fm.walPath(), `{"name":"gauge","type":"gauge","val`)
+			},
+			wantGauges: map[string]float64{"gauge": 2},
+		},
+		{
+			name: "uncommitted wal batch",
+			path: testFolder + "/wal/uncommitted",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				appendToFile(t, fm.walPath(), `{"name":"gauge","type":"gauge","value":"3","seq":2}`+"\n")
+			},
+			wantGauges: map[string]float64{"gauge": 2},
+		},
+		{
+			name: "torn wal tail is truncated before append",
+			path: testFolder + "/wal/truncated",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				appendToFile(t, fm.walPath(), `{"name":"gauge","type":"gauge","value":"5","seq":2}`+"\n"+`{"name":"gauge","labels":{"host":"`+strings.Repeat("a", 1024))
+
+				restarted := createFileManagerTest(fm.path, logger.CreateMock())
+				saveDelta(t, restarted, &gauge3)
+
+				wal, err := os.ReadFile(fm.walPath())
+				require.NoError(t, err)
+				assert.NotContains(t, string(wal), "aaa")
+			},
+			wantGauges: map[string]float64{"gauge": 3},
+		},
+		{
+			name: "torn wal tail of failed append is truncated",
+			path: testFolder + "/wal/failed",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				appendToFile(t, fm.walPath(), `{"name":"gauge","labels":{"host":"`+strings.Repeat("a", 1024))
+				saveDelta(t, fm, &gauge3)
+
+				wal, err := os.ReadFile(fm.walPath())
+				require.NoError(t, err)
+				assert.NotContains(t, string(wal), "aaa")
+			},
+			wantGauges: map[string]float64{"gauge": 3},
+		},
+		{
+			name: "broken wal record in the middle",
+			path: testFolder + "/wal/broken",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+
+				wal, err := os.ReadFile(fm.walPath())
+				require.NoError(t, err)
+				lines := strings.SplitAfter(string(wal), "\n")
+				lines = append(lines[:1], append([]string{"broken\n"}, lines[1:]...)...)
+				require.NoError(t, os.WriteFile(fm.walPath(), []byte(strings.Join(lines, "")), 0666))
+			},
+			wantGauges: map[string]float64{"gauge": 2},
+			wantErr:    true,
+		},
+		{
+			name: "wal left after snapshot is skipped",
+			path: testFolder + "/wal/stale",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				wal, err := os.ReadFile(fm.walPath())
+				require.NoError(t, err)
+
+				// crash after snapshot replacement but before WAL removal.
+				save(t, fm, &gauge3)
+				require.NoError(t, os.WriteFile(fm.walPath(), wal, 0666))
+			},
+			wantGauges: map[string]float64{"gauge": 3},
+		},
+		{
+			name: "wal written by restarted manager",
+			path: testFolder + "/wal/restart",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				save(t, fm, &gauge2)
+
+				restarted := createFileManagerTest(fm.path, logger.CreateMock())
+				saveDelta(t, restarted, &gauge3)
+			},
+			wantGauges: map[string]float64{"gauge": 3},
+		},
+		{
+			name: "snapshot saved by restarted manager covers wal",
+			path: testFolder + "/wal/restart_snapshot",
+			prepare: func(t *testing.T, fm *FileManager) {
+				save(t, fm, &gauge1)
+				saveDelta(t, fm, &gauge2)
+				wal, err := os.ReadFile(fm.walPath())
+				require.NoError(t, err)
+
+				// crash of restarted manager after snapshot replacement but before WAL removal.
+				restarted := createFileManagerTest(fm.path, logger.CreateMock())
+				save(t, restarted, &gauge3)
+				require.NoError(t, os.WriteFile(fm.walPath(), wal, 0666))
+			},
+			wantGauges: map[string]float64{"gauge": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.RemoveAll(testFolder)
+			tt.prepare(t, createFileManagerTest(tt.path, logger.CreateMock()))
+
+			gauges, counters, err := createFileManagerTest(tt.path, logger.CreateMock()).RestoreDataFromStorage(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantGauges, gauges)
+			assert.Equal(t, map[string]int64{"counter": 5}, counters)
+		})
+	}
+}
+
+func TestFileManager_WALBatchCrash(t *testing.T) {
+	_ = os.RemoveAll(testFolder)
+
+	path := testFolder + "/wal/batch"
+	fm := createFileManagerTest(path, logger.CreateMock())
+
+	counter, counterChanged := int64(10), int64(15)
+	latency := &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}
+	latencyChanged := &histogram.Histogram{Bounds: []float64{1}, Counts: []uint64{2, 0}, Count: 2, Sum: 1}
+	require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{
+		Counters:      map[string]interface{}{"counter": &counter},
+		CounterTotals: map[string]int64{"counter": 10},
+		Histograms:    map[string]*histogram.Histogram{"latency": latency},
+	}))
+	require.NoError(t, fm.SaveDataDeltaInStorage(context.Background(), &Data{
+		Counters:      map[string]interface{}{"counter": &counterChanged},
+		CounterTotals: map[string]int64{"counter": 15},
+		Histograms:    map[string]*histogram.Histogram{"latency": latencyChanged},
+	}))
+
+	wal, err := os.ReadFile(fm.walPath())
+	require.NoError(t, err)
+
+	// crash at any moment of batch append restores either the whole batch or nothing of it.
+	for size := 0; size <= len(wal); size++ {
+		require.NoError(t, os.WriteFile(fm.walPath(), wal[:size], 0666))
+
+		restored := createFileManagerTest(path, logger.CreateMock())
+		_, counters, err := restored.RestoreDataFromStorage(context.Background())
+		require.NoError(t, err)
+		totals, err := restored.RestoreCounterTotalsFromStorage(context.Background())
+		require.NoError(t, err)
+		histograms, err := restored.RestoreHistogramsFromStorage(context.Background())
+		require.NoError(t, err)
+
+		if size == len(wal) {
+			assert.Equal(t, map[string]int64{"counter": 15}, counters)
+			assert.Equal(t, map[string]int64{"counter": 15}, totals)
+			assert.Equal(t, map[string]*histogram.Histogram{"latency": latencyChanged}, histograms)
+		} else {
+			assert.Equal(t, map[string]int64{"counter": 10}, counters, "size %d", size)
+			assert.Equal(t, map[string]int64{"counter": 10}, totals, "size %d", size)
+			assert.Equal(t, map[string]*histogram.Histogram{"latency": latency}, histograms, "size %d", size)
+		}
+	}
+}
+
+func appendToFile(t *testing.T, path string, data string) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+}
+
+func TestFileManager_ReadMissing(t *testing.T) {
+	_ = os.RemoveAll(testFolder)
+
+	fm := createFileManagerTest(testFolder+"/missing", logger.CreateMock())
+
+	gaugesHistory, countersHistory, err := fm.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, gaugesHistory)
+	assert.Empty(t, countersHistory)
+
+	histograms, err := fm.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, histograms)
+
+	totals, err := fm.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, totals)
+}
+
+func TestFileManager_SaveAndReadHistograms(t *testing.T) {
+	_ = os.RemoveAll(testFolder)
+
+	fm := createFileManagerTest(testFolder+"/histograms", logger.CreateMock())
+
+	tests := []struct {
+		name       string
+		histograms map[string]*histogram.Histogram
+	}{
+		{
+			name: "histograms valid",
+			histograms: map[string]*histogram.Histogram{
+				"latency":             {Bounds: []float64{1, 5}, Counts: []uint64{1, 0, 2}, Count: 3, Sum: 20.5},
+				`latency{host="a"}`:   {Bounds: []float64{0.5}, Counts: []uint64{0, 1}, Count: 1, Sum: 1},
+				"latency_empty_count": {Bounds: []float64{}, Counts: []uint64{0}},
+			},
+		},
+		{
+			name:       "nothing to save",
+			histograms: map[string]*histogram.Histogram{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, fm.SaveDataInStorage(context.Background(), &Data{Histograms: tt.histograms}))
+
+			histograms, err := fm.RestoreHistogramsFromStorage(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.histograms, histograms)
+		})
+	}
+}
@@ -1,12 +1,38 @@
 package storagemngr
 
-import "context"
+import (
+	"context"
 
-// MetricData represents the structure of metric data, including the metric name, value type, and value.
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+)
+
+// MetricData represents the record of metrics file, including the metric name, value type, value and labels.
+// Histogram and Samples keep value of histogram and samples history records respectively.
+// Seq is a sequence number of write-ahead log batch. Snapshot header and commit record keep Seq of batches they cover.
+// Deleted marks write-ahead log record of removed metric.
 type MetricData struct {
-	Name      string `json:"name"`
-	ValueType string `json:"type"`
-	Value     string `json:"value"`
+	Name      string               `json:"name"`
+	ValueType string               `json:"type"`
+	Value     string               `json:"value"`
+	Labels    map[string]string    `json:"labels,omitempty"`
+	Histogram *histogram.Histogram `json:"histogram,omitempty"`
+	Samples   []history.Sample     `json:"samples,omitempty"`
+	Seq       uint64               `json:"seq,omitempty"`
+	Deleted   bool                 `json:"deleted,omitempty"`
+}
+
+// Data represents metrics data saved in the storage at once.
+// Values of gauges and counters are *float64 and *int64 respectively.
+// CounterTotals keeps the last reported totals of cumulative counters.
+// Samples history is kept untouched in the storage if GaugesHistory and CountersHistory are nil.
+type Data struct {
+	Gauges          map[string]interface{}
+	Counters        map[string]interface{}
+	CounterTotals   map[string]int64
+	Histograms      map[string]*histogram.Histogram
+	GaugesHistory   map[string][]history.Sample
+	CountersHistory map[string][]history.Sample
 }
 
 // StorageManager is an interface that defines methods for managing the storage of metric data.
@@ -15,15 +41,39 @@ type MetricData struct {
 //
 //go:generate mockgen -destination=../../../../mocks/mock_StorageManager.go -package=mocks github.com/erupshis/metrics/internal/server/memstorage/storagemngr StorageManager
 type StorageManager interface {
-	// SaveMetricsInStorage saves gauge and counter metric values in the storage.
+	// SaveDataInStorage replaces all stored metrics data by the provided one at once.
+	// Storage is never left with only part of data saved.
 	// The provided context is used for cancellation and timeout.
-	SaveMetricsInStorage(ctx context.Context, gaugeValues map[string]interface{}, counterValues map[string]interface{}) error
+	SaveDataInStorage(ctx context.Context, data *Data) error
+
+	// SaveDataDeltaInStorage saves data of changed metrics at once.
+	// Stored data of other metrics is kept untouched.
+	// The provided context is used for cancellation and timeout.
+	SaveDataDeltaInStorage(ctx context.Context, data *Data) error
 
 	// RestoreDataFromStorage retrieves and restores stored metric data from the storage.
 	// The provided context is used for cancellation and timeout.
 	// It returns two maps containing gauge and counter metric values respectively.
 	RestoreDataFromStorage(ctx context.Context) (map[string]float64, map[string]int64, error)
 
+	// DeleteMetricsFromStorage removes gauge, counter and histogram metrics with the specified series keys,
+	// samples history of removed gauges and counters and totals of removed counters from the storage. Missing metrics are ignored.
+	// The provided context is used for cancellation and timeout.
+	DeleteMetricsFromStorage(ctx context.Context, gaugeKeys []string, counterKeys []string, histogramKeys []string) error
+
+	// RestoreHistogramsFromStorage retrieves stored histogram metric values from the storage.
+	// The provided context is used for cancellation and timeout.
+	RestoreHistogramsFromStorage(ctx context.Context) (map[string]*histogram.Histogram, error)
+
+	// RestoreCounterTotalsFromStorage retrieves stored totals of cumulative counters from the storage.
+	// The provided context is used for cancellation and timeout.
+	RestoreCounterTotalsFromStorage(ctx context.Context) (map[string]int64, error)
+
+	// RestoreHistoryFromStorage retrieves stored metric samples history from the storage.
+	// The provided context is used for cancellation and timeout.
+	// It returns two maps containing gauge and counter metric samples respectively.
+	RestoreHistoryFromStorage(ctx context.Context) (map[string][]history.Sample, map[string][]history.Sample, error)
+
 	// CheckConnection checks the connection status to the storage.
 	// The provided context is used for cancellation and timeout.
 	// It returns a boolean indicating whether the connection is available and an error if any.
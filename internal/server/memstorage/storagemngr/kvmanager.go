@@ -0,0 +1,511 @@
+package storagemngr
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket names of key-value storage.
+var (
+	gaugesBucket          = []byte("gauges")
+	countersBucket        = []byte("counters")
+	histogramsBucket      = []byte("histograms")
+	gaugesHistoryBucket   = []byte("gauges_history")
+	countersHistoryBucket = []byte("counters_history")
+	counterTotalsBucket   = []byte("counter_totals")
+)
+
+const (
+	kvOpenTimeout = time.Second
+
+	// kvCompactMinSize is a minimal file size (bytes) to consider compaction.
+	kvCompactMinSize = 1 << 20
+	// kvCompactFreeRatio is a share of free space in file that triggers compaction.
+	kvCompactFreeRatio = 0.5
+	// kvCompactTxMaxSize limits size of compaction transaction (bytes).
+	kvCompactTxMaxSize = 64 << 20
+	compactFileSuffix  = ".compact"
+)
+
+var errKVClosed = errors.New("kv storage is closed")
+
+// KVManager is a struct implementing the StorageManager interface
+// for managing metric data storage in embedded key-value database stored in a single file.
+// Each save is performed in a single transaction, so storage is never left partially updated.
+// If database file can't be reopened after compaction, manager stays closed and its calls return error.
+type KVManager struct {
+	path string
+	// db is nil if database file wasn't reopened after compaction, errReopen keeps the reason.
+	db        *bolt.DB
+	errReopen error
+	// muDB guards db replacement during compaction.
+	muDB sync.RWMutex
+	log  logger.BaseLogger
+
+	open func(path string) (*bolt.DB, error)
+}
+
+// CreateKVManager opens or creates key-value database file and compacts it if needed.
+func CreateKVManager(path string, log logger.BaseLogger) (StorageManager, error) {
+	log.Info("[storagemngr:CreateKVManager] open key-value storage with file path: '%s'", path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create kv storage: %w", err)
+	}
+
+	db, err := openKV(path)
+	if err != nil {
+		return nil, fmt.Errorf("create kv storage: %w", err)
+	}
+
+	manager := &KVManager{path: path, db: db, log: log, open: openKV}
+	if err = manager.compactIfNeeded(); err != nil {
+		log.Info("[storagemngr:CreateKVManager] failed to compact storage: %v", err)
+	}
+
+	return manager, nil
+}
+
+// Close closes the underlying key-value database.
+func (m *KVManager) Close() error {
+	m.muDB.Lock()
+	defer m.muDB.Unlock()
+
+	if m.db == nil {
+		return nil
+	}
+	return m.db.Close()
+}
+
+// CheckConnection checks that database file is open.
+func (m *KVManager) CheckConnection(_ context.Context) (bool, error) {
+	if err := m.view(func(tx *bolt.Tx) error { return nil }); err != nil {
+		return false, fmt.Errorf("check connection: %w", err)
+	}
+	return true, nil
+}
+
+// SaveDataInStorage replaces all stored metrics data by the provided one in one transaction.
+// Storage file is compacted afterwards if it contains too much free space.
+func (m *KVManager) SaveDataInStorage(_ context.Context, data *Data) error {
+	if err := m.update(func(tx *bolt.Tx) error { return putData(tx, data, true) }); err != nil {
+		return fmt.Errorf("save data: %w", err)
+	}
+
+	if err := m.compactIfNeeded(); err != nil {
+		m.log.Info("[KVManager::SaveDataInStorage] failed to compact storage: %v", err)
+	}
+	return nil
+}
+
+// SaveDataDeltaInStorage saves data of changed metrics in one transaction.
+func (m *KVManager) SaveDataDeltaInStorage(_ context.Context, data *Data) error {
+	if err := m.update(func(tx *bolt.Tx) error { return putData(tx, data, false) }); err != nil {
+		return fmt.Errorf("save data delta: %w", err)
+	}
+	return nil
+}
+
+// RestoreDataFromStorage retrieves stored gauge and counter metric values.
+func (m *KVManager) RestoreDataFromStorage(_ context.Context) (map[string]float64, map[string]int64, error) {
+	gauges := map[string]float64{}
+	counters := map[string]int64{}
+
+	err := m.view(func(tx *bolt.Tx) error {
+		if err := forEach(tx, gaugesBucket, func(key, value []byte) error {
+			if len(value) != 8 {
+				return fmt.Errorf("invalid value of gauge '%s'", key)
+			}
+			gauges[string(key)] = math.Float64frombits(binary.BigEndian.Uint64(value))
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return forEach(tx, countersBucket, func(key, value []byte) error {
+			if len(value) != 8 {
+				return fmt.Errorf("invalid value of counter '%s'", key)
+			}
+			counters[string(key)] = int64(binary.BigEndian.Uint64(value))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf(restoreMetricsError, err)
+	}
+
+	return gauges, counters, nil
+}
+
+// DeleteMetricsFromStorage removes gauge, counter and histogram metrics with the specified keys
+// and samples history of removed gauges and counters in one transaction.
+func (m *KVManager) DeleteMetricsFromStorage(_ context.Context, gaugeKeys []string, counterKeys []string, histogramKeys []string) error {
+	err := m.update(func(tx *bolt.Tx) error {
+		deletes := map[string][]string{
+			string(gaugesBucket):          gaugeKeys,
+			string(countersBucket):        counterKeys,
+			string(histogramsBucket):      histogramKeys,
+			string(gaugesHistoryBucket):   gaugeKeys,
+			string(countersHistoryBucket): counterKeys,
+			string(counterTotalsBucket):   counterKeys,
+		}
+		for name, keys := range deletes {
+			if err := deleteKeys(tx, []byte(name), keys); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete metrics: %w", err)
+	}
+	return nil
+}
+
+// RestoreHistogramsFromStorage retrieves stored histogram metric values.
+func (m *KVManager) RestoreHistogramsFromStorage(_ context.Context) (map[string]*histogram.Histogram, error) {
+	histograms := map[string]*histogram.Histogram{}
+
+	err := m.view(func(tx *bolt.Tx) error {
+		return forEach(tx, histogramsBucket, func(key, value []byte) error {
+			var hist histogram.Histogram
+			if err := json.Unmarshal(value, &hist); err != nil {
+				return fmt.Errorf("unmarshal histogram '%s': %w", key, err)
+			}
+			histograms[string(key)] = &hist
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(restoreHistogramsError, err)
+	}
+
+	return histograms, nil
+}
+
+// RestoreCounterTotalsFromStorage retrieves stored totals of cumulative counters.
+func (m *KVManager) RestoreCounterTotalsFromStorage(_ context.Context) (map[string]int64, error) {
+	totals := map[string]int64{}
+
+	err := m.view(func(tx *bolt.Tx) error {
+		return forEach(tx, counterTotalsBucket, func(key, value []byte) error {
+			if len(value) != 8 {
+				return fmt.Errorf("invalid total of counter '%s'", key)
+			}
+			totals[string(key)] = int64(binary.BigEndian.Uint64(value))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf(restoreCounterTotalsError, err)
+	}
+
+	return totals, nil
+}
+
+// RestoreHistoryFromStorage retrieves stored metric samples history.
+func (m *KVManager) RestoreHistoryFromStorage(_ context.Context) (map[string][]history.Sample, map[string][]history.Sample, error) {
+	gaugesHistory := map[string][]history.Sample{}
+	countersHistory := map[string][]history.Sample{}
+
+	err := m.view(func(tx *bolt.Tx) error {
+		if err := getHistory(tx, gaugesHistoryBucket, gaugesHistory); err != nil {
+			return err
+		}
+		return getHistory(tx, countersHistoryBucket, countersHistory)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf(restoreHistoryError, err)
+	}
+
+	return gaugesHistory, countersHistory, nil
+}
+
+// Compact rewrites database file without free pages left by replaced data.
+func (m *KVManager) Compact() error {
+	m.muDB.Lock()
+	defer m.muDB.Unlock()
+
+	if _, err := m.database(); err != nil {
+		return err
+	}
+	return m.compact()
+}
+
+// compactIfNeeded compacts database file if it is large enough and mostly free.
+func (m *KVManager) compactIfNeeded() error {
+	m.muDB.Lock()
+	defer m.muDB.Unlock()
+
+	db, err := m.database()
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return fmt.Errorf("stat kv storage file: %w", err)
+	}
+
+	if info.Size() < kvCompactMinSize {
+		return nil
+	}
+
+	stats := db.Stats()
+	if float64(stats.FreeAlloc) < float64(info.Size())*kvCompactFreeRatio {
+		return nil
+	}
+
+	m.log.Info("[KVManager::compactIfNeeded] compact storage file '%s' of size %d bytes, free %d bytes", m.path, info.Size(), stats.FreeAlloc)
+	return m.compact()
+}
+
+// compact copies data in a new file, replaces storage file by it and reopens database.
+// Caller must hold muDB and check that database is open.
+func (m *KVManager) compact() error {
+	compactPath := m.path + compactFileSuffix
+	_ = os.Remove(compactPath)
+
+	dst, err := m.open(compactPath)
+	if err != nil {
+		return fmt.Errorf("open compacted file: %w", err)
+	}
+
+	if err = bolt.Compact(dst, m.db, kvCompactTxMaxSize); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(compactPath)
+		return fmt.Errorf("compact: %w", err)
+	}
+
+	if err = dst.Close(); err != nil {
+		_ = os.Remove(compactPath)
+		return fmt.Errorf("close compacted file: %w", err)
+	}
+
+	if err = m.db.Close(); err != nil {
+		return fmt.Errorf("close storage file: %w", err)
+	}
+
+	// database is reopened in any case to keep manager usable, manager is closed if reopening fails.
+	errRename := os.Rename(compactPath, m.path)
+	db, err := m.open(m.path)
+	if err != nil {
+		m.db, m.errReopen = nil, err
+		return fmt.Errorf("reopen storage file: %w", err)
+	}
+	m.db = db
+
+	if errRename != nil {
+		_ = os.Remove(compactPath)
+		return fmt.Errorf("replace storage file: %w", errRename)
+	}
+	return nil
+}
+
+// update runs fn in read-write transaction.
+func (m *KVManager) update(fn func(tx *bolt.Tx) error) error {
+	m.muDB.RLock()
+	defer m.muDB.RUnlock()
+
+	db, err := m.database()
+	if err != nil {
+		return err
+	}
+	return db.Update(fn)
+}
+
+// view runs fn in read-only transaction.
+func (m *KVManager) view(fn func(tx *bolt.Tx) error) error {
+	m.muDB.RLock()
+	defer m.muDB.RUnlock()
+
+	db, err := m.database()
+	if err != nil {
+		return err
+	}
+	return db.View(fn)
+}
+
+// database returns open database or error if it wasn't reopened after compaction. Caller must hold muDB.
+func (m *KVManager) database() (*bolt.DB, error) {
+	if m.db == nil {
+		return nil, fmt.Errorf("%w: %v", errKVClosed, m.errReopen)
+	}
+	return m.db, nil
+}
+
+// openKV opens key-value database file.
+func openKV(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0666, &bolt.Options{Timeout: kvOpenTimeout})
+}
+
+// recreateBucket removes bucket with all its data and creates an empty one.
+func recreateBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+		return nil, fmt.Errorf("delete bucket '%s': %w", name, err)
+	}
+
+	bucket, err := tx.CreateBucket(name)
+	if err != nil {
+		return nil, fmt.Errorf("create bucket '%s': %w", name, err)
+	}
+	return bucket, nil
+}
+
+// putData writes metrics data in buckets. Stored data is replaced by the provided one if replace is set.
+func putData(tx *bolt.Tx, data *Data, replace bool) error {
+	if err := putMetrics(tx, gaugesBucket, data.Gauges, replace); err != nil {
+		return err
+	}
+	if err := putMetrics(tx, countersBucket, data.Counters, replace); err != nil {
+		return err
+	}
+
+	totals := make(map[string]interface{}, len(data.CounterTotals))
+	for key, total := range data.CounterTotals {
+		total := total
+		totals[key] = &total
+	}
+	if err := putMetrics(tx, counterTotalsBucket, totals, replace); err != nil {
+		return err
+	}
+
+	if err := putHistograms(tx, data.Histograms, replace); err != nil {
+		return err
+	}
+
+	if data.GaugesHistory == nil && data.CountersHistory == nil {
+		return nil
+	}
+	if err := putHistory(tx, gaugesHistoryBucket, data.GaugesHistory, replace); err != nil {
+		return err
+	}
+	return putHistory(tx, countersHistoryBucket, data.CountersHistory, replace)
+}
+
+// createBucket returns empty bucket if replace is set or existing one otherwise.
+func createBucket(tx *bolt.Tx, name []byte, replace bool) (*bolt.Bucket, error) {
+	if replace {
+		return recreateBucket(tx, name)
+	}
+
+	bucket, err := tx.CreateBucketIfNotExists(name)
+	if err != nil {
+		return nil, fmt.Errorf("create bucket '%s': %w", name, err)
+	}
+	return bucket, nil
+}
+
+// putHistograms writes histogram values in bucket. Existing bucket data is removed if replace is set.
+func putHistograms(tx *bolt.Tx, histograms map[string]*histogram.Histogram, replace bool) error {
+	bucket, err := createBucket(tx, histogramsBucket, replace)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range histograms {
+		if err = putJSON(bucket, key, value); err != nil {
+			return fmt.Errorf("put histogram '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// putMetrics writes metric values in bucket. Existing bucket data is removed if replace is set.
+func putMetrics(tx *bolt.Tx, name []byte, values map[string]interface{}, replace bool) error {
+	bucket, err := createBucket(tx, name, replace)
+	if err != nil {
+		return err
+	}
+
+	value := make([]byte, 8)
+	for key, rawValue := range values {
+		switch v := rawValue.(type) {
+		case *float64:
+			binary.BigEndian.PutUint64(value, math.Float64bits(*v))
+		case *int64:
+			binary.BigEndian.PutUint64(value, uint64(*v))
+		default:
+			return fmt.Errorf("unknown value type %T of metric '%s'", rawValue, key)
+		}
+
+		// bolt keeps references to the value until transaction ends, so it is copied.
+		if err = bucket.Put([]byte(key), append([]byte(nil), value...)); err != nil {
+			return fmt.Errorf("put metric '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// deleteKeys removes keys from bucket. Missing bucket is considered as empty.
+func deleteKeys(tx *bolt.Tx, name []byte, keys []string) error {
+	bucket := tx.Bucket(name)
+	if bucket == nil {
+		return nil
+	}
+
+	for _, key := range keys {
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("delete '%s' from bucket '%s': %w", key, name, err)
+		}
+	}
+	return nil
+}
+
+// putHistory writes metrics samples in bucket replacing samples of the provided metrics.
+// Existing bucket data is removed if replace is set.
+func putHistory(tx *bolt.Tx, name []byte, metricsHistory map[string][]history.Sample, replace bool) error {
+	bucket, err := createBucket(tx, name, replace)
+	if err != nil {
+		return err
+	}
+
+	for key, samples := range metricsHistory {
+		if err = putJSON(bucket, key, samples); err != nil {
+			return fmt.Errorf("put history of '%s': %w", key, err)
+		}
+	}
+	return nil
+}
+
+// getHistory reads metrics samples from bucket in dest.
+func getHistory(tx *bolt.Tx, name []byte, dest map[string][]history.Sample) error {
+	return forEach(tx, name, func(key, value []byte) error {
+		var samples []history.Sample
+		if err := json.Unmarshal(value, &samples); err != nil {
+			return fmt.Errorf("unmarshal history of '%s': %w", key, err)
+		}
+		dest[string(key)] = samples
+		return nil
+	})
+}
+
+// putJSON writes value marshaled in JSON in bucket.
+func putJSON(bucket *bolt.Bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	return bucket.Put([]byte(key), data)
+}
+
+// forEach calls fn for every key-value pair of bucket. Missing bucket is considered as empty.
+func forEach(tx *bolt.Tx, name []byte, fn func(key, value []byte) error) error {
+	bucket := tx.Bucket(name)
+	if bucket == nil {
+		return nil
+	}
+	return bucket.ForEach(fn)
+}
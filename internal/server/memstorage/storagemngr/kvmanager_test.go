@@ -0,0 +1,306 @@
+package storagemngr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/logger"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func createKVManagerTest(t *testing.T, path string) *KVManager {
+	manager, err := CreateKVManager(path, logger.CreateMock())
+	require.NoError(t, err)
+	return manager.(*KVManager)
+}
+
+func TestKVManager_SaveAndRestoreMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv", "metrics.db")
+	manager := createKVManagerTest(t, path)
+
+	gauge1, gauge2, gauge2Changed := 1.5, -2.5, 3.5
+	counter1, counter2 := int64(10), int64(-20)
+
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{
+		Gauges:   map[string]interface{}{"gauge1": &gauge1, `gauge2{host="a"}`: &gauge2},
+		Counters: map[string]interface{}{"counter1": &counter1},
+	}))
+	require.NoError(t, manager.SaveDataDeltaInStorage(context.Background(), &Data{
+		Gauges:   map[string]interface{}{`gauge2{host="a"}`: &gauge2Changed},
+		Counters: map[string]interface{}{"counter2": &counter2},
+	}))
+
+	gauges, counters, err := manager.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5, `gauge2{host="a"}`: 3.5}, gauges)
+	assert.Equal(t, map[string]int64{"counter1": 10, "counter2": -20}, counters)
+
+	// full save replaces stored metrics.
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{
+		Gauges: map[string]interface{}{"gauge1": &gauge1},
+	}))
+	require.NoError(t, manager.Close())
+
+	manager = createKVManagerTest(t, path)
+	defer func() { _ = manager.Close() }()
+
+	gauges, counters, err = manager.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5}, gauges)
+	assert.Empty(t, counters)
+
+	err = manager.SaveDataDeltaInStorage(context.Background(), &Data{Gauges: map[string]interface{}{"gauge1": 1.5}})
+	assert.Error(t, err, "value has to be a pointer")
+}
+
+func TestKVManager_SaveAndRestoreHistogramsAndHistory(t *testing.T) {
+	manager := createKVManagerTest(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer func() { _ = manager.Close() }()
+
+	histograms := map[string]*histogram.Histogram{
+		"latency":           {Bounds: []float64{1, 5}, Counts: []uint64{1, 0, 2}, Count: 3, Sum: 20.5},
+		`latency{host="a"}`: {Bounds: []float64{0.5}, Counts: []uint64{0, 1}, Count: 1, Sum: 1},
+	}
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{Histograms: histograms}))
+
+	restoredHistograms, err := manager.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, histograms, restoredHistograms)
+
+	// delta keeps other histograms.
+	changed := &histogram.Histogram{Bounds: []float64{0.5}, Counts: []uint64{1, 1}, Count: 2, Sum: 1.2}
+	require.NoError(t, manager.SaveDataDeltaInStorage(context.Background(), &Data{
+		Histograms: map[string]*histogram.Histogram{`latency{host="a"}`: changed},
+	}))
+	histograms[`latency{host="a"}`] = changed
+
+	restoredHistograms, err = manager.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, histograms, restoredHistograms)
+
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	gaugesHistory := map[string][]history.Sample{"gauge1": {{Timestamp: ts, Value: 1.1}, {Timestamp: ts.Add(time.Second), Value: 2.2}}}
+	countersHistory := map[string][]history.Sample{"counter1": {{Timestamp: ts, Value: 1}}}
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{
+		Histograms:      histograms,
+		GaugesHistory:   gaugesHistory,
+		CountersHistory: countersHistory,
+	}))
+
+	restoredGauges, restoredCounters, err := manager.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, gaugesHistory, restoredGauges)
+	assert.Equal(t, countersHistory, restoredCounters)
+
+	// delta keeps history of other metrics.
+	gaugesDelta := map[string][]history.Sample{"gauge2": {{Timestamp: ts, Value: 3.3}}}
+	require.NoError(t, manager.SaveDataDeltaInStorage(context.Background(), &Data{
+		GaugesHistory:   gaugesDelta,
+		CountersHistory: map[string][]history.Sample{},
+	}))
+	gaugesHistory["gauge2"] = gaugesDelta["gauge2"]
+
+	restoredGauges, restoredCounters, err = manager.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, gaugesHistory, restoredGauges)
+	assert.Equal(t, countersHistory, restoredCounters)
+
+	// history is kept if it isn't provided.
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{Histograms: histograms}))
+
+	restoredGauges, restoredCounters, err = manager.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, gaugesHistory, restoredGauges)
+	assert.Equal(t, countersHistory, restoredCounters)
+
+	ok, err := manager.CheckConnection(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestKVManager_RestoreEmpty(t *testing.T) {
+	manager := createKVManagerTest(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer func() { _ = manager.Close() }()
+
+	gauges, counters, err := manager.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, gauges)
+	assert.Empty(t, counters)
+
+	histograms, err := manager.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, histograms)
+}
+
+func TestKVManager_SaveDataFailed(t *testing.T) {
+	manager := createKVManagerTest(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer func() { _ = manager.Close() }()
+
+	gauge, counter := 1.5, int64(10)
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	histograms := map[string]*histogram.Histogram{"latency": {Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5}}
+	gaugesHistory := map[string][]history.Sample{"gauge": {{Timestamp: ts, Value: 1.5}}}
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{
+		Gauges:        map[string]interface{}{"gauge": &gauge},
+		Counters:      map[string]interface{}{"counter": &counter},
+		CounterTotals: map[string]int64{"counter": 10},
+		Histograms:    histograms,
+		GaugesHistory: gaugesHistory,
+	}))
+
+	// invalid counter value fails the whole save, data saved before it is rolled back.
+	changedGauge := 2.5
+	for _, save := range []func(context.Context, *Data) error{manager.SaveDataInStorage, manager.SaveDataDeltaInStorage} {
+		err := save(context.Background(), &Data{
+			Gauges:        map[string]interface{}{"gauge": &changedGauge},
+			Counters:      map[string]interface{}{"counter": "invalid"},
+			CounterTotals: map[string]int64{"counter": 20},
+			Histograms:    map[string]*histogram.Histogram{},
+			GaugesHistory: map[string][]history.Sample{},
+		})
+		require.Error(t, err)
+	}
+
+	gauges, counters, err := manager.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge": 1.5}, gauges)
+	assert.Equal(t, map[string]int64{"counter": 10}, counters)
+
+	totals, err := manager.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"counter": 10}, totals)
+
+	restoredHistograms, err := manager.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, histograms, restoredHistograms)
+
+	restoredGauges, _, err := manager.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, gaugesHistory, restoredGauges)
+}
+
+func TestKVManager_SaveAndRestoreCounterTotals(t *testing.T) {
+	manager := createKVManagerTest(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer func() { _ = manager.Close() }()
+
+	totals, err := manager.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, totals)
+
+	counter1, counter2 := int64(10), int64(20)
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{
+		Counters:      map[string]interface{}{"counter1": &counter1, "counter2": &counter2},
+		CounterTotals: map[string]int64{"counter1": 10, "counter2": 20},
+	}))
+	counter2 = 25
+	require.NoError(t, manager.SaveDataDeltaInStorage(context.Background(), &Data{
+		Counters:      map[string]interface{}{"counter2": &counter2},
+		CounterTotals: map[string]int64{"counter2": 25},
+	}))
+	require.NoError(t, manager.DeleteMetricsFromStorage(context.Background(), nil, []string{"counter1"}, nil))
+
+	totals, err = manager.RestoreCounterTotalsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"counter2": 25}, totals)
+}
+
+func TestKVManager_DeleteMetrics(t *testing.T) {
+	manager := createKVManagerTest(t, filepath.Join(t.TempDir(), "metrics.db"))
+	defer func() { _ = manager.Close() }()
+
+	gauge1, gauge2 := 1.5, 2.5
+	counter1 := int64(1)
+	ts := time.Now().UTC().Truncate(time.Millisecond)
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{
+		Gauges:   map[string]interface{}{"gauge1": &gauge1, `gauge2{host="a"}`: &gauge2},
+		Counters: map[string]interface{}{"counter1": &counter1},
+		Histograms: map[string]*histogram.Histogram{
+			"histogram1": {Bounds: []float64{1}, Counts: []uint64{1, 0}, Count: 1, Sum: 0.5},
+		},
+		GaugesHistory:   map[string][]history.Sample{`gauge2{host="a"}`: {{Timestamp: ts, Value: 2.5}}},
+		CountersHistory: map[string][]history.Sample{"counter1": {{Timestamp: ts, Value: 1}}},
+	}))
+
+	require.NoError(t, manager.DeleteMetricsFromStorage(context.Background(),
+		[]string{`gauge2{host="a"}`, "missing"}, []string{"counter1"}, []string{"histogram1"}))
+
+	gauges, counters, err := manager.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge1": 1.5}, gauges)
+	assert.Empty(t, counters)
+
+	histograms, err := manager.RestoreHistogramsFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, histograms)
+
+	gaugesHistory, countersHistory, err := manager.RestoreHistoryFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, gaugesHistory)
+	assert.Empty(t, countersHistory)
+}
+
+func TestKVManager_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	manager := createKVManagerTest(t, path)
+	defer func() { _ = manager.Close() }()
+
+	gauges := make(map[string]interface{}, 20000)
+	for i := 0; i < 20000; i++ {
+		value := float64(i)
+		gauges[fmt.Sprintf(`gauge_%d{host="compact"}`, i)] = &value
+	}
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{Gauges: gauges}))
+
+	infoFull, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Greater(t, infoFull.Size(), int64(kvCompactMinSize))
+
+	// replaced metrics leave mostly free file that is compacted after save.
+	gauge := 42.0
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{Gauges: map[string]interface{}{"gauge": &gauge}}))
+
+	infoCompacted, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, infoCompacted.Size(), infoFull.Size())
+
+	require.NoError(t, manager.Compact())
+
+	restored, _, err := manager.RestoreDataFromStorage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"gauge": 42}, restored)
+}
+
+func TestKVManager_CompactReopenFailed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	manager := createKVManagerTest(t, path)
+
+	gauge := 1.0
+	require.NoError(t, manager.SaveDataInStorage(context.Background(), &Data{Gauges: map[string]interface{}{"gauge": &gauge}}))
+
+	open := manager.open
+	manager.open = func(p string) (*bolt.DB, error) {
+		if p == path {
+			return nil, fmt.Errorf("file is locked")
+		}
+		return open(p)
+	}
+	assert.Error(t, manager.Compact())
+
+	// manager is closed and returns errors instead of panics.
+	assert.ErrorIs(t, manager.SaveDataInStorage(context.Background(), &Data{Gauges: map[string]interface{}{"gauge": &gauge}}), errKVClosed)
+	_, _, err := manager.RestoreDataFromStorage(context.Background())
+	assert.ErrorIs(t, err, errKVClosed)
+	ok, err := manager.CheckConnection(context.Background())
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, errKVClosed)
+	assert.ErrorIs(t, manager.Compact(), errKVClosed)
+	assert.NoError(t, manager.Close())
+}
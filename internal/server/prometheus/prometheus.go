@@ -0,0 +1,233 @@
+// Package prometheus renders metrics in Prometheus text exposition format (version 0.0.4).
+// It provides metric and label names sanitization, label values escaping and grouping of samples in families.
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+// ContentType is the HTTP Content-Type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types supported by exposition.
+const (
+	GaugeType     = "gauge"
+	CounterType   = "counter"
+	HistogramType = "histogram"
+)
+
+// counterSuffix is conventional suffix of counter metric names.
+const counterSuffix = "_total"
+
+// Histogram series suffixes and bucket upper bound label name.
+const (
+	bucketSuffix = "_bucket"
+	sumSuffix    = "_sum"
+	countSuffix  = "_count"
+
+	bucketLabel = "le"
+)
+
+// Sample represents single value of metric family with optional labels.
+// Suffix is appended to the family name, it is used by series of histograms.
+type Sample struct {
+	Suffix string
+	Labels map[string]string
+	Value  float64
+}
+
+// Family represents metric samples sharing the same name and type.
+type Family struct {
+	Name    string
+	Type    string
+	Samples []Sample
+}
+
+// Registry collects samples and groups them in families by sanitized name.
+type Registry struct {
+	families map[string]*Family
+}
+
+// NewRegistry creates empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*Family)}
+}
+
+// Add registers sample of metric with the given name and type.
+// Name is sanitized, counters get conventional '_total' suffix.
+// Sample is skipped with error if the family with the same name but another type is already registered.
+func (r *Registry) Add(name string, metricType string, sample Sample) error {
+	familyName := SanitizeName(name)
+	if metricType == CounterType && !strings.HasSuffix(familyName, counterSuffix) {
+		familyName += counterSuffix
+	}
+
+	family, ok := r.families[familyName]
+	if !ok {
+		family = &Family{Name: familyName, Type: metricType}
+		r.families[familyName] = family
+	}
+
+	if family.Type != metricType {
+		return fmt.Errorf("metric '%s' of type '%s' conflicts with family '%s' of type '%s'", name, metricType, familyName, family.Type)
+	}
+
+	family.Samples = append(family.Samples, sample)
+	return nil
+}
+
+// AddHistogram registers histogram with the given name and labels as cumulative '_bucket' series
+// with 'le' label for every bound and '+Inf', followed by '_sum' and '_count' series.
+func (r *Registry) AddHistogram(name string, labels map[string]string, value *histogram.Histogram) error {
+	samples := make([]Sample, 0, len(value.Counts)+2)
+
+	var cumulative uint64
+	for i, count := range value.Counts {
+		cumulative += count
+
+		bound := math.Inf(1)
+		if i < len(value.Bounds) {
+			bound = value.Bounds[i]
+		}
+
+		bucketLabels := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			bucketLabels[k] = v
+		}
+		bucketLabels[bucketLabel] = formatValue(bound)
+
+		samples = append(samples, Sample{Suffix: bucketSuffix, Labels: bucketLabels, Value: float64(cumulative)})
+	}
+
+	samples = append(samples,
+		Sample{Suffix: sumSuffix, Labels: labels, Value: value.Sum},
+		Sample{Suffix: countSuffix, Labels: labels, Value: float64(value.Count)},
+	)
+
+	for _, sample := range samples {
+		if err := r.Add(name, HistogramType, sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Families returns registered families sorted by name. Samples of each family are sorted by labels.
+// Series of the same histogram keep their registration order.
+func (r *Registry) Families() []Family {
+	res := make([]Family, 0, len(r.families))
+	for _, family := range r.families {
+		samples := family.Samples
+		sort.SliceStable(samples, func(i, j int) bool {
+			return seriesLabels(samples[i], family.Type) < seriesLabels(samples[j], family.Type)
+		})
+		res = append(res, *family)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Write renders families in text exposition format.
+func Write(w io.Writer, families []Family) error {
+	writer := bufio.NewWriter(w)
+	for _, family := range families {
+		if _, err := fmt.Fprintf(writer, "# TYPE %s %s\n", family.Name, family.Type); err != nil {
+			return fmt.Errorf("write family '%s' type: %w", family.Name, err)
+		}
+
+		for _, sample := range family.Samples {
+			if _, err := fmt.Fprintf(writer, "%s%s%s %s\n", family.Name, sample.Suffix, formatLabels(sample.Labels), formatValue(sample.Value)); err != nil {
+				return fmt.Errorf("write family '%s' sample: %w", family.Name, err)
+			}
+		}
+	}
+
+	return writer.Flush()
+}
+
+// SanitizeName converts name into valid Prometheus metric name matching [a-zA-Z_:][a-zA-Z0-9_:]*.
+// Invalid characters are replaced by underscores.
+func SanitizeName(name string) string {
+	return networkmsg.SanitizeName(name)
+}
+
+// SanitizeLabelName converts name into valid Prometheus label name matching [a-zA-Z_][a-zA-Z0-9_]*.
+// Invalid characters are replaced by underscores.
+func SanitizeLabelName(name string) string {
+	return networkmsg.SanitizeLabelName(name)
+}
+
+// seriesLabels returns rendered labels identifying series of the sample.
+// Bucket bound label is ignored for histograms to keep all series of the same histogram together.
+func seriesLabels(sample Sample, familyType string) string {
+	if familyType != HistogramType {
+		return formatLabels(sample.Labels)
+	}
+
+	labels := make(map[string]string, len(sample.Labels))
+	for k, v := range sample.Labels {
+		if k != bucketLabel {
+			labels[k] = v
+		}
+	}
+	return formatLabels(labels)
+}
+
+// formatLabels renders labels sorted by name in curly braces. Returns empty string for no labels.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(SanitizeLabelName(name))
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(labels[name]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
+
+// escapeLabelValue escapes backslashes, double quotes and line feeds in label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatValue renders sample value including special values.
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
@@ -0,0 +1,135 @@
+package prometheus
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/erupshis/metrics/internal/histogram"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"valid name", "HeapAlloc", "HeapAlloc"},
+		{"valid with colon", "job:HeapAlloc", "job:HeapAlloc"},
+		{"invalid characters", "heap.alloc-bytes", "heap_alloc_bytes"},
+		{"leading digit", "1metric", "_1metric"},
+		{"non-ascii characters", "метрика", "_______"},
+		{"empty", "", "_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeName(tt.arg))
+		})
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"valid name", "host", "host"},
+		{"colon is not allowed", "agent:id", "agent_id"},
+		{"leading digit", "0host", "_0host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SanitizeLabelName(tt.arg))
+		})
+	}
+}
+
+func TestRegistry_Add(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Add("Alloc", GaugeType, Sample{Value: 1}))
+	require.NoError(t, r.Add("PollCount", CounterType, Sample{Value: 2}))
+	require.NoError(t, r.Add("requests_total", CounterType, Sample{Value: 3}))
+	require.NoError(t, r.Add("Alloc", GaugeType, Sample{Labels: map[string]string{"host": "a"}, Value: 4}))
+	require.Error(t, r.Add("PollCount_total", GaugeType, Sample{Value: 5}), "type conflict with counter family")
+
+	want := []Family{
+		{Name: "Alloc", Type: GaugeType, Samples: []Sample{{Value: 1}, {Labels: map[string]string{"host": "a"}, Value: 4}}},
+		{Name: "PollCount_total", Type: CounterType, Samples: []Sample{{Value: 2}}},
+		{Name: "requests_total", Type: CounterType, Samples: []Sample{{Value: 3}}},
+	}
+	assert.Equal(t, want, r.Families())
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		families []Family
+		want     string
+	}{
+		{
+			name:     "empty",
+			families: nil,
+			want:     "",
+		},
+		{
+			name: "gauge and counter",
+			families: []Family{
+				{Name: "Alloc", Type: GaugeType, Samples: []Sample{{Value: 123.5}}},
+				{Name: "PollCount_total", Type: CounterType, Samples: []Sample{{Value: 1234567890}}},
+			},
+			want: "# TYPE Alloc gauge\nAlloc 123.5\n# TYPE PollCount_total counter\nPollCount_total 1234567890\n",
+		},
+		{
+			name: "labels sorted and escaped",
+			families: []Family{
+				{Name: "Alloc", Type: GaugeType, Samples: []Sample{
+					{Labels: map[string]string{"zone": "a\"b", "host": "c:\\d\n"}, Value: 1},
+				}},
+			},
+			want: "# TYPE Alloc gauge\nAlloc{host=\"c:\\\\d\\n\",zone=\"a\\\"b\"} 1\n",
+		},
+		{
+			name: "special values",
+			families: []Family{
+				{Name: "g", Type: GaugeType, Samples: []Sample{{Value: math.NaN()}, {Value: math.Inf(1)}, {Value: math.Inf(-1)}}},
+			},
+			want: "# TYPE g gauge\ng NaN\ng +Inf\ng -Inf\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Write(&buf, tt.families))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestRegistry_AddHistogram(t *testing.T) {
+	r := NewRegistry()
+	value := &histogram.Histogram{Bounds: []float64{0.5, 1}, Counts: []uint64{1, 2, 1}, Count: 4, Sum: 3.5}
+
+	require.NoError(t, r.AddHistogram("gc.pause", map[string]string{"host": "b"}, value))
+	require.NoError(t, r.AddHistogram("gc.pause", map[string]string{"host": "a"}, value))
+	require.NoError(t, r.Add("Alloc", GaugeType, Sample{Value: 1}))
+	require.Error(t, r.AddHistogram("Alloc", nil, value))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, r.Families()))
+	assert.Equal(t, "# TYPE Alloc gauge\n"+
+		"Alloc 1\n"+
+		"# TYPE gc_pause histogram\n"+
+		"gc_pause_bucket{host=\"a\",le=\"0.5\"} 1\n"+
+		"gc_pause_bucket{host=\"a\",le=\"1\"} 3\n"+
+		"gc_pause_bucket{host=\"a\",le=\"+Inf\"} 4\n"+
+		"gc_pause_sum{host=\"a\"} 3.5\n"+
+		"gc_pause_count{host=\"a\"} 4\n"+
+		"gc_pause_bucket{host=\"b\",le=\"0.5\"} 1\n"+
+		"gc_pause_bucket{host=\"b\",le=\"1\"} 3\n"+
+		"gc_pause_bucket{host=\"b\",le=\"+Inf\"} 4\n"+
+		"gc_pause_sum{host=\"b\"} 3.5\n"+
+		"gc_pause_count{host=\"b\"} 4\n", buf.String())
+}
@@ -0,0 +1,364 @@
+// Package query evaluates aggregation queries over metric series.
+// A query selects series by metric name pattern and label filters, reduces samples of every series
+// over time windows and optionally aggregates the reduced values across series grouped by labels.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+)
+
+// Aggregation functions supported both over time and across series.
+// Percentiles are written as 'p' followed by the percentile in range [0, 100], e.g. 'p95' or 'p99.9'.
+const (
+	Sum   = "sum"
+	Avg   = "avg"
+	Min   = "min"
+	Max   = "max"
+	Count = "count"
+)
+
+// Aggregation functions supported over time only.
+const (
+	First = "first"
+	Last  = "last"
+	Rate  = "rate"
+)
+
+// percentilePrefix starts the name of percentile aggregation function.
+const percentilePrefix = "p"
+
+// ErrInvalid is returned if the query is malformed.
+var ErrInvalid = errors.New("invalid query")
+
+// Query describes selection and aggregation of series.
+// Name and label values are shell patterns as accepted by path.Match. Missing label is matched as empty value.
+// Zero From or To means the range is not limited from the corresponding side.
+// Query without Window and OverTime is instant: current values of series are returned.
+// Otherwise samples in range are reduced by OverTime (last by default) in windows of Window width,
+// or in the single window over the whole range if Window is zero.
+// Aggregation reduces values of selected series registered at the same moment, series are grouped by labels listed in By.
+type Query struct {
+	Name        string
+	Labels      map[string]string
+	From        time.Time
+	To          time.Time
+	Window      time.Duration
+	OverTime    string
+	Aggregation string
+	By          []string
+}
+
+// Input represents selected series with its current value and samples registered in query range.
+type Input struct {
+	Key     string
+	Value   float64
+	Samples []history.Sample
+}
+
+// Point represents a value of resulting series at the moment.
+type Point struct {
+	Timestamp time.Time `json:"ts"`
+	Value     float64   `json:"value"`
+}
+
+// Series represents resulting series of the query.
+type Series struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []Point           `json:"points"`
+}
+
+// Validate checks patterns, range and aggregation functions of the query.
+func (q *Query) Validate() error {
+	if q.Name == "" {
+		return fmt.Errorf("%w: empty name pattern", ErrInvalid)
+	}
+	if _, err := path.Match(q.Name, ""); err != nil {
+		return fmt.Errorf("%w: name pattern '%s': %v", ErrInvalid, q.Name, err)
+	}
+	for label, pattern := range q.Labels {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: label '%s' pattern '%s': %v", ErrInvalid, label, pattern, err)
+		}
+	}
+
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return fmt.Errorf("%w: range end is before its start", ErrInvalid)
+	}
+	if q.Window < 0 {
+		return fmt.Errorf("%w: negative window", ErrInvalid)
+	}
+
+	if q.OverTime != "" && !isOverTimeFunc(q.OverTime) {
+		return fmt.Errorf("%w: unknown over time aggregation '%s'", ErrInvalid, q.OverTime)
+	}
+	if q.Aggregation != "" && !isAcrossSeriesFunc(q.Aggregation) {
+		return fmt.Errorf("%w: unknown aggregation '%s'", ErrInvalid, q.Aggregation)
+	}
+	if q.Aggregation == "" && len(q.By) != 0 {
+		return fmt.Errorf("%w: grouping labels without aggregation", ErrInvalid)
+	}
+	return nil
+}
+
+// IsRange checks if the query reduces samples in range instead of current values.
+func (q *Query) IsRange() bool {
+	return q.Window > 0 || q.OverTime != ""
+}
+
+// Match checks if series with the given key is selected by the query. Malformed keys are not selected.
+func (q *Query) Match(key string) bool {
+	name, labels, err := networkmsg.ParseSeriesKey(key)
+	if err != nil {
+		return false
+	}
+
+	if ok, _ := path.Match(q.Name, name); !ok {
+		return false
+	}
+	for label, pattern := range q.Labels {
+		if ok, _ := path.Match(pattern, labels[label]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Execute evaluates the query over selected series. Moment now is used as timestamp of instant query values
+// and as the end of the range not limited from the right side.
+// Series without values in range are omitted. Resulting series are sorted by name and labels.
+func Execute(q Query, inputs []Input, now time.Time) ([]Series, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	series := make([]Series, 0, len(inputs))
+	for _, input := range inputs {
+		name, labels, err := networkmsg.ParseSeriesKey(input.Key)
+		if err != nil {
+			return nil, fmt.Errorf("parse series key: %w", err)
+		}
+
+		points, err := q.reduceOverTime(input, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(points) == 0 {
+			continue
+		}
+
+		series = append(series, Series{Name: name, Labels: labels, Points: points})
+	}
+
+	if q.Aggregation != "" {
+		var err error
+		if series, err = q.aggregateAcrossSeries(series); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return networkmsg.SeriesKey(series[i].Name, series[i].Labels) < networkmsg.SeriesKey(series[j].Name, series[j].Labels)
+	})
+	return series, nil
+}
+
+// reduceOverTime converts series input into points. Samples are reduced in windows aligned to the window width.
+func (q *Query) reduceOverTime(input Input, now time.Time) ([]Point, error) {
+	if !q.IsRange() {
+		return []Point{{Timestamp: now, Value: input.Value}}, nil
+	}
+
+	overTime := q.OverTime
+	if overTime == "" {
+		overTime = Last
+	}
+
+	end := q.To
+	if end.IsZero() {
+		end = now
+	}
+
+	var points []Point
+	for start := 0; start < len(input.Samples); {
+		ts := end
+		if q.Window > 0 {
+			ts = input.Samples[start].Timestamp.Truncate(q.Window)
+		}
+
+		finish := start + 1
+		for finish < len(input.Samples) && (q.Window == 0 || input.Samples[finish].Timestamp.Truncate(q.Window).Equal(ts)) {
+			finish++
+		}
+
+		value, err := reduceSamples(overTime, input.Samples[start:finish])
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, Point{Timestamp: ts, Value: value})
+		start = finish
+	}
+	return points, nil
+}
+
+// aggregateAcrossSeries reduces values of series in every group registered at the same moment.
+func (q *Query) aggregateAcrossSeries(series []Series) ([]Series, error) {
+	type group struct {
+		labels map[string]string
+		values map[time.Time][]float64
+	}
+
+	groups := make(map[string]*group)
+	for _, s := range series {
+		var labels map[string]string
+		for _, label := range q.By {
+			if value, ok := s.Labels[label]; ok {
+				if labels == nil {
+					labels = make(map[string]string, len(q.By))
+				}
+				labels[label] = value
+			}
+		}
+
+		key := networkmsg.SeriesKey("", labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{labels: labels, values: make(map[time.Time][]float64)}
+			groups[key] = g
+		}
+
+		for _, point := range s.Points {
+			g.values[point.Timestamp] = append(g.values[point.Timestamp], point.Value)
+		}
+	}
+
+	name := fmt.Sprintf("%s(%s)", q.Aggregation, q.Name)
+	result := make([]Series, 0, len(groups))
+	for _, g := range groups {
+		points := make([]Point, 0, len(g.values))
+		for ts, values := range g.values {
+			value, err := reduce(q.Aggregation, values)
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, Point{Timestamp: ts, Value: value})
+		}
+
+		sort.Slice(points, func(i, j int) bool {
+			return points[i].Timestamp.Before(points[j].Timestamp)
+		})
+		result = append(result, Series{Name: name, Labels: g.labels, Points: points})
+	}
+	return result, nil
+}
+
+// reduceSamples reduces chronologically ordered samples with function supported over time.
+func reduceSamples(function string, samples []history.Sample) (float64, error) {
+	switch function {
+	case First:
+		return samples[0].Value, nil
+	case Last:
+		return samples[len(samples)-1].Value, nil
+	case Rate:
+		return history.Rate(samples), nil
+	}
+
+	values := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		values = append(values, sample.Value)
+	}
+	return reduce(function, values)
+}
+
+// reduce reduces non-empty values with function supported across series.
+func reduce(function string, values []float64) (float64, error) {
+	switch function {
+	case Sum:
+		return sum(values), nil
+	case Avg:
+		return sum(values) / float64(len(values)), nil
+	case Min:
+		res := values[0]
+		for _, value := range values[1:] {
+			res = math.Min(res, value)
+		}
+		return res, nil
+	case Max:
+		res := values[0]
+		for _, value := range values[1:] {
+			res = math.Max(res, value)
+		}
+		return res, nil
+	case Count:
+		return float64(len(values)), nil
+	}
+
+	p, err := parsePercentile(function)
+	if err != nil {
+		return 0, err
+	}
+	return percentile(values, p), nil
+}
+
+// isOverTimeFunc checks if function can reduce samples of series over time.
+func isOverTimeFunc(function string) bool {
+	switch function {
+	case First, Last, Rate:
+		return true
+	}
+	return isAcrossSeriesFunc(function)
+}
+
+// isAcrossSeriesFunc checks if function can reduce values of different series.
+func isAcrossSeriesFunc(function string) bool {
+	switch function {
+	case Sum, Avg, Min, Max, Count:
+		return true
+	}
+	_, err := parsePercentile(function)
+	return err == nil
+}
+
+// parsePercentile parses percentile from function name like 'p95'.
+func parsePercentile(function string) (float64, error) {
+	if !strings.HasPrefix(function, percentilePrefix) {
+		return 0, fmt.Errorf("%w: unknown function '%s'", ErrInvalid, function)
+	}
+
+	p, err := strconv.ParseFloat(strings.TrimPrefix(function, percentilePrefix), 64)
+	if err != nil || math.IsNaN(p) || p < 0 || p > 100 {
+		return 0, fmt.Errorf("%w: incorrect percentile '%s'", ErrInvalid, function)
+	}
+	return p, nil
+}
+
+// percentile returns p-th percentile of non-empty values using linear interpolation between closest ranks.
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
+
+// sum returns sum of values.
+func sum(values []float64) float64 {
+	var res float64
+	for _, value := range values {
+		res += value
+	}
+	return res
+}
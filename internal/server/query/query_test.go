@@ -0,0 +1,297 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/erupshis/metrics/internal/server/memstorage/history"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuery_Validate(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		q       Query
+		wantErr bool
+	}{
+		{
+			name: "valid instant",
+			q:    Query{Name: "Alloc*"},
+		},
+		{
+			name: "valid range with aggregations",
+			q:    Query{Name: "Alloc", From: start, To: start.Add(time.Hour), Window: time.Minute, OverTime: "p99.9", Aggregation: Avg, By: []string{"host"}},
+		},
+		{
+			name:    "invalid empty name",
+			q:       Query{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid name pattern",
+			q:       Query{Name: "Alloc["},
+			wantErr: true,
+		},
+		{
+			name:    "invalid label pattern",
+			q:       Query{Name: "Alloc", Labels: map[string]string{"host": "[a"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid range",
+			q:       Query{Name: "Alloc", From: start, To: start.Add(-time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid negative window",
+			q:       Query{Name: "Alloc", Window: -time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "invalid over time function",
+			q:       Query{Name: "Alloc", OverTime: "median"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid across series function",
+			q:       Query{Name: "Alloc", Aggregation: Rate},
+			wantErr: true,
+		},
+		{
+			name:    "invalid percentile",
+			q:       Query{Name: "Alloc", Aggregation: "p101"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid grouping without aggregation",
+			q:       Query{Name: "Alloc", By: []string{"host"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.q.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestQuery_Match(t *testing.T) {
+	tests := []struct {
+		name string
+		q    Query
+		key  string
+		want bool
+	}{
+		{
+			name: "name pattern",
+			q:    Query{Name: "Heap*"},
+			key:  `HeapAlloc{host="a"}`,
+			want: true,
+		},
+		{
+			name: "name mismatch",
+			q:    Query{Name: "Heap*"},
+			key:  "Alloc",
+			want: false,
+		},
+		{
+			name: "label pattern",
+			q:    Query{Name: "Alloc", Labels: map[string]string{"host": "web-?"}},
+			key:  `Alloc{dc="eu",host="web-1"}`,
+			want: true,
+		},
+		{
+			name: "label mismatch",
+			q:    Query{Name: "Alloc", Labels: map[string]string{"host": "web-?"}},
+			key:  `Alloc{host="db-1"}`,
+			want: false,
+		},
+		{
+			name: "missing label matched as empty",
+			q:    Query{Name: "Alloc", Labels: map[string]string{"host": ""}},
+			key:  "Alloc",
+			want: true,
+		},
+		{
+			name: "malformed key",
+			q:    Query{Name: "*"},
+			key:  `Alloc{host}`,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.q.Match(tt.key))
+		})
+	}
+}
+
+func TestExecute(t *testing.T) {
+	start := time.Date(2023, 12, 1, 10, 0, 0, 0, time.UTC)
+	now := start.Add(time.Hour)
+
+	inputs := []Input{
+		{
+			Key:   `Alloc{host="b"}`,
+			Value: 6,
+			Samples: []history.Sample{
+				{Timestamp: start, Value: 2},
+				{Timestamp: start.Add(30 * time.Second), Value: 4},
+				{Timestamp: start.Add(70 * time.Second), Value: 6},
+			},
+		},
+		{
+			Key:   `Alloc{host="a"}`,
+			Value: 3,
+			Samples: []history.Sample{
+				{Timestamp: start.Add(10 * time.Second), Value: 1},
+				{Timestamp: start.Add(80 * time.Second), Value: 3},
+			},
+		},
+		{
+			Key:     `Alloc{host="c"}`,
+			Value:   1,
+			Samples: []history.Sample{},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		q       Query
+		want    []Series
+		wantErr bool
+	}{
+		{
+			name: "instant values",
+			q:    Query{Name: "Alloc"},
+			want: []Series{
+				{Name: "Alloc", Labels: map[string]string{"host": "a"}, Points: []Point{{now, 3}}},
+				{Name: "Alloc", Labels: map[string]string{"host": "b"}, Points: []Point{{now, 6}}},
+				{Name: "Alloc", Labels: map[string]string{"host": "c"}, Points: []Point{{now, 1}}},
+			},
+		},
+		{
+			name: "instant aggregation",
+			q:    Query{Name: "Alloc", Aggregation: Max},
+			want: []Series{
+				{Name: "max(Alloc)", Points: []Point{{now, 6}}},
+			},
+		},
+		{
+			name: "over whole range",
+			q:    Query{Name: "Alloc", OverTime: Avg},
+			want: []Series{
+				{Name: "Alloc", Labels: map[string]string{"host": "a"}, Points: []Point{{now, 2}}},
+				{Name: "Alloc", Labels: map[string]string{"host": "b"}, Points: []Point{{now, 4}}},
+			},
+		},
+		{
+			name: "over whole range ends at range end",
+			q:    Query{Name: "Alloc", To: start.Add(2 * time.Minute), OverTime: Rate},
+			want: []Series{
+				{Name: "Alloc", Labels: map[string]string{"host": "a"}, Points: []Point{{start.Add(2 * time.Minute), 2.0 / 70}}},
+				{Name: "Alloc", Labels: map[string]string{"host": "b"}, Points: []Point{{start.Add(2 * time.Minute), 4.0 / 70}}},
+			},
+		},
+		{
+			name: "over windows with default last",
+			q:    Query{Name: "Alloc", Window: time.Minute},
+			want: []Series{
+				{Name: "Alloc", Labels: map[string]string{"host": "a"}, Points: []Point{{start, 1}, {start.Add(time.Minute), 3}}},
+				{Name: "Alloc", Labels: map[string]string{"host": "b"}, Points: []Point{{start, 4}, {start.Add(time.Minute), 6}}},
+			},
+		},
+		{
+			name: "over windows across series",
+			q:    Query{Name: "Alloc", Window: time.Minute, OverTime: Sum, Aggregation: Sum},
+			want: []Series{
+				{Name: "sum(Alloc)", Points: []Point{{start, 7}, {start.Add(time.Minute), 9}}},
+			},
+		},
+		{
+			name: "percentile across series grouped by labels",
+			q:    Query{Name: "Alloc", Window: time.Minute, OverTime: First, Aggregation: "p50", By: []string{"host"}},
+			want: []Series{
+				{Name: "p50(Alloc)", Labels: map[string]string{"host": "a"}, Points: []Point{{start, 1}, {start.Add(time.Minute), 3}}},
+				{Name: "p50(Alloc)", Labels: map[string]string{"host": "b"}, Points: []Point{{start, 2}, {start.Add(time.Minute), 6}}},
+			},
+		},
+		{
+			name: "count across series",
+			q:    Query{Name: "Alloc", OverTime: Max, Aggregation: Count, By: []string{"missing"}},
+			want: []Series{
+				{Name: "count(Alloc)", Points: []Point{{now, 2}}},
+			},
+		},
+		{
+			name:    "invalid query",
+			q:       Query{Name: "Alloc", OverTime: "median"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Execute(tt.q, inputs, now)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalid)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{
+			name:   "single value",
+			values: []float64{5},
+			p:      99,
+			want:   5,
+		},
+		{
+			name:   "median of even count",
+			values: []float64{4, 1, 3, 2},
+			p:      50,
+			want:   2.5,
+		},
+		{
+			name:   "minimum",
+			values: []float64{4, 1, 3, 2},
+			p:      0,
+			want:   1,
+		},
+		{
+			name:   "maximum",
+			values: []float64{4, 1, 3, 2},
+			p:      100,
+			want:   4,
+		},
+		{
+			name:   "interpolated",
+			values: []float64{10, 20, 30, 40, 50},
+			p:      90,
+			want:   46,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, percentile(tt.values, tt.p), 1e-9)
+		})
+	}
+}
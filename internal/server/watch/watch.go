@@ -0,0 +1,150 @@
+// Package watch broadcasts metrics updates accepted by server to subscribers.
+// Every subscriber receives updates selected by its filter through the buffered channel.
+// Publishing never blocks: updates are dropped for subscribers which don't keep up.
+package watch
+
+import (
+	"path"
+	"sync"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+)
+
+// DefaultBufferSize is a count of updates buffered for every subscriber by default.
+const DefaultBufferSize = 256
+
+// Filter selects updates delivered to subscriber.
+// Types lists metric types, Names lists shell patterns of metric names as accepted by path.Match.
+// Empty list doesn't limit corresponding property.
+type Filter struct {
+	Types []string
+	Names []string
+}
+
+// Match checks if metric is selected by filter. Malformed name patterns match nothing.
+func (f Filter) Match(metric *networkmsg.Metric) bool {
+	if len(f.Types) != 0 && !contains(f.Types, metric.MType) {
+		return false
+	}
+
+	if len(f.Names) == 0 {
+		return true
+	}
+	for _, pattern := range f.Names {
+		if ok, _ := path.Match(pattern, metric.ID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks name patterns of filter.
+func (f Filter) Validate() error {
+	for _, pattern := range f.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Subscription receives updates selected by its filter until it is closed.
+type Subscription struct {
+	updates chan networkmsg.Metric
+	filter  Filter
+	hub     *Hub
+
+	dropped uint64
+}
+
+// Updates returns channel of updates. Channel is closed when subscription is closed.
+func (s *Subscription) Updates() <-chan networkmsg.Metric {
+	return s.updates
+}
+
+// Dropped returns count of updates dropped because subscriber didn't keep up.
+func (s *Subscription) Dropped() uint64 {
+	s.hub.mu.RLock()
+	defer s.hub.mu.RUnlock()
+	return s.dropped
+}
+
+// Close unsubscribes from updates. It is safe to call Close several times.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subscriptions[s]; !ok {
+		return
+	}
+	delete(s.hub.subscriptions, s)
+	close(s.updates)
+}
+
+// Hub broadcasts published updates to subscriptions. Safe for concurrent use.
+type Hub struct {
+	subscriptions map[*Subscription]struct{}
+	bufferSize    int
+	mu            sync.RWMutex
+}
+
+// Create initializes and returns a new instance of Hub buffering bufferSize updates for every subscription.
+func Create(bufferSize int) *Hub {
+	if bufferSize < 1 {
+		bufferSize = DefaultBufferSize
+	}
+
+	return &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+		bufferSize:    bufferSize,
+	}
+}
+
+// Subscribe creates subscription on updates selected by filter.
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	s := &Subscription{
+		updates: make(chan networkmsg.Metric, h.bufferSize),
+		filter:  filter,
+		hub:     h,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Publish sends update to subscriptions with matching filter. Subscribers must not modify received updates.
+func (h *Hub) Publish(metric networkmsg.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscriptions {
+		if !s.filter.Match(&metric) {
+			continue
+		}
+
+		select {
+		case s.updates <- metric:
+		default:
+			s.dropped++
+		}
+	}
+}
+
+// HasSubscriptions checks if anybody is subscribed on updates.
+func (h *Hub) HasSubscriptions() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subscriptions) != 0
+}
+
+// contains checks if values contain value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/erupshis/metrics/internal/networkmsg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Match(t *testing.T) {
+	gauge := networkmsg.CreateGaugeMetrics("HeapAlloc", 1)
+	counter := networkmsg.CreateCounterMetrics("PollCount", 1)
+
+	tests := []struct {
+		name   string
+		filter Filter
+		metric networkmsg.Metric
+		want   bool
+	}{
+		{
+			name:   "empty filter",
+			filter: Filter{},
+			metric: gauge,
+			want:   true,
+		},
+		{
+			name:   "type matched",
+			filter: Filter{Types: []string{"counter", "gauge"}},
+			metric: gauge,
+			want:   true,
+		},
+		{
+			name:   "type mismatched",
+			filter: Filter{Types: []string{"gauge"}},
+			metric: counter,
+			want:   false,
+		},
+		{
+			name:   "name pattern matched",
+			filter: Filter{Names: []string{"Alloc", "Heap*"}},
+			metric: gauge,
+			want:   true,
+		},
+		{
+			name:   "name pattern mismatched",
+			filter: Filter{Types: []string{"counter"}, Names: []string{"Heap*"}},
+			metric: counter,
+			want:   false,
+		},
+		{
+			name:   "malformed name pattern",
+			filter: Filter{Names: []string{"Heap["}},
+			metric: gauge,
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(&tt.metric))
+		})
+	}
+}
+
+func TestFilter_Validate(t *testing.T) {
+	assert.NoError(t, Filter{Names: []string{"Heap*", "?oll[A-Z]ount"}}.Validate())
+	assert.Error(t, Filter{Names: []string{"Heap["}}.Validate())
+}
+
+func TestHub_Publish(t *testing.T) {
+	hub := Create(2)
+	assert.False(t, hub.HasSubscriptions())
+
+	gauges := hub.Subscribe(Filter{Types: []string{"gauge"}})
+	all := hub.Subscribe(Filter{})
+	assert.True(t, hub.HasSubscriptions())
+
+	gauge := networkmsg.CreateGaugeMetrics("HeapAlloc", 1)
+	counter := networkmsg.CreateCounterMetrics("PollCount", 1)
+	hub.Publish(gauge)
+	hub.Publish(counter)
+
+	require.Len(t, gauges.Updates(), 1)
+	assert.Equal(t, gauge, <-gauges.Updates())
+	require.Len(t, all.Updates(), 2)
+	assert.Equal(t, gauge, <-all.Updates())
+	assert.Equal(t, counter, <-all.Updates())
+
+	// updates are dropped for subscriber which doesn't keep up.
+	for i := 0; i < 3; i++ {
+		hub.Publish(gauge)
+	}
+	assert.Len(t, gauges.Updates(), 2)
+	assert.Equal(t, uint64(1), gauges.Dropped())
+
+	gauges.Close()
+	gauges.Close()
+	for range gauges.Updates() {
+	}
+	hub.Publish(gauge)
+
+	all.Close()
+	assert.False(t, hub.HasSubscriptions())
+}
@@ -0,0 +1,311 @@
+"use strict";
+
+(function () {
+  const historyRange = 60 * 60; // seconds of history shown in sparkline.
+
+  const state = {
+    metrics: [],
+    agents: new Map(), // series key with type -> agent ids.
+    sortKey: "name",
+    sortAsc: true,
+    selected: null,
+    timer: null,
+  };
+
+  const $ = (id) => document.getElementById(id);
+
+  function seriesID(type, key) {
+    return type + "/" + key;
+  }
+
+  async function getJSON(url) {
+    const response = await fetch(url, {cache: "no-store"});
+    if (!response.ok) {
+      throw new Error(url + ": " + response.status + " " + response.statusText);
+    }
+    return response.json();
+  }
+
+  async function refresh() {
+    try {
+      const [metrics, agents] = await Promise.all([getJSON("/ui/api/values"), getJSON("/agents")]);
+      state.metrics = metrics || [];
+      state.agents = indexAgents(agents || []);
+      setStatus("Updated " + new Date().toLocaleTimeString(), false);
+      render();
+      if (state.selected) {
+        await showDetail(state.selected);
+      }
+    } catch (err) {
+      setStatus(err.message, true);
+    }
+  }
+
+  function indexAgents(agents) {
+    const index = new Map();
+    const add = (type, key, id) => {
+      const sid = seriesID(type, key);
+      if (!index.has(sid)) {
+        index.set(sid, []);
+      }
+      index.get(sid).push(id);
+    };
+    for (const agent of agents) {
+      (agent.gauges || []).forEach((key) => add("gauge", key, agent.id));
+      (agent.counters || []).forEach((key) => add("counter", key, agent.id));
+    }
+    return index;
+  }
+
+  function agentOf(metric) {
+    const ids = state.agents.get(seriesID(metric.type, metric.key));
+    return ids ? ids.join(", ") : "";
+  }
+
+  function labelsText(labels) {
+    return Object.keys(labels || {}).sort().map((name) => name + "=" + labels[name]).join(",");
+  }
+
+  function valueOf(metric) {
+    return metric.type === "histogram" ? metric.histogram.count : metric.value;
+  }
+
+  function formatValue(metric) {
+    if (metric.type === "histogram") {
+      return metric.histogram.count + " obs, sum " + formatNumber(metric.histogram.sum);
+    }
+    return formatNumber(metric.value);
+  }
+
+  function formatNumber(value) {
+    if (Number.isInteger(value)) {
+      return String(value);
+    }
+    return Number(value).toPrecision(6).replace(/\.?0+$/, "");
+  }
+
+  function setStatus(text, isError) {
+    const status = $("status");
+    status.textContent = text;
+    status.classList.toggle("error", isError);
+  }
+
+  function visibleMetrics() {
+    const filter = $("filter").value.trim().toLowerCase();
+    const type = $("type").value;
+
+    const rows = state.metrics
+      .filter((m) => !type || m.type === type)
+      .map((m) => ({metric: m, labels: labelsText(m.labels), agent: agentOf(m)}))
+      .filter((row) => !filter ||
+        row.metric.name.toLowerCase().includes(filter) ||
+        row.labels.toLowerCase().includes(filter) ||
+        row.agent.toLowerCase().includes(filter));
+
+    const sortValue = (row) => {
+      switch (state.sortKey) {
+        case "labels":
+          return row.labels;
+        case "type":
+          return row.metric.type;
+        case "value":
+          return valueOf(row.metric);
+        case "agent":
+          return row.agent;
+        default:
+          return row.metric.name;
+      }
+    };
+    rows.sort((a, b) => {
+      const x = sortValue(a);
+      const y = sortValue(b);
+      const res = typeof x === "number" ? x - y : String(x).localeCompare(String(y));
+      return state.sortAsc ? res : -res;
+    });
+    return rows;
+  }
+
+  function render() {
+    const rows = visibleMetrics();
+    const group = $("group").value;
+    const body = $("rows");
+    body.replaceChildren();
+
+    let current = null;
+    for (const row of rows) {
+      if (group) {
+        const name = (group === "type" ? row.metric.type : row.agent) || "unknown";
+        if (name !== current) {
+          current = name;
+          body.appendChild(groupRow(name));
+        }
+      }
+      body.appendChild(metricRow(row));
+    }
+    $("empty").hidden = rows.length !== 0;
+
+    document.querySelectorAll("th[data-sort]").forEach((th) => {
+      th.classList.toggle("asc", th.dataset.sort === state.sortKey && state.sortAsc);
+      th.classList.toggle("desc", th.dataset.sort === state.sortKey && !state.sortAsc);
+    });
+  }
+
+  function groupRow(name) {
+    const tr = document.createElement("tr");
+    tr.className = "group";
+    const td = document.createElement("td");
+    td.colSpan = 5;
+    td.textContent = name;
+    tr.appendChild(td);
+    return tr;
+  }
+
+  function metricRow(row) {
+    const m = row.metric;
+    const tr = document.createElement("tr");
+    if (state.selected && state.selected.type === m.type && state.selected.key === m.key) {
+      tr.className = "selected";
+    }
+
+    tr.appendChild(cell(m.name));
+    const labels = cell("");
+    Object.keys(m.labels || {}).sort().forEach((name) => {
+      const span = document.createElement("span");
+      span.className = "label";
+      span.textContent = name + "=" + m.labels[name];
+      labels.appendChild(span);
+    });
+    tr.appendChild(labels);
+    tr.appendChild(cell(m.type));
+    tr.appendChild(cell(formatValue(m), "num"));
+    tr.appendChild(cell(row.agent));
+
+    tr.addEventListener("click", () => {
+      state.selected = m;
+      render();
+      showDetail(m);
+    });
+    return tr;
+  }
+
+  function cell(text, className) {
+    const td = document.createElement("td");
+    td.textContent = text;
+    if (className) {
+      td.className = className;
+    }
+    return td;
+  }
+
+  async function showDetail(selected) {
+    const metric = state.metrics.find((m) => m.type === selected.type && m.key === selected.key);
+    if (!metric) {
+      closeDetail();
+      return;
+    }
+
+    $("detail").hidden = false;
+    $("detail-name").textContent = metric.key;
+
+    const info = [["Type", metric.type], ["Agent", agentOf(metric) || "unknown"]];
+    if (metric.type === "histogram") {
+      const h = metric.histogram;
+      info.push(["Count", String(h.count)], ["Sum", formatNumber(h.sum)]);
+      h.counts.forEach((count, i) => {
+        info.push([i < h.bounds.length ? "≤ " + formatNumber(h.bounds[i]) : "+Inf", String(count)]);
+      });
+    } else {
+      info.push(["Value", formatNumber(metric.value)]);
+    }
+    const dl = $("detail-info");
+    dl.replaceChildren();
+    for (const [name, value] of info) {
+      const dt = document.createElement("dt");
+      dt.textContent = name;
+      const dd = document.createElement("dd");
+      dd.textContent = value;
+      dl.append(dt, dd);
+    }
+
+    if (metric.type === "histogram") {
+      drawSparkline([]);
+      $("detail-note").textContent = "History is not stored for histograms.";
+      return;
+    }
+
+    const from = Math.floor(Date.now() / 1000) - historyRange;
+    try {
+      const res = await getJSON("/history/" + metric.type + "/" + encodeURIComponent(metric.key) + "?from=" + from);
+      const samples = res.samples || [];
+      drawSparkline(samples.map((s) => s.value));
+      $("detail-note").textContent = samples.length + " samples over the last hour";
+    } catch (err) {
+      drawSparkline([]);
+      $("detail-note").textContent = "History is unavailable: " + err.message;
+    }
+  }
+
+  function drawSparkline(values) {
+    const svg = $("sparkline");
+    svg.replaceChildren();
+    if (values.length === 0) {
+      return;
+    }
+
+    const width = 300;
+    const height = 80;
+    const min = Math.min(...values);
+    const max = Math.max(...values);
+    const span = max - min || 1;
+    const step = values.length > 1 ? width / (values.length - 1) : 0;
+
+    const points = values.map((v, i) => {
+      const x = values.length > 1 ? i * step : width / 2;
+      const y = height - 4 - ((v - min) / span) * (height - 8);
+      return x.toFixed(1) + "," + y.toFixed(1);
+    });
+    if (points.length === 1) {
+      points.unshift("0," + points[0].split(",")[1]);
+      points.push(width + "," + points[1].split(",")[1]);
+    }
+
+    const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+    line.setAttribute("points", points.join(" "));
+    svg.appendChild(line);
+  }
+
+  function closeDetail() {
+    state.selected = null;
+    $("detail").hidden = true;
+    render();
+  }
+
+  function schedule() {
+    clearInterval(state.timer);
+    state.timer = null;
+    const seconds = Number($("refresh").value);
+    if (seconds > 0) {
+      state.timer = setInterval(refresh, seconds * 1000);
+    }
+  }
+
+  document.querySelectorAll("th[data-sort]").forEach((th) => {
+    th.addEventListener("click", () => {
+      if (state.sortKey === th.dataset.sort) {
+        state.sortAsc = !state.sortAsc;
+      } else {
+        state.sortKey = th.dataset.sort;
+        state.sortAsc = true;
+      }
+      render();
+    });
+  });
+  $("filter").addEventListener("input", render);
+  $("type").addEventListener("change", render);
+  $("group").addEventListener("change", render);
+  $("refresh").addEventListener("change", schedule);
+  $("close").addEventListener("click", closeDetail);
+
+  refresh();
+  schedule();
+})();
@@ -0,0 +1,33 @@
+// Package webui embeds single-page dashboard of the metrics server.
+// The page lists metrics with sorting, filtering and grouping by type or agent, shows details of the selected metric
+// with sparkline of its history and refreshes data periodically. Data is requested from the server's dashboard API.
+package webui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// static contains page, scripts and styles of dashboard.
+//
+//go:embed static
+var static embed.FS
+
+// Index returns content of dashboard page.
+func Index() []byte {
+	index, err := static.ReadFile("static/index.html")
+	if err != nil {
+		panic(err)
+	}
+	return index
+}
+
+// Handler returns handler serving dashboard scripts and styles by their file names.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(files))
+}
@@ -0,0 +1,44 @@
+package webui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndex(t *testing.T) {
+	assert.Contains(t, string(Index()), "<!DOCTYPE html>")
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		code int
+	}{
+		{
+			name: "script",
+			path: "/app.js",
+			code: http.StatusOK,
+		},
+		{
+			name: "styles",
+			path: "/style.css",
+			code: http.StatusOK,
+		},
+		{
+			name: "missing file",
+			path: "/missing.js",
+			code: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
@@ -8,6 +8,9 @@ import (
 	context "context"
 	reflect "reflect"
 
+	histogram "github.com/erupshis/metrics/internal/histogram"
+	history "github.com/erupshis/metrics/internal/server/memstorage/history"
+	storagemngr "github.com/erupshis/metrics/internal/server/memstorage/storagemngr"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -63,6 +66,35 @@ func (mr *MockStorageManagerMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorageManager)(nil).Close))
 }
 
+// DeleteMetricsFromStorage mocks base method.
+func (m *MockStorageManager) DeleteMetricsFromStorage(arg0 context.Context, arg1, arg2, arg3 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetricsFromStorage", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMetricsFromStorage indicates an expected call of DeleteMetricsFromStorage.
+func (mr *MockStorageManagerMockRecorder) DeleteMetricsFromStorage(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetricsFromStorage", reflect.TypeOf((*MockStorageManager)(nil).DeleteMetricsFromStorage), arg0, arg1, arg2, arg3)
+}
+
+// RestoreCounterTotalsFromStorage mocks base method.
+func (m *MockStorageManager) RestoreCounterTotalsFromStorage(arg0 context.Context) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreCounterTotalsFromStorage", arg0)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreCounterTotalsFromStorage indicates an expected call of RestoreCounterTotalsFromStorage.
+func (mr *MockStorageManagerMockRecorder) RestoreCounterTotalsFromStorage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCounterTotalsFromStorage", reflect.TypeOf((*MockStorageManager)(nil).RestoreCounterTotalsFromStorage), arg0)
+}
+
 // RestoreDataFromStorage mocks base method.
 func (m *MockStorageManager) RestoreDataFromStorage(arg0 context.Context) (map[string]float64, map[string]int64, error) {
 	m.ctrl.T.Helper()
@@ -79,16 +111,61 @@ func (mr *MockStorageManagerMockRecorder) RestoreDataFromStorage(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreDataFromStorage", reflect.TypeOf((*MockStorageManager)(nil).RestoreDataFromStorage), arg0)
 }
 
-// SaveMetricsInStorage mocks base method.
-func (m *MockStorageManager) SaveMetricsInStorage(arg0 context.Context, arg1, arg2 map[string]interface{}) error {
+// RestoreHistogramsFromStorage mocks base method.
+func (m *MockStorageManager) RestoreHistogramsFromStorage(arg0 context.Context) (map[string]*histogram.Histogram, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreHistogramsFromStorage", arg0)
+	ret0, _ := ret[0].(map[string]*histogram.Histogram)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreHistogramsFromStorage indicates an expected call of RestoreHistogramsFromStorage.
+func (mr *MockStorageManagerMockRecorder) RestoreHistogramsFromStorage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreHistogramsFromStorage", reflect.TypeOf((*MockStorageManager)(nil).RestoreHistogramsFromStorage), arg0)
+}
+
+// RestoreHistoryFromStorage mocks base method.
+func (m *MockStorageManager) RestoreHistoryFromStorage(arg0 context.Context) (map[string][]history.Sample, map[string][]history.Sample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreHistoryFromStorage", arg0)
+	ret0, _ := ret[0].(map[string][]history.Sample)
+	ret1, _ := ret[1].(map[string][]history.Sample)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RestoreHistoryFromStorage indicates an expected call of RestoreHistoryFromStorage.
+func (mr *MockStorageManagerMockRecorder) RestoreHistoryFromStorage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreHistoryFromStorage", reflect.TypeOf((*MockStorageManager)(nil).RestoreHistoryFromStorage), arg0)
+}
+
+// SaveDataDeltaInStorage mocks base method.
+func (m *MockStorageManager) SaveDataDeltaInStorage(arg0 context.Context, arg1 *storagemngr.Data) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveDataDeltaInStorage", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveDataDeltaInStorage indicates an expected call of SaveDataDeltaInStorage.
+func (mr *MockStorageManagerMockRecorder) SaveDataDeltaInStorage(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDataDeltaInStorage", reflect.TypeOf((*MockStorageManager)(nil).SaveDataDeltaInStorage), arg0, arg1)
+}
+
+// SaveDataInStorage mocks base method.
+func (m *MockStorageManager) SaveDataInStorage(arg0 context.Context, arg1 *storagemngr.Data) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveMetricsInStorage", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "SaveDataInStorage", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// SaveMetricsInStorage indicates an expected call of SaveMetricsInStorage.
-func (mr *MockStorageManagerMockRecorder) SaveMetricsInStorage(arg0, arg1, arg2 interface{}) *gomock.Call {
+// SaveDataInStorage indicates an expected call of SaveDataInStorage.
+func (mr *MockStorageManagerMockRecorder) SaveDataInStorage(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveMetricsInStorage", reflect.TypeOf((*MockStorageManager)(nil).SaveMetricsInStorage), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDataInStorage", reflect.TypeOf((*MockStorageManager)(nil).SaveDataInStorage), arg0, arg1)
 }
@@ -27,6 +27,10 @@ type MetricsClient interface {
 	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	Value(ctx context.Context, in *ValueRequest, opts ...grpc.CallOption) (*ValueResponse, error)
 	Values(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (Metrics_ValuesClient, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
+	Rate(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*RateResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Metrics_WatchClient, error)
 	CheckStorage(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*CheckStorageResponse, error)
 }
 
@@ -122,6 +126,65 @@ func (x *metricsValuesClient) Recv() (*ValuesResponse, error) {
 	return m, nil
 }
 
+func (c *metricsClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, "/proto_metrics.Metrics/History", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) Rate(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*RateResponse, error) {
+	out := new(RateResponse)
+	err := c.cc.Invoke(ctx, "/proto_metrics.Metrics/Rate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/proto_metrics.Metrics/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Metrics_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Metrics_ServiceDesc.Streams[2], "/proto_metrics.Metrics/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &metricsWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Metrics_WatchClient interface {
+	Recv() (*WatchResponse, error)
+	grpc.ClientStream
+}
+
+type metricsWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *metricsWatchClient) Recv() (*WatchResponse, error) {
+	m := new(WatchResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *metricsClient) CheckStorage(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*CheckStorageResponse, error) {
 	out := new(CheckStorageResponse)
 	err := c.cc.Invoke(ctx, "/proto_metrics.Metrics/CheckStorage", in, out, opts...)
@@ -139,6 +202,10 @@ type MetricsServer interface {
 	Update(context.Context, *UpdateRequest) (*emptypb.Empty, error)
 	Value(context.Context, *ValueRequest) (*ValueResponse, error)
 	Values(*emptypb.Empty, Metrics_ValuesServer) error
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
+	Rate(context.Context, *HistoryRequest) (*RateResponse, error)
+	Delete(context.Context, *DeleteRequest) (*emptypb.Empty, error)
+	Watch(*WatchRequest, Metrics_WatchServer) error
 	CheckStorage(context.Context, *emptypb.Empty) (*CheckStorageResponse, error)
 	mustEmbedUnimplementedMetricsServer()
 }
@@ -159,6 +226,18 @@ func (UnimplementedMetricsServer) Value(context.Context, *ValueRequest) (*ValueR
 func (UnimplementedMetricsServer) Values(*emptypb.Empty, Metrics_ValuesServer) error {
 	return status.Errorf(codes.Unimplemented, "method Values not implemented")
 }
+func (UnimplementedMetricsServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
+func (UnimplementedMetricsServer) Rate(context.Context, *HistoryRequest) (*RateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rate not implemented")
+}
+func (UnimplementedMetricsServer) Delete(context.Context, *DeleteRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedMetricsServer) Watch(*WatchRequest, Metrics_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedMetricsServer) CheckStorage(context.Context, *emptypb.Empty) (*CheckStorageResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CheckStorage not implemented")
 }
@@ -258,6 +337,81 @@ func (x *metricsValuesServer) Send(m *ValuesResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Metrics_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto_metrics.Metrics/History",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_Rate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).Rate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto_metrics.Metrics/Rate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).Rate(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto_metrics.Metrics/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServer).Watch(m, &metricsWatchServer{stream})
+}
+
+type Metrics_WatchServer interface {
+	Send(*WatchResponse) error
+	grpc.ServerStream
+}
+
+type metricsWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *metricsWatchServer) Send(m *WatchResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Metrics_CheckStorage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(emptypb.Empty)
 	if err := dec(in); err != nil {
@@ -291,6 +445,18 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Value",
 			Handler:    _Metrics_Value_Handler,
 		},
+		{
+			MethodName: "History",
+			Handler:    _Metrics_History_Handler,
+		},
+		{
+			MethodName: "Rate",
+			Handler:    _Metrics_Rate_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Metrics_Delete_Handler,
+		},
 		{
 			MethodName: "CheckStorage",
 			Handler:    _Metrics_CheckStorage_Handler,
@@ -307,6 +473,11 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Metrics_Values_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Metrics_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "metrics.proto",
 }